@@ -11,53 +11,212 @@ import (
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/runner"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 )
 
 func main() {
 	appContext := context.Background()
 
+	// Exit only after run has returned, so any deferred clean-up is done first
+	os.Exit(run(appContext, os.Args))
+}
+
+// run will run the command requested by the user, and return the exit code for the application
+func run(ctx context.Context, args []string) int {
+	if len(args) > 1 && args[1] == config.CommandCleanup {
+		return runCleanup(ctx, args[1:])
+	}
+
+	if len(args) > 1 && args[1] == config.CommandLock {
+		return runLock(ctx, args[1:])
+	}
+
+	if len(args) > 1 && args[1] == config.CommandInstanceLock {
+		return runInstanceLock(ctx, args[1:])
+	}
+
+	if len(args) > 1 && args[1] == config.CommandScriptTemplate {
+		return runScriptTemplate(args[1:])
+	}
+
+	return runUpdate(ctx, args)
+}
+
+// runUpdate will update the instances in a fleet
+func runUpdate(ctx context.Context, cliArgs []string) int {
 	/*
 	 * Parse command line arguments from the user
 	 */
-	args, err := config.ParseAndValidateCLIArgs(os.Args)
+	args, err := config.ParseAndValidateCLIArgs(cliArgs)
 	if err != nil {
-		if err == flag.ErrHelp {
-			return
-		}
-		fmt.Println("error passing arguments:")
-		fmt.Println(err.Error())
-		os.Exit(1)
+		return handleArgsError(err)
 	}
 
 	/*
-	 * Set up the application logger
+	 * Set up the application logger, and span exports
 	 */
-	appLogger, err := config.InitializeLogger(args.Verbose)
+	appLogger, closeRun, err := initializeRun(ctx, args.Verbose, args.Logging, args.Tracing)
 	if err != nil {
-		fmt.Println("error initializing the logger: ", err)
-		os.Exit(1)
+		return 1
 	}
-	defer appLogger.Close()
+	defer closeRun()
 
 	/*
 	 * Initialize the fleet updater
 	 */
-	updater, err := runner.NewFleetUpdater(appContext, appLogger, args)
+	updater, err := runner.NewFleetUpdater(ctx, appLogger, args)
 	if err != nil {
 		slog.Error("error building a fleet updater", "error", strings.Replace(err.Error(), "\n", ", ", -1))
-		os.Exit(1)
+		return 1
 	}
-	defer updater.Cleanup()
+	defer updater.Cleanup(ctx)
 
 	/*
 	 * Update the instances in the fleet
 	 */
-	_, err = updater.UpdateInstances(appContext)
+	_, err = updater.UpdateInstances(ctx)
 	if err != nil {
 		if err != runner.UpdateFailedError {
 			slog.Error("error updating instances", "error", err)
 		}
+		return 1
+	}
+
+	return 0
+}
+
+// runCleanup will remove any SSH access left behind on a fleet
+func runCleanup(ctx context.Context, cliArgs []string) int {
+	args, err := config.ParseAndValidateCleanupArgs(cliArgs)
+	if err != nil {
+		return handleArgsError(err)
+	}
 
-		os.Exit(1)
+	appLogger, closeRun, err := initializeRun(ctx, args.Verbose, args.Logging, args.Tracing)
+	if err != nil {
+		return 1
+	}
+	defer closeRun()
+
+	cleaner, err := runner.NewFleetCleaner(ctx, appLogger, args)
+	if err != nil {
+		slog.Error("error building a fleet cleaner", "error", strings.Replace(err.Error(), "\n", ", ", -1))
+		return 1
+	}
+
+	_, err = cleaner.CleanupFleet(ctx)
+	if err != nil {
+		slog.Error("error cleaning up fleet", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// runLock will show, or break, the lock held on a fleet while it is updated
+func runLock(ctx context.Context, cliArgs []string) int {
+	args, err := config.ParseAndValidateLockArgs(cliArgs)
+	if err != nil {
+		return handleArgsError(err)
+	}
+
+	appLogger, closeRun, err := initializeRun(ctx, args.Verbose, args.Logging, args.Tracing)
+	if err != nil {
+		return 1
 	}
+	defer closeRun()
+
+	command, err := runner.NewFleetLockCommand(ctx, appLogger, args)
+	if err != nil {
+		slog.Error("error building a fleet lock command", "error", strings.Replace(err.Error(), "\n", ", ", -1))
+		return 1
+	}
+
+	_, err = command.Run(ctx)
+	if err != nil {
+		slog.Error("error running fleet lock command", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// runInstanceLock will show, or release, the lock the update script takes on each instance in a fleet
+func runInstanceLock(ctx context.Context, cliArgs []string) int {
+	args, err := config.ParseAndValidateInstanceLockArgs(cliArgs)
+	if err != nil {
+		return handleArgsError(err)
+	}
+
+	appLogger, closeRun, err := initializeRun(ctx, args.Verbose, args.Logging, args.Tracing)
+	if err != nil {
+		return 1
+	}
+	defer closeRun()
+
+	command, err := runner.NewInstanceLockCommand(ctx, appLogger, args)
+	if err != nil {
+		slog.Error("error building an instance lock command", "error", strings.Replace(err.Error(), "\n", ", ", -1))
+		return 1
+	}
+
+	_, err = command.Run(ctx)
+	if err != nil {
+		slog.Error("error running instance lock command", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// runScriptTemplate will print the built-in update script template for an operating system, as a starting point for --script-template
+func runScriptTemplate(cliArgs []string) int {
+	args, err := config.ParseAndValidateScriptTemplateArgs(cliArgs)
+	if err != nil {
+		return handleArgsError(err)
+	}
+
+	scriptTemplate, err := tools.BuiltinUpdateScriptTemplate(args.OperatingSystem)
+	if err != nil {
+		fmt.Println("error looking up the update script template: ", err)
+		return 1
+	}
+
+	fmt.Print(strings.TrimPrefix(scriptTemplate, "\n"))
+	return 0
+}
+
+// initializeRun sets up the application logger, and span exports if an OTLP endpoint was configured. Errors are written out before they are returned.
+// The returned function flushes any spans and closes the logger, it should be deferred until the command is done.
+func initializeRun(ctx context.Context, verbose bool, logOptions config.LogOptions, tracingOptions config.TracingOptions) (*config.ApplicationLogger, func(), error) {
+	appLogger, err := config.InitializeLogger(verbose, logOptions)
+	if err != nil {
+		fmt.Println("error initializing the logger: ", err)
+		return nil, nil, err
+	}
+
+	tracing, err := config.InitializeTracing(ctx, tracingOptions, appLogger.RunId)
+	if err != nil {
+		slog.Error("error initializing tracing", "error", err)
+		appLogger.Close()
+		return nil, nil, err
+	}
+
+	closeRun := func() {
+		if err := tracing.Shutdown(ctx); err != nil {
+			appLogger.Logger.Warn("error shutting down tracing", "err", err)
+		}
+		appLogger.Close()
+	}
+	return appLogger, closeRun, nil
+}
+
+func handleArgsError(err error) int {
+	if err == flag.ErrHelp {
+		return 0
+	}
+
+	fmt.Println("error passing arguments:")
+	fmt.Println(err.Error())
+	return 1
 }
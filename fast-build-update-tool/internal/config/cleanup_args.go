@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CommandCleanup is the name of the command used to clean up access this application has granted on a fleet
+const CommandCleanup = "cleanup"
+
+// CleanupArgs holds the parsed and validated args the user passed to the cleanup command
+type CleanupArgs struct {
+	// FleetId is the id of the fleet the user would like to clean up
+	FleetId string
+	// IpRange is the range of IP addresses to remove SSH permissions for. Without it the SSH permissions are only listed, since they may not have been opened by this tool.
+	IpRange string
+	// SSHPort is the SSH port that was opened on the fleet. It is only needed if a custom port was used for a Windows fleet.
+	SSHPort int
+	// RevokeAccess is an optional flag to also remove the SSH key for PrivateKeyPath from instances in the fleet
+	RevokeAccess bool
+	// PrivateKeyPath is the path on the local filesystem to the private SSH key whose access should be revoked
+	PrivateKeyPath string
+	// SSHAgent is an optional flag to revoke access for a key in the SSH agent, instead of for PrivateKeyPath
+	SSHAgent bool
+	// AgentPublicKeyPath is an optional path to the public key of the agent key, when there are several keys in the SSH agent
+	AgentPublicKeyPath string
+	// InstanceIds is an optional allow list of instance ids to revoke access on
+	InstanceIds []string
+	// StopSSHServer is an optional flag to stop the SSH server started by this tool when access is revoked
+	StopSSHServer bool
+	// DryRun is an optional flag to list the SSH permissions that would be removed, without removing them
+	DryRun bool
+	// Yes is an optional flag to remove the SSH permissions without asking for confirmation first
+	Yes bool
+	// Verbose is an optional argument to provide more verbose application logs
+	Verbose bool
+	// Logging holds where, and how, application logs are written
+	Logging LogOptions
+	// Tracing holds where OpenTelemetry spans are exported to
+	Tracing TracingOptions
+
+	instanceIdsRaw string
+}
+
+const (
+	argDryRun = "dry-run"
+)
+
+// ParseAndValidateCleanupArgs will parse the input slice of string arguments for the cleanup command, and validate them.
+// The first element of cliArgs is expected to be the name of the command.
+func ParseAndValidateCleanupArgs(cliArgs []string) (CleanupArgs, error) {
+	result, err := ParseCleanupArgs(cliArgs)
+	if err != nil {
+		return result, err
+	}
+
+	return result, result.Validate()
+}
+
+// ParseCleanupArgs will parse the input slice of string arguments into CleanupArgs
+func ParseCleanupArgs(args []string) (CleanupArgs, error) {
+	result := CleanupArgs{}
+
+	flags := flag.NewFlagSet(AppName+" "+CommandCleanup, flag.ContinueOnError)
+
+	// Define required arguments
+	flags.StringVar(&result.FleetId, argFleetId, "", "[Required] The ID of the GameLift Fleet to clean up")
+
+	// Define optional arguments
+	flags.StringVar(&result.IpRange, argIpRange, "", "[Optional] Remove SSH access for this IP range (eg. 127.0.0.1/32). If not provided the SSH permissions on the fleet are only listed, since they may not have been opened by this tool.")
+	flags.IntVar(&result.SSHPort, argSSHPort, 0, "[Optional] The SSH port that was opened on the fleet. It will default to 22 for Linux, and 1026 for Windows.")
+	flags.BoolVar(&result.RevokeAccess, argRevokeAccess, false, "[Optional] Also remove the SSH key for --"+argPrivateKey+" from each instance in the fleet")
+	flags.StringVar(&result.PrivateKeyPath, argPrivateKey, "", "[Optional] The local path to the private key whose access should be revoked. Required with --"+argRevokeAccess+", unless --"+argSSHAgent+" is set.")
+	flags.BoolVar(&result.SSHAgent, argSSHAgent, false, "[Optional] Revoke access for a key from the SSH agent at $SSH_AUTH_SOCK (or the OpenSSH agent service on Windows). The first key in the agent is used, unless --"+argAgentPublicKey+" is set.")
+	flags.StringVar(&result.AgentPublicKeyPath, argAgentPublicKey, "", "[Optional] The local path to the public key of the agent key whose access should be revoked. Can only be used along with --"+argSSHAgent+".")
+	flags.StringVar(&result.instanceIdsRaw, argInstanceIds, "", "[Optional] A list of instance ids to revoke access on separated by comma. If not provided access is revoked on all instances.")
+	flags.BoolVar(&result.StopSSHServer, argStopSSHServer, false, "[Optional] Stop the SSH server started by this tool when access is revoked. On Windows the firewall rule created by this tool is also removed.")
+	flags.BoolVar(&result.DryRun, argDryRun, false, "[Optional] List the SSH permissions found on the fleet without removing them")
+	flags.BoolVar(&result.Yes, argYes, false, "[Optional] Remove the SSH permissions for --"+argIpRange+" without asking for confirmation first")
+	flags.BoolVar(&result.Verbose, argVerbose, false, "[Optional] Write more verbose logs as output")
+	addLogFlags(flags, &result.Logging)
+	addTracingFlags(flags, &result.Tracing)
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s --%s FLEET_ID\n", os.Args[0], CommandCleanup, argFleetId)
+		flags.PrintDefaults()
+	}
+
+	// If nothing was passed at all, show the usage instructions
+	if len(args) <= 1 {
+		flags.Usage()
+		return result, flag.ErrHelp
+	}
+
+	// Parse the arguments (without the command name in the slice)
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return result, err
+	}
+
+	// Split instance id CSV into a slice if provided
+	if result.instanceIdsRaw != "" {
+		result.InstanceIds = strings.Split(result.instanceIdsRaw, ",")
+	}
+
+	result.Logging.parsed()
+
+	return result, nil
+}
+
+// Validate that all of the CleanupArgs are valid
+func (c *CleanupArgs) Validate() (err error) {
+	if c.FleetId == "" {
+		err = errors.Join(err, missingArgumentError(argFleetId))
+	}
+
+	if c.IpRange != "" && !isValidIpRange(c.IpRange) {
+		err = errors.Join(err, invalidArgumentError(argIpRange, "must be a valid IP range"))
+	}
+
+	if c.RevokeAccess {
+		err = errors.Join(err, validateKeyPath(c.PrivateKeyPath, c.SSHAgent, c.AgentPublicKeyPath))
+	} else if c.StopSSHServer {
+		err = errors.Join(err, invalidArgumentError(argStopSSHServer, "can only be used along with the "+argRevokeAccess+" flag"))
+	}
+
+	err = errors.Join(err, c.Logging.Validate())
+	err = errors.Join(err, c.Tracing.Validate())
+
+	return err
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseAndValidateCleanupArgs validates that this function properly parses valid args without error
+func TestParseAndValidateCleanupArgs(t *testing.T) {
+	args, err := ParseAndValidateCleanupArgs([]string{
+		CommandCleanup,
+		"--fleet-id", "1234",
+		"--ip-range", "127.0.0.1/32",
+		"--ssh-port", "1500",
+		"--dry-run",
+		"--verbose"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", args.FleetId)
+	assert.Equal(t, "127.0.0.1/32", args.IpRange)
+	assert.Equal(t, 1500, args.SSHPort)
+	assert.True(t, args.DryRun)
+	assert.True(t, args.Verbose)
+}
+
+// TestParseCleanupArgsEmpty validates that we return the help/usage error when no args are passed
+func TestParseCleanupArgsEmpty(t *testing.T) {
+	_, err := ParseAndValidateCleanupArgs([]string{CommandCleanup})
+	assert.Equal(t, flag.ErrHelp, err)
+}
+
+// TestValidateCleanupArgs validates that we return errors for missing and invalid cleanup args
+func TestValidateCleanupArgs(t *testing.T) {
+	args := &CleanupArgs{IpRange: "127.0.0.1"}
+
+	err := args.Validate()
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "missing required argument fleet-id")
+	assert.ErrorContains(t, err, "argument ip-range was invalid: must be a valid IP range")
+
+	args = &CleanupArgs{FleetId: "fleet-1234"}
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateCleanupArgsRevokeAccess validates that a private key is required to revoke access
+func TestValidateCleanupArgsRevokeAccess(t *testing.T) {
+	args := &CleanupArgs{FleetId: "fleet-1234", RevokeAccess: true}
+	assert.ErrorContains(t, args.Validate(), "missing required argument private-key")
+
+	args.PrivateKeyPath = privateKeyPath
+	assert.Nil(t, args.Validate())
+
+	args = &CleanupArgs{FleetId: "fleet-1234", StopSSHServer: true}
+	assert.ErrorContains(t, args.Validate(), "argument stop-ssh-server was invalid")
+
+	// A key file is not required when revoking access for a key in the SSH agent
+	args = &CleanupArgs{FleetId: "fleet-1234", RevokeAccess: true, SSHAgent: true}
+	assert.Nil(t, args.Validate())
+
+	args.PrivateKeyPath = privateKeyPath
+	assert.ErrorContains(t, args.Validate(), "argument private-key was invalid")
+}
+
+// TestParseCleanupArgsInstanceIds validates that instance ids are split into a slice
+func TestParseCleanupArgsInstanceIds(t *testing.T) {
+	args, err := ParseCleanupArgs([]string{CommandCleanup, "--fleet-id", "1234", "--instance-ids", "i-1,i-2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"i-1", "i-2"}, args.InstanceIds)
+}
@@ -2,12 +2,18 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
 // CLIArgs holds the parsed and validated args the user passed to the application
@@ -18,8 +24,16 @@ type CLIArgs struct {
 	IpRange string
 	// BuildZipPath is the path on the local filesystem to the build zip file
 	BuildZipPath string
+	// BuildDir is the path on the local filesystem to a build directory, it is zipped once to a temporary file that is copied to each instance instead of BuildZipPath
+	BuildDir string
 	// PrivateKeyPath is the path on the local filesystem to the private SSH key that will be used to interact with remote instances
 	PrivateKeyPath string
+	// SSHAgent is an optional flag to use a key from the SSH agent instead of PrivateKeyPath
+	SSHAgent bool
+	// AgentPublicKeyPath is an optional path to the public key of the agent key to use, when there are several keys in the SSH agent
+	AgentPublicKeyPath string
+	// EphemeralKey is an optional flag to generate a new SSH key in memory for this run, instead of loading PrivateKeyPath
+	EphemeralKey bool
 	// SSHPort is the port that will be opened for SSH use on any remote instances
 	SSHPort int
 	// InstanceIds is an optional allow list of instance ids to update in GameLift
@@ -28,10 +42,82 @@ type CLIArgs struct {
 	RestartProcess bool
 	// LockName is an optional override to change the name of the lock file used on remote servers in-case of deadlock.
 	LockName string
+	// PreHookPath is an optional local script run on each instance before the server processes are stopped
+	PreHookPath string
+	// PostHookPath is an optional local script run on each instance once the new build is unpacked, and again once the server processes were restarted
+	PostHookPath string
+	// ScriptTemplatePath is an optional local text/template file the update script is generated from, instead of the built-in template for the fleet
+	ScriptTemplatePath string
+	// StopGracePeriod is how long each server process is given to exit after it was asked to stop, before it is killed
+	StopGracePeriod time.Duration
+	// OnNoProcess is what the update script does when no server process is running for one of the executables of the fleet
+	OnNoProcess NoProcessPolicy
+	// FleetLockTTL is how long the lock on the fleet is held without being renewed, so a run that was interrupted does not lock the fleet forever. DefaultFleetLockTTL is used when it is 0.
+	FleetLockTTL time.Duration
+	// NoLock is an optional flag to update the fleet without taking the lock on it, for users that are not allowed to tag the fleet
+	NoLock bool
+	// RevokeAccess is an optional flag to remove the SSH key installed on each instance once the update is done
+	RevokeAccess bool
+	// StopSSHServer is an optional flag to stop the SSH server started by this tool when access is revoked
+	StopSSHServer bool
+	// KeepPortOpen is an optional flag to leave the SSH port open on the fleet after the update is done
+	KeepPortOpen bool
+	// NoCache is an optional flag to always enable SSH over SSM, instead of reusing host keys cached by a previous run
+	NoCache bool
+	// OpenSSHPackagePath is an optional local OpenSSH-Win64.zip to copy to Windows instances over SSM, instead of downloading OpenSSH on the instance
+	OpenSSHPackagePath string
+	// OpenSSHSHA256 is the SHA-256 the OpenSSH package must match before it is installed on Windows instances
+	OpenSSHSHA256 string
+	// OpenSSHCapability is an optional flag to install the Windows built-in OpenSSH server on instances that offer it
+	OpenSSHCapability bool
+	// Transport is how files are copied to, and the update script is run on, remote instances
+	Transport Transport
+	// Follow is an optional flag to print the output of the update script on each instance as it runs
+	Follow bool
+	// Dashboard is an optional flag to show an interactive dashboard of every instance while they are updated
+	Dashboard bool
 	// Verbose is an optional argument to provide more verbose application logs
 	Verbose bool
+	// Logging holds where, and how, application logs are written
+	Logging LogOptions
+	// Tracing holds where OpenTelemetry spans are exported to
+	Tracing TracingOptions
+	// Webhooks holds where, and how, notifications about the update are sent
+	Webhooks WebhookOptions
 
 	instanceIdsRaw string
+	transportRaw   string
+	onNoProcessRaw string
+}
+
+// OpenSSHInstallOptions holds how OpenSSH is installed on Windows instances that are not already running an SSH server
+type OpenSSHInstallOptions struct {
+	// PackagePath is an optional local OpenSSH package to copy to instances over SSM. When empty, the package is downloaded on the instance.
+	PackagePath string
+	// PackageSHA256 is the upper case hex SHA-256 the package must match before it is installed. When empty, the package is not downloaded or installed.
+	PackageSHA256 string
+	// UseCapability will install the Windows built-in OpenSSH server on instances that offer it, instead of the package
+	UseCapability bool
+}
+
+// UpdateHooks holds the local scripts that are copied to each instance, and run by the update script around the build swap
+type UpdateHooks struct {
+	// PreHookPath is run before the server processes are stopped, it is empty when there is no pre-hook
+	PreHookPath string
+	// PostHookPath is run once the new build is unpacked, and again once the server processes were restarted. It is empty when there is no post-hook.
+	PostHookPath string
+}
+
+// Paths returns the local path of every hook that is set, each path is only returned once
+func (u UpdateHooks) Paths() []string {
+	result := make([]string, 0, 2)
+	if u.PreHookPath != "" {
+		result = append(result, u.PreHookPath)
+	}
+	if u.PostHookPath != "" && u.PostHookPath != u.PreHookPath {
+		result = append(result, u.PostHookPath)
+	}
+	return result
 }
 
 // ParseAndValidateCLIArgs will parse the input slice of string arguments, and validate them
@@ -45,15 +131,36 @@ func ParseAndValidateCLIArgs(cliArgs []string) (CLIArgs, error) {
 }
 
 const (
-	argFleetId        = "fleet-id"
-	argIpRange        = "ip-range"
-	argBuildZipPath   = "zip-path"
-	argPrivateKey     = "private-key"
-	argSSHPort        = "ssh-port"
-	argInstanceIds    = "instance-ids"
-	argRestartProcess = "restart-process"
-	argLockName       = "lock-name"
-	argVerbose        = "verbose"
+	argFleetId           = "fleet-id"
+	argIpRange           = "ip-range"
+	argBuildZipPath      = "zip-path"
+	argBuildDir          = "build-dir"
+	argPrivateKey        = "private-key"
+	argEphemeralKey      = "ephemeral-key"
+	argSSHAgent          = "ssh-agent"
+	argAgentPublicKey    = "agent-public-key"
+	argSSHPort           = "ssh-port"
+	argInstanceIds       = "instance-ids"
+	argRestartProcess    = "restart-process"
+	argLockName          = "lock-name"
+	argFleetLockTTL      = "fleet-lock-ttl"
+	argNoLock            = "no-lock"
+	argPreHook           = "pre-hook"
+	argPostHook          = "post-hook"
+	argScriptTemplate    = "script-template"
+	argStopGracePeriod   = "stop-grace-period"
+	argOnNoProcess       = "on-no-process"
+	argKeepPortOpen      = "keep-port-open"
+	argRevokeAccess      = "revoke-access"
+	argStopSSHServer     = "stop-ssh-server"
+	argNoCache           = "no-cache"
+	argOpenSSHPackage    = "openssh-package"
+	argOpenSSHSHA256     = "openssh-sha256"
+	argOpenSSHCapability = "openssh-capability"
+	argTransport         = "transport"
+	argFollow            = "follow"
+	argDashboard         = "dashboard"
+	argVerbose           = "verbose"
 )
 
 // ParseArgs will parse the input slice of string arguments into CLIArgs
@@ -65,18 +172,49 @@ func ParseArgs(args []string) (CLIArgs, error) {
 	// Define required arguments
 	flags.StringVar(&result.FleetId, argFleetId, "", "[Required] The ID of the GameLift Fleet to update")
 	flags.StringVar(&result.IpRange, argIpRange, "", "[Required] Your local IP Address, needed to open ports on the fleet for remote connections (eg. 127.0.0.1/32)")
-	flags.StringVar(&result.BuildZipPath, argBuildZipPath, "", "[Required] The path to the zip file containing your build")
-	flags.StringVar(&result.PrivateKeyPath, argPrivateKey, "", "[Required] The local path to a private key to be used with SSH")
+	flags.StringVar(&result.BuildZipPath, argBuildZipPath, "", "[Required] The path to the zip, tar.gz or tar.zst file containing your build. Not needed when --"+argBuildDir+" is set.")
+	flags.StringVar(&result.PrivateKeyPath, argPrivateKey, "", "[Required] The local path to a private key to be used with SSH. You will be prompted for a passphrase if the key is encrypted. Not needed when --"+argEphemeralKey+" or --"+argSSHAgent+" is set.")
 
 	// Define optional arguments
-	flags.IntVar(&result.SSHPort, argSSHPort, 0, "[Optional] The port to open for SSH on the fleet. This option is for Windows remote instances only. It will default to 1026.")
+	flags.StringVar(&result.BuildDir, argBuildDir, "", "[Optional] The path to a directory containing your build, instead of --"+argBuildZipPath+". It is zipped once, to a temporary file that is copied to every instance and removed when the tool exits, leaving out the files matched by the "+BuildIgnoreFileName+" file in the directory.")
+	flags.BoolVar(&result.SSHAgent, argSSHAgent, false, "[Optional] Use a key from the SSH agent at $SSH_AUTH_SOCK (or the OpenSSH agent service on Windows) instead of a private key file. The first key in the agent is used, unless --"+argAgentPublicKey+" is set.")
+	flags.StringVar(&result.AgentPublicKeyPath, argAgentPublicKey, "", "[Optional] The local path to the public key of the agent key to use. Can only be used along with --"+argSSHAgent+".")
+	flags.BoolVar(&result.EphemeralKey, argEphemeralKey, false, "[Optional] Generate a new SSH key in memory for this run instead of using --"+argPrivateKey+". The key is never written to disk, and is removed from each instance when the update is done.")
+	flags.IntVar(&result.SSHPort, argSSHPort, 0, "[Optional] The port to open for SSH on the fleet. It will default to 22 for Linux, and 1026 for Windows. Custom ports must be between 1026 and 60000.")
 	flags.StringVar(&result.instanceIdsRaw, argInstanceIds, "", "[Optional] A list of instance ids to update separated by comma. If not provided all instances will be updated")
 	flags.BoolVar(&result.RestartProcess, argRestartProcess, false, "[Optional] Flag to restart existing game server processes on a server, and skip uploading a new build and replacing the old build.")
-	flags.StringVar(&result.LockName, argLockName, AppName, "[Optional] This should only be set if you encounter a deadlock. This should not be set in typical application use. Set this argument to manually override the lock file name used on the server if your application gets stuck in an update deadlock.")
+	flags.StringVar(&result.LockName, argLockName, AppName, "[Optional] This should only be set if you encounter a deadlock. This should not be set in typical application use. Set this argument to manually override the lock file name used on the server if your application gets stuck in an update deadlock. Prefer the "+CommandInstanceLock+" command, which releases the stuck lock instead.")
+	flags.StringVar(&result.PreHookPath, argPreHook, "", "[Optional] The local path to a script to copy to each instance, and run before the server processes are stopped. It is passed the stage of the update (pre-kill) as its first argument. The update of an instance stops if it fails.")
+	flags.StringVar(&result.PostHookPath, argPostHook, "", "[Optional] The local path to a script to copy to each instance, and run once the new build is unpacked (post-unzip), and again once the server processes were restarted (post-restart). It is passed the stage as its first argument. The update of an instance stops if it fails.")
+	flags.StringVar(&result.ScriptTemplatePath, argScriptTemplate, "", "[Optional] The local path to a text/template file to generate the update script from, instead of the built-in template. Use the "+CommandScriptTemplate+" command to print the built-in templates.")
+	flags.DurationVar(&result.StopGracePeriod, argStopGracePeriod, 0, "[Optional] How long each server process is given to exit after it was asked to stop (SIGTERM on Linux, CTRL_BREAK on Windows), before it is killed, eg. 30s. By default processes are sent SIGTERM and not waited for on Linux, and killed straight away on Windows.")
+	flags.StringVar(&result.onNoProcessRaw, argOnNoProcess, string(NoProcessPolicyFail), "[Optional] What to do when no server process is running for one of the executables of the fleet, eg. because the servers already crashed. \""+string(NoProcessPolicyFail)+"\" stops the update of the instance, \""+string(NoProcessPolicyWarn)+"\" carries on and reports a warning, \""+string(NoProcessPolicyIgnore)+"\" carries on without reporting it.")
+	flags.DurationVar(&result.FleetLockTTL, argFleetLockTTL, DefaultFleetLockTTL, "[Optional] How long the lock on the fleet is held without being renewed. The lock is renewed while the update runs, so only a run that was interrupted holds it until it expires.")
+	flags.BoolVar(&result.NoLock, argNoLock, false, "[Optional] Update the fleet without taking the lock on it. Use this when you are not allowed to call gamelift:TagResource, gamelift:UntagResource and gamelift:ListTagsForResource on the fleet. Nothing then stops another run from updating the fleet at the same time.")
+	flags.BoolVar(&result.RevokeAccess, argRevokeAccess, false, "[Optional] Remove the SSH key installed by this tool from each instance once the update is done")
+	flags.BoolVar(&result.StopSSHServer, argStopSSHServer, false, "[Optional] Stop the SSH server started by this tool when access is revoked. On Windows the firewall rule created by this tool is also removed. Requires --"+argRevokeAccess+".")
+	flags.BoolVar(&result.KeepPortOpen, argKeepPortOpen, false, "[Optional] Leave the SSH port open for the provided IP range after the update is done. By default a port opened by this tool is closed again before it exits.")
+	flags.BoolVar(&result.NoCache, argNoCache, false, "[Optional] Always enable SSH on instances over SSM. By default host keys from a previous run are reused when the instance can still be reached with them.")
+	flags.StringVar(&result.OpenSSHPackagePath, argOpenSSHPackage, "", "[Optional] Windows only. The local path to an OpenSSH-Win64.zip package to install on instances that are not running an SSH server. The package is copied to each instance over SSM, so instances do not need internet access. Requires --"+argOpenSSHSHA256+".")
+	flags.StringVar(&result.OpenSSHSHA256, argOpenSSHSHA256, "", "[Optional] Windows only. The SHA-256 of the OpenSSH package, as a hex string. The package is not installed on an instance unless it matches. If --"+argOpenSSHPackage+" is not set, the package downloaded on the instance is verified against it. By default the downloaded package is verified by checking that every program and script in it is signed by Microsoft.")
+	flags.BoolVar(&result.OpenSSHCapability, argOpenSSHCapability, false, "[Optional] Windows only. Install the Windows built-in OpenSSH server capability when an instance offers it, and only fall back to the OpenSSH package when it does not.")
+	flags.StringVar(&result.transportRaw, argTransport, string(TransportSSH), "[Optional] How the build is copied to, and the update script is run on, instances. Use \""+string(TransportSSM)+"\" on fleets that can't open an SSH port, everything is then sent through the SSM session instead. This is much slower, and none of the SSH arguments can be used.")
+	flags.BoolVar(&result.Follow, argFollow, false, "[Optional] Print the output of the update script on each instance as it runs, prefixed with the instance ID.")
+	flags.BoolVar(&result.Dashboard, argDashboard, false, "[Optional] Show an interactive dashboard of every instance while they are updated. Plain output is used when stdout is not a terminal.")
 	flags.BoolVar(&result.Verbose, argVerbose, false, "[Optional] Write more verbose logs as output")
+	addLogFlags(flags, &result.Logging)
+	addTracingFlags(flags, &result.Tracing)
+	addWebhookFlags(flags, &result.Webhooks)
 
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s --%s FLEET_ID --%s IP_RANGE --%s BUILD_ZIP_PATH --%s PRIVATE_KEY \n", os.Args[0], argFleetId, argIpRange, argBuildZipPath, argPrivateKey)
+		fmt.Fprintf(os.Stderr, "       %s --%s FLEET_ID --%s IP_RANGE --%s BUILD_DIR --%s PRIVATE_KEY \n", os.Args[0], argFleetId, argIpRange, argBuildDir, argPrivateKey)
+		fmt.Fprintf(os.Stderr, "       %s --%s FLEET_ID --%s IP_RANGE --%s BUILD_ZIP_PATH --%s\n", os.Args[0], argFleetId, argIpRange, argBuildZipPath, argEphemeralKey)
+		fmt.Fprintf(os.Stderr, "       %s --%s FLEET_ID --%s BUILD_ZIP_PATH --%s %s\n", os.Args[0], argFleetId, argBuildZipPath, argTransport, TransportSSM)
+		fmt.Fprintf(os.Stderr, "       %s %s --%s FLEET_ID [OPTIONS]\n", os.Args[0], CommandCleanup, argFleetId)
+		fmt.Fprintf(os.Stderr, "       %s %s %s|%s --%s FLEET_ID\n", os.Args[0], CommandLock, LockActionStatus, LockActionBreak, argFleetId)
+		fmt.Fprintf(os.Stderr, "       %s %s %s|%s --%s FLEET_ID [OPTIONS]\n", os.Args[0], CommandInstanceLock, InstanceLockActionStatus, InstanceLockActionRelease, argFleetId)
+		fmt.Fprintf(os.Stderr, "       %s %s %s|%s\n", os.Args[0], CommandScriptTemplate, OperatingSystemLinux, OperatingSystemWindows)
 		flags.PrintDefaults()
 	}
 
@@ -97,6 +235,11 @@ func ParseArgs(args []string) (CLIArgs, error) {
 		result.InstanceIds = strings.Split(result.instanceIdsRaw, ",")
 	}
 
+	result.Transport = Transport(result.transportRaw)
+	result.OnNoProcess = NoProcessPolicy(result.onNoProcessRaw)
+	result.Logging.parsed()
+	result.Webhooks.parsed()
+
 	return result, nil
 }
 
@@ -106,38 +249,140 @@ func (c *CLIArgs) Validate() (err error) {
 		err = errors.Join(err, missingArgumentError(argFleetId))
 	}
 
-	if c.IpRange == "" {
-		err = errors.Join(err, missingArgumentError(argIpRange))
-
-	} else if !isValidIpRange(c.IpRange) {
-		err = errors.Join(err, invalidArgumentError(argIpRange, "must be a valid IP range"))
-	}
-
 	// We do not need to validate a build zip file if we are just restarting the process
 	if c.RestartProcess {
 		if c.BuildZipPath != "" {
 			err = errors.Join(err, invalidArgumentError(argBuildZipPath, "zip file provided along with restart process flag"))
 		}
+		if c.BuildDir != "" {
+			err = errors.Join(err, invalidArgumentError(argBuildDir, "build directory provided along with restart process flag"))
+		}
 	} else {
-		if c.BuildZipPath == "" {
+		switch {
+		case c.BuildDir != "" && c.BuildZipPath != "":
+			err = errors.Join(err, invalidArgumentError(argBuildDir, "can not be used along with --"+argBuildZipPath))
+
+		case c.BuildDir != "":
+			if !isDirectory(c.BuildDir) {
+				err = errors.Join(err, invalidArgumentError(argBuildDir, "could not find directory"))
+			}
+
+		case c.BuildZipPath == "":
 			err = errors.Join(err, missingArgumentError(argBuildZipPath))
 
-		} else if !doesFileExist(c.BuildZipPath) {
+		case !doesFileExist(c.BuildZipPath):
 			err = errors.Join(err, missingFileError(argBuildZipPath))
+		}
+	}
+
+	switch c.Transport {
+	case TransportSSH, "":
+		err = errors.Join(err, c.validateSSHTransport())
+	case TransportSSM:
+		err = errors.Join(err, c.validateSSMTransport())
+	default:
+		err = errors.Join(err, invalidArgumentError(argTransport, fmt.Sprintf("must be %s or %s", TransportSSH, TransportSSM)))
+	}
+
+	err = errors.Join(err, c.validateHooks())
+
+	if c.ScriptTemplatePath != "" && !doesFileExist(c.ScriptTemplatePath) {
+		err = errors.Join(err, missingFileError(argScriptTemplate))
+	}
+
+	if c.StopGracePeriod < 0 {
+		err = errors.Join(err, invalidArgumentError(argStopGracePeriod, "must not be negative"))
+	}
+
+	switch c.OnNoProcess {
+	case NoProcessPolicyFail, NoProcessPolicyWarn, NoProcessPolicyIgnore, "":
+	default:
+		err = errors.Join(err, invalidArgumentError(argOnNoProcess, fmt.Sprintf("must be %s, %s or %s", NoProcessPolicyFail, NoProcessPolicyWarn, NoProcessPolicyIgnore)))
+	}
+
+	if c.FleetLockTTL != 0 && c.FleetLockTTL < MinimumFleetLockTTL {
+		err = errors.Join(err, invalidArgumentError(argFleetLockTTL, fmt.Sprintf("must be at least %s", MinimumFleetLockTTL)))
+	}
+
+	err = errors.Join(err, c.Logging.Validate())
+	err = errors.Join(err, c.Tracing.Validate())
+	err = errors.Join(err, c.Webhooks.Validate())
 
+	// Verbose logs are written to stdout, they would be drawn over by the dashboard
+	if c.Dashboard && c.Verbose {
+		err = errors.Join(err, invalidArgumentError(argDashboard, "can not be used along with the "+argVerbose+" flag"))
+	}
+
+	return err
+}
+
+// validateSSHTransport validates the arguments needed to copy files and run the update script over SSH
+func (c *CLIArgs) validateSSHTransport() (err error) {
+	if c.IpRange == "" {
+		err = errors.Join(err, missingArgumentError(argIpRange))
+
+	} else if !isValidIpRange(c.IpRange) {
+		err = errors.Join(err, invalidArgumentError(argIpRange, "must be a valid IP range"))
+	}
+
+	// An ephemeral key is generated for the run, so a key file must not be provided along with it
+	if c.EphemeralKey {
+		if c.PrivateKeyPath != "" {
+			err = errors.Join(err, invalidArgumentError(argPrivateKey, "private key provided along with the "+argEphemeralKey+" flag"))
 		}
+		if c.SSHAgent {
+			err = errors.Join(err, invalidArgumentError(argSSHAgent, "can not be used along with the "+argEphemeralKey+" flag"))
+		}
+		if c.AgentPublicKeyPath != "" {
+			err = errors.Join(err, invalidArgumentError(argAgentPublicKey, "can not be used along with the "+argEphemeralKey+" flag"))
+		}
+	} else {
+		err = errors.Join(err, validateKeyPath(c.PrivateKeyPath, c.SSHAgent, c.AgentPublicKeyPath))
+	}
+
+	err = errors.Join(err, validateOpenSSHPackage(c.OpenSSHPackagePath, c.OpenSSHSHA256))
+
+	if c.StopSSHServer && !c.ShouldRevokeAccess() {
+		err = errors.Join(err, invalidArgumentError(argStopSSHServer, "can only be used along with the "+argRevokeAccess+" or "+argEphemeralKey+" flags"))
 	}
 
-	if c.PrivateKeyPath == "" {
-		err = errors.Join(err, missingArgumentError(argPrivateKey))
+	return err
+}
+
+// validateSSMTransport validates that none of the SSH arguments are used when everything is sent through an SSM session
+func (c *CLIArgs) validateSSMTransport() (err error) {
+	sshArgs := []struct {
+		name  string
+		isSet bool
+	}{
+		{argIpRange, c.IpRange != ""},
+		{argPrivateKey, c.PrivateKeyPath != ""},
+		{argSSHAgent, c.SSHAgent},
+		{argAgentPublicKey, c.AgentPublicKeyPath != ""},
+		{argEphemeralKey, c.EphemeralKey},
+		{argSSHPort, c.SSHPort != 0},
+		{argRevokeAccess, c.RevokeAccess},
+		{argStopSSHServer, c.StopSSHServer},
+		{argKeepPortOpen, c.KeepPortOpen},
+		{argOpenSSHPackage, c.OpenSSHPackagePath != ""},
+		{argOpenSSHSHA256, c.OpenSSHSHA256 != ""},
+		{argOpenSSHCapability, c.OpenSSHCapability},
+	}
 
-	} else if !doesFileExist(c.PrivateKeyPath) {
-		err = errors.Join(err, missingFileError(argPrivateKey))
+	for _, arg := range sshArgs {
+		if arg.isSet {
+			err = errors.Join(err, invalidArgumentError(arg.name, "can not be used along with --"+argTransport+"="+string(TransportSSM)))
+		}
 	}
 
 	return err
 }
 
+// UsesSSH will return true if files are copied to, and the update script is run on, instances over SSH
+func (c *CLIArgs) UsesSSH() bool {
+	return c.Transport != TransportSSM
+}
+
 // GetUpdateOperation will return what update operation the CLIArgs have instructed the app to take
 func (c *CLIArgs) GetUpdateOperation() UpdateOperation {
 	// Currently only two options here (restart processes, or replace the build on all instances)
@@ -147,11 +392,188 @@ func (c *CLIArgs) GetUpdateOperation() UpdateOperation {
 	return UpdateOperationReplaceBuild
 }
 
+// BuildArchiveName will return the file name of the build zip copied to each instance, it is empty when the build is not replaced
+func (c *CLIArgs) BuildArchiveName() string {
+	switch {
+	case c.RestartProcess:
+		return ""
+	case c.BuildDir != "":
+		return DirectoryArchiveName(c.BuildDir)
+	case c.BuildZipPath != "":
+		return filepath.Base(c.BuildZipPath)
+	default:
+		return ""
+	}
+}
+
+// DirectoryArchiveName returns the file name of the zip built from a build directory, the name of the directory with a .zip extension
+func DirectoryArchiveName(dir string) string {
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		absoluteDir = dir
+	}
+	return filepath.Base(absoluteDir) + ".zip"
+}
+
+// GetNoProcessPolicy will return what the update script does when no server process is running for one of the executables of the fleet
+func (c *CLIArgs) GetNoProcessPolicy() NoProcessPolicy {
+	if c.OnNoProcess == "" {
+		return NoProcessPolicyFail
+	}
+	return c.OnNoProcess
+}
+
+// ShouldRevokeAccess will return true if the SSH key installed on each instance should be removed once the update is done.
+// An ephemeral key is always removed, since it can not be used again after this run.
+func (c *CLIArgs) ShouldRevokeAccess() bool {
+	return c.RevokeAccess || c.EphemeralKey
+}
+
+// ShouldUseHostKeyCache will return true if host keys cached by a previous run may be used to skip enabling SSH over SSM.
+// The cache is only useful when our key stays authorized on the instance after this run.
+func (c *CLIArgs) ShouldUseHostKeyCache() bool {
+	return c.UsesSSH() && !c.NoCache && !c.ShouldRevokeAccess()
+}
+
+// validateHooks validates the hook scripts. Each hook is uploaded next to the build zip, so its file name must be safe to use in the update script and must not overwrite another uploaded file.
+func (c *CLIArgs) validateHooks() (err error) {
+	hooks := []struct {
+		name string
+		path string
+	}{
+		{argPreHook, c.PreHookPath},
+		{argPostHook, c.PostHookPath},
+	}
+
+	for _, hook := range hooks {
+		if hook.path == "" {
+			continue
+		}
+
+		if !doesFileExist(hook.path) {
+			err = errors.Join(err, missingFileError(hook.name))
+			continue
+		}
+
+		fileName := filepath.Base(hook.path)
+		if !hookNameRegex.MatchString(fileName) {
+			err = errors.Join(err, invalidArgumentError(hook.name, "file name must only contain letters, numbers, '.', '_' and '-'"))
+		} else if fileName == c.BuildArchiveName() {
+			err = errors.Join(err, invalidArgumentError(hook.name, "file name must be different from the build zip file name"))
+		}
+	}
+
+	if c.PreHookPath != "" && c.PostHookPath != "" && c.PreHookPath != c.PostHookPath && filepath.Base(c.PreHookPath) == filepath.Base(c.PostHookPath) {
+		err = errors.Join(err, invalidArgumentError(argPostHook, "file name must be different from the "+argPreHook+" file name"))
+	}
+
+	return err
+}
+
+// Hooks returns the scripts run on each instance around the build swap
+func (c *CLIArgs) Hooks() UpdateHooks {
+	return UpdateHooks{
+		PreHookPath:  c.PreHookPath,
+		PostHookPath: c.PostHookPath,
+	}
+}
+
+// validateKeyPath validates the key arguments. When using the SSH agent no private key is needed, and the agent public key is optional since it is only used to choose an agent key.
+func validateKeyPath(privateKeyPath string, useSSHAgent bool, agentPublicKeyPath string) error {
+	if useSSHAgent {
+		if privateKeyPath != "" {
+			return invalidArgumentError(argPrivateKey, "can not be used along with the "+argSSHAgent+" flag, use --"+argAgentPublicKey+" to choose the agent key")
+		}
+		if agentPublicKeyPath != "" && !doesFileExist(agentPublicKeyPath) {
+			return missingFileError(argAgentPublicKey)
+		}
+		return nil
+	}
+
+	if agentPublicKeyPath != "" {
+		return invalidArgumentError(argAgentPublicKey, "can only be used along with the "+argSSHAgent+" flag")
+	}
+
+	if privateKeyPath == "" {
+		return missingArgumentError(argPrivateKey)
+	}
+
+	if !doesFileExist(privateKeyPath) {
+		return missingFileError(argPrivateKey)
+	}
+
+	return nil
+}
+
+// OpenSSHInstall returns how OpenSSH should be installed on Windows instances that are not already running an SSH server
+func (c *CLIArgs) OpenSSHInstall() OpenSSHInstallOptions {
+	return OpenSSHInstallOptions{
+		PackagePath:   c.OpenSSHPackagePath,
+		PackageSHA256: strings.ToUpper(c.OpenSSHSHA256),
+		UseCapability: c.OpenSSHCapability,
+	}
+}
+
+// validateOpenSSHPackage validates the OpenSSH package arguments. A local package must always come with a checksum, and is verified here so a mismatch is found before any instance is changed.
+func validateOpenSSHPackage(packagePath string, packageSHA256 string) error {
+	if packageSHA256 != "" && !isValidSHA256(packageSHA256) {
+		return invalidArgumentError(argOpenSSHSHA256, "must be a hex encoded SHA-256")
+	}
+
+	if packagePath == "" {
+		return nil
+	}
+
+	if packageSHA256 == "" {
+		return invalidArgumentError(argOpenSSHPackage, "requires the "+argOpenSSHSHA256+" argument")
+	}
+
+	actualSHA256, err := FileSHA256(packagePath)
+	if err != nil {
+		return missingFileError(argOpenSSHPackage)
+	}
+
+	if !strings.EqualFold(actualSHA256, packageSHA256) {
+		return invalidArgumentError(argOpenSSHPackage, fmt.Sprintf("file has SHA-256 %s, which does not match the %s argument", actualSHA256, argOpenSSHSHA256))
+	}
+
+	return nil
+}
+
+func isValidSHA256(s string) bool {
+	decoded, err := hex.DecodeString(s)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// FileSHA256 returns the hex encoded SHA-256 of the file at path
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hookNameRegex matches the hook file names that can be used as is in the update script on every operating system
+var hookNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
 func doesFileExist(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
 func isValidIpRange(ipRange string) bool {
 	_, _, cidrErr := net.ParseCIDR(ipRange)
 	return cidrErr == nil
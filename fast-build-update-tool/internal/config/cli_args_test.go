@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -71,6 +72,21 @@ func TestParseArgs(t *testing.T) {
 		"--instance-ids", instanceIds,
 		"--restart-process",
 		"--lock-name", lockName,
+		"--fleet-lock-ttl", "5m",
+		"--pre-hook", "pre.sh",
+		"--post-hook", "post.sh",
+		"--script-template", "update.tmpl",
+		"--stop-grace-period", "45s",
+		"--on-no-process", "warn",
+		"--keep-port-open",
+		"--follow",
+		"--dashboard",
+		"--log-format", "json",
+		"--log-dir", "/var/log/fastbuild",
+		"--log-retention", "3",
+		"--webhook-urls", "https://hooks.example.com/a,https://hooks.example.com/b",
+		"--webhook-template", "slack",
+		"--webhook-secret", "secret",
 		"--verbose"})
 
 	assert.Nil(t, err)
@@ -83,6 +99,18 @@ func TestParseArgs(t *testing.T) {
 	assert.Contains(t, args.InstanceIds, "2")
 	assert.True(t, args.RestartProcess)
 	assert.Equal(t, lockName, args.LockName)
+	assert.Equal(t, 5*time.Minute, args.FleetLockTTL)
+	assert.Equal(t, UpdateHooks{PreHookPath: "pre.sh", PostHookPath: "post.sh"}, args.Hooks())
+	assert.Equal(t, "update.tmpl", args.ScriptTemplatePath)
+	assert.Equal(t, 45*time.Second, args.StopGracePeriod)
+	assert.Equal(t, NoProcessPolicyWarn, args.GetNoProcessPolicy())
+	assert.True(t, args.KeepPortOpen)
+	assert.True(t, args.Follow)
+	assert.True(t, args.Dashboard)
+	assert.Equal(t, LogOptions{Format: LogFormatJSON, Dir: "/var/log/fastbuild", Retention: 3, formatRaw: "json"}, args.Logging)
+	assert.Equal(t, []string{"https://hooks.example.com/a", "https://hooks.example.com/b"}, args.Webhooks.URLs)
+	assert.Equal(t, WebhookTemplateSlack, args.Webhooks.Template)
+	assert.Equal(t, "secret", args.Webhooks.Secret)
 	assert.True(t, args.Verbose)
 }
 
@@ -174,3 +202,317 @@ func TestGetUpdateOperationReplaceBuild(t *testing.T) {
 	args := &CLIArgs{}
 	assert.Equal(t, args.GetUpdateOperation(), UpdateOperationReplaceBuild)
 }
+
+// TestValidateStopSSHServerWithoutRevokeAccess ensures that stopping the SSH server requires revoking access
+func TestValidateStopSSHServerWithoutRevokeAccess(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildZipPath:   buildZipPath,
+		PrivateKeyPath: privateKeyPath,
+		StopSSHServer:  true,
+	}
+
+	err := args.Validate()
+	assert.ErrorContains(t, err, "argument stop-ssh-server was invalid")
+
+	args.RevokeAccess = true
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateEphemeralKey ensures that a private key is not required, or allowed, when using an ephemeral key
+func TestValidateEphemeralKey(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:      "fleet-id",
+		IpRange:      "127.0.0.1/0",
+		BuildZipPath: buildZipPath,
+		EphemeralKey: true,
+	}
+
+	assert.Nil(t, args.Validate())
+	assert.True(t, args.ShouldRevokeAccess())
+
+	args.PrivateKeyPath = privateKeyPath
+	assert.ErrorContains(t, args.Validate(), "argument private-key was invalid: private key provided along with the ephemeral-key flag")
+}
+
+// TestValidateStopSSHServerWithEphemeralKey ensures that the SSH server can be stopped when an ephemeral key is revoked
+func TestValidateStopSSHServerWithEphemeralKey(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:       "fleet-id",
+		IpRange:       "127.0.0.1/0",
+		BuildZipPath:  buildZipPath,
+		EphemeralKey:  true,
+		StopSSHServer: true,
+	}
+
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateSSHAgent ensures that a private key is not used along with the SSH agent, and the agent public key is only used with it
+func TestValidateSSHAgent(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:      "fleet-id",
+		IpRange:      "127.0.0.1/0",
+		BuildZipPath: buildZipPath,
+		SSHAgent:     true,
+	}
+
+	assert.Nil(t, args.Validate())
+
+	args.PrivateKeyPath = privateKeyPath
+	assert.ErrorContains(t, args.Validate(), "argument private-key was invalid: can not be used along with the ssh-agent flag")
+
+	args.PrivateKeyPath = ""
+	args.AgentPublicKeyPath = "not a real public key file"
+	assert.ErrorContains(t, args.Validate(), "argument agent-public-key was invalid: could not find file")
+
+	args.AgentPublicKeyPath = privateKeyPath
+	assert.Nil(t, args.Validate())
+
+	args.SSHAgent = false
+	args.PrivateKeyPath = privateKeyPath
+	assert.ErrorContains(t, args.Validate(), "argument agent-public-key was invalid: can only be used along with the ssh-agent flag")
+
+	args.SSHAgent = true
+	args.PrivateKeyPath = ""
+	args.EphemeralKey = true
+	assert.ErrorContains(t, args.Validate(), "argument ssh-agent was invalid")
+	assert.ErrorContains(t, args.Validate(), "argument agent-public-key was invalid")
+}
+
+// TestShouldUseHostKeyCache ensures that the host key cache is only used when our key stays authorized after the run
+func TestShouldUseHostKeyCache(t *testing.T) {
+	assert.True(t, (&CLIArgs{}).ShouldUseHostKeyCache())
+	assert.False(t, (&CLIArgs{NoCache: true}).ShouldUseHostKeyCache())
+	assert.False(t, (&CLIArgs{RevokeAccess: true}).ShouldUseHostKeyCache())
+	assert.False(t, (&CLIArgs{EphemeralKey: true}).ShouldUseHostKeyCache())
+}
+
+// TestValidateOpenSSHPackage ensures that a local OpenSSH package is only accepted along with a matching checksum
+func TestValidateOpenSSHPackage(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:            "fleet-id",
+		IpRange:            "127.0.0.1/0",
+		BuildZipPath:       buildZipPath,
+		PrivateKeyPath:     privateKeyPath,
+		OpenSSHPackagePath: buildZipPath,
+	}
+
+	assert.ErrorContains(t, args.Validate(), "argument openssh-package was invalid: requires the openssh-sha256 argument")
+
+	args.OpenSSHSHA256 = "not a checksum"
+	assert.ErrorContains(t, args.Validate(), "argument openssh-sha256 was invalid: must be a hex encoded SHA-256")
+
+	args.OpenSSHSHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+	assert.ErrorContains(t, args.Validate(), "does not match the openssh-sha256 argument")
+
+	args.OpenSSHSHA256 = "1DD9D64946C4CE5A6C5113ED418EDAD519449D71DB92675D7FB8AC73A8CC8828"
+	assert.Nil(t, args.Validate())
+
+	args.OpenSSHPackagePath = "not a real package"
+	assert.ErrorContains(t, args.Validate(), "argument openssh-package was invalid: could not find file")
+}
+
+// TestOpenSSHInstall ensures that the checksum is normalized to match the output of Get-FileHash
+func TestOpenSSHInstall(t *testing.T) {
+	args := &CLIArgs{
+		OpenSSHPackagePath: "OpenSSH-Win64.zip",
+		OpenSSHSHA256:      "1dd9d64946c4ce5a6c5113ed418edad519449d71db92675d7fb8ac73a8cc8828",
+		OpenSSHCapability:  true,
+	}
+
+	assert.Equal(t, OpenSSHInstallOptions{
+		PackagePath:   "OpenSSH-Win64.zip",
+		PackageSHA256: "1DD9D64946C4CE5A6C5113ED418EDAD519449D71DB92675D7FB8AC73A8CC8828",
+		UseCapability: true,
+	}, args.OpenSSHInstall())
+}
+
+// TestValidateSSMTransport ensures that no IP range or key is needed when everything is sent through SSM, and SSH arguments are rejected
+func TestValidateSSMTransport(t *testing.T) {
+	args, err := ParseAndValidateCLIArgs([]string{
+		"appName.exe",
+		"--fleet-id", "1234",
+		"--zip-path", buildZipPath,
+		"--transport", "ssm"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, TransportSSM, args.Transport)
+	assert.False(t, args.UsesSSH())
+	assert.False(t, args.ShouldUseHostKeyCache())
+
+	args.IpRange = "127.0.0.1/0"
+	args.PrivateKeyPath = privateKeyPath
+	err = args.Validate()
+	assert.ErrorContains(t, err, "argument ip-range was invalid: can not be used along with --transport=ssm")
+	assert.ErrorContains(t, err, "argument private-key was invalid: can not be used along with --transport=ssm")
+}
+
+// TestValidateUnknownTransport ensures that an unknown transport is rejected
+func TestValidateUnknownTransport(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildZipPath:   buildZipPath,
+		PrivateKeyPath: privateKeyPath,
+		Transport:      "scp",
+	}
+
+	assert.ErrorContains(t, args.Validate(), "argument transport was invalid: must be ssh or ssm")
+
+	args.Transport = TransportSSH
+	assert.Nil(t, args.Validate())
+	assert.True(t, args.UsesSSH())
+}
+
+// TestValidateDashboardWithVerbose ensures the dashboard can't be used along with verbose logs, which are written to stdout
+func TestValidateDashboardWithVerbose(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildZipPath:   buildZipPath,
+		PrivateKeyPath: privateKeyPath,
+		Dashboard:      true,
+		Verbose:        true,
+	}
+
+	assert.ErrorContains(t, args.Validate(), "argument dashboard was invalid: can not be used along with the verbose flag")
+
+	args.Verbose = false
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateFleetLockTTL validates that the fleet lock can't expire between renewals
+func TestValidateFleetLockTTL(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildZipPath:   buildZipPath,
+		PrivateKeyPath: privateKeyPath,
+		FleetLockTTL:   30 * time.Second,
+	}
+
+	assert.ErrorContains(t, args.Validate(), "argument fleet-lock-ttl was invalid: must be at least 1m0s")
+
+	args.FleetLockTTL = time.Minute
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateHooks validates that hooks must exist, and have a file name that can be uploaded next to the build zip
+func TestValidateHooks(t *testing.T) {
+	dir := t.TempDir()
+	writeHook := func(name string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte("#!/bin/bash\n"), 0755))
+		return path
+	}
+
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildZipPath:   buildZipPath,
+		PrivateKeyPath: privateKeyPath,
+		PreHookPath:    filepath.Join(dir, "missing.sh"),
+		PostHookPath:   writeHook("game-executable.zip"),
+	}
+
+	err := args.Validate()
+	assert.ErrorContains(t, err, "argument pre-hook was invalid: could not find file")
+	assert.ErrorContains(t, err, "argument post-hook was invalid: file name must be different from the build zip file name")
+
+	args.PreHookPath = writeHook("pre hook; reboot.sh")
+	args.PostHookPath = filepath.Join(t.TempDir(), "pre hook; reboot.sh")
+	assert.Nil(t, os.WriteFile(args.PostHookPath, nil, 0755))
+	err = args.Validate()
+	assert.ErrorContains(t, err, "argument pre-hook was invalid: file name must only contain letters, numbers, '.', '_' and '-'")
+
+	args.PreHookPath = writeHook("hook.sh")
+	args.PostHookPath = filepath.Join(t.TempDir(), "hook.sh")
+	assert.Nil(t, os.WriteFile(args.PostHookPath, nil, 0755))
+	assert.ErrorContains(t, args.Validate(), "argument post-hook was invalid: file name must be different from the pre-hook file name")
+
+	// The same script can be used for both hooks, it tells the stages apart by its first argument
+	args.PostHookPath = args.PreHookPath
+	assert.Nil(t, args.Validate())
+	assert.Equal(t, []string{args.PreHookPath}, args.Hooks().Paths())
+}
+
+// TestValidateScriptTemplate validates that the update script template must exist, it is rendered once the fleet updater is built
+func TestValidateScriptTemplate(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:            "fleet-id",
+		IpRange:            "127.0.0.1/0",
+		BuildZipPath:       buildZipPath,
+		PrivateKeyPath:     privateKeyPath,
+		ScriptTemplatePath: "not a real template",
+	}
+
+	assert.ErrorContains(t, args.Validate(), "argument script-template was invalid: could not find file")
+
+	args.ScriptTemplatePath = buildZipPath
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateStopGracePeriod validates that the stop grace period can't be negative
+func TestValidateStopGracePeriod(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:         "fleet-id",
+		IpRange:         "127.0.0.1/0",
+		BuildZipPath:    buildZipPath,
+		PrivateKeyPath:  privateKeyPath,
+		StopGracePeriod: -time.Second,
+	}
+
+	assert.ErrorContains(t, args.Validate(), "argument stop-grace-period was invalid: must not be negative")
+
+	args.StopGracePeriod = 30 * time.Second
+	assert.Nil(t, args.Validate())
+}
+
+// TestValidateOnNoProcess validates that only the known no process policies are accepted, and that the update fails by default
+func TestValidateOnNoProcess(t *testing.T) {
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildZipPath:   buildZipPath,
+		PrivateKeyPath: privateKeyPath,
+	}
+
+	assert.Nil(t, args.Validate())
+	assert.Equal(t, NoProcessPolicyFail, args.GetNoProcessPolicy())
+
+	args.OnNoProcess = "skip"
+	assert.ErrorContains(t, args.Validate(), "argument on-no-process was invalid: must be fail, warn or ignore")
+
+	args.OnNoProcess = NoProcessPolicyIgnore
+	assert.Nil(t, args.Validate())
+	assert.Equal(t, NoProcessPolicyIgnore, args.GetNoProcessPolicy())
+}
+
+// TestValidateBuildDir validates that a build directory can be used instead of a build zip file, but not along with one
+func TestValidateBuildDir(t *testing.T) {
+	buildDir := filepath.Join(t.TempDir(), "mybuild")
+	assert.Nil(t, os.Mkdir(buildDir, 0755))
+
+	args := &CLIArgs{
+		FleetId:        "fleet-id",
+		IpRange:        "127.0.0.1/0",
+		BuildDir:       buildDir,
+		PrivateKeyPath: privateKeyPath,
+	}
+
+	assert.Nil(t, args.Validate())
+	assert.Equal(t, "mybuild.zip", args.BuildArchiveName())
+
+	args.BuildZipPath = buildZipPath
+	assert.ErrorContains(t, args.Validate(), "argument build-dir was invalid: can not be used along with --zip-path")
+
+	args.BuildZipPath = ""
+	args.BuildDir = buildZipPath
+	assert.ErrorContains(t, args.Validate(), "argument build-dir was invalid: could not find directory")
+
+	args.BuildDir = buildDir
+	args.RestartProcess = true
+	assert.ErrorContains(t, args.Validate(), "argument build-dir was invalid: build directory provided along with restart process flag")
+}
@@ -9,6 +9,12 @@ const (
 	// DefaultPortLinux is the default SSH port for Linux instances
 	DefaultPortLinux int32 = 22
 
+	// MinCustomPort is the lowest port that can be used for SSH instead of the default
+	MinCustomPort int32 = 1026
+
+	// MaxCustomPort is the highest port that can be used for SSH instead of the default
+	MaxCustomPort int32 = 60000
+
 	// AppName is the name of this application
 	AppName = "fast-build-update-tool"
 )
@@ -39,6 +45,45 @@ const (
 	OperatingSystemWindows OperatingSystem = iota
 )
 
+// Transport is how files are copied to, and the update script is run on, remote instances
+type Transport string
+
+const (
+	// TransportSSH copies files and runs the update script over SSH, after SSH has been enabled over SSM
+	TransportSSH Transport = "ssh"
+
+	// TransportSSM copies files and runs the update script through an SSM session, without opening an SSH port
+	TransportSSM Transport = "ssm"
+)
+
+// BuildIgnoreFileName is the file in the root of a build directory that lists the files to leave out of its archive
+const BuildIgnoreFileName = ".fastbuildignore"
+
+// NoProcessPolicy is what the update script does when no server process is running for one of the executables of the fleet
+type NoProcessPolicy string
+
+const (
+	// NoProcessPolicyFail stops the update of the instance, and reports it as failed
+	NoProcessPolicyFail NoProcessPolicy = "fail"
+
+	// NoProcessPolicyWarn carries on with the update, and reports a warning for the instance
+	NoProcessPolicyWarn NoProcessPolicy = "warn"
+
+	// NoProcessPolicyIgnore carries on with the update without reporting anything
+	NoProcessPolicyIgnore NoProcessPolicy = "ignore"
+)
+
+// LogFormat is the format application logs are written in
+type LogFormat string
+
+const (
+	// LogFormatText writes each log as key=value pairs, or as pretty output in the terminal when not verbose
+	LogFormatText LogFormat = "text"
+
+	// LogFormatJSON writes each log as a JSON object on its own line, so it can be indexed by a log shipper
+	LogFormatJSON LogFormat = "json"
+)
+
 // RemoteUser is an enum of usernames that can be used to remotely access a GameLift instance
 type RemoteUser string
 
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// CommandInstanceLock is the name of the command used to inspect, or release, the lock the update script takes on each instance
+const CommandInstanceLock = "instance-lock"
+
+// InstanceLockAction is what the instance-lock command does with the update lock on each instance
+type InstanceLockAction string
+
+const (
+	// InstanceLockActionStatus shows whether the update lock is held on each instance, and by which processes
+	InstanceLockActionStatus InstanceLockAction = "status"
+	// InstanceLockActionRelease stops the processes holding the update lock on each instance, once the user has confirmed it
+	InstanceLockActionRelease InstanceLockAction = "release"
+)
+
+const (
+	argCleanArchives = "clean-archives"
+	argYes           = "yes"
+)
+
+// lockNameRegex matches the lock names that can be used in a file name, and in the name of a Windows mutex
+var lockNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// InstanceLockArgs holds the parsed and validated args the user passed to the instance-lock command
+type InstanceLockArgs struct {
+	// Action is what to do with the update lock on each instance
+	Action InstanceLockAction
+	// FleetId is the id of the fleet whose instances are inspected
+	FleetId string
+	// InstanceIds is an optional allow list of instance ids to inspect
+	InstanceIds []string
+	// LockName is the name of the lock taken by the update script, it must match the --lock-name the update was run with
+	LockName string
+	// CleanArchives is an optional flag to also remove the archives left behind in the upload directory when the lock is released
+	CleanArchives bool
+	// Yes is an optional flag to release the lock without asking for confirmation first
+	Yes bool
+	// Verbose is an optional argument to provide more verbose application logs
+	Verbose bool
+	// Logging holds where, and how, application logs are written
+	Logging LogOptions
+	// Tracing holds where OpenTelemetry spans are exported to
+	Tracing TracingOptions
+
+	instanceIdsRaw string
+}
+
+// ParseAndValidateInstanceLockArgs will parse the input slice of string arguments for the instance-lock command, and validate them.
+// The first element of cliArgs is expected to be the name of the command, and the second the action.
+func ParseAndValidateInstanceLockArgs(cliArgs []string) (InstanceLockArgs, error) {
+	result, err := ParseInstanceLockArgs(cliArgs)
+	if err != nil {
+		return result, err
+	}
+
+	return result, result.Validate()
+}
+
+// ParseInstanceLockArgs will parse the input slice of string arguments into InstanceLockArgs
+func ParseInstanceLockArgs(args []string) (InstanceLockArgs, error) {
+	result := InstanceLockArgs{}
+
+	flags := flag.NewFlagSet(AppName+" "+CommandInstanceLock, flag.ContinueOnError)
+
+	// Define required arguments
+	flags.StringVar(&result.FleetId, argFleetId, "", "[Required] The ID of the GameLift Fleet whose instances should be inspected")
+
+	// Define optional arguments
+	flags.StringVar(&result.instanceIdsRaw, argInstanceIds, "", "[Optional] A list of instance ids to inspect separated by comma. If not provided all instances are inspected.")
+	flags.StringVar(&result.LockName, argLockName, AppName, "[Optional] The name of the lock taken by the update script. Only needed if the update was run with --"+argLockName+".")
+	flags.BoolVar(&result.CleanArchives, argCleanArchives, false, "[Optional] Also remove the build archives left behind in the upload directory when the lock is released")
+	flags.BoolVar(&result.Yes, argYes, false, "[Optional] Release the lock without asking for confirmation first")
+	flags.BoolVar(&result.Verbose, argVerbose, false, "[Optional] Write more verbose logs as output")
+	addLogFlags(flags, &result.Logging)
+	addTracingFlags(flags, &result.Tracing)
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s --%s FLEET_ID\n", os.Args[0], CommandInstanceLock, InstanceLockActionStatus, argFleetId)
+		fmt.Fprintf(os.Stderr, "       %s %s %s --%s FLEET_ID\n", os.Args[0], CommandInstanceLock, InstanceLockActionRelease, argFleetId)
+		flags.PrintDefaults()
+	}
+
+	// If no action was passed, show the usage instructions
+	if len(args) <= 1 || strings.HasPrefix(args[1], "-") {
+		flags.Usage()
+		return result, flag.ErrHelp
+	}
+
+	result.Action = InstanceLockAction(args[1])
+
+	// Parse the arguments (without the command name and action in the slice)
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return result, err
+	}
+
+	// Split instance id CSV into a slice if provided
+	if result.instanceIdsRaw != "" {
+		result.InstanceIds = strings.Split(result.instanceIdsRaw, ",")
+	}
+
+	result.Logging.parsed()
+
+	return result, nil
+}
+
+// Validate that all of the InstanceLockArgs are valid
+func (i *InstanceLockArgs) Validate() (err error) {
+	switch i.Action {
+	case InstanceLockActionStatus, InstanceLockActionRelease:
+	default:
+		err = errors.Join(err, invalidArgumentError(argLockAction, fmt.Sprintf("must be %s or %s", InstanceLockActionStatus, InstanceLockActionRelease)))
+	}
+
+	if i.FleetId == "" {
+		err = errors.Join(err, missingArgumentError(argFleetId))
+	}
+
+	// The lock name is used in the commands run on each instance
+	if !lockNameRegex.MatchString(i.LockName) {
+		err = errors.Join(err, invalidArgumentError(argLockName, "must only contain letters, numbers, '.', '_' and '-'"))
+	}
+
+	if i.CleanArchives && i.Action != InstanceLockActionRelease {
+		err = errors.Join(err, invalidArgumentError(argCleanArchives, "can only be used with the "+string(InstanceLockActionRelease)+" action"))
+	}
+
+	err = errors.Join(err, i.Logging.Validate())
+	err = errors.Join(err, i.Tracing.Validate())
+
+	return err
+}
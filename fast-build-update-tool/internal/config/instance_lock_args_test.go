@@ -0,0 +1,44 @@
+package config
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseAndValidateInstanceLockArgs validates that the action and flags are parsed from the instance-lock command
+func TestParseAndValidateInstanceLockArgs(t *testing.T) {
+	args, err := ParseAndValidateInstanceLockArgs([]string{CommandInstanceLock, "release", "--fleet-id", "1234", "--instance-ids", "i-1,i-2", "--clean-archives", "--yes"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, InstanceLockActionRelease, args.Action)
+	assert.Equal(t, "1234", args.FleetId)
+	assert.Equal(t, []string{"i-1", "i-2"}, args.InstanceIds)
+	assert.Equal(t, AppName, args.LockName)
+	assert.True(t, args.CleanArchives)
+	assert.True(t, args.Yes)
+}
+
+// TestParseInstanceLockArgsNoAction validates that we return the help/usage error when no action is passed
+func TestParseInstanceLockArgsNoAction(t *testing.T) {
+	_, err := ParseAndValidateInstanceLockArgs([]string{CommandInstanceLock})
+	assert.Equal(t, flag.ErrHelp, err)
+
+	_, err = ParseAndValidateInstanceLockArgs([]string{CommandInstanceLock, "--fleet-id", "1234"})
+	assert.Equal(t, flag.ErrHelp, err)
+}
+
+// TestValidateInstanceLockArgs validates that we return errors for unknown actions, invalid lock names and missing args
+func TestValidateInstanceLockArgs(t *testing.T) {
+	args := &InstanceLockArgs{Action: "steal", LockName: "my lock; rm -rf /", CleanArchives: true}
+
+	err := args.Validate()
+	assert.ErrorContains(t, err, "argument action was invalid: must be status or release")
+	assert.ErrorContains(t, err, "missing required argument fleet-id")
+	assert.ErrorContains(t, err, "argument lock-name was invalid")
+	assert.ErrorContains(t, err, "argument clean-archives was invalid: can only be used with the release action")
+
+	args = &InstanceLockArgs{Action: InstanceLockActionStatus, FleetId: "1234", LockName: "my-lock.v2"}
+	assert.Nil(t, args.Validate())
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CommandLock is the name of the command used to show, or break, the lock held on a fleet while it is updated
+const CommandLock = "lock"
+
+// LockAction is what the lock command does with the lock held on a fleet
+type LockAction string
+
+const (
+	// LockActionStatus shows who holds the lock on a fleet, and when it expires
+	LockActionStatus LockAction = "status"
+	// LockActionBreak removes the lock on a fleet, so a run that was interrupted does not keep others from updating it
+	LockActionBreak LockAction = "break"
+)
+
+const (
+	// DefaultFleetLockTTL is how long the lock on a fleet is held without being renewed by default
+	DefaultFleetLockTTL = 15 * time.Minute
+	// MinimumFleetLockTTL is the shortest time the lock on a fleet can be held without being renewed, so it is not lost between renewals
+	MinimumFleetLockTTL = time.Minute
+)
+
+// argLockAction is the name used in errors about the action passed to the lock command
+const argLockAction = "action"
+
+// LockArgs holds the parsed and validated args the user passed to the lock command
+type LockArgs struct {
+	// Action is what to do with the lock on the fleet
+	Action LockAction
+	// FleetId is the id of the fleet whose lock is shown, or broken
+	FleetId string
+	// Verbose is an optional argument to provide more verbose application logs
+	Verbose bool
+	// Logging holds where, and how, application logs are written
+	Logging LogOptions
+	// Tracing holds where OpenTelemetry spans are exported to
+	Tracing TracingOptions
+}
+
+// ParseAndValidateLockArgs will parse the input slice of string arguments for the lock command, and validate them.
+// The first element of cliArgs is expected to be the name of the command, and the second the action.
+func ParseAndValidateLockArgs(cliArgs []string) (LockArgs, error) {
+	result, err := ParseLockArgs(cliArgs)
+	if err != nil {
+		return result, err
+	}
+
+	return result, result.Validate()
+}
+
+// ParseLockArgs will parse the input slice of string arguments into LockArgs
+func ParseLockArgs(args []string) (LockArgs, error) {
+	result := LockArgs{}
+
+	flags := flag.NewFlagSet(AppName+" "+CommandLock, flag.ContinueOnError)
+
+	// Define required arguments
+	flags.StringVar(&result.FleetId, argFleetId, "", "[Required] The ID of the GameLift Fleet whose lock should be shown, or broken")
+
+	// Define optional arguments
+	flags.BoolVar(&result.Verbose, argVerbose, false, "[Optional] Write more verbose logs as output")
+	addLogFlags(flags, &result.Logging)
+	addTracingFlags(flags, &result.Tracing)
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s --%s FLEET_ID\n", os.Args[0], CommandLock, LockActionStatus, argFleetId)
+		fmt.Fprintf(os.Stderr, "       %s %s %s --%s FLEET_ID\n", os.Args[0], CommandLock, LockActionBreak, argFleetId)
+		flags.PrintDefaults()
+	}
+
+	// If no action was passed, show the usage instructions
+	if len(args) <= 1 || strings.HasPrefix(args[1], "-") {
+		flags.Usage()
+		return result, flag.ErrHelp
+	}
+
+	result.Action = LockAction(args[1])
+
+	// Parse the arguments (without the command name and action in the slice)
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return result, err
+	}
+
+	result.Logging.parsed()
+
+	return result, nil
+}
+
+// Validate that all of the LockArgs are valid
+func (l *LockArgs) Validate() (err error) {
+	switch l.Action {
+	case LockActionStatus, LockActionBreak:
+	default:
+		err = errors.Join(err, invalidArgumentError(argLockAction, fmt.Sprintf("must be %s or %s", LockActionStatus, LockActionBreak)))
+	}
+
+	if l.FleetId == "" {
+		err = errors.Join(err, missingArgumentError(argFleetId))
+	}
+
+	err = errors.Join(err, l.Logging.Validate())
+	err = errors.Join(err, l.Tracing.Validate())
+
+	return err
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseAndValidateLockArgs validates that the action and fleet are parsed from the lock command
+func TestParseAndValidateLockArgs(t *testing.T) {
+	args, err := ParseAndValidateLockArgs([]string{CommandLock, "break", "--fleet-id", "1234", "--verbose"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, LockActionBreak, args.Action)
+	assert.Equal(t, "1234", args.FleetId)
+	assert.True(t, args.Verbose)
+}
+
+// TestParseLockArgsNoAction validates that we return the help/usage error when no action is passed
+func TestParseLockArgsNoAction(t *testing.T) {
+	_, err := ParseAndValidateLockArgs([]string{CommandLock})
+	assert.Equal(t, flag.ErrHelp, err)
+
+	_, err = ParseAndValidateLockArgs([]string{CommandLock, "--fleet-id", "1234"})
+	assert.Equal(t, flag.ErrHelp, err)
+}
+
+// TestValidateLockArgs validates that we return errors for unknown actions and missing args
+func TestValidateLockArgs(t *testing.T) {
+	args := &LockArgs{Action: "steal"}
+
+	err := args.Validate()
+	assert.ErrorContains(t, err, "argument action was invalid: must be status or break")
+	assert.ErrorContains(t, err, "missing required argument fleet-id")
+
+	args = &LockArgs{Action: LockActionStatus, FleetId: "1234"}
+	assert.Nil(t, args.Validate())
+}
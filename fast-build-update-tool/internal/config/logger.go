@@ -1,11 +1,19 @@
 package config
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
 
 	"github.com/aws/smithy-go/logging"
 	"github.com/pterm/pterm"
@@ -13,82 +21,204 @@ import (
 
 const logFileName = AppName + ".log"
 
+const (
+	argLogFormat    = "log-format"
+	argLogDir       = "log-dir"
+	argLogRetention = "log-retention"
+
+	// defaultLogRetention is the number of runs whose logs are kept by default
+	defaultLogRetention = 5
+
+	// runIdKey is the key of the run ID attached to every log
+	runIdKey = "runId"
+)
+
+// runIdRegex matches the run IDs made by newRunId, only log directories named after a run ID are removed when old runs are cleaned up
+var runIdRegex = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`)
+
+// runLogsDir and runId are set once the logger is initialized. Per-instance logs are written to runLogsDir.
+var (
+	runLogsDir = logsDir()
+	runId      string
+)
+
+// LogOptions holds where, and how, application logs are written
+type LogOptions struct {
+	// Format is the format of the application logs, LogFormatText when empty
+	Format LogFormat
+	// Dir is the directory a log directory is created in for each run, ./fast-build-update-tool-logs when empty
+	Dir string
+	// Retention is the number of runs whose logs are kept, including this one. The logs of every run are kept when it is 0.
+	Retention int
+
+	formatRaw string
+}
+
+// addLogFlags defines the arguments for where, and how, application logs are written
+func addLogFlags(flags *flag.FlagSet, options *LogOptions) {
+	flags.StringVar(&options.formatRaw, argLogFormat, string(LogFormatText), "[Optional] The format of the application logs, \""+string(LogFormatText)+"\" or \""+string(LogFormatJSON)+"\". JSON logs can be indexed by a log shipper.")
+	flags.StringVar(&options.Dir, argLogDir, logsDir(), "[Optional] The directory to write logs to. A new directory, named after the run ID, is created in it for each run.")
+	flags.IntVar(&options.Retention, argLogRetention, defaultLogRetention, "[Optional] The number of runs whose logs are kept in --"+argLogDir+", older runs are removed. Use 0 to keep every run.")
+}
+
+// parsed is called once the flags were parsed
+func (l *LogOptions) parsed() {
+	l.Format = LogFormat(l.formatRaw)
+}
+
+// Validate that the LogOptions are valid
+func (l *LogOptions) Validate() (err error) {
+	switch l.Format {
+	case LogFormatText, LogFormatJSON, "":
+	default:
+		err = errors.Join(err, invalidArgumentError(argLogFormat, fmt.Sprintf("must be %s or %s", LogFormatText, LogFormatJSON)))
+	}
+
+	if l.Retention < 0 {
+		err = errors.Join(err, invalidArgumentError(argLogRetention, "must not be negative"))
+	}
+
+	return err
+}
+
 type ApplicationLogger struct {
-	Logger      *slog.Logger
-	AwsLogger   logging.Logger
-	logsDir     string
-	prevLogsDir string
-	logFile     *os.File
+	Logger    *slog.Logger
+	AwsLogger logging.Logger
+	// RunId identifies this run of the application, it is attached to every log
+	RunId string
+	// RunLogsDir is the directory every log of this run is written to
+	RunLogsDir string
+
+	logsDir   string
+	retention int
+	logFile   *os.File
 }
 
 // InitializeLogger will initialize the app logger. Use the verbose flag to configure the level of logging that will be used.
-func InitializeLogger(verbose bool) (*ApplicationLogger, error) {
+// Every log of this run is written to a new directory in options.Dir, and the directories of old runs are removed.
+func InitializeLogger(verbose bool, options LogOptions) (*ApplicationLogger, error) {
+	id, err := newRunId(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	dir := options.Dir
+	if dir == "" {
+		dir = logsDir()
+	}
+
 	result := &ApplicationLogger{
-		AwsLogger:   &awsLogger{},
-		logsDir:     logsDir(),
-		prevLogsDir: logsDir() + "-prev",
+		RunId:      id,
+		RunLogsDir: filepath.Join(dir, id),
+		logsDir:    dir,
+		retention:  options.Retention,
 	}
 
 	if err := result.initializeLogDirectories(); err != nil {
 		return result, err
 	}
 
-	if err := result.initializeSlog(verbose); err != nil {
+	if err := result.initializeSlog(verbose, options.Format); err != nil {
 		return result, err
 	}
 
+	result.AwsLogger = &awsLogger{logger: result.Logger}
+
+	// Logs written through the default logger get the run ID too
+	slog.SetDefault(result.Logger)
+	runLogsDir = result.RunLogsDir
+	runId = result.RunId
+
 	return result, nil
 }
 
+// newRunId returns a new ID for a run started at now. It starts with the time, so the log directories of each run are sorted from oldest to newest.
+func newRunId(now time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("error generating run id %w", err)
+	}
+
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix), nil
+}
+
 func (a *ApplicationLogger) initializeLogDirectories() error {
-	// Remove an existing prev log dir if we have one
-	err := os.RemoveAll(a.prevLogsDir)
+	// Create a folder for storing the logs of this run
+	err := os.MkdirAll(a.RunLogsDir, os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("error removing old log directory %w", err)
+		return fmt.Errorf("error making new log directory %w", err)
 	}
 
-	// Move existing log dir to prev
-	if doesFileExist(a.logsDir) {
-		err = os.Rename(a.logsDir, a.prevLogsDir)
-		if err != nil {
-			return fmt.Errorf("error renaming previous log directory %w", err)
-		}
+	return a.removeOldRuns()
+}
+
+// removeOldRuns removes the log directories of every run but the newest retention runs (including this one)
+func (a *ApplicationLogger) removeOldRuns() error {
+	if a.retention == 0 {
+		return nil
 	}
 
-	// Create a folder for storing our logs
-	err = os.MkdirAll(a.logsDir, os.ModePerm)
+	entries, err := os.ReadDir(a.logsDir)
 	if err != nil {
-		return fmt.Errorf("error making new log directory %w", err)
+		return fmt.Errorf("error reading log directory %w", err)
+	}
+
+	runs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && runIdRegex.MatchString(entry.Name()) {
+			runs = append(runs, entry.Name())
+		}
+	}
+	sort.Strings(runs)
+
+	for len(runs) > a.retention {
+		err = os.RemoveAll(filepath.Join(a.logsDir, runs[0]))
+		if err != nil {
+			return fmt.Errorf("error removing old log directory %w", err)
+		}
+		runs = runs[1:]
 	}
 
 	return nil
 }
 
-func (a *ApplicationLogger) initializeSlog(verbose bool) (err error) {
-	var handler slog.Handler
-
-	if verbose {
-		if a.logFile == nil {
-			// If we have verbose logs, use the default slog.TextHandler, and write everything to STDOUT, and a log file
-			a.logFile, err = os.OpenFile(filepath.Join(a.logsDir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-			if err != nil {
-				return fmt.Errorf("error creating log file %w", err)
-			}
-		}
+func (a *ApplicationLogger) initializeSlog(verbose bool, format LogFormat) (err error) {
+	// Everything is always written to the log file, only the level written to STDOUT depends on verbose
+	a.logFile, err = os.OpenFile(filepath.Join(a.RunLogsDir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating log file %w", err)
+	}
 
-		level := &slog.LevelVar{}
-		level.Set(slog.LevelDebug)
-		handler = slog.NewTextHandler(io.MultiWriter(a.logFile, os.Stdout), &slog.HandlerOptions{Level: level})
-	} else {
-		// Otherwise use the pretty logger at Warn level, and only log to STDOUT
+	var consoleHandler slog.Handler
+	switch {
+	case verbose:
+		consoleHandler = newLogHandler(format, os.Stdout, slog.LevelDebug)
+	case format == LogFormatJSON:
+		consoleHandler = newLogHandler(format, os.Stdout, slog.LevelWarn)
+	default:
+		// Otherwise use the pretty logger at Warn level
 		pterm.DefaultLogger.Level = pterm.LogLevelWarn
-		handler = pterm.NewSlogHandler(&pterm.DefaultLogger)
+		consoleHandler = pterm.NewSlogHandler(&pterm.DefaultLogger)
 	}
 
-	a.Logger = slog.New(handler)
+	handler := &multiHandler{handlers: []slog.Handler{
+		newLogHandler(format, a.logFile, slog.LevelDebug),
+		consoleHandler,
+	}}
+
+	a.Logger = slog.New(handler).With(runIdKey, a.RunId)
 	return nil
 }
 
+// newLogHandler returns a handler that writes logs at level and above to w in format
+func newLogHandler(format LogFormat, w io.Writer, level slog.Level) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if format == LogFormatJSON {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
 func (a *ApplicationLogger) Close() {
 	if a.logFile != nil {
 		err := a.logFile.Close()
@@ -104,19 +234,79 @@ func logsDir() string {
 
 // GetLogPathForFile will return the proper path where application logs can be written
 func GetLogPathForFile(fileName string) string {
-	return filepath.Join(logsDir(), fileName)
+	return filepath.Join(runLogsDir, fileName)
+}
+
+// OpenLogFile opens a per-instance log file at path, and writes the run ID at the start of it.
+// The file is appended to, so the logs of an instance that is updated again in the same run are kept.
+func OpenLogFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if runId != "" {
+		_, err = fmt.Fprintf(file, "%s=%s\n", runIdKey, runId)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+// multiHandler passes each record on to every handler that is enabled for its level
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+func (m *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range m.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *multiHandler) Handle(ctx context.Context, record slog.Record) (err error) {
+	for _, handler := range m.handlers {
+		if handler.Enabled(ctx, record.Level) {
+			err = errors.Join(err, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return err
+}
+
+func (m *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(m.handlers))
+	for _, handler := range m.handlers {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+	return &multiHandler{handlers: handlers}
 }
 
-// awsLogger implements the logger interface required by the AWS SDK, and writes logs to the standard slog logger
-type awsLogger struct{}
+func (m *multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(m.handlers))
+	for _, handler := range m.handlers {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+	return &multiHandler{handlers: handlers}
+}
+
+// awsLogger implements the logger interface required by the AWS SDK, and writes logs to the application logger
+type awsLogger struct {
+	logger *slog.Logger
+}
 
 func (a *awsLogger) Logf(classification logging.Classification, format string, v ...interface{}) {
 	switch classification {
 	case logging.Warn:
-		slog.Warn("(AWSSDK) " + fmt.Sprintf(format, v...))
+		a.logger.Warn("(AWSSDK) " + fmt.Sprintf(format, v...))
 
 	default:
-		slog.Debug("(AWSSDK) " + fmt.Sprintf(format, v...))
+		a.logger.Debug("(AWSSDK) " + fmt.Sprintf(format, v...))
 	}
 }
 
@@ -1,19 +1,120 @@
 package config
 
 import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestInitializeLoggerVerbose(t *testing.T) {
-	l, err := InitializeLogger(true)
+// testInitializeLogger initializes the logger, and puts back the default logger and log directory once the test is done
+func testInitializeLogger(t *testing.T, verbose bool, options LogOptions) *ApplicationLogger {
+	defaultLogger, defaultRunLogsDir, defaultRunId := slog.Default(), runLogsDir, runId
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		runLogsDir, runId = defaultRunLogsDir, defaultRunId
+	})
+
+	l, err := InitializeLogger(verbose, options)
 	assert.Nil(t, err)
-	l.Close()
+	t.Cleanup(l.Close)
+	return l
+}
+
+func TestInitializeLoggerVerbose(t *testing.T) {
+	testInitializeLogger(t, true, LogOptions{Dir: t.TempDir()})
 }
 
 func TestInitializeLoggerNotVerbose(t *testing.T) {
-	l, err := InitializeLogger(false)
+	testInitializeLogger(t, false, LogOptions{Dir: t.TempDir()})
+}
+
+// TestInitializeLoggerJSON ensures every log is written as JSON to the directory of the run, along with the run ID
+func TestInitializeLoggerJSON(t *testing.T) {
+	dir := t.TempDir()
+	l := testInitializeLogger(t, false, LogOptions{Dir: dir, Format: LogFormatJSON})
+
+	assert.Regexp(t, runIdRegex, l.RunId)
+	assert.Equal(t, filepath.Join(dir, l.RunId), l.RunLogsDir)
+	assert.Equal(t, filepath.Join(l.RunLogsDir, "i-1234-ssh-command.log"), GetLogPathForFile("i-1234-ssh-command.log"))
+
+	slog.Debug("from the default logger", "instanceId", "i-1234")
+	l.AwsLogger.Logf("debug", "from the aws sdk")
+
+	contents, err := os.ReadFile(filepath.Join(l.RunLogsDir, logFileName))
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		record := map[string]any{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, l.RunId, record[runIdKey])
+	}
+}
+
+// TestOpenLogFile ensures per-instance logs start with the run ID, and are appended to when opened again
+func TestOpenLogFile(t *testing.T) {
+	l := testInitializeLogger(t, false, LogOptions{Dir: t.TempDir()})
+	path := GetLogPathForFile("i-1234-ssm-enable.log")
+
+	for i := 0; i < 2; i++ {
+		file, err := OpenLogFile(path)
+		assert.Nil(t, err)
+		file.WriteString("output\n")
+		file.Close()
+	}
+
+	contents, err := os.ReadFile(path)
 	assert.Nil(t, err)
-	l.Close()
+	assert.Equal(t, strings.Repeat("runId="+l.RunId+"\noutput\n", 2), string(contents))
+}
+
+// TestInitializeLoggerRetention ensures only the newest runs are kept, and other directories are left alone
+func TestInitializeLoggerRetention(t *testing.T) {
+	dir := t.TempDir()
+	oldRuns := []string{"20240101T000000Z-00000001", "20240102T000000Z-00000002", "20240103T000000Z-00000003"}
+	for _, name := range append(oldRuns, "not-a-run") {
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, name), os.ModePerm))
+	}
+
+	l := testInitializeLogger(t, false, LogOptions{Dir: dir, Retention: 2})
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"20240103T000000Z-00000003", l.RunId, "not-a-run"}, names)
+}
+
+// TestInitializeLoggerKeepEveryRun ensures no run is removed when the retention is 0
+func TestInitializeLoggerKeepEveryRun(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "20240101T000000Z-00000001"), os.ModePerm))
+
+	testInitializeLogger(t, false, LogOptions{Dir: dir})
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestNewRunId(t *testing.T) {
+	id, err := newRunId(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Regexp(t, `^20240506T070809Z-[0-9a-f]{8}$`, id)
+}
+
+func TestValidateLogOptions(t *testing.T) {
+	assert.Nil(t, (&LogOptions{}).Validate())
+	assert.Nil(t, (&LogOptions{Format: LogFormatJSON, Retention: 3}).Validate())
+	assert.ErrorContains(t, (&LogOptions{Format: "xml"}).Validate(), "argument log-format was invalid: must be text or json")
+	assert.ErrorContains(t, (&LogOptions{Retention: -1}).Validate(), "argument log-retention was invalid: must not be negative")
 }
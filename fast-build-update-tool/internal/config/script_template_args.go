@@ -0,0 +1,78 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CommandScriptTemplate is the name of the command used to print the built-in update script templates
+const CommandScriptTemplate = "script-template"
+
+// argOperatingSystem is the name used in errors about the operating system passed to the script-template command
+const argOperatingSystem = "operating-system"
+
+// ScriptTemplateArgs holds the parsed and validated args the user passed to the script-template command
+type ScriptTemplateArgs struct {
+	// OperatingSystem is the operating system whose built-in update script template is printed
+	OperatingSystem OperatingSystem
+
+	operatingSystemRaw string
+}
+
+// ParseAndValidateScriptTemplateArgs will parse the input slice of string arguments for the script-template command, and validate them.
+// The first element of cliArgs is expected to be the name of the command, and the second the operating system.
+func ParseAndValidateScriptTemplateArgs(cliArgs []string) (ScriptTemplateArgs, error) {
+	result, err := ParseScriptTemplateArgs(cliArgs)
+	if err != nil {
+		return result, err
+	}
+
+	return result, result.Validate()
+}
+
+// ParseScriptTemplateArgs will parse the input slice of string arguments into ScriptTemplateArgs
+func ParseScriptTemplateArgs(args []string) (ScriptTemplateArgs, error) {
+	result := ScriptTemplateArgs{}
+
+	flags := flag.NewFlagSet(AppName+" "+CommandScriptTemplate, flag.ContinueOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s|%s > update-template.tmpl\n", os.Args[0], CommandScriptTemplate, OperatingSystemLinux, OperatingSystemWindows)
+		fmt.Fprintf(os.Stderr, "Prints the built-in update script template for the operating system, to use as a starting point for --%s\n", argScriptTemplate)
+		flags.PrintDefaults()
+	}
+
+	// If no operating system was passed, show the usage instructions
+	if len(args) <= 1 || strings.HasPrefix(args[1], "-") {
+		flags.Usage()
+		return result, flag.ErrHelp
+	}
+
+	result.operatingSystemRaw = args[1]
+
+	// Parse the arguments (without the command name and operating system in the slice)
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return result, err
+	}
+
+	switch strings.ToLower(result.operatingSystemRaw) {
+	case OperatingSystemLinux.String():
+		result.OperatingSystem = OperatingSystemLinux
+	case OperatingSystemWindows.String():
+		result.OperatingSystem = OperatingSystemWindows
+	}
+
+	return result, nil
+}
+
+// Validate that all of the ScriptTemplateArgs are valid
+func (s *ScriptTemplateArgs) Validate() error {
+	if s.OperatingSystem == OperatingSystemUnknown {
+		return invalidArgumentError(argOperatingSystem, fmt.Sprintf("must be %s or %s", OperatingSystemLinux, OperatingSystemWindows))
+	}
+
+	return nil
+}
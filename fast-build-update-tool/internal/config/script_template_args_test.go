@@ -0,0 +1,28 @@
+package config
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseAndValidateScriptTemplateArgs validates that the operating system is parsed from the script-template command
+func TestParseAndValidateScriptTemplateArgs(t *testing.T) {
+	args, err := ParseAndValidateScriptTemplateArgs([]string{CommandScriptTemplate, "linux"})
+	assert.Nil(t, err)
+	assert.Equal(t, OperatingSystemLinux, args.OperatingSystem)
+
+	args, err = ParseAndValidateScriptTemplateArgs([]string{CommandScriptTemplate, "Windows"})
+	assert.Nil(t, err)
+	assert.Equal(t, OperatingSystemWindows, args.OperatingSystem)
+}
+
+// TestParseAndValidateScriptTemplateArgsInvalid validates that we return the help/usage error when no operating system is passed, and an error for an unknown one
+func TestParseAndValidateScriptTemplateArgsInvalid(t *testing.T) {
+	_, err := ParseAndValidateScriptTemplateArgs([]string{CommandScriptTemplate})
+	assert.Equal(t, flag.ErrHelp, err)
+
+	_, err = ParseAndValidateScriptTemplateArgs([]string{CommandScriptTemplate, "macos"})
+	assert.ErrorContains(t, err, "argument operating-system was invalid: must be linux or windows")
+}
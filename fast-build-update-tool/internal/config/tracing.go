@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const argOTLPEndpoint = "otlp-endpoint"
+
+// The environment variables the OTLP exporter reads its endpoint from, tracing is enabled when either of them is set
+const (
+	envOTLPEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envOTLPTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+)
+
+// The attributes set on spans
+const (
+	AttributeFleetId          = attribute.Key("gamelift.fleet.id")
+	AttributeInstanceId       = attribute.Key("gamelift.instance.id")
+	AttributeRegion           = attribute.Key("cloud.region")
+	AttributeOperatingSystem  = attribute.Key("os.type")
+	AttributeBytesTransferred = attribute.Key("transfer.bytes")
+)
+
+// TracingOptions holds where spans are exported to
+type TracingOptions struct {
+	// Endpoint is the URL of an OTLP/HTTP collector to export spans to. When empty, the OTEL_EXPORTER_OTLP_* environment variables are used.
+	Endpoint string
+}
+
+// addTracingFlags defines the arguments for where spans are exported to
+func addTracingFlags(flags *flag.FlagSet, options *TracingOptions) {
+	flags.StringVar(&options.Endpoint, argOTLPEndpoint, "", "[Optional] The URL of an OTLP/HTTP collector to export OpenTelemetry spans to (eg. http://localhost:4318). When not set, spans are only exported if $"+envOTLPEndpoint+" or $"+envOTLPTracesEndpoint+" is set.")
+}
+
+// Validate that the TracingOptions are valid
+func (t *TracingOptions) Validate() (err error) {
+	if t.Endpoint == "" {
+		return nil
+	}
+
+	endpoint, parseErr := url.Parse(t.Endpoint)
+	if parseErr != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		err = errors.Join(err, invalidArgumentError(argOTLPEndpoint, "must be an http or https URL"))
+	}
+
+	return err
+}
+
+// enabled returns true when spans should be exported
+func (t *TracingOptions) enabled() bool {
+	return t.Endpoint != "" || os.Getenv(envOTLPEndpoint) != "" || os.Getenv(envOTLPTracesEndpoint) != ""
+}
+
+// Tracing exports the spans of this run, call Shutdown before the application exits so no spans are lost
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+}
+
+// InitializeTracing will export spans to the OTLP endpoint in options, or in the environment. Nothing is exported when neither is set.
+func InitializeTracing(ctx context.Context, options TracingOptions, runId string) (*Tracing, error) {
+	if !options.enabled() {
+		return &Tracing{}, nil
+	}
+
+	exporterOptions := []otlptracehttp.Option{}
+	if options.Endpoint != "" {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(options.Endpoint))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating otlp exporter %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", AppName),
+		attribute.String(runIdKey, runId),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error creating tracing resource %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	// Spans are exported in the background, any error doing so is logged along with the other logs of the run instead of printed
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("error exporting spans", "err", err)
+	}))
+
+	return &Tracing{provider: provider}, nil
+}
+
+// Shutdown exports any spans that are left, and stops the exporter
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+
+	err := t.provider.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("error exporting spans %w", err)
+	}
+	return nil
+}
+
+// Tracer returns the tracer spans of this application are started with
+func Tracer() trace.Tracer {
+	return otel.Tracer(AppName)
+}
+
+// EndSpan ends span, and marks it as failed when err is set
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
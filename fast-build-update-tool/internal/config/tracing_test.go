@@ -0,0 +1,99 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracingOptionsValidate ensures only http and https endpoints are accepted
+func TestTracingOptionsValidate(t *testing.T) {
+	assert.Nil(t, (&TracingOptions{}).Validate())
+	assert.Nil(t, (&TracingOptions{Endpoint: "http://localhost:4318"}).Validate())
+	assert.Nil(t, (&TracingOptions{Endpoint: "https://collector.example.com/v1/traces"}).Validate())
+	assert.ErrorContains(t, (&TracingOptions{Endpoint: "localhost:4318"}).Validate(), "argument otlp-endpoint was invalid: must be an http or https URL")
+	assert.ErrorContains(t, (&TracingOptions{Endpoint: "grpc://localhost:4317"}).Validate(), "argument otlp-endpoint was invalid")
+}
+
+// TestTracingEnabled ensures spans are exported when an endpoint is set by flag, or in the environment
+func TestTracingEnabled(t *testing.T) {
+	t.Setenv(envOTLPEndpoint, "")
+	t.Setenv(envOTLPTracesEndpoint, "")
+
+	assert.False(t, (&TracingOptions{}).enabled())
+	assert.True(t, (&TracingOptions{Endpoint: "http://localhost:4318"}).enabled())
+
+	t.Setenv(envOTLPTracesEndpoint, "http://localhost:4318/v1/traces")
+	assert.True(t, (&TracingOptions{}).enabled())
+}
+
+// TestInitializeTracing ensures the global tracer provider is only replaced when spans are exported
+func TestInitializeTracing(t *testing.T) {
+	t.Setenv(envOTLPEndpoint, "")
+	t.Setenv(envOTLPTracesEndpoint, "")
+
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	tracing, err := InitializeTracing(context.Background(), TracingOptions{}, "run-1")
+	assert.Nil(t, err)
+	assert.Nil(t, tracing.provider)
+	assert.Equal(t, previous, otel.GetTracerProvider())
+	assert.Nil(t, tracing.Shutdown(context.Background()))
+
+	tracing, err = InitializeTracing(context.Background(), TracingOptions{Endpoint: "http://127.0.0.1:4318"}, "run-1")
+	assert.Nil(t, err)
+	assert.NotNil(t, tracing.provider)
+	assert.Equal(t, tracing.provider, otel.GetTracerProvider())
+	assert.Nil(t, tracing.Shutdown(context.Background()))
+}
+
+// TestTracingExportError ensures spans that could not be exported are logged, instead of being printed
+func TestTracingExportError(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	defaultLogger := slog.Default()
+	defer slog.SetDefault(defaultLogger)
+	logs := &strings.Builder{}
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+
+	// Nothing listens on port 1, so the span can never be exported
+	tracing, err := InitializeTracing(context.Background(), TracingOptions{Endpoint: "http://127.0.0.1:1"}, "run-1")
+	assert.Nil(t, err)
+	_, span := Tracer().Start(context.Background(), "UpdateFleet")
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, tracing.Shutdown(ctx))
+	assert.Contains(t, logs.String(), `level=WARN msg="error exporting spans"`)
+	assert.Contains(t, logs.String(), "127.0.0.1:1")
+}
+
+// TestEndSpan ensures spans are only marked as failed when there was an error
+func TestEndSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	EndSpan(span, nil)
+
+	_, span = tracer.Start(context.Background(), "failed")
+	EndSpan(span, errors.New("connection reset"))
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "connection reset", spans[1].Status.Description)
+	assert.Len(t, spans[1].Events, 1)
+}
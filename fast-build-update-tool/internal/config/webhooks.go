@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// WebhookTemplate is the format of the payloads sent to webhooks
+type WebhookTemplate string
+
+const (
+	// WebhookTemplateJSON sends the full details of each event as JSON
+	WebhookTemplateJSON WebhookTemplate = "json"
+	// WebhookTemplateSlack sends a message that can be posted to a Slack incoming webhook
+	WebhookTemplateSlack WebhookTemplate = "slack"
+)
+
+const (
+	argWebhookURLs     = "webhook-urls"
+	argWebhookTemplate = "webhook-template"
+	argWebhookSecret   = "webhook-secret"
+
+	// EnvWebhookSecret is read for the webhook secret when --webhook-secret is not set, so the secret does not have to be passed on the command line
+	EnvWebhookSecret = "FAST_BUILD_UPDATE_TOOL_WEBHOOK_SECRET"
+)
+
+// WebhookOptions holds where, and how, notifications about an update are sent
+type WebhookOptions struct {
+	// URLs are the webhooks that are notified when the update starts, when an instance fails to update, and when the update is done
+	URLs []string
+	// Template is the format of the payloads, WebhookTemplateJSON when empty
+	Template WebhookTemplate
+	// Secret is optional, when set every request is signed with an HMAC-SHA256 of the payload
+	Secret string
+
+	urlsRaw     string
+	templateRaw string
+}
+
+// addWebhookFlags defines the arguments for where, and how, notifications about an update are sent
+func addWebhookFlags(flags *flag.FlagSet, options *WebhookOptions) {
+	flags.StringVar(&options.urlsRaw, argWebhookURLs, "", "[Optional] A list of webhook URLs separated by comma. Each is sent a notification when the update starts, when an instance fails to update, and when the update is done.")
+	flags.StringVar(&options.templateRaw, argWebhookTemplate, string(WebhookTemplateJSON), "[Optional] The format of webhook notifications, \""+string(WebhookTemplateJSON)+"\" or \""+string(WebhookTemplateSlack)+"\". Use \""+string(WebhookTemplateSlack)+"\" to post to a Slack incoming webhook.")
+	flags.StringVar(&options.Secret, argWebhookSecret, "", "[Optional] A secret to sign webhook notifications with, the HMAC-SHA256 of each payload is sent in the X-Signature-256 header. Defaults to $"+EnvWebhookSecret+".")
+}
+
+// parsed is called once the flags were parsed
+func (w *WebhookOptions) parsed() {
+	if w.urlsRaw != "" {
+		w.URLs = strings.Split(w.urlsRaw, ",")
+	}
+	w.Template = WebhookTemplate(w.templateRaw)
+
+	if w.Secret == "" {
+		w.Secret = os.Getenv(EnvWebhookSecret)
+	}
+}
+
+// Validate that the WebhookOptions are valid
+func (w *WebhookOptions) Validate() (err error) {
+	for _, webhookURL := range w.URLs {
+		parsed, parseErr := url.Parse(webhookURL)
+		if parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			err = errors.Join(err, invalidArgumentError(argWebhookURLs, fmt.Sprintf("%q must be an http or https URL", webhookURL)))
+		}
+	}
+
+	switch w.Template {
+	case WebhookTemplateJSON, WebhookTemplateSlack, "":
+	default:
+		err = errors.Join(err, invalidArgumentError(argWebhookTemplate, fmt.Sprintf("must be %s or %s", WebhookTemplateJSON, WebhookTemplateSlack)))
+	}
+
+	return err
+}
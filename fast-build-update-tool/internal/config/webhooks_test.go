@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWebhookOptionsValidate ensures only http and https webhooks, and known templates, are accepted
+func TestWebhookOptionsValidate(t *testing.T) {
+	assert.Nil(t, (&WebhookOptions{}).Validate())
+	assert.Nil(t, (&WebhookOptions{URLs: []string{"https://hooks.slack.com/services/T0/B0/X"}, Template: WebhookTemplateSlack}).Validate())
+	assert.ErrorContains(t, (&WebhookOptions{URLs: []string{"hooks.example.com"}}).Validate(), "argument webhook-urls was invalid: \"hooks.example.com\" must be an http or https URL")
+	assert.ErrorContains(t, (&WebhookOptions{Template: "teams"}).Validate(), "argument webhook-template was invalid: must be json or slack")
+}
+
+// TestWebhookSecretFromEnvironment ensures the secret is read from the environment when it is not passed as an argument
+func TestWebhookSecretFromEnvironment(t *testing.T) {
+	t.Setenv(EnvWebhookSecret, "from-env")
+
+	options := WebhookOptions{}
+	options.parsed()
+	assert.Equal(t, "from-env", options.Secret)
+	assert.Equal(t, WebhookTemplate(""), options.Template)
+	assert.Nil(t, options.URLs)
+
+	options = WebhookOptions{Secret: "from-flag"}
+	options.parsed()
+	assert.Equal(t, "from-flag", options.Secret)
+}
@@ -0,0 +1,113 @@
+package gamelift
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift/types"
+)
+
+// The tags the fleet lock is stored in
+const (
+	fleetLockTagOwner   = config.AppName + ":lock-owner"
+	fleetLockTagHost    = config.AppName + ":lock-host"
+	fleetLockTagRunId   = config.AppName + ":lock-run-id"
+	fleetLockTagExpires = config.AppName + ":lock-expires"
+)
+
+var fleetLockTags = []string{fleetLockTagOwner, fleetLockTagHost, fleetLockTagRunId, fleetLockTagExpires}
+
+// invalidTagValueRegex matches the characters that are not allowed in a tag value
+var invalidTagValueRegex = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+
+// FleetLock is the advisory lock held on a fleet by a run of this application, so only one run updates a fleet at a time
+type FleetLock struct {
+	// Owner is the user that started the run holding the lock
+	Owner string
+	// Host is the machine the run holding the lock is running on
+	Host string
+	// RunId is the run ID of the run holding the lock
+	RunId string
+	// Expires is when the lock is released, unless it is renewed by the run holding it
+	Expires time.Time
+}
+
+// Expired returns true if the lock is no longer held at now
+func (f *FleetLock) Expired(now time.Time) bool {
+	return !now.Before(f.Expires)
+}
+
+// GetFleetLock returns the lock held on the fleet, or nil when no lock is held
+func (g *GameLiftClient) GetFleetLock(ctx context.Context, fleetArn string) (*FleetLock, error) {
+	output, err := g.gamelift.ListTagsForResource(ctx, &gamelift.ListTagsForResourceInput{
+		ResourceARN: aws.String(fleetArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing fleet tags %w", err)
+	}
+
+	tags := make(map[string]string, len(output.Tags))
+	for _, tag := range output.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	runId, found := tags[fleetLockTagRunId]
+	if !found {
+		return nil, nil
+	}
+
+	// A lock without a valid expiry has already expired, so it can't keep the fleet locked forever
+	expires, _ := time.Parse(time.RFC3339, tags[fleetLockTagExpires])
+
+	return &FleetLock{
+		Owner:   tags[fleetLockTagOwner],
+		Host:    tags[fleetLockTagHost],
+		RunId:   runId,
+		Expires: expires,
+	}, nil
+}
+
+// PutFleetLock tags the fleet with lock, replacing any lock that is already held
+func (g *GameLiftClient) PutFleetLock(ctx context.Context, fleetArn string, lock *FleetLock) error {
+	_, err := g.gamelift.TagResource(ctx, &gamelift.TagResourceInput{
+		ResourceARN: aws.String(fleetArn),
+		Tags: []types.Tag{
+			{Key: aws.String(fleetLockTagOwner), Value: aws.String(tagValue(lock.Owner))},
+			{Key: aws.String(fleetLockTagHost), Value: aws.String(tagValue(lock.Host))},
+			{Key: aws.String(fleetLockTagRunId), Value: aws.String(tagValue(lock.RunId))},
+			{Key: aws.String(fleetLockTagExpires), Value: aws.String(lock.Expires.UTC().Format(time.RFC3339))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging fleet %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFleetLock removes the lock tags from the fleet
+func (g *GameLiftClient) RemoveFleetLock(ctx context.Context, fleetArn string) error {
+	_, err := g.gamelift.UntagResource(ctx, &gamelift.UntagResourceInput{
+		ResourceARN: aws.String(fleetArn),
+		TagKeys:     fleetLockTags,
+	})
+	if err != nil {
+		return fmt.Errorf("error removing fleet tags %w", err)
+	}
+
+	return nil
+}
+
+// tagValue replaces any character that is not allowed in a tag value (eg. the \ in DOMAIN\user)
+func tagValue(value string) string {
+	value = invalidTagValueRegex.ReplaceAllString(value, "_")
+	if runes := []rune(value); len(runes) > 256 {
+		value = string(runes[:256])
+	}
+	return value
+}
@@ -0,0 +1,126 @@
+package gamelift
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGetFleetLock ensures the lock is read from the tags of the fleet
+func TestGetFleetLock(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.ListTagsForResourceFunc = func(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error) {
+		return &gamelift.ListTagsForResourceOutput{Tags: []types.Tag{
+			{Key: aws.String("team"), Value: aws.String("backend")},
+			{Key: aws.String(fleetLockTagOwner), Value: aws.String("alex")},
+			{Key: aws.String(fleetLockTagHost), Value: aws.String("devbox")},
+			{Key: aws.String(fleetLockTagRunId), Value: aws.String("20240506T070809Z-1a2b3c4d")},
+			{Key: aws.String(fleetLockTagExpires), Value: aws.String("2024-05-06T07:23:09Z")},
+		}}, nil
+	}
+
+	lock, err := client.GetFleetLock(context.Background(), fleetArn)
+	assert.Nil(t, err)
+	assert.Equal(t, fleetArn, *awsMock.ListTagsForResourceCalls()[0].Params.ResourceARN)
+	assert.Equal(t, &FleetLock{
+		Owner:   "alex",
+		Host:    "devbox",
+		RunId:   "20240506T070809Z-1a2b3c4d",
+		Expires: time.Date(2024, 5, 6, 7, 23, 9, 0, time.UTC),
+	}, lock)
+
+	assert.False(t, lock.Expired(time.Date(2024, 5, 6, 7, 23, 8, 0, time.UTC)))
+	assert.True(t, lock.Expired(time.Date(2024, 5, 6, 7, 23, 9, 0, time.UTC)))
+}
+
+// TestGetFleetLockNotLocked ensures no lock is returned when the fleet is not tagged with one, and a lock without an expiry has expired
+func TestGetFleetLockNotLocked(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	tags := []types.Tag{{Key: aws.String("team"), Value: aws.String("backend")}}
+	awsMock.ListTagsForResourceFunc = func(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error) {
+		return &gamelift.ListTagsForResourceOutput{Tags: tags}, nil
+	}
+
+	lock, err := client.GetFleetLock(context.Background(), fleetArn)
+	assert.Nil(t, err)
+	assert.Nil(t, lock)
+
+	tags = append(tags, types.Tag{Key: aws.String(fleetLockTagRunId), Value: aws.String("run-1")})
+	lock, err = client.GetFleetLock(context.Background(), fleetArn)
+	assert.Nil(t, err)
+	assert.True(t, lock.Expired(time.Now()))
+}
+
+// TestGetFleetLockError ensures errors listing the tags of the fleet are returned
+func TestGetFleetLockError(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.ListTagsForResourceFunc = func(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error) {
+		return nil, errors.New("access denied")
+	}
+
+	_, err := client.GetFleetLock(context.Background(), fleetArn)
+	assert.ErrorContains(t, err, "access denied")
+}
+
+// TestPutFleetLock ensures the lock is written to the tags of the fleet, without any characters that are not allowed in a tag
+func TestPutFleetLock(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.TagResourceFunc = func(ctx context.Context, params *gamelift.TagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.TagResourceOutput, error) {
+		return &gamelift.TagResourceOutput{}, nil
+	}
+
+	err := client.PutFleetLock(context.Background(), fleetArn, &FleetLock{
+		Owner:   `CORP\alex`,
+		Host:    "devbox",
+		RunId:   "20240506T070809Z-1a2b3c4d",
+		Expires: time.Date(2024, 5, 6, 0, 23, 9, 0, time.FixedZone("PDT", -7*60*60)),
+	})
+	assert.Nil(t, err)
+
+	calls := awsMock.TagResourceCalls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, fleetArn, *calls[0].Params.ResourceARN)
+
+	tags := map[string]string{}
+	for _, tag := range calls[0].Params.Tags {
+		tags[*tag.Key] = *tag.Value
+	}
+	assert.Equal(t, map[string]string{
+		fleetLockTagOwner:   "CORP_alex",
+		fleetLockTagHost:    "devbox",
+		fleetLockTagRunId:   "20240506T070809Z-1a2b3c4d",
+		fleetLockTagExpires: "2024-05-06T07:23:09Z",
+	}, tags)
+}
+
+// TestRemoveFleetLock ensures every lock tag is removed from the fleet
+func TestRemoveFleetLock(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.UntagResourceFunc = func(ctx context.Context, params *gamelift.UntagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.UntagResourceOutput, error) {
+		return &gamelift.UntagResourceOutput{}, nil
+	}
+
+	err := client.RemoveFleetLock(context.Background(), fleetArn)
+	assert.Nil(t, err)
+
+	calls := awsMock.UntagResourceCalls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, fleetArn, *calls[0].Params.ResourceARN)
+	assert.ElementsMatch(t, []string{fleetLockTagOwner, fleetLockTagHost, fleetLockTagRunId, fleetLockTagExpires}, calls[0].Params.TagKeys)
+}
@@ -22,6 +22,9 @@ func NewGameLiftClient(ctx context.Context, logger logging.Logger) (*GameLiftCli
 		return nil, err
 	}
 
+	// Every call to AWS is traced, along with the steps of the update
+	cfg.APIOptions = append(cfg.APIOptions, addTracingMiddleware)
+
 	return &GameLiftClient{gamelift: gamelift.NewFromConfig(cfg)}, nil
 }
 
@@ -31,8 +34,12 @@ func NewGameLiftClient(ctx context.Context, logger logging.Logger) (*GameLiftCli
 type AWSGameliftClient interface {
 	DescribeFleetAttributes(ctx context.Context, params *gamelift.DescribeFleetAttributesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetAttributesOutput, error)
 	DescribeRuntimeConfiguration(ctx context.Context, params *gamelift.DescribeRuntimeConfigurationInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeRuntimeConfigurationOutput, error)
+	DescribeFleetPortSettings(ctx context.Context, params *gamelift.DescribeFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetPortSettingsOutput, error)
 	UpdateFleetPortSettings(ctx context.Context, params *gamelift.UpdateFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.UpdateFleetPortSettingsOutput, error)
 	DescribeFleetLocationAttributes(ctx context.Context, params *gamelift.DescribeFleetLocationAttributesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetLocationAttributesOutput, error)
 	DescribeInstances(ctx context.Context, params *gamelift.DescribeInstancesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeInstancesOutput, error)
 	GetComputeAccess(ctx context.Context, params *gamelift.GetComputeAccessInput, optFns ...func(*gamelift.Options)) (*gamelift.GetComputeAccessOutput, error)
+	ListTagsForResource(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error)
+	TagResource(ctx context.Context, params *gamelift.TagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.TagResourceOutput, error)
+	UntagResource(ctx context.Context, params *gamelift.UntagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.UntagResourceOutput, error)
 }
@@ -15,6 +15,8 @@ import (
 type Fleet struct {
 	// Id of the GameLift fleet
 	Id string
+	// Arn of the GameLift fleet, it is needed to tag the fleet
+	Arn string
 	// OperatingSystem that all instances in the fleet run on
 	OperatingSystem config.OperatingSystem
 	// ExecutablePaths is a slice of all executable paths described by the runtime configuration for this fleet
@@ -55,6 +57,7 @@ func (g *GameLiftClient) GetFleet(ctx context.Context, fleetId string) (*Fleet,
 
 	return &Fleet{
 		Id:              fleetId,
+		Arn:             aws.ToString(fleetAttributesOutput.FleetAttributes[0].FleetArn),
 		OperatingSystem: os,
 		ExecutablePaths: executablePaths,
 	}, nil
@@ -23,7 +23,7 @@ func TestGetFleet(t *testing.T) {
 	awsMock.DescribeFleetAttributesFunc = func(ctx context.Context, params *gamelift.DescribeFleetAttributesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetAttributesOutput, error) {
 		return &gamelift.DescribeFleetAttributesOutput{
 			FleetAttributes: []types.FleetAttributes{
-				types.FleetAttributes{OperatingSystem: types.OperatingSystemAmazonLinux},
+				types.FleetAttributes{FleetArn: aws.String(fleetArn), OperatingSystem: types.OperatingSystemAmazonLinux},
 			},
 		}, nil
 	}
@@ -53,6 +53,7 @@ func TestGetFleet(t *testing.T) {
 	assert.Equal(t, fleetId, *describeRuntimeCalls[0].Params.FleetId)
 
 	assert.Equal(t, fleetId, fleet.Id)
+	assert.Equal(t, fleetArn, fleet.Arn)
 	assert.Equal(t, config.OperatingSystemLinux, fleet.OperatingSystem)
 	assert.Len(t, fleet.ExecutablePaths, 2)
 	assert.Contains(t, fleet.ExecutablePaths, expectedExeOne)
@@ -97,7 +98,7 @@ func TestGetFleetRuntimeLookupError(t *testing.T) {
 	awsMock.DescribeFleetAttributesFunc = func(ctx context.Context, params *gamelift.DescribeFleetAttributesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetAttributesOutput, error) {
 		return &gamelift.DescribeFleetAttributesOutput{
 			FleetAttributes: []types.FleetAttributes{
-				types.FleetAttributes{OperatingSystem: types.OperatingSystemAmazonLinux},
+				types.FleetAttributes{FleetArn: aws.String(fleetArn), OperatingSystem: types.OperatingSystemAmazonLinux},
 			},
 		}, nil
 	}
@@ -0,0 +1,51 @@
+package gamelift
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift"
+)
+
+// InboundPermission represents a single inbound port permission on a GameLift fleet
+type InboundPermission struct {
+	// FromPort the first port in the range of ports allowed
+	FromPort int32
+	// ToPort the last port in the range of ports allowed
+	ToPort int32
+	// IpRange the range of IP addresses (in CIDR notation) allowed access
+	IpRange string
+	// Protocol the network protocol allowed (TCP or UDP)
+	Protocol string
+}
+
+// String returns a friendly version of the InboundPermission
+func (i *InboundPermission) String() string {
+	if i.FromPort == i.ToPort {
+		return fmt.Sprintf("%s %d %s", i.Protocol, i.FromPort, i.IpRange)
+	}
+	return fmt.Sprintf("%s %d-%d %s", i.Protocol, i.FromPort, i.ToPort, i.IpRange)
+}
+
+// GetInboundPermissions will return all inbound port permissions currently set on the provided fleet
+func (g *GameLiftClient) GetInboundPermissions(ctx context.Context, fleetId string) ([]*InboundPermission, error) {
+	portSettingsOutput, err := g.gamelift.DescribeFleetPortSettings(ctx, &gamelift.DescribeFleetPortSettingsInput{
+		FleetId: aws.String(fleetId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing fleet port settings: %w", err)
+	}
+
+	result := make([]*InboundPermission, 0, len(portSettingsOutput.InboundPermissions))
+	for _, permission := range portSettingsOutput.InboundPermissions {
+		result = append(result, &InboundPermission{
+			FromPort: aws.ToInt32(permission.FromPort),
+			ToPort:   aws.ToInt32(permission.ToPort),
+			IpRange:  aws.ToString(permission.IpRange),
+			Protocol: string(permission.Protocol),
+		})
+	}
+
+	return result, nil
+}
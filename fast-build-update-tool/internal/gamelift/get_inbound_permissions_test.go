@@ -0,0 +1,51 @@
+package gamelift
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGetInboundPermissions ensures we properly convert the port settings returned by GameLift
+func TestGetInboundPermissions(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.DescribeFleetPortSettingsFunc = func(ctx context.Context, params *gamelift.DescribeFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetPortSettingsOutput, error) {
+		return &gamelift.DescribeFleetPortSettingsOutput{
+			InboundPermissions: []types.IpPermission{
+				types.IpPermission{FromPort: aws.Int32(22), ToPort: aws.Int32(22), IpRange: aws.String("127.0.0.1/32"), Protocol: types.IpProtocolTcp},
+				types.IpPermission{FromPort: aws.Int32(7770), ToPort: aws.Int32(7780), IpRange: aws.String("0.0.0.0/0"), Protocol: types.IpProtocolUdp},
+			},
+		}, nil
+	}
+
+	permissions, err := client.GetInboundPermissions(context.Background(), fleetId)
+	assert.Nil(t, err)
+
+	calls := awsMock.DescribeFleetPortSettingsCalls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, fleetId, *calls[0].Params.FleetId)
+
+	assert.Len(t, permissions, 2)
+	assert.Equal(t, "TCP 22 127.0.0.1/32", permissions[0].String())
+	assert.Equal(t, "UDP 7770-7780 0.0.0.0/0", permissions[1].String())
+}
+
+// TestGetInboundPermissionsError ensures we return any errors from GameLift
+func TestGetInboundPermissionsError(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.DescribeFleetPortSettingsFunc = func(ctx context.Context, params *gamelift.DescribeFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetPortSettingsOutput, error) {
+		return nil, errors.New("test error")
+	}
+
+	_, err := client.GetInboundPermissions(context.Background(), fleetId)
+	assert.ErrorContains(t, err, "test error")
+}
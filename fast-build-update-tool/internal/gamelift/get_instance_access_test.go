@@ -16,6 +16,7 @@ var (
 	sessionToken    = "sessionToken"
 	instanceId      = "i-12345"
 	fleetId         = "fleet-6789"
+	fleetArn        = "arn:aws:gamelift:us-west-2:123456789012:fleet/fleet-6789"
 )
 
 // TestGetInstanceAccessSuccess verifies that GetComputeAccess is called with the proper inputs, and returns the proper data
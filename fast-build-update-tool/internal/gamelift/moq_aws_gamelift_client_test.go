@@ -21,6 +21,9 @@ import (
 //			DescribeFleetLocationAttributesFunc: func(ctx context.Context, params *gamelift.DescribeFleetLocationAttributesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetLocationAttributesOutput, error) {
 //				panic("mock out the DescribeFleetLocationAttributes method")
 //			},
+//			DescribeFleetPortSettingsFunc: func(ctx context.Context, params *gamelift.DescribeFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetPortSettingsOutput, error) {
+//				panic("mock out the DescribeFleetPortSettings method")
+//			},
 //			DescribeInstancesFunc: func(ctx context.Context, params *gamelift.DescribeInstancesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeInstancesOutput, error) {
 //				panic("mock out the DescribeInstances method")
 //			},
@@ -30,6 +33,15 @@ import (
 //			GetComputeAccessFunc: func(ctx context.Context, params *gamelift.GetComputeAccessInput, optFns ...func(*gamelift.Options)) (*gamelift.GetComputeAccessOutput, error) {
 //				panic("mock out the GetComputeAccess method")
 //			},
+//			ListTagsForResourceFunc: func(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error) {
+//				panic("mock out the ListTagsForResource method")
+//			},
+//			TagResourceFunc: func(ctx context.Context, params *gamelift.TagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.TagResourceOutput, error) {
+//				panic("mock out the TagResource method")
+//			},
+//			UntagResourceFunc: func(ctx context.Context, params *gamelift.UntagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.UntagResourceOutput, error) {
+//				panic("mock out the UntagResource method")
+//			},
 //			UpdateFleetPortSettingsFunc: func(ctx context.Context, params *gamelift.UpdateFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.UpdateFleetPortSettingsOutput, error) {
 //				panic("mock out the UpdateFleetPortSettings method")
 //			},
@@ -46,6 +58,9 @@ type AWSGameliftClientMock struct {
 	// DescribeFleetLocationAttributesFunc mocks the DescribeFleetLocationAttributes method.
 	DescribeFleetLocationAttributesFunc func(ctx context.Context, params *gamelift.DescribeFleetLocationAttributesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetLocationAttributesOutput, error)
 
+	// DescribeFleetPortSettingsFunc mocks the DescribeFleetPortSettings method.
+	DescribeFleetPortSettingsFunc func(ctx context.Context, params *gamelift.DescribeFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetPortSettingsOutput, error)
+
 	// DescribeInstancesFunc mocks the DescribeInstances method.
 	DescribeInstancesFunc func(ctx context.Context, params *gamelift.DescribeInstancesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeInstancesOutput, error)
 
@@ -55,6 +70,15 @@ type AWSGameliftClientMock struct {
 	// GetComputeAccessFunc mocks the GetComputeAccess method.
 	GetComputeAccessFunc func(ctx context.Context, params *gamelift.GetComputeAccessInput, optFns ...func(*gamelift.Options)) (*gamelift.GetComputeAccessOutput, error)
 
+	// ListTagsForResourceFunc mocks the ListTagsForResource method.
+	ListTagsForResourceFunc func(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error)
+
+	// TagResourceFunc mocks the TagResource method.
+	TagResourceFunc func(ctx context.Context, params *gamelift.TagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.TagResourceOutput, error)
+
+	// UntagResourceFunc mocks the UntagResource method.
+	UntagResourceFunc func(ctx context.Context, params *gamelift.UntagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.UntagResourceOutput, error)
+
 	// UpdateFleetPortSettingsFunc mocks the UpdateFleetPortSettings method.
 	UpdateFleetPortSettingsFunc func(ctx context.Context, params *gamelift.UpdateFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.UpdateFleetPortSettingsOutput, error)
 
@@ -78,6 +102,15 @@ type AWSGameliftClientMock struct {
 			// OptFns is the optFns argument value.
 			OptFns []func(*gamelift.Options)
 		}
+		// DescribeFleetPortSettings holds details about calls to the DescribeFleetPortSettings method.
+		DescribeFleetPortSettings []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *gamelift.DescribeFleetPortSettingsInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*gamelift.Options)
+		}
 		// DescribeInstances holds details about calls to the DescribeInstances method.
 		DescribeInstances []struct {
 			// Ctx is the ctx argument value.
@@ -105,6 +138,33 @@ type AWSGameliftClientMock struct {
 			// OptFns is the optFns argument value.
 			OptFns []func(*gamelift.Options)
 		}
+		// ListTagsForResource holds details about calls to the ListTagsForResource method.
+		ListTagsForResource []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *gamelift.ListTagsForResourceInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*gamelift.Options)
+		}
+		// TagResource holds details about calls to the TagResource method.
+		TagResource []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *gamelift.TagResourceInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*gamelift.Options)
+		}
+		// UntagResource holds details about calls to the UntagResource method.
+		UntagResource []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *gamelift.UntagResourceInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*gamelift.Options)
+		}
 		// UpdateFleetPortSettings holds details about calls to the UpdateFleetPortSettings method.
 		UpdateFleetPortSettings []struct {
 			// Ctx is the ctx argument value.
@@ -117,9 +177,13 @@ type AWSGameliftClientMock struct {
 	}
 	lockDescribeFleetAttributes         sync.RWMutex
 	lockDescribeFleetLocationAttributes sync.RWMutex
+	lockDescribeFleetPortSettings       sync.RWMutex
 	lockDescribeInstances               sync.RWMutex
 	lockDescribeRuntimeConfiguration    sync.RWMutex
 	lockGetComputeAccess                sync.RWMutex
+	lockListTagsForResource             sync.RWMutex
+	lockTagResource                     sync.RWMutex
+	lockUntagResource                   sync.RWMutex
 	lockUpdateFleetPortSettings         sync.RWMutex
 }
 
@@ -203,6 +267,46 @@ func (mock *AWSGameliftClientMock) DescribeFleetLocationAttributesCalls() []stru
 	return calls
 }
 
+// DescribeFleetPortSettings calls DescribeFleetPortSettingsFunc.
+func (mock *AWSGameliftClientMock) DescribeFleetPortSettings(ctx context.Context, params *gamelift.DescribeFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeFleetPortSettingsOutput, error) {
+	if mock.DescribeFleetPortSettingsFunc == nil {
+		panic("AWSGameliftClientMock.DescribeFleetPortSettingsFunc: method is nil but AWSGameliftClient.DescribeFleetPortSettings was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *gamelift.DescribeFleetPortSettingsInput
+		OptFns []func(*gamelift.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockDescribeFleetPortSettings.Lock()
+	mock.calls.DescribeFleetPortSettings = append(mock.calls.DescribeFleetPortSettings, callInfo)
+	mock.lockDescribeFleetPortSettings.Unlock()
+	return mock.DescribeFleetPortSettingsFunc(ctx, params, optFns...)
+}
+
+// DescribeFleetPortSettingsCalls gets all the calls that were made to DescribeFleetPortSettings.
+// Check the length with:
+//
+//	len(mockedAWSGameliftClient.DescribeFleetPortSettingsCalls())
+func (mock *AWSGameliftClientMock) DescribeFleetPortSettingsCalls() []struct {
+	Ctx    context.Context
+	Params *gamelift.DescribeFleetPortSettingsInput
+	OptFns []func(*gamelift.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *gamelift.DescribeFleetPortSettingsInput
+		OptFns []func(*gamelift.Options)
+	}
+	mock.lockDescribeFleetPortSettings.RLock()
+	calls = mock.calls.DescribeFleetPortSettings
+	mock.lockDescribeFleetPortSettings.RUnlock()
+	return calls
+}
+
 // DescribeInstances calls DescribeInstancesFunc.
 func (mock *AWSGameliftClientMock) DescribeInstances(ctx context.Context, params *gamelift.DescribeInstancesInput, optFns ...func(*gamelift.Options)) (*gamelift.DescribeInstancesOutput, error) {
 	if mock.DescribeInstancesFunc == nil {
@@ -323,6 +427,126 @@ func (mock *AWSGameliftClientMock) GetComputeAccessCalls() []struct {
 	return calls
 }
 
+// ListTagsForResource calls ListTagsForResourceFunc.
+func (mock *AWSGameliftClientMock) ListTagsForResource(ctx context.Context, params *gamelift.ListTagsForResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.ListTagsForResourceOutput, error) {
+	if mock.ListTagsForResourceFunc == nil {
+		panic("AWSGameliftClientMock.ListTagsForResourceFunc: method is nil but AWSGameliftClient.ListTagsForResource was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *gamelift.ListTagsForResourceInput
+		OptFns []func(*gamelift.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockListTagsForResource.Lock()
+	mock.calls.ListTagsForResource = append(mock.calls.ListTagsForResource, callInfo)
+	mock.lockListTagsForResource.Unlock()
+	return mock.ListTagsForResourceFunc(ctx, params, optFns...)
+}
+
+// ListTagsForResourceCalls gets all the calls that were made to ListTagsForResource.
+// Check the length with:
+//
+//	len(mockedAWSGameliftClient.ListTagsForResourceCalls())
+func (mock *AWSGameliftClientMock) ListTagsForResourceCalls() []struct {
+	Ctx    context.Context
+	Params *gamelift.ListTagsForResourceInput
+	OptFns []func(*gamelift.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *gamelift.ListTagsForResourceInput
+		OptFns []func(*gamelift.Options)
+	}
+	mock.lockListTagsForResource.RLock()
+	calls = mock.calls.ListTagsForResource
+	mock.lockListTagsForResource.RUnlock()
+	return calls
+}
+
+// TagResource calls TagResourceFunc.
+func (mock *AWSGameliftClientMock) TagResource(ctx context.Context, params *gamelift.TagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.TagResourceOutput, error) {
+	if mock.TagResourceFunc == nil {
+		panic("AWSGameliftClientMock.TagResourceFunc: method is nil but AWSGameliftClient.TagResource was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *gamelift.TagResourceInput
+		OptFns []func(*gamelift.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockTagResource.Lock()
+	mock.calls.TagResource = append(mock.calls.TagResource, callInfo)
+	mock.lockTagResource.Unlock()
+	return mock.TagResourceFunc(ctx, params, optFns...)
+}
+
+// TagResourceCalls gets all the calls that were made to TagResource.
+// Check the length with:
+//
+//	len(mockedAWSGameliftClient.TagResourceCalls())
+func (mock *AWSGameliftClientMock) TagResourceCalls() []struct {
+	Ctx    context.Context
+	Params *gamelift.TagResourceInput
+	OptFns []func(*gamelift.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *gamelift.TagResourceInput
+		OptFns []func(*gamelift.Options)
+	}
+	mock.lockTagResource.RLock()
+	calls = mock.calls.TagResource
+	mock.lockTagResource.RUnlock()
+	return calls
+}
+
+// UntagResource calls UntagResourceFunc.
+func (mock *AWSGameliftClientMock) UntagResource(ctx context.Context, params *gamelift.UntagResourceInput, optFns ...func(*gamelift.Options)) (*gamelift.UntagResourceOutput, error) {
+	if mock.UntagResourceFunc == nil {
+		panic("AWSGameliftClientMock.UntagResourceFunc: method is nil but AWSGameliftClient.UntagResource was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *gamelift.UntagResourceInput
+		OptFns []func(*gamelift.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockUntagResource.Lock()
+	mock.calls.UntagResource = append(mock.calls.UntagResource, callInfo)
+	mock.lockUntagResource.Unlock()
+	return mock.UntagResourceFunc(ctx, params, optFns...)
+}
+
+// UntagResourceCalls gets all the calls that were made to UntagResource.
+// Check the length with:
+//
+//	len(mockedAWSGameliftClient.UntagResourceCalls())
+func (mock *AWSGameliftClientMock) UntagResourceCalls() []struct {
+	Ctx    context.Context
+	Params *gamelift.UntagResourceInput
+	OptFns []func(*gamelift.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *gamelift.UntagResourceInput
+		OptFns []func(*gamelift.Options)
+	}
+	mock.lockUntagResource.RLock()
+	calls = mock.calls.UntagResource
+	mock.lockUntagResource.RUnlock()
+	return calls
+}
+
 // UpdateFleetPortSettings calls UpdateFleetPortSettingsFunc.
 func (mock *AWSGameliftClientMock) UpdateFleetPortSettings(ctx context.Context, params *gamelift.UpdateFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.UpdateFleetPortSettingsOutput, error) {
 	if mock.UpdateFleetPortSettingsFunc == nil {
@@ -10,29 +10,83 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/gamelift/types"
 )
 
-// OpenPortForFleet will open the provided port for the range of IPs provided
-func (g *GameLiftClient) OpenPortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) error {
+// OpenPortForFleet will open the provided port for the range of IPs provided.
+// The bool returned is true only if this call added the permission, and false if the permission already existed on the fleet.
+func (g *GameLiftClient) OpenPortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
 	_, err := g.gamelift.UpdateFleetPortSettings(ctx, &gamelift.UpdateFleetPortSettingsInput{
 		FleetId: aws.String(fleetId),
 		InboundPermissionAuthorizations: []types.IpPermission{
-			types.IpPermission{
-				FromPort: aws.Int32(port),
-				IpRange:  aws.String(ipRange),
-				Protocol: types.IpProtocolTcp,
-				ToPort:   aws.Int32(port),
-			},
+			tcpPermission(port, ipRange),
 		},
 	})
 
 	// If we have already opened this port on this fleet, there is no reason to return an error
+	if isInvalidRequest(err, "InvalidPermission.Duplicate") {
+		return false, nil
+	}
+
 	if err != nil {
-		ire := new(types.InvalidRequestException)
-		if errors.As(err, &ire) {
-			if strings.Contains(ire.ErrorMessage(), "InvalidPermission.Duplicate") {
-				err = nil
-			}
-		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ClosePortForFleet will revoke access to the provided port for the range of IPs provided
+func (g *GameLiftClient) ClosePortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) error {
+	return g.RevokeInboundPermissions(ctx, fleetId, []*InboundPermission{
+		&InboundPermission{FromPort: port, ToPort: port, IpRange: ipRange, Protocol: string(types.IpProtocolTcp)},
+	})
+}
+
+// RevokeInboundPermissions will remove all of the provided inbound permissions from the fleet
+func (g *GameLiftClient) RevokeInboundPermissions(ctx context.Context, fleetId string, permissions []*InboundPermission) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	revocations := make([]types.IpPermission, 0, len(permissions))
+	for _, permission := range permissions {
+		revocations = append(revocations, types.IpPermission{
+			FromPort: aws.Int32(permission.FromPort),
+			IpRange:  aws.String(permission.IpRange),
+			Protocol: types.IpProtocol(permission.Protocol),
+			ToPort:   aws.Int32(permission.ToPort),
+		})
+	}
+
+	_, err := g.gamelift.UpdateFleetPortSettings(ctx, &gamelift.UpdateFleetPortSettingsInput{
+		FleetId:                      aws.String(fleetId),
+		InboundPermissionRevocations: revocations,
+	})
+
+	// If the permission has already been removed from this fleet, there is no reason to return an error
+	if isInvalidRequest(err, "InvalidPermission.NotFound") {
+		return nil
 	}
 
 	return err
 }
+
+func tcpPermission(port int32, ipRange string) types.IpPermission {
+	return types.IpPermission{
+		FromPort: aws.Int32(port),
+		IpRange:  aws.String(ipRange),
+		Protocol: types.IpProtocolTcp,
+		ToPort:   aws.Int32(port),
+	}
+}
+
+// isInvalidRequest returns true if err is an InvalidRequestException containing the provided message
+func isInvalidRequest(err error, message string) bool {
+	if err == nil {
+		return false
+	}
+
+	ire := new(types.InvalidRequestException)
+	if errors.As(err, &ire) {
+		return strings.Contains(ire.ErrorMessage(), message)
+	}
+
+	return false
+}
@@ -22,9 +22,10 @@ func TestOpenPortForFleet(t *testing.T) {
 		return nil, nil
 	}
 
-	err := client.OpenPortForFleet(context.Background(), fleetId, port, ipRange)
+	opened, err := client.OpenPortForFleet(context.Background(), fleetId, port, ipRange)
 
 	assert.Nil(t, err)
+	assert.True(t, opened)
 
 	calls := awsMock.UpdateFleetPortSettingsCalls()
 	assert.Len(t, calls, 1)
@@ -43,9 +44,63 @@ func TestOpenPortForFleetHandleDuplicateError(t *testing.T) {
 		return nil, &types.InvalidRequestException{Message: aws.String("InvalidPermission.Duplicate error")}
 	}
 
-	err := client.OpenPortForFleet(context.Background(), fleetId, 1026, "127.0.0.1/32")
+	opened, err := client.OpenPortForFleet(context.Background(), fleetId, 1026, "127.0.0.1/32")
 
-	// Ensure we don't forward this error
+	// Ensure we don't forward this error, and report that this call did not add the permission
 	assert.Nil(t, err)
+	assert.False(t, opened)
 	assert.Len(t, awsMock.UpdateFleetPortSettingsCalls(), 1)
 }
+
+// TestClosePortForFleet ensures we call UpdateFleetPortSettingsFunc with the proper revocation params
+func TestClosePortForFleet(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	port := int32(22)
+	ipRange := "127.0.0.1/32"
+
+	awsMock.UpdateFleetPortSettingsFunc = func(ctx context.Context, params *gamelift.UpdateFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.UpdateFleetPortSettingsOutput, error) {
+		return nil, nil
+	}
+
+	err := client.ClosePortForFleet(context.Background(), fleetId, port, ipRange)
+
+	assert.Nil(t, err)
+
+	calls := awsMock.UpdateFleetPortSettingsCalls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, fleetId, *calls[0].Params.FleetId)
+	assert.Empty(t, calls[0].Params.InboundPermissionAuthorizations)
+	assert.Len(t, calls[0].Params.InboundPermissionRevocations, 1)
+	assert.Equal(t, ipRange, *calls[0].Params.InboundPermissionRevocations[0].IpRange)
+	assert.Equal(t, port, *calls[0].Params.InboundPermissionRevocations[0].FromPort)
+	assert.Equal(t, port, *calls[0].Params.InboundPermissionRevocations[0].ToPort)
+	assert.Equal(t, types.IpProtocolTcp, calls[0].Params.InboundPermissionRevocations[0].Protocol)
+}
+
+// TestClosePortForFleetHandleNotFoundError ensures that we don't error when a port has already been closed on a fleet
+func TestClosePortForFleetHandleNotFoundError(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	awsMock.UpdateFleetPortSettingsFunc = func(ctx context.Context, params *gamelift.UpdateFleetPortSettingsInput, optFns ...func(*gamelift.Options)) (*gamelift.UpdateFleetPortSettingsOutput, error) {
+		return nil, &types.InvalidRequestException{Message: aws.String("InvalidPermission.NotFound error")}
+	}
+
+	err := client.ClosePortForFleet(context.Background(), fleetId, 22, "127.0.0.1/32")
+
+	assert.Nil(t, err)
+	assert.Len(t, awsMock.UpdateFleetPortSettingsCalls(), 1)
+}
+
+// TestRevokeInboundPermissionsEmpty ensures we don't call GameLift when there is nothing to revoke
+func TestRevokeInboundPermissionsEmpty(t *testing.T) {
+	awsMock := &AWSGameliftClientMock{}
+	client := &GameLiftClient{gamelift: awsMock}
+
+	err := client.RevokeInboundPermissions(context.Background(), fleetId, []*InboundPermission{})
+
+	assert.Nil(t, err)
+	assert.Len(t, awsMock.UpdateFleetPortSettingsCalls(), 0)
+}
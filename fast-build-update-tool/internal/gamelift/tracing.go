@@ -0,0 +1,26 @@
+package gamelift
+
+import (
+	"context"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// addTracingMiddleware adds a middleware to the AWS SDK that starts a span for every call to AWS, named after the service and operation (eg. GameLift.DescribeInstances)
+func addTracingMiddleware(stack *middleware.Stack) error {
+	// The service and operation are only known once the service metadata was registered, which is done before any API options are added
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Tracing", handleTracing), middleware.After)
+}
+
+func handleTracing(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (out middleware.InitializeOutput, metadata middleware.Metadata, err error) {
+	ctx, span := config.Tracer().Start(ctx, awsmiddleware.GetServiceID(ctx)+"."+awsmiddleware.GetOperationName(ctx),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(config.AttributeRegion.String(awsmiddleware.GetRegion(ctx))),
+	)
+	defer func() { config.EndSpan(span, err) }()
+
+	return next.HandleInitialize(ctx, in)
+}
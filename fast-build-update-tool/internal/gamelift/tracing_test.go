@@ -0,0 +1,64 @@
+package gamelift
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracingMiddleware ensures a span is recorded for each call to AWS, and calls that fail are marked as failed
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{}`))
+		} else {
+			w.Write([]byte(`{"__type":"NotFoundException","message":"fleet not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := gamelift.NewFromConfig(aws.Config{
+		Region:           "us-west-2",
+		Credentials:      aws.AnonymousCredentials{},
+		BaseEndpoint:     aws.String(server.URL),
+		RetryMaxAttempts: 1,
+		APIOptions:       []func(*middleware.Stack) error{addTracingMiddleware},
+	})
+
+	_, err := client.DescribeFleetAttributes(context.Background(), &gamelift.DescribeFleetAttributesInput{})
+	assert.Nil(t, err)
+
+	status = http.StatusBadRequest
+	_, err = client.DescribeInstances(context.Background(), &gamelift.DescribeInstancesInput{FleetId: aws.String("fleet-1234")})
+	assert.NotNil(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, "GameLift.DescribeFleetAttributes", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, config.AttributeRegion.String("us-west-2"))
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+
+	assert.Equal(t, "GameLift.DescribeInstances", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Contains(t, spans[1].Status.Description, "NotFoundException")
+}
@@ -0,0 +1,615 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/pterm/pterm"
+	"golang.org/x/term"
+)
+
+const (
+	// dashboardRefreshInterval is how often the dashboard is drawn
+	dashboardRefreshInterval = 250 * time.Millisecond
+	// maxDashboardLogLines is the number of log lines kept for each instance, the oldest lines are dropped first
+	maxDashboardLogLines = 500
+	// defaultDashboardWidth and defaultDashboardHeight are used when the size of the terminal can't be read
+	defaultDashboardWidth  = 80
+	defaultDashboardHeight = 24
+	// stateColumnWidth fits the longest state, "failed while restarting server processes"
+	stateColumnWidth = 40
+)
+
+// Escape sequences used to take over the whole terminal while the dashboard is shown
+const (
+	enterAlternateScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAlternateScreen = "\x1b[?25h\x1b[?1049l"
+	cursorHome           = "\x1b[H"
+	clearLine            = "\x1b[K"
+	clearToEnd           = "\x1b[J"
+)
+
+// Keys read from the terminal, arrow keys are sent as escape sequences
+const (
+	keyUp     = "\x1b[A"
+	keyDown   = "\x1b[B"
+	keyEscape = "\x1b"
+	keyCtrlC  = "\x03"
+)
+
+type dashboardStatus int
+
+const (
+	dashboardStatusQueued dashboardStatus = iota
+	dashboardStatusRunning
+	dashboardStatusSucceeded
+	dashboardStatusFailed
+	dashboardStatusCanceled
+)
+
+// Dashboard is a full screen view of every instance in a fleet update. It shows the state, elapsed time, bytes uploaded, and last log line of each instance.
+// From the keyboard the user can show the log of an instance, retry failed instances, or cancel the instances that have not been started.
+type Dashboard struct {
+	// mutex is held while reading or changing the state of the dashboard, it is changed by the instance being updated, the keyboard, and the fleet updater
+	mutex     sync.Mutex
+	fleetId   string
+	instances []*dashboardInstance
+	selected  int
+	showLog   bool
+
+	// retries holds the instances the user asked to retry, until the fleet updater takes them
+	retries []string
+	// quit is set once the user asked to stop, no more instances are started or retried
+	quit bool
+	// waiting is set while the fleet updater waits for the user to retry failed instances or quit, the choice is sent to decision
+	waiting  bool
+	decision chan bool
+
+	input         *os.File
+	output        *os.File
+	terminalState *term.State
+	stop          chan struct{}
+	stopped       chan struct{}
+
+	// logs holds anything written by the application logger while the dashboard is shown, it is printed once the dashboard is stopped
+	logs         *lockedBuffer
+	loggerWriter io.Writer
+}
+
+// DashboardSupported returns true when stdin and stdout are both terminals, the dashboard can't be shown otherwise
+func DashboardSupported() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// NewDashboard builds a new dashboard for the fleet, it is not shown until Start is called
+func NewDashboard(fleetId string) *Dashboard {
+	return &Dashboard{
+		fleetId:  fleetId,
+		decision: make(chan bool, 1),
+		input:    os.Stdin,
+		output:   os.Stdout,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		logs:     &lockedBuffer{},
+	}
+}
+
+// Start takes over the terminal, and shows the dashboard for instances until Stop is called
+func (d *Dashboard) Start(instances []*gamelift.Instance) error {
+	d.addInstances(instances)
+
+	state, err := term.MakeRaw(int(d.input.Fd()))
+	if err != nil {
+		return fmt.Errorf("error starting dashboard: %w", err)
+	}
+	d.terminalState = state
+
+	// Anything logged while the dashboard is shown would be drawn over, so it is held until the dashboard is stopped
+	d.loggerWriter = pterm.DefaultLogger.Writer
+	pterm.DefaultLogger.Writer = d.logs
+
+	fmt.Fprint(d.output, enterAlternateScreen)
+
+	go d.readKeys()
+	go d.drawUntilStopped()
+
+	return nil
+}
+
+// Stop gives the terminal back, and prints anything that was logged while the dashboard was shown
+func (d *Dashboard) Stop() {
+	close(d.stop)
+	<-d.stopped
+
+	fmt.Fprint(d.output, leaveAlternateScreen)
+	if err := term.Restore(int(d.input.Fd()), d.terminalState); err != nil {
+		fmt.Fprintln(d.output, "error restoring terminal: ", err)
+	}
+
+	pterm.DefaultLogger.Writer = d.loggerWriter
+	d.output.Write(d.logs.Bytes())
+}
+
+// Canceled returns true if the user canceled the instance before it was started
+func (d *Dashboard) Canceled(instanceId string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.instance(instanceId).status == dashboardStatusCanceled
+}
+
+// TakeRetries returns the instances the user asked to retry since it was last called
+func (d *Dashboard) TakeRetries() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	retries := d.retries
+	d.retries = nil
+	return retries
+}
+
+// WaitForRetries is called once every instance is done. If any of them failed, it waits for the user to retry them or quit.
+// It returns the instances to retry, it is empty once the user is done.
+func (d *Dashboard) WaitForRetries(ctx context.Context) []string {
+	d.mutex.Lock()
+	if d.quit || d.count(dashboardStatusFailed) == 0 {
+		d.mutex.Unlock()
+		return nil
+	}
+	d.waiting = true
+	d.mutex.Unlock()
+
+	select {
+	case retry := <-d.decision:
+		if retry {
+			return d.TakeRetries()
+		}
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (d *Dashboard) addInstances(instances []*gamelift.Instance) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, instance := range instances {
+		d.instances = append(d.instances, &dashboardInstance{
+			dashboard:  d,
+			instanceId: instance.InstanceId,
+			ipAddress:  instance.IpAddress,
+		})
+	}
+}
+
+// instance returns the row for instanceId, it must be called with the mutex held
+func (d *Dashboard) instance(instanceId string) *dashboardInstance {
+	for _, instance := range d.instances {
+		if instance.instanceId == instanceId {
+			return instance
+		}
+	}
+
+	instance := &dashboardInstance{dashboard: d, instanceId: instanceId}
+	d.instances = append(d.instances, instance)
+	return instance
+}
+
+// instanceRow returns the row shown for an instance, its progress is written to it as the instance is updated
+func (d *Dashboard) instanceRow(instance *gamelift.Instance) *dashboardInstance {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	row := d.instance(instance.InstanceId)
+	row.ipAddress = instance.IpAddress
+	return row
+}
+
+// readKeys handles the keys pressed by the user until the dashboard is stopped.
+// The last read is only returned after the next key press, that key is dropped.
+func (d *Dashboard) readKeys() {
+	buffer := make([]byte, 64)
+	for {
+		n, err := d.input.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-d.stop:
+			return
+		default:
+			d.handleKeys(buffer[:n])
+		}
+	}
+}
+
+// handleKeys handles the keys in input, each key is a single byte, or an escape sequence for the arrow keys
+func (d *Dashboard) handleKeys(input []byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for len(input) > 0 {
+		key := input[:1]
+		if len(input) >= 3 && input[0] == keyEscape[0] && input[1] == '[' {
+			key = input[:3]
+		}
+		input = input[len(key):]
+
+		d.handleKey(string(key))
+	}
+}
+
+// handleKey handles a single key, it must be called with the mutex held
+func (d *Dashboard) handleKey(key string) {
+	switch key {
+	case keyUp, "k":
+		d.selected = max(d.selected-1, 0)
+	case keyDown, "j":
+		d.selected = min(d.selected+1, len(d.instances)-1)
+	case "\r", "\n", "l":
+		d.showLog = true
+	case keyEscape, "h", "\x7f":
+		d.showLog = false
+	case "r":
+		d.retryFailed()
+	case "c":
+		d.cancelQueued()
+	case "q", keyCtrlC:
+		d.quit = true
+		d.cancelQueued()
+		d.decide(false)
+	}
+}
+
+// retryFailed queues every failed instance to be updated again
+func (d *Dashboard) retryFailed() {
+	if d.quit {
+		return
+	}
+
+	for _, instance := range d.instances {
+		if instance.status == dashboardStatusFailed {
+			instance.status = dashboardStatusQueued
+			instance.addLine("queued to retry")
+			d.retries = append(d.retries, instance.instanceId)
+		}
+	}
+
+	if len(d.retries) > 0 {
+		d.decide(true)
+	}
+}
+
+// cancelQueued cancels every instance that has not been started
+func (d *Dashboard) cancelQueued() {
+	for _, instance := range d.instances {
+		if instance.status == dashboardStatusQueued {
+			instance.status = dashboardStatusCanceled
+			instance.addLine("canceled")
+		}
+	}
+	d.retries = nil
+}
+
+// decide sends the choice of the user to WaitForRetries, if it is waiting for one
+func (d *Dashboard) decide(retry bool) {
+	if !d.waiting {
+		return
+	}
+
+	d.waiting = false
+	d.decision <- retry
+}
+
+func (d *Dashboard) drawUntilStopped() {
+	defer close(d.stopped)
+
+	ticker := time.NewTicker(dashboardRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		d.draw()
+
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dashboard) draw() {
+	width, height, err := term.GetSize(int(d.output.Fd()))
+	if err != nil {
+		width, height = defaultDashboardWidth, defaultDashboardHeight
+	}
+
+	d.mutex.Lock()
+	lines := d.render(width, height, time.Now())
+	d.mutex.Unlock()
+
+	// The terminal is in raw mode, so each line has to return to the start of the line itself
+	fmt.Fprint(d.output, cursorHome+strings.Join(lines, clearLine+"\r\n")+clearLine+clearToEnd)
+}
+
+// render returns each line of the dashboard, it must be called with the mutex held
+func (d *Dashboard) render(width, height int, now time.Time) []string {
+	if d.showLog && len(d.instances) > 0 {
+		return d.renderLog(d.instances[d.selected], width, height)
+	}
+
+	lines := []string{
+		truncate(fmt.Sprintf("Updating fleet %s: %d updated, %d failed, %d running, %d queued, %d canceled", d.fleetId,
+			d.count(dashboardStatusSucceeded), d.count(dashboardStatusFailed), d.count(dashboardStatusRunning),
+			d.count(dashboardStatusQueued), d.count(dashboardStatusCanceled)), width),
+		"",
+	}
+
+	idWidth := len("INSTANCE")
+	ipWidth := len("IP ADDRESS")
+	for _, instance := range d.instances {
+		idWidth = max(idWidth, len(instance.instanceId))
+		ipWidth = max(ipWidth, len(instance.ipAddress))
+	}
+	rowFormat := fmt.Sprintf("%%s %%-%ds  %%-%ds  %%-%ds  %%8s  %%10s  %%s", idWidth, ipWidth, stateColumnWidth)
+	lines = append(lines, truncate(fmt.Sprintf(rowFormat, " ", "INSTANCE", "IP ADDRESS", "STATE", "ELAPSED", "UPLOADED", "LAST LINE"), width))
+
+	// Scroll so the selected instance is always shown, leaving room for the header and the help at the bottom
+	visibleRows := max(height-len(lines)-2, 1)
+	first := max(d.selected-visibleRows+1, 0)
+	last := min(first+visibleRows, len(d.instances))
+
+	for index, instance := range d.instances[first:last] {
+		selected := " "
+		if first+index == d.selected {
+			selected = ">"
+		}
+
+		row := truncate(fmt.Sprintf(rowFormat, selected, instance.instanceId, instance.ipAddress,
+			truncate(instance.stateString(), stateColumnWidth), instance.elapsed(now), instance.uploaded(), instance.lastLine()), width)
+		lines = append(lines, instance.status.color().Sprint(row))
+	}
+
+	return append(lines, "", truncate(d.help(), width))
+}
+
+// renderLog returns each line of the log view for instance, it must be called with the mutex held
+func (d *Dashboard) renderLog(instance *dashboardInstance, width, height int) []string {
+	lines := []string{
+		truncate(fmt.Sprintf("Log for %s (%s): %s", instance.instanceId, instance.ipAddress, instance.stateString()), width),
+		"",
+	}
+
+	visibleLines := max(height-len(lines)-2, 1)
+	first := max(len(instance.log)-visibleLines, 0)
+	for _, line := range instance.log[first:] {
+		text := truncate(line.text, width)
+		if line.isError {
+			text = pterm.FgRed.Sprint(text)
+		}
+		lines = append(lines, text)
+	}
+
+	return append(lines, "", truncate("esc back  ↑/↓ select instance  "+d.help(), width))
+}
+
+// help describes the keys that can be used, it must be called with the mutex held
+func (d *Dashboard) help() string {
+	switch {
+	case d.waiting:
+		return "r retry failed instances  q quit"
+	case d.quit:
+		return "finishing the running instance, the remaining instances were canceled"
+	default:
+		return "↑/↓ select  enter show log  r retry failed  c cancel remaining  q quit"
+	}
+}
+
+// count returns the number of instances in status, it must be called with the mutex held
+func (d *Dashboard) count(status dashboardStatus) int {
+	count := 0
+	for _, instance := range d.instances {
+		if instance.status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// dashboardInstance is a single instance shown on the dashboard
+type dashboardInstance struct {
+	dashboard     *Dashboard
+	instanceId    string
+	ipAddress     string
+	status        dashboardStatus
+	state         InstanceUpdateState
+	err           error
+	startedAt     time.Time
+	finishedAt    time.Time
+	bytesUploaded int64
+	log           []dashboardLogLine
+}
+
+// dashboardLogLine is a single line in the log of an instance, isError is set for lines the update script wrote to stderr
+type dashboardLogLine struct {
+	text    string
+	isError bool
+}
+
+// start is called when the instance starts being updated, again when it is retried
+func (i *dashboardInstance) start() {
+	i.dashboard.mutex.Lock()
+	defer i.dashboard.mutex.Unlock()
+
+	if len(i.log) > 0 {
+		i.addLine("retrying")
+	}
+
+	i.status = dashboardStatusRunning
+	i.state = UpdateStateNotStarted
+	i.err = nil
+	i.startedAt = time.Now()
+	i.finishedAt = time.Time{}
+	i.bytesUploaded = 0
+}
+
+func (i *dashboardInstance) setState(state InstanceUpdateState) {
+	i.dashboard.mutex.Lock()
+	defer i.dashboard.mutex.Unlock()
+
+	i.state = state
+	i.addLine("==> " + state.String())
+
+	if state == UpdateStateCount {
+		i.status = dashboardStatusSucceeded
+		i.finishedAt = time.Now()
+	}
+}
+
+func (i *dashboardInstance) setFailed(err error) {
+	i.dashboard.mutex.Lock()
+	defer i.dashboard.mutex.Unlock()
+
+	i.status = dashboardStatusFailed
+	i.err = err
+	i.finishedAt = time.Now()
+	i.addLine(fmt.Sprintf("<== failed while %s: %s", i.state.String(), err))
+}
+
+// addBytesUploaded can be used as a tools.UploadProgressHandler
+func (i *dashboardInstance) addBytesUploaded(bytes int64) {
+	i.dashboard.mutex.Lock()
+	defer i.dashboard.mutex.Unlock()
+
+	i.bytesUploaded += bytes
+}
+
+// addOutputLine adds a line of output from the update script to the log of the instance, it can be used as a tools.OutputLineHandler
+func (i *dashboardInstance) addOutputLine(line string, isError bool) {
+	i.dashboard.mutex.Lock()
+	defer i.dashboard.mutex.Unlock()
+
+	i.log = append(i.log, dashboardLogLine{text: line, isError: isError})
+	i.trimLog()
+}
+
+// addLine adds a line written by the tool to the log of the instance, it must be called with the mutex held
+func (i *dashboardInstance) addLine(line string) {
+	i.log = append(i.log, dashboardLogLine{text: line})
+	i.trimLog()
+}
+
+// trimLog drops the oldest lines once there are more than maxDashboardLogLines, it must be called with the mutex held
+func (i *dashboardInstance) trimLog() {
+	if len(i.log) > maxDashboardLogLines {
+		i.log = i.log[len(i.log)-maxDashboardLogLines:]
+	}
+}
+
+func (i *dashboardInstance) stateString() string {
+	switch i.status {
+	case dashboardStatusQueued:
+		return "queued"
+	case dashboardStatusFailed:
+		return "failed while " + i.state.String()
+	case dashboardStatusCanceled:
+		return "canceled"
+	default:
+		return i.state.String()
+	}
+}
+
+func (i *dashboardInstance) lastLine() string {
+	if i.err != nil {
+		return strings.ReplaceAll(i.err.Error(), "\n", " ")
+	}
+	if len(i.log) == 0 {
+		return ""
+	}
+	return i.log[len(i.log)-1].text
+}
+
+func (i *dashboardInstance) elapsed(now time.Time) string {
+	if i.startedAt.IsZero() {
+		return ""
+	}
+	if !i.finishedAt.IsZero() {
+		now = i.finishedAt
+	}
+	return now.Sub(i.startedAt).Round(time.Second).String()
+}
+
+func (i *dashboardInstance) uploaded() string {
+	if i.bytesUploaded == 0 {
+		return ""
+	}
+	return formatBytes(i.bytesUploaded)
+}
+
+func (s dashboardStatus) color() pterm.Color {
+	switch s {
+	case dashboardStatusSucceeded:
+		return pterm.FgGreen
+	case dashboardStatusFailed:
+		return pterm.FgRed
+	case dashboardStatusCanceled:
+		return pterm.FgGray
+	default:
+		return pterm.FgDefault
+	}
+}
+
+// formatBytes formats a number of bytes for the user, eg. "1.5 MB"
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TB", value)
+}
+
+// truncate cuts line down to width characters, so it is never wrapped onto the next line of the terminal
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	return string(runes[:max(width, 0)])
+}
+
+// lockedBuffer is a bytes.Buffer that can be written to from multiple goroutines
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.buffer.Write(p)
+}
+
+func (l *lockedBuffer) Bytes() []byte {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.buffer.Bytes()
+}
@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDashboard(instanceIds ...string) *Dashboard {
+	instances := make([]*gamelift.Instance, 0, len(instanceIds))
+	for _, instanceId := range instanceIds {
+		instances = append(instances, &gamelift.Instance{InstanceId: instanceId, IpAddress: "127.0.0.1"})
+	}
+
+	dashboard := NewDashboard(fleetId)
+	dashboard.addInstances(instances)
+	return dashboard
+}
+
+// TestDashboardProgress ensures the progress of an instance is shown on its row, along with why it failed
+func TestDashboardProgress(t *testing.T) {
+	dashboard := testDashboard("i-1", "i-2")
+	instance := &gamelift.Instance{InstanceId: "i-1", IpAddress: "127.0.0.1"}
+
+	progressTracker := newDashboardProgressWriter(instance, dashboard.instanceRow(instance))
+	progressTracker.UpdateState(UpdateStateCopyBuild)
+	dashboard.instance("i-1").addBytesUploaded(1536)
+	dashboard.instance("i-1").addOutputLine("unzipping the archive", false)
+
+	lines := strings.Join(dashboard.render(200, 24, time.Now()), "\n")
+	assert.Contains(t, lines, "Updating fleet fleet-1234: 0 updated, 0 failed, 1 running, 1 queued, 0 canceled")
+	assert.Contains(t, lines, "copying build to instance")
+	assert.Contains(t, lines, "1.5 KB")
+	assert.Contains(t, lines, "unzipping the archive")
+
+	progressTracker.UpdateFailed(errors.New("connection reset"))
+
+	lines = strings.Join(dashboard.render(200, 24, time.Now()), "\n")
+	assert.Contains(t, lines, "failed while copying build to instance")
+	assert.Contains(t, lines, "connection reset")
+}
+
+// TestDashboardKeys ensures instances can be selected, and their log shown, from the keyboard
+func TestDashboardKeys(t *testing.T) {
+	dashboard := testDashboard("i-1", "i-2")
+	dashboard.instance("i-2").addOutputLine("killing running processes", false)
+
+	dashboard.handleKeys([]byte(keyDown + keyDown))
+	assert.Equal(t, 1, dashboard.selected)
+
+	dashboard.handleKeys([]byte("\r"))
+	lines := strings.Join(dashboard.render(200, 24, time.Now()), "\n")
+	assert.Contains(t, lines, "Log for i-2")
+	assert.Contains(t, lines, "killing running processes")
+
+	dashboard.handleKeys([]byte(keyEscape))
+	assert.False(t, dashboard.showLog)
+
+	dashboard.handleKeys([]byte("kk"))
+	assert.Equal(t, 0, dashboard.selected)
+}
+
+// TestDashboardRetryAndCancel ensures failed instances are queued again when retried, and queued instances are never started once canceled
+func TestDashboardRetryAndCancel(t *testing.T) {
+	dashboard := testDashboard("i-1", "i-2")
+	dashboard.instance("i-1").start()
+	dashboard.instance("i-1").setFailed(errors.New("failed"))
+
+	dashboard.handleKeys([]byte("r"))
+	assert.Equal(t, []string{"i-1"}, dashboard.TakeRetries())
+	assert.Empty(t, dashboard.TakeRetries())
+
+	dashboard.handleKeys([]byte("c"))
+	assert.True(t, dashboard.Canceled("i-1"))
+	assert.True(t, dashboard.Canceled("i-2"))
+}
+
+// TestDashboardWaitForRetries ensures the user is only asked to retry when an instance failed, and the failed instances are returned when they do
+func TestDashboardWaitForRetries(t *testing.T) {
+	dashboard := testDashboard("i-1", "i-2")
+	assert.Empty(t, dashboard.WaitForRetries(context.Background()))
+
+	dashboard.instance("i-2").start()
+	dashboard.instance("i-2").setFailed(errors.New("failed"))
+
+	go func() {
+		for {
+			dashboard.mutex.Lock()
+			waiting := dashboard.waiting
+			dashboard.mutex.Unlock()
+
+			if waiting {
+				dashboard.handleKeys([]byte("r"))
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	assert.Equal(t, []string{"i-2"}, dashboard.WaitForRetries(context.Background()))
+
+	dashboard.instance("i-2").setFailed(errors.New("failed again"))
+	dashboard.handleKeys([]byte("q"))
+	assert.Empty(t, dashboard.WaitForRetries(context.Background()))
+}
+
+// TestDashboardRenderFitsTerminal ensures the selected instance is always shown, and no line is wider than the terminal
+func TestDashboardRenderFitsTerminal(t *testing.T) {
+	dashboard := testDashboard("i-1", "i-2", "i-3", "i-4", "i-5", "i-6", "i-7", "i-8")
+	dashboard.selected = 7
+
+	lines := dashboard.render(40, 8, time.Now())
+	assert.Len(t, lines, 8)
+	assert.Contains(t, strings.Join(lines, "\n"), "i-8")
+	for _, line := range lines {
+		assert.LessOrEqual(t, len([]rune(pterm.RemoveColorFromString(line))), 40)
+	}
+}
+
+// TestFormatBytes ensures sizes are shown in the largest unit that fits
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.0 KB", formatBytes(1024))
+	assert.Equal(t, "2.5 MB", formatBytes(5*1024*1024/2))
+	assert.Equal(t, "1.0 GB", formatBytes(1024*1024*1024))
+}
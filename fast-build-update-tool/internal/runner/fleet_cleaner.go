@@ -0,0 +1,252 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"github.com/aws/aws-sdk-go-v2/service/gamelift/types"
+	"github.com/pterm/pterm"
+	"golang.org/x/crypto/ssh"
+)
+
+// FleetCleaner is used to find, and remove any SSH access that has been left behind on a GameLift fleet
+type FleetCleaner struct {
+	args config.CleanupArgs
+
+	logger *slog.Logger
+
+	gameLiftClient   GameLiftClient
+	sshConfigManager *tools.SSHConfigManager
+	newAccessRevoker func(logger *slog.Logger, instance *gamelift.Instance, publicKey ssh.PublicKey) (RemoteAccessRevoker, error)
+	// confirm asks the user whether to go ahead, it returns false if they declined
+	confirm func(message string) (bool, error)
+}
+
+// FleetCleanupResults holds the results of cleaning up a fleet
+type FleetCleanupResults struct {
+	SSHPort            int32
+	PermissionsFound   []*gamelift.InboundPermission
+	PermissionsRevoked int
+
+	InstancesFound        int
+	InstancesRevoked      int
+	InstancesFailedRevoke []string
+}
+
+// NewFleetCleaner will build a new FleetCleaner using command line arguments
+func NewFleetCleaner(ctx context.Context, logger *config.ApplicationLogger, args config.CleanupArgs) (*FleetCleaner, error) {
+	slogger := logger.Logger.With("fleetId", args.FleetId)
+
+	gameLift, err := gamelift.NewGameLiftClient(ctx, logger.AwsLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FleetCleaner{
+		args:             args,
+		logger:           slogger,
+		gameLiftClient:   gameLift,
+		sshConfigManager: tools.NewSSHConfigManager(slogger, args.PrivateKeyPath, args.SSHPort, args.SSHAgent, args.AgentPublicKeyPath),
+		newAccessRevoker: func(logger *slog.Logger, instance *gamelift.Instance, publicKey ssh.PublicKey) (RemoteAccessRevoker, error) {
+			return tools.NewSSHAccessRevoker(logger, instance, gameLift, publicKey, args.StopSSHServer)
+		},
+		confirm: func(message string) (bool, error) {
+			return pterm.DefaultInteractiveConfirm.WithDefaultValue(false).Show(message)
+		},
+	}, nil
+}
+
+// CleanupFleet will list any SSH permissions found on the fleet, and revoke them unless this is a dry run
+func (f *FleetCleaner) CleanupFleet(ctx context.Context) (*FleetCleanupResults, error) {
+	f.logger.Info("starting fleet cleanup process")
+
+	fleet, err := f.gameLiftClient.GetFleet(ctx, f.args.FleetId)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up fleet: %w", err)
+	}
+
+	sshPort, err := f.sshConfigManager.DeterminePort(fleet.OperatingSystem)
+	if err != nil {
+		return nil, fmt.Errorf("error determining ssh port %w", err)
+	}
+
+	permissions, err := f.gameLiftClient.GetInboundPermissions(ctx, f.args.FleetId)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up fleet port settings: %w", err)
+	}
+
+	results := &FleetCleanupResults{
+		SSHPort:               sshPort,
+		PermissionsFound:      f.filterSSHPermissions(permissions, sshPort),
+		InstancesFailedRevoke: make([]string, 0),
+	}
+
+	// Revoke access on the instances first, this is done over SSM so it does not depend on the SSH port being open
+	if f.args.RevokeAccess {
+		err = f.revokeInstanceAccess(ctx, results)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	f.logger.Debug("done looking up SSH permissions on fleet", "port", sshPort, "permissionCount", len(results.PermissionsFound))
+
+	// Without an IP range we can't tell the permissions opened by this tool from the ones set up by an admin, so they are only listed
+	if f.args.DryRun || f.args.IpRange == "" || len(results.PermissionsFound) == 0 {
+		f.reportResults(results)
+		return results, nil
+	}
+
+	if !f.args.Yes {
+		confirmed, err := f.confirm(fmt.Sprintf("Remove %d SSH permission(s) for %s on port %d?", len(results.PermissionsFound), f.args.IpRange, sshPort))
+		if err != nil {
+			return results, fmt.Errorf("error asking for confirmation, use --yes to remove the permissions without it: %w", err)
+		}
+		if !confirmed {
+			f.logger.Info("removing SSH permissions was not confirmed, nothing was changed")
+			f.reportResults(results)
+			return results, nil
+		}
+	}
+
+	err = f.gameLiftClient.RevokeInboundPermissions(ctx, f.args.FleetId, results.PermissionsFound)
+	if err != nil {
+		return results, fmt.Errorf("error revoking SSH permissions for fleet: %w", err)
+	}
+
+	results.PermissionsRevoked = len(results.PermissionsFound)
+
+	f.logger.Debug("done revoking SSH permissions on fleet", "permissionCount", results.PermissionsRevoked)
+
+	f.reportResults(results)
+
+	return results, nil
+}
+
+// revokeInstanceAccess will remove the SSH key provided by the user from each instance in the fleet
+func (f *FleetCleaner) revokeInstanceAccess(ctx context.Context, results *FleetCleanupResults) error {
+	signer, err := f.sshConfigManager.LoadKey(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading private ssh key %w", err)
+	}
+	defer f.sshConfigManager.Close()
+
+	instances, err := f.gameLiftClient.GetInstances(ctx, f.args.FleetId, f.args.InstanceIds)
+	if err != nil {
+		return fmt.Errorf("error fetching instances for fleet: %w", err)
+	}
+
+	results.InstancesFound = len(instances)
+
+	if f.args.DryRun {
+		f.logger.Debug("dry run, skipping revoking access on instances", "instanceCount", len(instances))
+		return nil
+	}
+
+	for _, instance := range instances {
+		instanceLogger := f.logger.With("instanceId", instance.InstanceId)
+
+		revoker, err := f.newAccessRevoker(instanceLogger, instance, signer.PublicKey())
+		if err == nil {
+			err = revoker.RevokeAccess(ctx)
+		}
+
+		if err != nil {
+			// If we fail to revoke access on an instance, log the error and continue. We may still be able to clean up other instances in the fleet
+			instanceLogger.Error("error revoking access on remote instance", "error", err)
+			results.InstancesFailedRevoke = append(results.InstancesFailedRevoke, instance.InstanceId)
+			continue
+		}
+
+		results.InstancesRevoked = results.InstancesRevoked + 1
+	}
+
+	f.logger.Debug("done revoking access on instances", "revoked", results.InstancesRevoked, "failed", len(results.InstancesFailedRevoke))
+
+	if len(results.InstancesFailedRevoke) > 0 {
+		f.reportResults(results)
+		return fmt.Errorf("failed to revoke access on instance(s): %s", strings.Join(results.InstancesFailedRevoke, ", "))
+	}
+
+	return nil
+}
+
+// filterSSHPermissions will return only the permissions that grant TCP access to exactly the SSH port, for the IP range if one was provided
+func (f *FleetCleaner) filterSSHPermissions(permissions []*gamelift.InboundPermission, sshPort int32) []*gamelift.InboundPermission {
+	result := make([]*gamelift.InboundPermission, 0, len(permissions))
+
+	for _, permission := range permissions {
+		if !strings.EqualFold(permission.Protocol, string(types.IpProtocolTcp)) {
+			continue
+		}
+
+		if permission.FromPort != sshPort || permission.ToPort != sshPort {
+			continue
+		}
+
+		if f.args.IpRange != "" && permission.IpRange != f.args.IpRange {
+			continue
+		}
+
+		result = append(result, permission)
+	}
+
+	return result
+}
+
+// reportResults will print out the permissions that were found, and what was done with them
+func (f *FleetCleaner) reportResults(results *FleetCleanupResults) {
+	if f.args.Verbose {
+		return
+	}
+
+	if f.args.RevokeAccess {
+		f.reportInstanceResults(results)
+	}
+
+	if len(results.PermissionsFound) == 0 {
+		pterm.Success.Printf("No SSH permissions found on port %d for fleet: %s\n", results.SSHPort, f.args.FleetId)
+		return
+	}
+
+	pterm.Info.Printf("Found %d SSH permission(s) on port %d for fleet: %s\n", len(results.PermissionsFound), results.SSHPort, f.args.FleetId)
+	for _, permission := range results.PermissionsFound {
+		pterm.Printf("  %s\n", permission.String())
+	}
+
+	if f.args.DryRun {
+		pterm.Info.Println("Dry run, no SSH permissions were removed")
+		return
+	}
+
+	if f.args.IpRange == "" {
+		pterm.Info.Println("No SSH permissions were removed, pass --ip-range to remove the permissions for your IP range")
+		return
+	}
+
+	if results.PermissionsRevoked == 0 {
+		pterm.Info.Println("No SSH permissions were removed")
+		return
+	}
+
+	pterm.Success.Printf("Removed %d SSH permission(s)\n", results.PermissionsRevoked)
+}
+
+// reportInstanceResults will print out the results of revoking access on the instances in the fleet
+func (f *FleetCleaner) reportInstanceResults(results *FleetCleanupResults) {
+	if f.args.DryRun {
+		pterm.Info.Printf("Dry run, SSH key access would be revoked on %d instance(s)\n", results.InstancesFound)
+		return
+	}
+
+	if len(results.InstancesFailedRevoke) > 0 {
+		pterm.Error.Printf("Failed to revoke SSH key access on %d instance(s): %s\n", len(results.InstancesFailedRevoke), strings.Join(results.InstancesFailedRevoke, ", "))
+	}
+
+	pterm.Success.Printf("Revoked SSH key access on %d of %d instance(s)\n", results.InstancesRevoked, results.InstancesFound)
+}
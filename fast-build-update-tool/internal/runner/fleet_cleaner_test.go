@@ -0,0 +1,205 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestFleetCleaner(args config.CleanupArgs, gameliftClient GameLiftClient) *FleetCleaner {
+	logger := NewTestLogger()
+	return &FleetCleaner{
+		args:             args,
+		logger:           logger,
+		gameLiftClient:   gameliftClient,
+		sshConfigManager: tools.NewSSHConfigManager(logger, args.PrivateKeyPath, args.SSHPort, false, ""),
+		confirm: func(message string) (bool, error) {
+			return false, errors.New("no confirmation in tests")
+		},
+	}
+}
+
+func newTestCleanupGameLiftClient() *GameLiftClientMock {
+	return &GameLiftClientMock{
+		GetFleetFunc: func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+			return &gamelift.Fleet{Id: fleetId, OperatingSystem: config.OperatingSystemLinux}, nil
+		},
+		GetInboundPermissionsFunc: func(ctx context.Context, fleetId string) ([]*gamelift.InboundPermission, error) {
+			return []*gamelift.InboundPermission{
+				&gamelift.InboundPermission{FromPort: 22, ToPort: 22, IpRange: "127.0.0.1/32", Protocol: "TCP"},
+				&gamelift.InboundPermission{FromPort: 22, ToPort: 22, IpRange: "10.0.0.0/8", Protocol: "TCP"},
+				&gamelift.InboundPermission{FromPort: 7770, ToPort: 7780, IpRange: "0.0.0.0/0", Protocol: "UDP"},
+				&gamelift.InboundPermission{FromPort: 20, ToPort: 30, IpRange: "0.0.0.0/0", Protocol: "TCP"},
+			}, nil
+		},
+		RevokeInboundPermissionsFunc: func(ctx context.Context, fleetId string, permissions []*gamelift.InboundPermission) error {
+			return nil
+		},
+	}
+}
+
+// TestCleanupFleet ensures we only list the permissions that grant access to exactly the SSH port when no IP range is provided, they may not have been opened by this tool
+func TestCleanupFleet(t *testing.T) {
+	gameliftClient := newTestCleanupGameLiftClient()
+	cleaner := newTestFleetCleaner(config.CleanupArgs{FleetId: fleetId, Yes: true}, gameliftClient)
+
+	results, err := cleaner.CleanupFleet(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, int32(22), results.SSHPort)
+	assert.Len(t, results.PermissionsFound, 2)
+	assert.Equal(t, "127.0.0.1/32", results.PermissionsFound[0].IpRange)
+	assert.Equal(t, "10.0.0.0/8", results.PermissionsFound[1].IpRange)
+	assert.Equal(t, 0, results.PermissionsRevoked)
+	assert.Len(t, gameliftClient.RevokeInboundPermissionsCalls(), 0)
+}
+
+// TestCleanupFleetIpRange ensures we only revoke permissions for the IP range provided
+func TestCleanupFleetIpRange(t *testing.T) {
+	gameliftClient := newTestCleanupGameLiftClient()
+	cleaner := newTestFleetCleaner(config.CleanupArgs{FleetId: fleetId, IpRange: "10.0.0.0/8", Yes: true}, gameliftClient)
+
+	results, err := cleaner.CleanupFleet(context.Background())
+	assert.Nil(t, err)
+
+	assert.Len(t, results.PermissionsFound, 1)
+	assert.Equal(t, "10.0.0.0/8", results.PermissionsFound[0].IpRange)
+	assert.Equal(t, 1, results.PermissionsRevoked)
+
+	revokeCalls := gameliftClient.RevokeInboundPermissionsCalls()
+	assert.Len(t, revokeCalls, 1)
+	assert.Equal(t, fleetId, revokeCalls[0].FleetId)
+	assert.Equal(t, "10.0.0.0/8", revokeCalls[0].Permissions[0].IpRange)
+}
+
+// TestCleanupFleetConfirm ensures permissions are only revoked once the user confirms it, unless --yes was passed
+func TestCleanupFleetConfirm(t *testing.T) {
+	for _, confirmed := range []bool{false, true} {
+		gameliftClient := newTestCleanupGameLiftClient()
+		cleaner := newTestFleetCleaner(config.CleanupArgs{FleetId: fleetId, IpRange: "10.0.0.0/8"}, gameliftClient)
+		var message string
+		cleaner.confirm = func(m string) (bool, error) {
+			message = m
+			return confirmed, nil
+		}
+
+		results, err := cleaner.CleanupFleet(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "Remove 1 SSH permission(s) for 10.0.0.0/8 on port 22?", message)
+		assert.Equal(t, confirmed, len(gameliftClient.RevokeInboundPermissionsCalls()) == 1)
+		assert.Equal(t, confirmed, results.PermissionsRevoked == 1)
+	}
+
+	gameliftClient := newTestCleanupGameLiftClient()
+	cleaner := newTestFleetCleaner(config.CleanupArgs{FleetId: fleetId, IpRange: "10.0.0.0/8"}, gameliftClient)
+	_, err := cleaner.CleanupFleet(context.Background())
+	assert.ErrorContains(t, err, "use --yes to remove the permissions without it")
+	assert.Len(t, gameliftClient.RevokeInboundPermissionsCalls(), 0)
+}
+
+// TestCleanupFleetDryRun ensures that we don't revoke anything during a dry run
+func TestCleanupFleetDryRun(t *testing.T) {
+	gameliftClient := newTestCleanupGameLiftClient()
+	cleaner := newTestFleetCleaner(config.CleanupArgs{FleetId: fleetId, DryRun: true}, gameliftClient)
+
+	results, err := cleaner.CleanupFleet(context.Background())
+	assert.Nil(t, err)
+
+	assert.Len(t, results.PermissionsFound, 2)
+	assert.Equal(t, 0, results.PermissionsRevoked)
+	assert.Len(t, gameliftClient.RevokeInboundPermissionsCalls(), 0)
+}
+
+// TestCleanupFleetRevokeError ensures we return an error when GameLift fails to revoke permissions
+func TestCleanupFleetRevokeError(t *testing.T) {
+	gameliftClient := newTestCleanupGameLiftClient()
+	gameliftClient.RevokeInboundPermissionsFunc = func(ctx context.Context, fleetId string, permissions []*gamelift.InboundPermission) error {
+		return errors.New("test error")
+	}
+	cleaner := newTestFleetCleaner(config.CleanupArgs{FleetId: fleetId, IpRange: "10.0.0.0/8", Yes: true}, gameliftClient)
+
+	_, err := cleaner.CleanupFleet(context.Background())
+	assert.ErrorContains(t, err, "test error")
+}
+
+// TestCleanupFleetRevokeAccess ensures that we revoke access on every instance in the fleet when asked
+func TestCleanupFleetRevokeAccess(t *testing.T) {
+	signer, privateKeyPath := generatePrivateSSHKey()
+	defer os.Remove(privateKeyPath)
+
+	gameliftClient := newTestCleanupGameLiftClient()
+	gameliftClient.GetInstancesFunc = func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+		return []*gamelift.Instance{
+			&gamelift.Instance{InstanceId: "i-1", OperatingSystem: config.OperatingSystemLinux},
+			&gamelift.Instance{InstanceId: "i-2", OperatingSystem: config.OperatingSystemLinux},
+		}, nil
+	}
+
+	args := config.CleanupArgs{FleetId: fleetId, IpRange: "10.0.0.0/8", Yes: true, RevokeAccess: true, PrivateKeyPath: privateKeyPath, InstanceIds: []string{"i-1", "i-2"}}
+	cleaner := newTestFleetCleaner(args, gameliftClient)
+
+	revoker := &RemoteAccessRevokerMock{
+		RevokeAccessFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+
+	revokedInstances := make([]string, 0)
+	cleaner.newAccessRevoker = func(logger *slog.Logger, instance *gamelift.Instance, publicKey ssh.PublicKey) (RemoteAccessRevoker, error) {
+		assert.Equal(t, signer.PublicKey().Marshal(), publicKey.Marshal())
+		revokedInstances = append(revokedInstances, instance.InstanceId)
+		return revoker, nil
+	}
+
+	results, err := cleaner.CleanupFleet(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"i-1", "i-2"}, gameliftClient.GetInstancesCalls()[0].AllowedInstanceIds)
+	assert.Equal(t, []string{"i-1", "i-2"}, revokedInstances)
+	assert.Len(t, revoker.RevokeAccessCalls(), 2)
+	assert.Equal(t, 2, results.InstancesFound)
+	assert.Equal(t, 2, results.InstancesRevoked)
+	assert.Equal(t, 1, results.PermissionsRevoked)
+}
+
+// TestCleanupFleetRevokeAccessFailed ensures that we keep going when revoking access on an instance fails, and report it
+func TestCleanupFleetRevokeAccessFailed(t *testing.T) {
+	_, privateKeyPath := generatePrivateSSHKey()
+	defer os.Remove(privateKeyPath)
+
+	gameliftClient := newTestCleanupGameLiftClient()
+	gameliftClient.GetInstancesFunc = func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+		return []*gamelift.Instance{
+			&gamelift.Instance{InstanceId: "i-1", OperatingSystem: config.OperatingSystemLinux},
+			&gamelift.Instance{InstanceId: "i-2", OperatingSystem: config.OperatingSystemLinux},
+		}, nil
+	}
+
+	args := config.CleanupArgs{FleetId: fleetId, RevokeAccess: true, PrivateKeyPath: privateKeyPath}
+	cleaner := newTestFleetCleaner(args, gameliftClient)
+	cleaner.newAccessRevoker = func(logger *slog.Logger, instance *gamelift.Instance, publicKey ssh.PublicKey) (RemoteAccessRevoker, error) {
+		return &RemoteAccessRevokerMock{
+			RevokeAccessFunc: func(ctx context.Context) error {
+				if instance.InstanceId == "i-1" {
+					return errors.New("test error")
+				}
+				return nil
+			},
+		}, nil
+	}
+
+	results, err := cleaner.CleanupFleet(context.Background())
+	assert.ErrorContains(t, err, "i-1")
+
+	assert.Equal(t, 1, results.InstancesRevoked)
+	assert.Equal(t, []string{"i-1"}, results.InstancesFailedRevoke)
+	assert.Len(t, gameliftClient.RevokeInboundPermissionsCalls(), 0)
+}
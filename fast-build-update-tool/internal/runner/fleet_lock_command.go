@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/pterm/pterm"
+)
+
+// FleetLockCommand is used to show who holds the lock on a GameLift fleet, and to break locks left behind by runs that were interrupted
+type FleetLockCommand struct {
+	args config.LockArgs
+
+	logger *slog.Logger
+
+	gameLiftClient GameLiftClient
+	now            func() time.Time
+}
+
+// NewFleetLockCommand will build a new FleetLockCommand using command line arguments
+func NewFleetLockCommand(ctx context.Context, logger *config.ApplicationLogger, args config.LockArgs) (*FleetLockCommand, error) {
+	gameLift, err := gamelift.NewGameLiftClient(ctx, logger.AwsLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FleetLockCommand{
+		args:           args,
+		logger:         logger.Logger.With("fleetId", args.FleetId),
+		gameLiftClient: gameLift,
+		now:            time.Now,
+	}, nil
+}
+
+// Run will show the lock held on the fleet, and remove it when the break action was requested.
+// The lock that was found is returned, it is nil when the fleet was not locked.
+func (f *FleetLockCommand) Run(ctx context.Context) (*gamelift.FleetLock, error) {
+	fleet, err := f.gameLiftClient.GetFleet(ctx, f.args.FleetId)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up fleet: %w", err)
+	}
+
+	lock, err := f.gameLiftClient.GetFleetLock(ctx, fleet.Arn)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up fleet lock: %w", err)
+	}
+
+	f.reportLock(lock)
+
+	if f.args.Action != config.LockActionBreak || lock == nil {
+		return lock, nil
+	}
+
+	err = f.gameLiftClient.RemoveFleetLock(ctx, fleet.Arn)
+	if err != nil {
+		return lock, fmt.Errorf("error removing fleet lock: %w", err)
+	}
+
+	f.logger.Info("removed fleet lock", "owner", lock.Owner, "host", lock.Host, "runId", lock.RunId)
+	if !f.args.Verbose {
+		pterm.Success.Printf("Removed the lock on fleet: %s\n", f.args.FleetId)
+	}
+
+	return lock, nil
+}
+
+// reportLock will print out who holds the lock on the fleet, and when it expires
+func (f *FleetLockCommand) reportLock(lock *gamelift.FleetLock) {
+	if f.args.Verbose {
+		return
+	}
+
+	if lock == nil {
+		pterm.Success.Printf("Fleet is not locked: %s\n", f.args.FleetId)
+		return
+	}
+
+	now := f.now()
+	if lock.Expired(now) {
+		pterm.Info.Printf("Fleet %s has an expired lock, it will be taken over by the next update\n", f.args.FleetId)
+	} else {
+		pterm.Warning.Printf("Fleet %s is locked, it expires in %s unless it is renewed\n", f.args.FleetId, lock.Expires.Sub(now).Round(time.Second))
+	}
+
+	pterm.Printf("Owner: %s\n", lock.Owner)
+	pterm.Printf("Host: %s\n", lock.Host)
+	pterm.Printf("Run ID: %s\n", lock.RunId)
+	pterm.Printf("Expires: %s\n", lock.Expires.Local().Format(time.RFC1123))
+}
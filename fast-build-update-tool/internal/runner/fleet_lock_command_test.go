@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFleetLockCommand(client GameLiftClient, action config.LockAction) *FleetLockCommand {
+	return &FleetLockCommand{
+		args:           config.LockArgs{Action: action, FleetId: fleetId},
+		logger:         NewTestLogger(),
+		gameLiftClient: client,
+		now:            time.Now,
+	}
+}
+
+// TestFleetLockStatus ensures the lock is shown, and left in place
+func TestFleetLockStatus(t *testing.T) {
+	held := &gamelift.FleetLock{Owner: "alex", Host: "devbox", RunId: "run-1", Expires: time.Now().Add(10 * time.Minute)}
+	client := testFleetLockClient(held)
+
+	lock, err := testFleetLockCommand(client, config.LockActionStatus).Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, held, lock)
+	assert.Equal(t, testFleetArn, client.GetFleetLockCalls()[0].FleetArn)
+	assert.Empty(t, client.RemoveFleetLockCalls())
+}
+
+// TestFleetLockBreak ensures the lock is removed, and nothing is done when the fleet is not locked
+func TestFleetLockBreak(t *testing.T) {
+	held := &gamelift.FleetLock{Owner: "alex", Host: "devbox", RunId: "run-1", Expires: time.Now().Add(10 * time.Minute)}
+	client := testFleetLockClient(held)
+
+	lock, err := testFleetLockCommand(client, config.LockActionBreak).Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, held, lock)
+	assert.Len(t, client.RemoveFleetLockCalls(), 1)
+
+	lock, err = testFleetLockCommand(client, config.LockActionBreak).Run(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, lock)
+	assert.Len(t, client.RemoveFleetLockCalls(), 1)
+}
@@ -0,0 +1,266 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+)
+
+// FleetLockedError is returned when another run holds the lock on a fleet
+type FleetLockedError struct {
+	FleetId string
+	Lock    *gamelift.FleetLock
+}
+
+func (f *FleetLockedError) Error() string {
+	return fmt.Sprintf("fleet %s is locked by %s on %s (run %s) until %s. If that run is no longer running, remove the lock with: %s %s --fleet-id %s",
+		f.FleetId, f.Lock.Owner, f.Lock.Host, f.Lock.RunId, f.Lock.Expires.Local().Format(time.RFC1123), config.CommandLock, config.LockActionBreak, f.FleetId)
+}
+
+const (
+	// fleetLockPollInterval is how often the lock is read back after tagging the fleet, until the tags of this run can be seen
+	fleetLockPollInterval = 250 * time.Millisecond
+	// fleetLockSettleTimeout is how long we wait for the tags of this run to be seen, before giving up on the lock
+	fleetLockSettleTimeout = 30 * time.Second
+)
+
+// FleetLocker holds the advisory lock on a fleet while it is updated, so only one run updates a fleet at a time.
+// The lock is stored in the tags of the fleet, and is renewed in the background until it is released.
+type FleetLocker struct {
+	gameLiftClient GameLiftClient
+	logger         *slog.Logger
+
+	owner         string
+	host          string
+	runId         string
+	ttl           time.Duration
+	pollInterval  time.Duration
+	settleTimeout time.Duration
+	now           func() time.Time
+
+	// fleet is the fleet the lock is held on, it is nil when no lock is held
+	fleet        *gamelift.Fleet
+	stopRenewing context.CancelFunc
+	renewDone    chan struct{}
+	// lost is closed once another run took the lock while this run held it
+	lost chan struct{}
+}
+
+// NewFleetLocker builds a new FleetLocker for this run. The lock expires ttl after it was last renewed, config.DefaultFleetLockTTL is used when ttl is 0.
+func NewFleetLocker(logger *slog.Logger, gameLiftClient GameLiftClient, runId string, ttl time.Duration) *FleetLocker {
+	if ttl == 0 {
+		ttl = config.DefaultFleetLockTTL
+	}
+
+	return &FleetLocker{
+		gameLiftClient: gameLiftClient,
+		logger:         logger.With("context", "FleetLocker"),
+		owner:          currentUser(),
+		host:           currentHost(),
+		runId:          runId,
+		ttl:            ttl,
+		pollInterval:   fleetLockPollInterval,
+		settleTimeout:  fleetLockSettleTimeout,
+		now:            time.Now,
+	}
+}
+
+// Acquire takes the lock on fleet, a FleetLockedError is returned when it is held by another run that has not expired
+func (f *FleetLocker) Acquire(ctx context.Context, fleet *gamelift.Fleet) error {
+	existing, err := f.gameLiftClient.GetFleetLock(ctx, fleet.Arn)
+	if err != nil {
+		return fmt.Errorf("error looking up fleet lock %w", err)
+	}
+
+	if existing != nil && existing.RunId != f.runId {
+		if !existing.Expired(f.now()) {
+			return &FleetLockedError{FleetId: fleet.Id, Lock: existing}
+		}
+		f.logger.Warn("taking over expired fleet lock", "owner", existing.Owner, "host", existing.Host, "runId", existing.RunId, "expired", existing.Expires)
+	}
+
+	err = f.put(ctx, fleet)
+	if err != nil {
+		return err
+	}
+
+	held, err := f.waitForTags(ctx, fleet, existing)
+	if err != nil {
+		return err
+	}
+	if held.RunId != f.runId {
+		return &FleetLockedError{FleetId: fleet.Id, Lock: held}
+	}
+
+	f.logger.Debug("acquired fleet lock", "expires", held.Expires)
+
+	renewCtx, cancel := context.WithCancel(ctx)
+	f.fleet = fleet
+	f.stopRenewing = cancel
+	f.renewDone = make(chan struct{})
+	f.lost = make(chan struct{})
+	go f.renew(renewCtx, fleet, f.renewDone)
+
+	return nil
+}
+
+// waitForTags reads the lock back until the tags of this run, or of a run that tagged the fleet after it, can be seen.
+// Tags are not updated atomically, so another run may have taken the lock at the same time. The run that tagged the fleet last holds it.
+func (f *FleetLocker) waitForTags(ctx context.Context, fleet *gamelift.Fleet, existing *gamelift.FleetLock) (*gamelift.FleetLock, error) {
+	timeout := time.After(f.settleTimeout)
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			err = fmt.Errorf("fleet lock could not be read back within %s", f.settleTimeout)
+		case <-time.After(f.pollInterval):
+		}
+		if err != nil {
+			// The fleet was already tagged, so the lock must not be left behind until it expires
+			if removeErr := f.removeIfHeld(context.WithoutCancel(ctx), fleet); removeErr != nil {
+				f.logger.Warn("error removing fleet lock", "err", removeErr)
+			}
+			return nil, err
+		}
+
+		held, err := f.gameLiftClient.GetFleetLock(ctx, fleet.Arn)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up fleet lock %w", err)
+		}
+
+		// Until the new tags can be seen, the lock reads back as it was before the fleet was tagged
+		stale := held == nil || (existing != nil && held.RunId == existing.RunId && held.RunId != f.runId)
+		if !stale {
+			return held, nil
+		}
+	}
+}
+
+// Lost returns true once another run took the lock while this run held it. No more changes should be made to the fleet once it is lost.
+func (f *FleetLocker) Lost() bool {
+	select {
+	case <-f.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release stops renewing the lock, and removes it from the fleet if it is still held by this run
+func (f *FleetLocker) Release(ctx context.Context) error {
+	if f.fleet == nil {
+		return nil
+	}
+
+	f.stopRenewing()
+	<-f.renewDone
+
+	fleet := f.fleet
+	f.fleet = nil
+
+	return f.removeIfHeld(ctx, fleet)
+}
+
+// removeIfHeld removes the lock from fleet. The lock may have been broken, and taken by another run, so it is only removed if it is still ours.
+func (f *FleetLocker) removeIfHeld(ctx context.Context, fleet *gamelift.Fleet) error {
+	held, err := f.gameLiftClient.GetFleetLock(ctx, fleet.Arn)
+	if err != nil {
+		return fmt.Errorf("error looking up fleet lock %w", err)
+	}
+	if held == nil || held.RunId != f.runId {
+		f.logger.Warn("fleet lock is no longer held by this run, leaving it in place")
+		return nil
+	}
+
+	err = f.gameLiftClient.RemoveFleetLock(ctx, fleet.Arn)
+	if err != nil {
+		return fmt.Errorf("error removing fleet lock %w", err)
+	}
+
+	f.logger.Debug("released fleet lock")
+
+	return nil
+}
+
+// renew extends the lock a few times before it expires, until ctx is canceled or the lock is broken
+func (f *FleetLocker) renew(ctx context.Context, fleet *gamelift.Fleet, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(f.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !f.renewOnce(ctx, fleet) {
+				return
+			}
+		}
+	}
+}
+
+// renewOnce extends the lock, unless it was broken. It returns false once the lock is no longer held by this run.
+func (f *FleetLocker) renewOnce(ctx context.Context, fleet *gamelift.Fleet) bool {
+	held, err := f.gameLiftClient.GetFleetLock(ctx, fleet.Arn)
+	if err != nil {
+		if ctx.Err() == nil {
+			f.logger.Warn("error looking up fleet lock", "err", err)
+		}
+		return true
+	}
+
+	// Someone broke the lock, it must not be taken back from whoever holds it now
+	if held == nil || held.RunId != f.runId {
+		f.logger.Warn("fleet lock is no longer held by this run, it will not be renewed")
+		close(f.lost)
+		return false
+	}
+
+	err = f.put(ctx, fleet)
+	if err != nil && ctx.Err() == nil {
+		f.logger.Warn("error renewing fleet lock", "err", err)
+	}
+	return true
+}
+
+// put tags the fleet with a lock held by this run, that expires ttl from now
+func (f *FleetLocker) put(ctx context.Context, fleet *gamelift.Fleet) error {
+	err := f.gameLiftClient.PutFleetLock(ctx, fleet.Arn, &gamelift.FleetLock{
+		Owner:   f.owner,
+		Host:    f.host,
+		RunId:   f.runId,
+		Expires: f.now().Add(f.ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("error writing fleet lock %w", err)
+	}
+	return nil
+}
+
+// currentUser returns the name of the user running this application, or an empty string if it is not known
+func currentUser() string {
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return current.Username
+}
+
+// currentHost returns the hostname of the machine running this application, or an empty string if it is not known
+func currentHost() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
@@ -0,0 +1,213 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFleetArn = "arn:aws:gamelift:us-west-2:123456789012:fleet/fleet-1234"
+
+// testFleetLockClient returns a GameLiftClientMock that stores the fleet lock in memory, starting with lock
+func testFleetLockClient(lock *gamelift.FleetLock) *GameLiftClientMock {
+	var mutex sync.Mutex
+	return &GameLiftClientMock{
+		GetFleetFunc: func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+			return &gamelift.Fleet{Id: fleetId, Arn: testFleetArn}, nil
+		},
+		GetFleetLockFunc: func(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return lock, nil
+		},
+		PutFleetLockFunc: func(ctx context.Context, fleetArn string, newLock *gamelift.FleetLock) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			lock = newLock
+			return nil
+		},
+		RemoveFleetLockFunc: func(ctx context.Context, fleetArn string) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			lock = nil
+			return nil
+		},
+	}
+}
+
+func testFleetLocker(client GameLiftClient, ttl time.Duration) *FleetLocker {
+	locker := NewFleetLocker(NewTestLogger(), client, "run-2", ttl)
+	locker.owner = "sam"
+	locker.host = "laptop"
+	locker.pollInterval = time.Millisecond
+	return locker
+}
+
+// TestFleetLockerAcquireAndRelease ensures the lock is written with the owner, host and expiry of this run, and removed once it is released
+func TestFleetLockerAcquireAndRelease(t *testing.T) {
+	client := testFleetLockClient(nil)
+	locker := testFleetLocker(client, time.Hour)
+
+	before := time.Now()
+	err := locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn})
+	assert.Nil(t, err)
+
+	puts := client.PutFleetLockCalls()
+	assert.Len(t, puts, 1)
+	assert.Equal(t, testFleetArn, puts[0].FleetArn)
+	assert.Equal(t, "sam", puts[0].Lock.Owner)
+	assert.Equal(t, "laptop", puts[0].Lock.Host)
+	assert.Equal(t, "run-2", puts[0].Lock.RunId)
+	assert.WithinDuration(t, before.Add(time.Hour), puts[0].Lock.Expires, time.Minute)
+
+	err = locker.Release(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, client.RemoveFleetLockCalls(), 1)
+
+	// Releasing again does nothing
+	assert.Nil(t, locker.Release(context.Background()))
+	assert.Len(t, client.RemoveFleetLockCalls(), 1)
+}
+
+// TestFleetLockerHeldByAnotherRun ensures the lock is not taken while another run holds it, but is taken over once it has expired
+func TestFleetLockerHeldByAnotherRun(t *testing.T) {
+	held := &gamelift.FleetLock{Owner: "alex", Host: "devbox", RunId: "run-1", Expires: time.Now().Add(10 * time.Minute)}
+	client := testFleetLockClient(held)
+	locker := testFleetLocker(client, time.Hour)
+
+	err := locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn})
+
+	var lockedErr *FleetLockedError
+	assert.ErrorAs(t, err, &lockedErr)
+	assert.Equal(t, held, lockedErr.Lock)
+	assert.ErrorContains(t, err, "fleet fleet-1234 is locked by alex on devbox (run run-1)")
+	assert.ErrorContains(t, err, "lock break --fleet-id fleet-1234")
+	assert.Empty(t, client.PutFleetLockCalls())
+
+	// Nothing is removed, as this run never held the lock
+	assert.Nil(t, locker.Release(context.Background()))
+	assert.Empty(t, client.RemoveFleetLockCalls())
+
+	held.Expires = time.Now().Add(-time.Minute)
+	err = locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn})
+	assert.Nil(t, err)
+	assert.Len(t, client.PutFleetLockCalls(), 1)
+	assert.Nil(t, locker.Release(context.Background()))
+}
+
+// TestFleetLockerLostRace ensures the lock is not held when another run tagged the fleet at the same time
+func TestFleetLockerLostRace(t *testing.T) {
+	client := testFleetLockClient(nil)
+	other := &gamelift.FleetLock{Owner: "alex", Host: "devbox", RunId: "run-1", Expires: time.Now().Add(time.Hour)}
+	client.PutFleetLockFunc = func(ctx context.Context, fleetArn string, lock *gamelift.FleetLock) error {
+		return nil
+	}
+	client.GetFleetLockFunc = func(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error) {
+		// The other run tags the fleet right after this run does
+		if len(client.PutFleetLockCalls()) == 0 {
+			return nil, nil
+		}
+		return other, nil
+	}
+
+	locker := testFleetLocker(client, time.Hour)
+	err := locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn})
+
+	var lockedErr *FleetLockedError
+	assert.ErrorAs(t, err, &lockedErr)
+	assert.Equal(t, "run-1", lockedErr.Lock.RunId)
+
+	assert.Nil(t, locker.Release(context.Background()))
+	assert.Empty(t, client.RemoveFleetLockCalls())
+}
+
+// TestFleetLockerRenew ensures the lock is renewed until it is released, and a lock taken by another run is not removed
+func TestFleetLockerRenew(t *testing.T) {
+	client := testFleetLockClient(nil)
+	locker := testFleetLocker(client, 30*time.Millisecond)
+
+	err := locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn})
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool { return len(client.PutFleetLockCalls()) >= 3 }, time.Second, 5*time.Millisecond)
+
+	assert.False(t, locker.Lost())
+
+	// Someone breaks the lock, and another run takes it
+	assert.Nil(t, client.PutFleetLock(context.Background(), testFleetArn, &gamelift.FleetLock{RunId: "run-3"}))
+	assert.Eventually(t, locker.Lost, time.Second, 5*time.Millisecond)
+
+	assert.Nil(t, locker.Release(context.Background()))
+	assert.Empty(t, client.RemoveFleetLockCalls())
+
+	// No renewals happen after the lock was released
+	renewals := len(client.PutFleetLockCalls())
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, client.PutFleetLockCalls(), renewals)
+}
+
+// TestFleetLockerWaitsForTags ensures the lock is read back until the tags of this run can be seen, instead of waiting a fixed delay
+func TestFleetLockerWaitsForTags(t *testing.T) {
+	client := testFleetLockClient(nil)
+	getFleetLock := client.GetFleetLockFunc
+	reads := 0
+	client.GetFleetLockFunc = func(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error) {
+		// The tags of this run are only seen on the third read after the fleet was tagged
+		reads++
+		if reads < 4 {
+			return nil, nil
+		}
+		return getFleetLock(ctx, fleetArn)
+	}
+
+	locker := testFleetLocker(client, time.Hour)
+	locker.settleTimeout = time.Minute
+	start := time.Now()
+	assert.Nil(t, locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn}))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 4, reads)
+	assert.Nil(t, locker.Release(context.Background()))
+}
+
+// TestFleetLockerWaitsForTagsGivesUp ensures the lock is not taken when the tags of this run are never seen, or the run is canceled,
+// and the fleet is not left tagged
+func TestFleetLockerWaitsForTagsGivesUp(t *testing.T) {
+	expired := &gamelift.FleetLock{RunId: "run-1", Expires: time.Now().Add(-time.Minute)}
+	client := testFleetLockClient(expired)
+	client.GetFleetLockFunc = func(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error) {
+		return expired, nil
+	}
+
+	locker := testFleetLocker(client, time.Hour)
+	locker.settleTimeout = 20 * time.Millisecond
+	err := locker.Acquire(context.Background(), &gamelift.Fleet{Id: fleetId, Arn: testFleetArn})
+	assert.ErrorContains(t, err, "fleet lock could not be read back within 20ms")
+	assert.Len(t, client.PutFleetLockCalls(), 1)
+
+	// The polling is cut short when the run is canceled, and the tags of this run are removed instead of being left until they expire
+	client = testFleetLockClient(nil)
+	locker = testFleetLocker(client, time.Hour)
+	locker.pollInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, locker.Acquire(ctx, &gamelift.Fleet{Id: fleetId, Arn: testFleetArn}), context.Canceled)
+	assert.Len(t, client.RemoveFleetLockCalls(), 1)
+	lock, _ := client.GetFleetLock(context.Background(), testFleetArn)
+	assert.Nil(t, lock)
+}
+
+// TestNewFleetLockerNoLock ensures the fleet is not locked with --no-lock, for users that are not allowed to tag the fleet
+func TestNewFleetLockerNoLock(t *testing.T) {
+	client := testFleetLockClient(nil)
+
+	locker := newFleetLocker(NewTestLogger(), client, "run-2", config.CLIArgs{FleetLockTTL: time.Hour})
+	assert.NotNil(t, locker)
+	assert.Equal(t, time.Hour, locker.ttl)
+
+	assert.Nil(t, newFleetLocker(NewTestLogger(), client, "run-2", config.CLIArgs{NoLock: true}))
+}
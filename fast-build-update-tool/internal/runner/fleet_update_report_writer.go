@@ -1,8 +1,12 @@
 package runner
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 	"github.com/pterm/pterm"
 )
 
@@ -42,12 +46,86 @@ func (f *FleetUpdateReportWriter) ReportResults(results *FleetUpdateResults) {
 		return
 	}
 
-	if len(results.InstancesFailedUpdate) == 0 {
+	if len(results.InstancesFailedUpdate) == 0 && len(results.InstancesCanceled) == 0 {
 		pterm.Success.Printf("Fleet Update Succeeded! Updated %d instance(s)\n", results.InstancesUpdated)
 	} else {
-		pterm.Error.Printf("Fleet Update Failed. Failed to update %d instance(s)\n", len(results.InstancesFailedUpdate))
-		pterm.Error.Printf("Instance(s) failed: %s\n", strings.Join(results.InstancesFailedUpdate, ", "))
+		pterm.Error.Printf("Fleet Update Failed. Failed to update %d instance(s)\n", len(results.InstancesFailedUpdate)+len(results.InstancesCanceled))
+		if len(results.InstancesFailedUpdate) > 0 {
+			pterm.Error.Printf("Instance(s) failed: %s\n", strings.Join(results.InstancesFailedUpdate, ", "))
+		}
+		if len(results.InstancesCanceled) > 0 {
+			pterm.Warning.Printf("Instance(s) canceled: %s\n", strings.Join(results.InstancesCanceled, ", "))
+		}
+		for _, instanceId := range results.InstancesFailedUpdate {
+			if stepErr, ok := results.FailedSteps[instanceId]; ok && stepErr.LogFilePath != "" {
+				pterm.Printf("%s failed at step %q, check logs in %s\n", instanceId, stepErr.Step, stepErr.LogFilePath)
+			}
+		}
 		pterm.Printf("Instance(s) Successfully Updated: %d\n", results.InstancesUpdated)
 		pterm.Printf("Total Instance(s) Found: %d\n", results.InstancesFound)
 	}
+
+	f.reportProcessStops(results)
+	f.reportNoProcesses(results)
+}
+
+// reportNoProcesses will print a warning for each instance that had no running server process for an executable, unless the update was asked to ignore it
+func (f *FleetUpdateReportWriter) reportNoProcesses(results *FleetUpdateResults) {
+	instanceIds := make([]string, 0, len(results.NoProcesses))
+	for instanceId := range results.NoProcesses {
+		instanceIds = append(instanceIds, instanceId)
+	}
+	sort.Strings(instanceIds)
+
+	for _, instanceId := range instanceIds {
+		for _, noProcess := range results.NoProcesses[instanceId] {
+			switch noProcess.Policy {
+			case config.NoProcessPolicyFail:
+				pterm.Warning.Printf("%s had no running server process for %s, the update of the instance was stopped\n", instanceId, noProcess.Name)
+			case config.NoProcessPolicyWarn:
+				pterm.Warning.Printf("%s had no running server process for %s\n", instanceId, noProcess.Name)
+			}
+		}
+	}
+}
+
+// reportProcessStops will print out how each server process stopped by the update script exited, with the processes that had to be killed first
+func (f *FleetUpdateReportWriter) reportProcessStops(results *FleetUpdateResults) {
+	instanceIds := make([]string, 0, len(results.ProcessStops))
+	for instanceId := range results.ProcessStops {
+		instanceIds = append(instanceIds, instanceId)
+	}
+	if len(instanceIds) == 0 {
+		return
+	}
+	sort.Strings(instanceIds)
+
+	pterm.Println("Server processes stopped:")
+	for _, instanceId := range instanceIds {
+		for _, stop := range results.ProcessStops[instanceId] {
+			line := fmt.Sprintf("  %s PID %d (%s) %s", instanceId, stop.Pid, stop.Name, processStopDescription(stop))
+			if stop.Result == tools.ProcessStopKilled {
+				pterm.Warning.Println(strings.TrimSpace(line))
+			} else {
+				pterm.Println(line)
+			}
+		}
+	}
+}
+
+// processStopDescription describes how a server process exited
+func processStopDescription(stop tools.ProcessStop) string {
+	switch stop.Result {
+	case tools.ProcessStopExited:
+		return fmt.Sprintf("exited after %s", stop.Waited)
+	case tools.ProcessStopKilled:
+		if stop.Waited == 0 {
+			return "was killed"
+		}
+		return fmt.Sprintf("was killed after %s", stop.Waited)
+	case tools.ProcessStopSignaled:
+		return "was sent SIGTERM"
+	default:
+		return string(stop.Result)
+	}
 }
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"text/template"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -26,6 +28,18 @@ type FleetUpdater struct {
 	zipValidator           *tools.ZipValidator
 	instanceUpdaterFactory InstanceUpdaterFactory
 	reportWriter           *FleetUpdateReportWriter
+	// dashboard is nil unless the dashboard was asked for, and can be shown in this terminal
+	dashboard *Dashboard
+	// notifier is optional, when set webhooks are notified as the update progresses
+	notifier *WebhookNotifier
+	// fleetLocker is optional, when set the fleet is locked before any changes are made to it
+	fleetLocker *FleetLocker
+
+	// buildDirArchive is set when the build is zipped from --build-dir
+	buildDirArchive *tools.DirectoryArchive
+
+	// openedPort is the SSH port opened on the fleet by this run, it is 0 when this run did not open a port
+	openedPort int32
 }
 
 // NewFleetUpdater will build a new FleetUpdater using command line arguments
@@ -37,50 +51,129 @@ func NewFleetUpdater(ctx context.Context, logger *config.ApplicationLogger, args
 		return nil, err
 	}
 
+	// Load the update script template up front, so a broken template is found before any fleet is changed
+	var scriptTemplate *template.Template
+	if args.ScriptTemplatePath != "" {
+		scriptTemplate, err = tools.LoadUpdateScriptTemplate(args.ScriptTemplatePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var dashboard *Dashboard
+	if args.Dashboard && DashboardSupported() {
+		dashboard = NewDashboard(args.FleetId)
+	}
+
+	archive, buildDirArchive, err := newBuildArchive(args)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FleetUpdater{
 		args:                   args,
 		gameLiftClient:         gameLift,
 		logger:                 slogger,
-		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(args.GetUpdateOperation(), args.BuildZipPath, args.LockName),
-		sshConfigManager:       tools.NewSSHConfigManager(slogger, args.PrivateKeyPath, args.SSHPort),
-		zipValidator:           tools.NewZipValidator(args.BuildZipPath),
-		instanceUpdaterFactory: NewInstanceUpdaterFactory(ctx, slogger, gameLift, args),
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(args.GetUpdateOperation(), archive, args.LockName, args.Hooks(), scriptTemplate, args.StopGracePeriod, args.GetNoProcessPolicy()),
+		sshConfigManager:       tools.NewSSHConfigManager(slogger, args.PrivateKeyPath, args.SSHPort, args.SSHAgent, args.AgentPublicKeyPath),
+		zipValidator:           tools.NewZipValidator(archive),
+		instanceUpdaterFactory: NewInstanceUpdaterFactory(ctx, slogger, gameLift, args, archive, dashboard),
 		reportWriter:           NewFleetUpdateReportWriter(args.FleetId, args.Verbose),
+		dashboard:              dashboard,
+		notifier:               NewWebhookNotifier(slogger, args.FleetId, logger.RunId, args.Webhooks),
+		fleetLocker:            newFleetLocker(slogger, gameLift, logger.RunId, args),
+		buildDirArchive:        buildDirArchive,
 	}, nil
 }
 
+// newFleetLocker returns the FleetLocker for this run, or nil when the fleet should not be locked
+func newFleetLocker(logger *slog.Logger, gameLift GameLiftClient, runId string, args config.CLIArgs) *FleetLocker {
+	if args.NoLock {
+		logger.Warn("the fleet is not locked, another run may update it at the same time")
+		return nil
+	}
+	return NewFleetLocker(logger, gameLift, runId, args.FleetLockTTL)
+}
+
+// newBuildArchive returns the build zip to copy to each instance. When --build-dir is set the directory is zipped once, to a temporary file
+// that is copied to each instance. Over SSH it is sent through the DirectoryArchive, SSM is given the path of the temporary file itself.
+func newBuildArchive(args config.CLIArgs) (tools.BuildArchive, *tools.DirectoryArchive, error) {
+	if args.BuildDir == "" || args.RestartProcess {
+		return tools.ArchiveFile(args.BuildZipPath), nil, nil
+	}
+
+	buildDirArchive, err := tools.NewDirectoryArchive(args.BuildDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if args.Transport != config.TransportSSM {
+		return buildDirArchive, buildDirArchive, nil
+	}
+
+	zipFile, err := buildDirArchive.WriteTempZip()
+	if err != nil {
+		return nil, nil, errors.Join(err, buildDirArchive.Cleanup())
+	}
+	return zipFile, buildDirArchive, nil
+}
+
 // UpdateInstances will perform any actions necessary to update instances in a GameLift fleet
-func (f *FleetUpdater) UpdateInstances(ctx context.Context) (*FleetUpdateResults, error) {
+func (f *FleetUpdater) UpdateInstances(ctx context.Context) (results *FleetUpdateResults, err error) {
+	ctx, span := config.Tracer().Start(ctx, "UpdateFleet", trace.WithAttributes(config.AttributeFleetId.String(f.args.FleetId)))
+	defer func() {
+		// A failed update is already reported per instance, only mark the span as failed when the update never got going
+		if err == UpdateFailedError {
+			config.EndSpan(span, nil)
+		} else {
+			config.EndSpan(span, err)
+		}
+	}()
+
 	f.logger.Info("starting fleet update process")
 
 	f.reportWriter.Preparing()
 
-	fleet, err := f.lookupFleet(ctx)
-	if err != nil {
-		return nil, err
+	// Load the key first, so the user is prompted for a passphrase before we make any changes to the fleet
+	var sshKey ssh.Signer
+	if f.args.UsesSSH() {
+		sshKey, err = f.loadSSHKey(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = f.validateZipFile(ctx, fleet)
+	fleet, err := f.lookupFleet(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	sshPort, err := f.ensureSSHPortIsSet(ctx, fleet.OperatingSystem)
+	// Lock the fleet before anything is changed, so no one else updates it at the same time
+	err = f.lockFleet(ctx, fleet)
 	if err != nil {
 		return nil, err
 	}
 
-	err = f.ensureSSHPortIsOpenForFleet(ctx, sshPort)
+	err = f.validateZipFile(ctx, fleet)
 	if err != nil {
 		return nil, err
 	}
 
-	updateScript, err := f.generateUpdateScript(ctx, fleet)
-	if err != nil {
-		return nil, err
+	// No SSH port is needed when everything is sent through SSM
+	var sshPort int32
+	if f.args.UsesSSH() {
+		sshPort, err = f.ensureSSHPortIsSet(ctx, fleet.OperatingSystem)
+		if err != nil {
+			return nil, err
+		}
+
+		err = f.ensureSSHPortIsOpenForFleet(ctx, sshPort)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	sshKey, err := f.loadSSHKey(ctx)
+	updateScript, err := f.generateUpdateScript(ctx, fleet)
 	if err != nil {
 		return nil, err
 	}
@@ -94,28 +187,48 @@ func (f *FleetUpdater) UpdateInstances(ctx context.Context) (*FleetUpdateResults
 }
 
 // lookupFleet will verify the fleet exists, and fetch any relevant data we need to perform an update
-func (f *FleetUpdater) lookupFleet(ctx context.Context) (*gamelift.Fleet, error) {
-	fleet, err := f.gameLiftClient.GetFleet(ctx, f.args.FleetId)
+func (f *FleetUpdater) lookupFleet(ctx context.Context) (fleet *gamelift.Fleet, err error) {
+	ctx, span := config.Tracer().Start(ctx, "GetFleet", trace.WithAttributes(config.AttributeFleetId.String(f.args.FleetId)))
+	defer func() { config.EndSpan(span, err) }()
+
+	fleet, err = f.gameLiftClient.GetFleet(ctx, f.args.FleetId)
 	if err != nil {
 		return fleet, fmt.Errorf("error looking up fleet: %w", err)
 	}
 
+	span.SetAttributes(config.AttributeOperatingSystem.String(fleet.OperatingSystem.String()))
 	f.logger.Debug("looking up fleet attributes", "os", fleet.OperatingSystem, "executables", fleet.ExecutablePaths)
 
 	return fleet, nil
 }
 
-// validateZipFile will validate that the zip file provided by the user is valid for the given fleet
+// lockFleet will take the advisory lock on the fleet, it is released in Cleanup
+func (f *FleetUpdater) lockFleet(ctx context.Context, fleet *gamelift.Fleet) error {
+	if f.fleetLocker == nil {
+		return nil
+	}
+
+	err := f.fleetLocker.Acquire(ctx, fleet)
+	if err != nil {
+		return fmt.Errorf("error locking fleet: %w", err)
+	}
+
+	f.logger.Debug("done locking fleet")
+
+	return nil
+}
+
+// validateZipFile will validate that the build archive provided by the user is valid for the given fleet
 func (f *FleetUpdater) validateZipFile(ctx context.Context, fleet *gamelift.Fleet) error {
-	// If the user is restarting server processes, we don't have a zip file to validate
+	// If the user is restarting server processes, we don't have a build archive to validate
 	if f.args.RestartProcess {
-		f.logger.Debug("running as a restart process update, skipping zip file validation")
+		f.logger.Debug("running as a restart process update, skipping build archive validation")
 		return nil
 	}
 
 	err := f.zipValidator.ValidateZip(ctx, fleet)
 	if err != nil {
-		return fmt.Errorf("error validating zip file: %w", err)
+		return fmt.Errorf("error validating build archive: %w", err)
 	}
 
 	f.logger.Debug("done validating zip file")
@@ -136,19 +249,38 @@ func (f *FleetUpdater) ensureSSHPortIsSet(ctx context.Context, os config.Operati
 }
 
 // ensureSSHPortIsOpenForFleet will update GameLift configuration to verify the ssh port is open for the IP range provided by the user
-func (f *FleetUpdater) ensureSSHPortIsOpenForFleet(ctx context.Context, sshPort int32) error {
-	err := f.gameLiftClient.OpenPortForFleet(ctx, f.args.FleetId, sshPort, f.args.IpRange)
+func (f *FleetUpdater) ensureSSHPortIsOpenForFleet(ctx context.Context, sshPort int32) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "OpenPortForFleet", trace.WithAttributes(config.AttributeFleetId.String(f.args.FleetId)))
+	defer func() { config.EndSpan(span, err) }()
+
+	opened, err := f.gameLiftClient.OpenPortForFleet(ctx, f.args.FleetId, sshPort, f.args.IpRange)
 	if err != nil {
 		return fmt.Errorf("error opening port for fleet %w", err)
 	}
 
-	f.logger.Debug("done ensuring SSH port is open for fleet")
+	// Only keep track of the port if this run opened it, we should not remove access that someone else granted
+	if opened {
+		f.openedPort = sshPort
+	}
+
+	f.logger.Debug("done ensuring SSH port is open for fleet", "openedByThisRun", opened)
 
 	return nil
 }
 
-// loadSSHKey will load the SSH key provided by the user
+// loadSSHKey will load the SSH key provided by the user, or generate an ephemeral key for this run
 func (f *FleetUpdater) loadSSHKey(ctx context.Context) (ssh.Signer, error) {
+	if f.args.EphemeralKey {
+		signer, err := f.sshConfigManager.GenerateEphemeralKey(ctx)
+		if err != nil {
+			return signer, err
+		}
+
+		f.logger.Debug("done generating ephemeral ssh key")
+
+		return signer, nil
+	}
+
 	signer, err := f.sshConfigManager.LoadKey(ctx)
 	if err != nil {
 		return signer, fmt.Errorf("error loading private ssh key %w", err)
@@ -173,8 +305,11 @@ func (f *FleetUpdater) generateUpdateScript(ctx context.Context, fleet *gamelift
 }
 
 // getInstances will load any relevant instances for this update operation
-func (f *FleetUpdater) getInstances(ctx context.Context) ([]*gamelift.Instance, error) {
-	instances, err := f.gameLiftClient.GetInstances(ctx, f.args.FleetId, f.args.InstanceIds)
+func (f *FleetUpdater) getInstances(ctx context.Context) (instances []*gamelift.Instance, err error) {
+	ctx, span := config.Tracer().Start(ctx, "GetInstances", trace.WithAttributes(config.AttributeFleetId.String(f.args.FleetId)))
+	defer func() { config.EndSpan(span, err) }()
+
+	instances, err = f.gameLiftClient.GetInstances(ctx, f.args.FleetId, f.args.InstanceIds)
 	if err != nil {
 		return instances, fmt.Errorf("error fetching instances for fleet: %w", err)
 	}
@@ -190,36 +325,132 @@ func (f *FleetUpdater) updateInstances(ctx context.Context, instances []*gamelif
 
 	f.reportWriter.StartUpdatingInstances(len(instances))
 
-	results := &FleetUpdateResults{
-		InstancesFound:        len(instances),
-		InstancesFailedUpdate: make([]string, 0, len(instances)),
+	if f.notifier != nil {
+		f.notifier.Started(ctx, len(instances))
 	}
 
-	for _, instance := range instances {
+	if f.dashboard != nil {
+		err := f.dashboard.Start(instances)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// updateErrors holds the result of the last attempt to update each instance, instances that were canceled are never attempted
+	updateErrors := make(map[string]error, len(instances))
+
+	queue := instances
+	for len(queue) > 0 {
+		instance := queue[0]
+		queue = queue[1:]
+
+		if f.dashboard != nil && f.dashboard.Canceled(instance.InstanceId) {
+			continue
+		}
+
+		// Another run is updating the fleet now, so the instances left are not updated to avoid both runs changing the same instance
+		if f.fleetLocker != nil && f.fleetLocker.Lost() {
+			slog.Error("Fleet lock was taken by another run, the remaining instances will not be updated", "instancesLeft", len(queue)+1)
+			break
+		}
+
 		err := f.updateInstance(ctx, sshKey, sshPort, updateScript, instance)
 		if err != nil {
 			// If we fail to update an instance, log the error and continue. We may still be able to update other instances in the fleet
 			slog.Error("Error updating remote instance", "error", err, "instanceId", instance.InstanceId)
-			results.InstancesFailedUpdate = append(results.InstancesFailedUpdate, instance.InstanceId)
-			continue
+
+			if f.notifier != nil {
+				f.notifier.InstanceFailed(ctx, instance, err)
+			}
+		}
+		updateErrors[instance.InstanceId] = err
+
+		// Failed instances the user asked to retry are updated again once the rest of the queue is done
+		if f.dashboard != nil {
+			queue = append(queue, instancesWithIds(instances, f.dashboard.TakeRetries())...)
+			if len(queue) == 0 {
+				queue = instancesWithIds(instances, f.dashboard.WaitForRetries(ctx))
+			}
+		}
+	}
+
+	if f.dashboard != nil {
+		f.dashboard.Stop()
+	}
+
+	results := &FleetUpdateResults{
+		InstancesFound:        len(instances),
+		InstancesFailedUpdate: make([]string, 0, len(instances)),
+		FailedSteps:           map[string]*tools.RemoteCommandError{},
+		ProcessStops:          map[string][]tools.ProcessStop{},
+		NoProcesses:           map[string][]tools.NoProcess{},
+	}
+
+	for _, instance := range instances {
+		err, attempted := updateErrors[instance.InstanceId]
+		if attempted {
+			status := f.instanceUpdaterFactory.ScriptStatus(instance.InstanceId)
+			if len(status.ProcessStops) > 0 {
+				results.ProcessStops[instance.InstanceId] = status.ProcessStops
+			}
+			if len(status.NoProcesses) > 0 {
+				results.NoProcesses[instance.InstanceId] = status.NoProcesses
+			}
 		}
 
-		results.InstancesUpdated = results.InstancesUpdated + 1
+		switch {
+		case !attempted:
+			results.InstancesCanceled = append(results.InstancesCanceled, instance.InstanceId)
+		case err != nil:
+			results.InstancesFailedUpdate = append(results.InstancesFailedUpdate, instance.InstanceId)
+
+			var stepErr *tools.RemoteCommandError
+			if errors.As(err, &stepErr) {
+				results.FailedSteps[instance.InstanceId] = stepErr
+			}
+		default:
+			results.InstancesUpdated = results.InstancesUpdated + 1
+		}
 	}
 
 	// We're done updating instances, write the report out for the user
 	f.reportWriter.ReportResults(results)
 
-	// If any instances failed to update, ensure that we return an error
-	if len(results.InstancesFailedUpdate) > 0 {
+	if f.notifier != nil {
+		f.notifier.Completed(ctx, results)
+	}
+
+	// If any instances failed to update, or were canceled, ensure that we return an error
+	if len(results.InstancesFailedUpdate) > 0 || len(results.InstancesCanceled) > 0 {
 		return results, UpdateFailedError
 	}
 
 	return results, nil
 }
 
+// instancesWithIds returns the instances with the given IDs, in the order of instanceIds
+func instancesWithIds(instances []*gamelift.Instance, instanceIds []string) []*gamelift.Instance {
+	result := make([]*gamelift.Instance, 0, len(instanceIds))
+	for _, instanceId := range instanceIds {
+		for _, instance := range instances {
+			if instance.InstanceId == instanceId {
+				result = append(result, instance)
+			}
+		}
+	}
+	return result
+}
+
 // updateInstance update an individual instance in the fleet
-func (f *FleetUpdater) updateInstance(ctx context.Context, sshKey ssh.Signer, sshPort int32, updateScript string, instance *gamelift.Instance) error {
+func (f *FleetUpdater) updateInstance(ctx context.Context, sshKey ssh.Signer, sshPort int32, updateScript string, instance *gamelift.Instance) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "UpdateInstance", trace.WithAttributes(
+		config.AttributeFleetId.String(instance.FleetId),
+		config.AttributeInstanceId.String(instance.InstanceId),
+		config.AttributeRegion.String(instance.Region),
+		config.AttributeOperatingSystem.String(instance.OperatingSystem.String()),
+	))
+	defer func() { config.EndSpan(span, err) }()
+
 	// create a fleet updater
 	instanceUpdater, err := f.instanceUpdaterFactory.Create(ctx, f.args.Verbose, sshKey, updateScript, sshPort, instance)
 	if err != nil {
@@ -229,15 +460,41 @@ func (f *FleetUpdater) updateInstance(ctx context.Context, sshKey ssh.Signer, ss
 	// update the instance
 	err = instanceUpdater.Update(ctx)
 	if err != nil {
+		// Say why the update script failed when it stopped because a server process was not running
+		if status := f.instanceUpdaterFactory.ScriptStatus(instance.InstanceId); status.Failed() {
+			return fmt.Errorf("error updating instance, no server process was running for one of the executables: %w", err)
+		}
 		return fmt.Errorf("error updating instance: %w", err)
 	}
 
 	return nil
 }
 
-func (f *FleetUpdater) Cleanup() {
+// Cleanup will remove any local files, and revoke any fleet access that was set up by this FleetUpdater
+func (f *FleetUpdater) Cleanup(ctx context.Context) {
 	f.logger.Debug("cleaning up fleet updater resources")
 
+	if f.openedPort != 0 {
+		if f.args.KeepPortOpen {
+			f.logger.Debug("leaving SSH port open for fleet", "port", f.openedPort)
+		} else {
+			err := f.gameLiftClient.ClosePortForFleet(ctx, f.args.FleetId, f.openedPort, f.args.IpRange)
+			if err != nil {
+				f.logger.Warn("error closing SSH port for fleet", "port", f.openedPort, "err", err)
+			} else {
+				f.openedPort = 0
+				f.logger.Debug("done closing SSH port for fleet")
+			}
+		}
+	}
+
+	if f.sshConfigManager != nil {
+		err := f.sshConfigManager.Close()
+		if err != nil {
+			f.logger.Warn("error closing ssh agent connection", "err", err)
+		}
+	}
+
 	if f.updateScriptGenerator != nil {
 		err := f.updateScriptGenerator.Cleanup()
 		if err != nil {
@@ -245,5 +502,20 @@ func (f *FleetUpdater) Cleanup() {
 		}
 	}
 
+	if f.buildDirArchive != nil {
+		err := f.buildDirArchive.Cleanup()
+		if err != nil {
+			f.logger.Warn("error cleaning up local build archive", "err", err)
+		}
+	}
+
+	// The lock is released last, once every change made to the fleet by this run has been undone
+	if f.fleetLocker != nil {
+		err := f.fleetLocker.Release(ctx)
+		if err != nil {
+			f.logger.Warn("error releasing fleet lock", "err", err)
+		}
+	}
+
 	f.logger.Debug("done cleaning up fleet updater resources")
 }
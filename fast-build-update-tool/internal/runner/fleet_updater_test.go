@@ -6,17 +6,23 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
-	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -28,6 +34,28 @@ func NewTestLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
 }
 
+// testRecordSpans records every span started by the test in memory
+func testRecordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return exporter
+}
+
+// testSpan returns the recorded span with the given name
+func testSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %s was recorded", name)
+	return tracetest.SpanStub{}
+}
+
 type FleetUpdaterTestSuite struct {
 	suite.Suite
 
@@ -110,12 +138,20 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesSuccess() {
 		GetInstancesFunc: func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
 			return []*gamelift.Instance{s.defaultInstance}, nil
 		},
-		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
+		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+			return true, nil
+		},
+		ClosePortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
 			return nil
 		},
 	}
 
 	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{
+				ProcessStops: []tools.ProcessStop{{Pid: 1234, Name: "/local/game/server", Result: tools.ProcessStopExited, Waited: 3 * time.Second}},
+			}
+		},
 		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
 			return &InstanceUpdaterMock{
 				UpdateFunc: func(ctx context.Context) error {
@@ -129,13 +165,13 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesSuccess() {
 		args:                   s.defaultArgs,
 		gameLiftClient:         gameliftClient,
 		logger:                 logger,
-		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), s.defaultArgs.BuildZipPath, s.defaultArgs.LockName),
-		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort),
-		zipValidator:           tools.NewZipValidator(s.defaultArgs.BuildZipPath),
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), tools.ArchiveFile(s.defaultArgs.BuildZipPath), s.defaultArgs.LockName, s.defaultArgs.Hooks(), nil, 0, ""),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(s.defaultArgs.BuildZipPath)),
 		instanceUpdaterFactory: instanceUpdaterFactory,
 		reportWriter:           NewFleetUpdateReportWriter(s.defaultArgs.FleetId, s.defaultArgs.Verbose),
 	}
-	defer f.Cleanup()
+	defer f.Cleanup(context.Background())
 
 	results, err := f.UpdateInstances(context.Background())
 
@@ -144,6 +180,7 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesSuccess() {
 	assert.Empty(t, results.InstancesFailedUpdate)
 	assert.Equal(t, 1, results.InstancesFound)
 	assert.Equal(t, 1, results.InstancesUpdated)
+	assert.Equal(t, []tools.ProcessStop{{Pid: 1234, Name: "/local/game/server", Result: tools.ProcessStopExited, Waited: 3 * time.Second}}, results.ProcessStops[s.defaultInstance.InstanceId])
 
 	createCalls := instanceUpdaterFactory.CreateCalls()
 	assert.Len(t, createCalls, 1)
@@ -152,6 +189,72 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesSuccess() {
 	assert.NotEmpty(t, createCalls[0].UpdateScript)
 	assert.Equal(t, int32(22), createCalls[0].SshPort)
 	assert.Equal(t, s.defaultInstance, createCalls[0].Instance)
+
+	// Make sure the port opened by this run is closed again
+	f.Cleanup(context.Background())
+	closeCalls := gameliftClient.ClosePortForFleetCalls()
+	assert.Len(t, closeCalls, 1)
+	assert.Equal(t, fleetId, closeCalls[0].FleetId)
+	assert.Equal(t, int32(22), closeCalls[0].Port)
+	assert.Equal(t, s.defaultArgs.IpRange, closeCalls[0].IpRange)
+}
+
+// TestUpdateInstancesSSMTransport ensures that no key is loaded, and no port is opened, when the update is sent through SSM
+func (s *FleetUpdaterTestSuite) TestUpdateInstancesSSMTransport() {
+	t := s.T()
+
+	logger := NewTestLogger()
+
+	args := s.defaultArgs
+	args.Transport = config.TransportSSM
+	args.IpRange = ""
+	args.PrivateKeyPath = ""
+	args.SSHPort = 0
+
+	gameliftClient := &GameLiftClientMock{
+		GetFleetFunc: func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+			return &gamelift.Fleet{Id: fleetId, OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"bin/server.exe"}}, nil
+		},
+		GetInstancesFunc: func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+			return []*gamelift.Instance{s.defaultInstance}, nil
+		},
+	}
+
+	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{}
+		},
+		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
+			return &InstanceUpdaterMock{
+				UpdateFunc: func(ctx context.Context) error {
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	f := &FleetUpdater{
+		args:                   args,
+		gameLiftClient:         gameliftClient,
+		logger:                 logger,
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(args.GetUpdateOperation(), tools.ArchiveFile(args.BuildZipPath), args.LockName, args.Hooks(), nil, 0, ""),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, args.PrivateKeyPath, args.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(args.BuildZipPath)),
+		instanceUpdaterFactory: instanceUpdaterFactory,
+		reportWriter:           NewFleetUpdateReportWriter(args.FleetId, args.Verbose),
+	}
+	defer f.Cleanup(context.Background())
+
+	results, err := f.UpdateInstances(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, results.InstancesUpdated)
+
+	createCalls := instanceUpdaterFactory.CreateCalls()
+	assert.Len(t, createCalls, 1)
+	assert.Nil(t, createCalls[0].SshKey)
+	assert.Equal(t, int32(0), createCalls[0].SshPort)
+	assert.Equal(t, int32(0), f.openedPort)
 }
 
 // TestUpdateInstancesFailed ensures we return proper errors, and results when updating an instance in the fleet fails
@@ -167,17 +270,26 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesFailed() {
 		GetInstancesFunc: func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
 			return []*gamelift.Instance{s.defaultInstance}, nil
 		},
-		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
+		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+			return true, nil
+		},
+		ClosePortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
 			return nil
 		},
 	}
 
-	// Set up an instance updater that fails
+	webhook := newTestWebhookServer(t)
+
+	// Set up an instance updater that fails in a remote step
+	stepErr := &tools.RemoteCommandError{Step: "add public key to authorized_keys", ExitCode: 1, LogFilePath: "i-1234-ssm-enable.log"}
 	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{}
+		},
 		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
 			return &InstanceUpdaterMock{
 				UpdateFunc: func(ctx context.Context) error {
-					return errors.New("failed to update instance")
+					return fmt.Errorf("error enabling ssh on remote instance %w", stepErr)
 				},
 			}, nil
 		},
@@ -187,13 +299,14 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesFailed() {
 		args:                   s.defaultArgs,
 		gameLiftClient:         gameliftClient,
 		logger:                 logger,
-		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), s.defaultArgs.BuildZipPath, s.defaultArgs.LockName),
-		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort),
-		zipValidator:           tools.NewZipValidator(s.defaultArgs.BuildZipPath),
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), tools.ArchiveFile(s.defaultArgs.BuildZipPath), s.defaultArgs.LockName, s.defaultArgs.Hooks(), nil, 0, ""),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(s.defaultArgs.BuildZipPath)),
 		instanceUpdaterFactory: instanceUpdaterFactory,
 		reportWriter:           NewFleetUpdateReportWriter(s.defaultArgs.FleetId, s.defaultArgs.Verbose),
+		notifier:               testWebhookNotifier(config.WebhookOptions{URLs: []string{webhook.URL}}),
 	}
-	defer f.Cleanup()
+	defer f.Cleanup(context.Background())
 
 	results, err := f.UpdateInstances(context.Background())
 
@@ -202,4 +315,324 @@ func (s *FleetUpdaterTestSuite) TestUpdateInstancesFailed() {
 	assert.Len(t, results.InstancesFailedUpdate, 1)
 	assert.Equal(t, 1, results.InstancesFound)
 	assert.Equal(t, 0, results.InstancesUpdated)
+	assert.Equal(t, map[string]*tools.RemoteCommandError{s.defaultInstance.InstanceId: stepErr}, results.FailedSteps)
+
+	// Webhooks are notified when the update starts, when the instance fails, and when the update is done
+	events := make([]string, 0, 3)
+	for _, request := range webhook.received() {
+		events = append(events, request.header.Get(webhookEventHeader))
+	}
+	assert.Equal(t, []string{string(WebhookEventStarted), string(WebhookEventInstanceFailed), string(WebhookEventCompleted)}, events)
+}
+
+// TestUpdateInstancesSpans ensures a span is recorded for each step of the update, and for each instance
+func (s *FleetUpdaterTestSuite) TestUpdateInstancesSpans() {
+	t := s.T()
+	spans := testRecordSpans(t)
+
+	logger := NewTestLogger()
+
+	gameliftClient := &GameLiftClientMock{
+		GetFleetFunc: func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+			return &gamelift.Fleet{Id: fleetId, OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"bin/server.exe"}}, nil
+		},
+		GetInstancesFunc: func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+			return []*gamelift.Instance{s.defaultInstance}, nil
+		},
+		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{}
+		},
+		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
+			return &InstanceUpdaterMock{
+				UpdateFunc: func(ctx context.Context) error {
+					return fmt.Errorf("connection reset")
+				},
+			}, nil
+		},
+	}
+
+	f := &FleetUpdater{
+		args:                   s.defaultArgs,
+		gameLiftClient:         gameliftClient,
+		logger:                 logger,
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), tools.ArchiveFile(s.defaultArgs.BuildZipPath), s.defaultArgs.LockName, s.defaultArgs.Hooks(), nil, 0, ""),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(s.defaultArgs.BuildZipPath)),
+		instanceUpdaterFactory: instanceUpdaterFactory,
+		reportWriter:           NewFleetUpdateReportWriter(s.defaultArgs.FleetId, s.defaultArgs.Verbose),
+	}
+	defer f.Cleanup(context.Background())
+
+	_, err := f.UpdateInstances(context.Background())
+	assert.Equal(t, UpdateFailedError, err)
+
+	root := testSpan(t, spans, "UpdateFleet")
+	assert.Contains(t, root.Attributes, config.AttributeFleetId.String(fleetId))
+	assert.Equal(t, codes.Unset, root.Status.Code)
+
+	fleet := testSpan(t, spans, "GetFleet")
+	assert.Equal(t, root.SpanContext.SpanID(), fleet.Parent.SpanID())
+	assert.Contains(t, fleet.Attributes, config.AttributeOperatingSystem.String("linux"))
+
+	openPort := testSpan(t, spans, "OpenPortForFleet")
+	assert.Equal(t, root.SpanContext.SpanID(), openPort.Parent.SpanID())
+
+	instance := testSpan(t, spans, "UpdateInstance")
+	assert.Equal(t, root.SpanContext.SpanID(), instance.Parent.SpanID())
+	assert.Subset(t, instance.Attributes, []attribute.KeyValue{
+		config.AttributeFleetId.String(fleetId),
+		config.AttributeInstanceId.String("i-12345"),
+		config.AttributeRegion.String("us-east-1"),
+		config.AttributeOperatingSystem.String("linux"),
+	})
+	assert.Equal(t, codes.Error, instance.Status.Code)
+	assert.Contains(t, instance.Status.Description, "connection reset")
+}
+
+// TestUpdateInstancesNoProcess ensures an instance whose update script stopped because no server process was running is failed with the reason, and the executables are in the results
+func (s *FleetUpdaterTestSuite) TestUpdateInstancesNoProcess() {
+	t := s.T()
+	spans := testRecordSpans(t)
+
+	logger := NewTestLogger()
+
+	gameliftClient := &GameLiftClientMock{
+		GetFleetFunc: func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+			return &gamelift.Fleet{Id: fleetId, OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"bin/server.exe"}}, nil
+		},
+		GetInstancesFunc: func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+			return []*gamelift.Instance{s.defaultInstance}, nil
+		},
+		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	noProcesses := []tools.NoProcess{{Name: "/local/game/bin/server.exe", Policy: config.NoProcessPolicyFail}}
+	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{NoProcesses: noProcesses}
+		},
+		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
+			return &InstanceUpdaterMock{
+				UpdateFunc: func(ctx context.Context) error {
+					return fmt.Errorf("update script exited with code 1")
+				},
+			}, nil
+		},
+	}
+
+	f := &FleetUpdater{
+		args:                   s.defaultArgs,
+		gameLiftClient:         gameliftClient,
+		logger:                 logger,
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), tools.ArchiveFile(s.defaultArgs.BuildZipPath), s.defaultArgs.LockName, s.defaultArgs.Hooks(), nil, 0, config.NoProcessPolicyFail),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(s.defaultArgs.BuildZipPath)),
+		instanceUpdaterFactory: instanceUpdaterFactory,
+		reportWriter:           NewFleetUpdateReportWriter(s.defaultArgs.FleetId, s.defaultArgs.Verbose),
+	}
+	defer f.Cleanup(context.Background())
+
+	results, err := f.UpdateInstances(context.Background())
+	assert.Equal(t, UpdateFailedError, err)
+	assert.Equal(t, []string{s.defaultInstance.InstanceId}, results.InstancesFailedUpdate)
+	assert.Equal(t, noProcesses, results.NoProcesses[s.defaultInstance.InstanceId])
+
+	instance := testSpan(t, spans, "UpdateInstance")
+	assert.Contains(t, instance.Status.Description, "no server process was running for one of the executables: update script exited with code 1")
+}
+
+// TestUpdateInstancesFleetLocked ensures nothing is changed on a fleet that another run is updating, and the lock is released once the update is done
+func (s *FleetUpdaterTestSuite) TestUpdateInstancesFleetLocked() {
+	t := s.T()
+
+	logger := NewTestLogger()
+
+	gameliftClient := testFleetLockClient(&gamelift.FleetLock{Owner: "alex", Host: "devbox", RunId: "run-1", Expires: time.Now().Add(time.Hour)})
+	gameliftClient.GetFleetFunc = func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+		return &gamelift.Fleet{Id: fleetId, Arn: testFleetArn, OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"bin/server.exe"}}, nil
+	}
+	gameliftClient.GetInstancesFunc = func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+		return []*gamelift.Instance{s.defaultInstance}, nil
+	}
+	gameliftClient.OpenPortForFleetFunc = func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+		return false, nil
+	}
+
+	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{}
+		},
+		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
+			return &InstanceUpdaterMock{
+				UpdateFunc: func(ctx context.Context) error {
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	f := &FleetUpdater{
+		args:                   s.defaultArgs,
+		gameLiftClient:         gameliftClient,
+		logger:                 logger,
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), tools.ArchiveFile(s.defaultArgs.BuildZipPath), s.defaultArgs.LockName, s.defaultArgs.Hooks(), nil, 0, ""),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(s.defaultArgs.BuildZipPath)),
+		instanceUpdaterFactory: instanceUpdaterFactory,
+		reportWriter:           NewFleetUpdateReportWriter(s.defaultArgs.FleetId, s.defaultArgs.Verbose),
+		fleetLocker:            testFleetLocker(gameliftClient, time.Hour),
+	}
+
+	_, err := f.UpdateInstances(context.Background())
+
+	var lockedErr *FleetLockedError
+	assert.ErrorAs(t, err, &lockedErr)
+	assert.Empty(t, gameliftClient.OpenPortForFleetCalls())
+	assert.Empty(t, instanceUpdaterFactory.CreateCalls())
+
+	f.Cleanup(context.Background())
+	assert.Empty(t, gameliftClient.RemoveFleetLockCalls())
+
+	// Once the other run is done, the fleet can be updated
+	assert.Nil(t, gameliftClient.RemoveFleetLock(context.Background(), testFleetArn))
+
+	_, err = f.UpdateInstances(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, instanceUpdaterFactory.CreateCalls(), 1)
+
+	f.Cleanup(context.Background())
+	lock, _ := gameliftClient.GetFleetLock(context.Background(), testFleetArn)
+	assert.Nil(t, lock)
+}
+
+// TestUpdateInstancesFleetLockLost ensures no more instances are updated once another run took the lock on the fleet
+func (s *FleetUpdaterTestSuite) TestUpdateInstancesFleetLockLost() {
+	t := s.T()
+
+	logger := NewTestLogger()
+	other := &gamelift.Instance{InstanceId: "i-2", IpAddress: "127.0.0.2", OperatingSystem: config.OperatingSystemLinux}
+
+	gameliftClient := testFleetLockClient(nil)
+	gameliftClient.GetFleetFunc = func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
+		return &gamelift.Fleet{Id: fleetId, Arn: testFleetArn, OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"bin/server.exe"}}, nil
+	}
+	gameliftClient.GetInstancesFunc = func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+		return []*gamelift.Instance{s.defaultInstance, other}, nil
+	}
+	gameliftClient.OpenPortForFleetFunc = func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+		return false, nil
+	}
+
+	// The lock is renewed often, so it is noticed quickly when another run takes it
+	locker := testFleetLocker(gameliftClient, 30*time.Millisecond)
+
+	instanceUpdaterFactory := &InstanceUpdaterFactoryMock{
+		ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+			return tools.UpdateScriptStatus{}
+		},
+		CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
+			return &InstanceUpdaterMock{
+				UpdateFunc: func(ctx context.Context) error {
+					// Someone breaks the lock while the first instance is updated, and another run takes it
+					assert.Nil(t, gameliftClient.PutFleetLock(ctx, testFleetArn, &gamelift.FleetLock{RunId: "run-3"}))
+					assert.Eventually(t, locker.Lost, time.Second, 5*time.Millisecond)
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	f := &FleetUpdater{
+		args:                   s.defaultArgs,
+		gameLiftClient:         gameliftClient,
+		logger:                 logger,
+		updateScriptGenerator:  tools.NewInstanceUpdateScriptGenerator(s.defaultArgs.GetUpdateOperation(), tools.ArchiveFile(s.defaultArgs.BuildZipPath), s.defaultArgs.LockName, s.defaultArgs.Hooks(), nil, 0, ""),
+		sshConfigManager:       tools.NewSSHConfigManager(logger, s.defaultArgs.PrivateKeyPath, s.defaultArgs.SSHPort, false, ""),
+		zipValidator:           tools.NewZipValidator(tools.ArchiveFile(s.defaultArgs.BuildZipPath)),
+		instanceUpdaterFactory: instanceUpdaterFactory,
+		reportWriter:           NewFleetUpdateReportWriter(s.defaultArgs.FleetId, s.defaultArgs.Verbose),
+		fleetLocker:            locker,
+	}
+
+	results, err := f.UpdateInstances(context.Background())
+	assert.Equal(t, UpdateFailedError, err)
+	assert.Len(t, instanceUpdaterFactory.CreateCalls(), 1)
+	assert.Equal(t, 1, results.InstancesUpdated)
+	assert.Equal(t, []string{"i-2"}, results.InstancesCanceled)
+
+	// The lock of the other run is left in place
+	f.Cleanup(context.Background())
+	assert.Empty(t, gameliftClient.RemoveFleetLockCalls())
+}
+
+// TestCleanupPortNotOpenedByRun ensures we never close a port that was already open before this run started
+func (s *FleetUpdaterTestSuite) TestCleanupPortNotOpenedByRun() {
+	t := s.T()
+
+	gameliftClient := &GameLiftClientMock{
+		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+			return false, nil
+		},
+		ClosePortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
+			return nil
+		},
+	}
+
+	f := &FleetUpdater{args: s.defaultArgs, gameLiftClient: gameliftClient, logger: NewTestLogger()}
+
+	err := f.ensureSSHPortIsOpenForFleet(context.Background(), 22)
+	assert.Nil(t, err)
+
+	f.Cleanup(context.Background())
+	assert.Len(t, gameliftClient.ClosePortForFleetCalls(), 0)
+}
+
+// TestCleanupKeepPortOpen ensures we leave the port open when the user asks us to
+func (s *FleetUpdaterTestSuite) TestCleanupKeepPortOpen() {
+	t := s.T()
+
+	gameliftClient := &GameLiftClientMock{
+		OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
+			return true, nil
+		},
+		ClosePortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
+			return nil
+		},
+	}
+
+	args := s.defaultArgs
+	args.KeepPortOpen = true
+
+	f := &FleetUpdater{args: args, gameLiftClient: gameliftClient, logger: NewTestLogger()}
+
+	err := f.ensureSSHPortIsOpenForFleet(context.Background(), 22)
+	assert.Nil(t, err)
+
+	f.Cleanup(context.Background())
+	assert.Len(t, gameliftClient.ClosePortForFleetCalls(), 0)
+}
+
+// TestLoadSSHKeyEphemeral ensures that an ephemeral key is generated instead of loading one from disk
+func (s *FleetUpdaterTestSuite) TestLoadSSHKeyEphemeral() {
+	t := s.T()
+
+	logger := NewTestLogger()
+
+	args := s.defaultArgs
+	args.PrivateKeyPath = ""
+	args.EphemeralKey = true
+
+	f := &FleetUpdater{args: args, logger: logger, sshConfigManager: tools.NewSSHConfigManager(logger, args.PrivateKeyPath, args.SSHPort, false, "")}
+
+	signer, err := f.loadSSHKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "ssh-ed25519", signer.PublicKey().Type())
 }
@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"github.com/pterm/pterm"
+)
+
+//go:generate moq -skip-ensure -out ./moq_remote_update_lock_test.go . RemoteUpdateLock
+
+// RemoteUpdateLock is an abstraction around the lock the update script takes on an instance
+type RemoteUpdateLock interface {
+	// Inspect finds out whether the lock is held, and what a run that died left behind
+	Inspect(ctx context.Context) (*tools.UpdateLockStatus, error)
+	// Release stops the processes in status, and returns the state of the lock afterwards
+	Release(ctx context.Context, status *tools.UpdateLockStatus, cleanArchives bool) (*tools.UpdateLockStatus, error)
+}
+
+// InstanceLockCommand is used to show whether the update lock is held on the instances in a fleet, and to release it when an update died while holding it
+type InstanceLockCommand struct {
+	args config.InstanceLockArgs
+
+	logger *slog.Logger
+
+	gameLiftClient GameLiftClient
+	newUpdateLock  func(logger *slog.Logger, instance *gamelift.Instance) (RemoteUpdateLock, error)
+	// confirm asks the user whether to go ahead, it returns false if they declined
+	confirm func(message string) (bool, error)
+	now     func() time.Time
+}
+
+// InstanceLockResults holds the state of the update lock on each instance that was inspected
+type InstanceLockResults struct {
+	InstancesFound int
+	// Statuses is the state of the lock on each instance, by instance id. Once the lock is released it is the state afterwards.
+	Statuses          map[string]*tools.UpdateLockStatus
+	InstancesReleased []string
+	InstancesFailed   []string
+}
+
+// NewInstanceLockCommand will build a new InstanceLockCommand using command line arguments
+func NewInstanceLockCommand(ctx context.Context, logger *config.ApplicationLogger, args config.InstanceLockArgs) (*InstanceLockCommand, error) {
+	gameLift, err := gamelift.NewGameLiftClient(ctx, logger.AwsLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstanceLockCommand{
+		args:           args,
+		logger:         logger.Logger.With("fleetId", args.FleetId),
+		gameLiftClient: gameLift,
+		newUpdateLock: func(logger *slog.Logger, instance *gamelift.Instance) (RemoteUpdateLock, error) {
+			return tools.NewUpdateLockInspector(logger, instance, gameLift, args.LockName)
+		},
+		confirm: func(message string) (bool, error) {
+			return pterm.DefaultInteractiveConfirm.WithDefaultValue(false).Show(message)
+		},
+		now: time.Now,
+	}, nil
+}
+
+// Run will show the state of the update lock on each instance, and release it after confirmation when the release action was requested
+func (i *InstanceLockCommand) Run(ctx context.Context) (*InstanceLockResults, error) {
+	fleet, err := i.gameLiftClient.GetFleet(ctx, i.args.FleetId)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up fleet: %w", err)
+	}
+
+	// While another run holds the fleet lock, the update lock is held by an update that is still going
+	if i.args.Action == config.InstanceLockActionRelease {
+		lock, err := i.gameLiftClient.GetFleetLock(ctx, fleet.Arn)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up fleet lock: %w", err)
+		}
+		if lock != nil && !lock.Expired(i.now()) {
+			return nil, &FleetLockedError{FleetId: fleet.Id, Lock: lock}
+		}
+	}
+
+	instances, err := i.gameLiftClient.GetInstances(ctx, i.args.FleetId, i.args.InstanceIds)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching instances for fleet: %w", err)
+	}
+
+	results := &InstanceLockResults{
+		InstancesFound:    len(instances),
+		Statuses:          make(map[string]*tools.UpdateLockStatus, len(instances)),
+		InstancesReleased: make([]string, 0),
+		InstancesFailed:   make([]string, 0),
+	}
+
+	updateLocks := make(map[string]RemoteUpdateLock, len(instances))
+	for _, instance := range instances {
+		instanceLogger := i.logger.With("instanceId", instance.InstanceId)
+
+		updateLock, err := i.newUpdateLock(instanceLogger, instance)
+		var status *tools.UpdateLockStatus
+		if err == nil {
+			status, err = updateLock.Inspect(ctx)
+		}
+
+		if err != nil {
+			// If we fail to inspect an instance, log the error and continue. We may still be able to inspect other instances in the fleet
+			instanceLogger.Error("error inspecting update lock on remote instance", "error", err)
+			results.InstancesFailed = append(results.InstancesFailed, instance.InstanceId)
+			continue
+		}
+
+		instanceLogger.Debug("inspected update lock", "held", status.Held, "processIds", status.ProcessIds(), "archives", len(status.Archives))
+		updateLocks[instance.InstanceId] = updateLock
+		results.Statuses[instance.InstanceId] = status
+	}
+
+	i.reportStatuses(instances, results)
+
+	if i.args.Action == config.InstanceLockActionRelease {
+		err = i.release(ctx, instances, updateLocks, results)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	if len(results.InstancesFailed) > 0 {
+		return results, fmt.Errorf("failed to inspect, or release the update lock on instance(s): %s", strings.Join(results.InstancesFailed, ", "))
+	}
+
+	return results, nil
+}
+
+// release will ask the user to confirm, and then release the lock on every instance where there is something to release
+func (i *InstanceLockCommand) release(ctx context.Context, instances []*gamelift.Instance, updateLocks map[string]RemoteUpdateLock, results *InstanceLockResults) error {
+	toRelease := make([]*gamelift.Instance, 0, len(instances))
+	processCount, archiveCount := 0, 0
+	for _, instance := range instances {
+		status, found := results.Statuses[instance.InstanceId]
+		if !found || !i.needsRelease(status) {
+			continue
+		}
+		toRelease = append(toRelease, instance)
+		processCount += len(status.ProcessIds())
+		if i.args.CleanArchives {
+			archiveCount += len(status.Archives)
+		}
+	}
+
+	if len(toRelease) == 0 {
+		i.logger.Debug("nothing to release on any instance")
+		if !i.args.Verbose {
+			pterm.Success.Println("Nothing to release")
+		}
+		return nil
+	}
+
+	if !i.args.Yes {
+		message := fmt.Sprintf("Stop %d process(es)", processCount)
+		if i.args.CleanArchives {
+			message += fmt.Sprintf(", and remove %d archive(s)", archiveCount)
+		}
+		message += fmt.Sprintf(" to release the update lock on %d instance(s)?", len(toRelease))
+
+		confirmed, err := i.confirm(message)
+		if err != nil {
+			return fmt.Errorf("error asking for confirmation, use --yes to release the lock without it: %w", err)
+		}
+		if !confirmed {
+			i.logger.Info("release was not confirmed, nothing was changed")
+			if !i.args.Verbose {
+				pterm.Info.Println("Nothing was changed")
+			}
+			return nil
+		}
+	}
+
+	for _, instance := range toRelease {
+		instanceLogger := i.logger.With("instanceId", instance.InstanceId)
+
+		status, err := updateLocks[instance.InstanceId].Release(ctx, results.Statuses[instance.InstanceId], i.args.CleanArchives)
+		if err == nil && status.Held {
+			err = errors.New("the update lock is still held after every process holding it was stopped")
+		}
+
+		if err != nil {
+			instanceLogger.Error("error releasing update lock on remote instance", "error", err)
+			results.InstancesFailed = append(results.InstancesFailed, instance.InstanceId)
+			if status != nil {
+				results.Statuses[instance.InstanceId] = status
+			}
+			continue
+		}
+
+		instanceLogger.Info("released update lock")
+		results.Statuses[instance.InstanceId] = status
+		results.InstancesReleased = append(results.InstancesReleased, instance.InstanceId)
+	}
+
+	i.reportReleased(results)
+
+	return nil
+}
+
+// needsRelease returns true if the lock is held on the instance, or a run that died left something behind that should be removed
+func (i *InstanceLockCommand) needsRelease(status *tools.UpdateLockStatus) bool {
+	return status.Held || len(status.ProcessIds()) > 0 || (i.args.CleanArchives && len(status.Archives) > 0)
+}
+
+// reportStatuses will print out the state of the lock on each instance that was inspected
+func (i *InstanceLockCommand) reportStatuses(instances []*gamelift.Instance, results *InstanceLockResults) {
+	if i.args.Verbose {
+		return
+	}
+
+	for _, instance := range instances {
+		status, found := results.Statuses[instance.InstanceId]
+		if !found {
+			pterm.Error.Printf("Failed to inspect the update lock on instance: %s\n", instance.InstanceId)
+			continue
+		}
+
+		if status.Held {
+			pterm.Warning.Printf("Update lock %s is held on instance: %s\n", status.LockPath, instance.InstanceId)
+		} else {
+			pterm.Success.Printf("Update lock %s is free on instance: %s\n", status.LockPath, instance.InstanceId)
+		}
+
+		for _, process := range status.Holders {
+			pterm.Printf("  Held by PID %d: %s\n", process.Pid, process.Command)
+		}
+		for _, process := range status.Scripts {
+			pterm.Printf("  Update script running as PID %d: %s\n", process.Pid, process.Command)
+		}
+		for _, archive := range status.Archives {
+			pterm.Printf("  Archive left behind: %s\n", archive)
+		}
+	}
+}
+
+// reportReleased will print out the instances the lock was released on
+func (i *InstanceLockCommand) reportReleased(results *InstanceLockResults) {
+	if i.args.Verbose {
+		return
+	}
+
+	if len(results.InstancesReleased) > 0 {
+		pterm.Success.Printf("Released the update lock on %d instance(s): %s\n", len(results.InstancesReleased), strings.Join(results.InstancesReleased, ", "))
+	}
+}
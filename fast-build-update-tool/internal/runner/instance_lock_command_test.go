@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+// testInstanceLockCommand builds an InstanceLockCommand for the instances that have a status in statuses, the lock on each of them is released once Release is called
+func testInstanceLockCommand(args config.InstanceLockArgs, fleetLock *gamelift.FleetLock, statuses map[string]*tools.UpdateLockStatus) (*InstanceLockCommand, map[string]*RemoteUpdateLockMock) {
+	client := testFleetLockClient(fleetLock)
+	client.GetInstancesFunc = func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
+		instances := []*gamelift.Instance{}
+		for _, instanceId := range []string{"i-1", "i-2", "i-3"} {
+			if _, found := statuses[instanceId]; found {
+				instances = append(instances, &gamelift.Instance{FleetId: fleetId, InstanceId: instanceId})
+			}
+		}
+		return instances, nil
+	}
+
+	updateLocks := map[string]*RemoteUpdateLockMock{}
+	for instanceId, status := range statuses {
+		status := status
+		updateLocks[instanceId] = &RemoteUpdateLockMock{
+			InspectFunc: func(ctx context.Context) (*tools.UpdateLockStatus, error) {
+				if status == nil {
+					return nil, errors.New("ssm session ended before it started")
+				}
+				return status, nil
+			},
+			ReleaseFunc: func(ctx context.Context, status *tools.UpdateLockStatus, cleanArchives bool) (*tools.UpdateLockStatus, error) {
+				return &tools.UpdateLockStatus{LockPath: status.LockPath}, nil
+			},
+		}
+	}
+
+	args.FleetId = fleetId
+	return &InstanceLockCommand{
+		args:           args,
+		logger:         NewTestLogger(),
+		gameLiftClient: client,
+		newUpdateLock: func(logger *slog.Logger, instance *gamelift.Instance) (RemoteUpdateLock, error) {
+			return updateLocks[instance.InstanceId], nil
+		},
+		confirm: func(message string) (bool, error) {
+			return true, nil
+		},
+		now: time.Now,
+	}, updateLocks
+}
+
+func testHeldUpdateLock() *tools.UpdateLockStatus {
+	return &tools.UpdateLockStatus{
+		LockPath: "/tmp/fast-build-update-tool.lock",
+		Held:     true,
+		Holders:  []tools.RemoteProcess{{Pid: 1200, Command: "/bin/bash /tmp/1234update-instance.sh"}},
+		Archives: []string{"/tmp/build.zip"},
+	}
+}
+
+// TestInstanceLockStatus ensures the lock is inspected on every instance, and nothing is released
+func TestInstanceLockStatus(t *testing.T) {
+	command, updateLocks := testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionStatus}, nil, map[string]*tools.UpdateLockStatus{
+		"i-1": testHeldUpdateLock(),
+		"i-2": {LockPath: "/tmp/fast-build-update-tool.lock"},
+	})
+
+	results, err := command.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, results.InstancesFound)
+	assert.True(t, results.Statuses["i-1"].Held)
+	assert.False(t, results.Statuses["i-2"].Held)
+	assert.Empty(t, results.InstancesReleased)
+
+	for _, updateLock := range updateLocks {
+		assert.Len(t, updateLock.InspectCalls(), 1)
+		assert.Empty(t, updateLock.ReleaseCalls())
+	}
+}
+
+// TestInstanceLockRelease ensures the lock is only released on instances where something was found, after the user confirmed it
+func TestInstanceLockRelease(t *testing.T) {
+	command, updateLocks := testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionRelease, CleanArchives: true}, nil, map[string]*tools.UpdateLockStatus{
+		"i-1": testHeldUpdateLock(),
+		"i-2": {LockPath: "/tmp/fast-build-update-tool.lock"},
+	})
+
+	var confirmed string
+	command.confirm = func(message string) (bool, error) {
+		confirmed = message
+		return true, nil
+	}
+
+	results, err := command.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "Stop 1 process(es), and remove 1 archive(s) to release the update lock on 1 instance(s)?", confirmed)
+	assert.Equal(t, []string{"i-1"}, results.InstancesReleased)
+	assert.False(t, results.Statuses["i-1"].Held)
+
+	assert.Len(t, updateLocks["i-1"].ReleaseCalls(), 1)
+	assert.Equal(t, testHeldUpdateLock(), updateLocks["i-1"].ReleaseCalls()[0].Status)
+	assert.True(t, updateLocks["i-1"].ReleaseCalls()[0].CleanArchives)
+	assert.Empty(t, updateLocks["i-2"].ReleaseCalls())
+}
+
+// TestInstanceLockReleaseDeclined ensures nothing is released when the user does not confirm it, and --yes skips the prompt
+func TestInstanceLockReleaseDeclined(t *testing.T) {
+	command, updateLocks := testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionRelease}, nil, map[string]*tools.UpdateLockStatus{"i-1": testHeldUpdateLock()})
+	command.confirm = func(message string) (bool, error) {
+		return false, nil
+	}
+
+	results, err := command.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, results.InstancesReleased)
+	assert.Empty(t, updateLocks["i-1"].ReleaseCalls())
+
+	command, updateLocks = testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionRelease, Yes: true}, nil, map[string]*tools.UpdateLockStatus{"i-1": testHeldUpdateLock()})
+	command.confirm = func(message string) (bool, error) {
+		return false, errors.New("prompt should not be shown")
+	}
+
+	results, err = command.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"i-1"}, results.InstancesReleased)
+	assert.False(t, updateLocks["i-1"].ReleaseCalls()[0].CleanArchives)
+}
+
+// TestInstanceLockReleaseFleetLocked ensures nothing is touched while another run holds the fleet lock, but an expired fleet lock is ignored
+func TestInstanceLockReleaseFleetLocked(t *testing.T) {
+	fleetLock := &gamelift.FleetLock{Owner: "alex", Host: "devbox", RunId: "run-1", Expires: time.Now().Add(10 * time.Minute)}
+	command, updateLocks := testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionRelease, Yes: true}, fleetLock, map[string]*tools.UpdateLockStatus{"i-1": testHeldUpdateLock()})
+
+	_, err := command.Run(context.Background())
+	var lockedErr *FleetLockedError
+	assert.ErrorAs(t, err, &lockedErr)
+	assert.Empty(t, updateLocks["i-1"].InspectCalls())
+
+	fleetLock.Expires = time.Now().Add(-time.Minute)
+	command, _ = testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionRelease, Yes: true}, fleetLock, map[string]*tools.UpdateLockStatus{"i-1": testHeldUpdateLock()})
+
+	results, err := command.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"i-1"}, results.InstancesReleased)
+}
+
+// TestInstanceLockFailures ensures an instance that can't be inspected, or is still locked after release, fails the command without stopping the others
+func TestInstanceLockFailures(t *testing.T) {
+	command, updateLocks := testInstanceLockCommand(config.InstanceLockArgs{Action: config.InstanceLockActionRelease, Yes: true}, nil, map[string]*tools.UpdateLockStatus{
+		"i-1": nil,
+		"i-2": testHeldUpdateLock(),
+		"i-3": testHeldUpdateLock(),
+	})
+	updateLocks["i-3"].ReleaseFunc = func(ctx context.Context, status *tools.UpdateLockStatus, cleanArchives bool) (*tools.UpdateLockStatus, error) {
+		return testHeldUpdateLock(), nil
+	}
+
+	results, err := command.Run(context.Background())
+	assert.ErrorContains(t, err, "failed to inspect, or release the update lock on instance(s): i-1, i-3")
+	assert.Equal(t, []string{"i-2"}, results.InstancesReleased)
+	assert.True(t, results.Statuses["i-3"].Held)
+}
@@ -3,6 +3,7 @@ package runner
 import (
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
 	"github.com/pterm/pterm"
@@ -10,7 +11,13 @@ import (
 
 // InstanceProgressWriter is used to track and display the progress of updating a single GameLift instance to the user
 type InstanceProgressWriter struct {
-	verbose             bool
+	// mutex is held while updating, the phases of the update script are found while its output is being read
+	mutex   sync.Mutex
+	verbose bool
+	// plain prints a line for each change in state instead of a progress bar, it is used when the dashboard can't be shown
+	plain bool
+	// dashboard is set when the progress is shown on the dashboard instead of a progress bar
+	dashboard           *dashboardInstance
 	instanceId          string
 	instanceIp          string
 	instanceUpdateState InstanceUpdateState
@@ -43,18 +50,61 @@ func NewInstanceProgressWriter(instance *gamelift.Instance, verbose bool) (*Inst
 	}, nil
 }
 
-// UpdateState update the instance progress with newState, and display any relevant information to the user
+// newPlainProgressWriter builds a progress writer that prints a line for each change in state, it can be used when stdout is not a terminal
+func newPlainProgressWriter(instance *gamelift.Instance) *InstanceProgressWriter {
+	return &InstanceProgressWriter{
+		plain:      true,
+		instanceId: instance.InstanceId,
+		instanceIp: instance.IpAddress,
+	}
+}
+
+// newDashboardProgressWriter builds a progress writer that shows the progress of the instance on its row of the dashboard
+func newDashboardProgressWriter(instance *gamelift.Instance, row *dashboardInstance) *InstanceProgressWriter {
+	row.start()
+
+	return &InstanceProgressWriter{
+		dashboard:  row,
+		instanceId: instance.InstanceId,
+		instanceIp: instance.IpAddress,
+	}
+}
+
+// UpdateState update the instance progress with newState, and display any relevant information to the user.
+// The progress bar never moves backwards, an earlier state only updates the title (the phases of the update script are not in the same order on every OS).
 func (i *InstanceProgressWriter) UpdateState(newState InstanceUpdateState) {
 	if i.verbose {
 		return
 	}
 
-	// Calculate the amount to update the progress bar
-	diff := newState - i.instanceUpdateState
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	advanced := newState > i.instanceUpdateState
+	diff := InstanceUpdateState(0)
+	if advanced {
+		diff = newState - i.instanceUpdateState
+		i.instanceUpdateState = newState
+	}
+
+	if i.dashboard != nil {
+		i.dashboard.setState(newState)
+		return
+	}
+
+	if i.plain {
+		if newState == UpdateStateCount {
+			pterm.Success.Println(i.instanceId)
+		} else {
+			pterm.Info.Println(stateString(i.instanceId, i.instanceIp, newState))
+		}
+		return
+	}
 
-	// Update the state and title with the new state
-	i.instanceUpdateState = newState
-	i.progressBar.UpdateTitle(stateString(i.instanceId, i.instanceIp, i.instanceUpdateState))
+	i.progressBar.UpdateTitle(stateString(i.instanceId, i.instanceIp, newState))
+	if !advanced {
+		return
+	}
 
 	// Actually update the progress bar (do this last, otherwise it causes display issues)
 	i.progressBar.Add(int(diff))
@@ -71,6 +121,19 @@ func (i *InstanceProgressWriter) UpdateFailed(err error) {
 		return
 	}
 
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.dashboard != nil {
+		i.dashboard.setFailed(err)
+		return
+	}
+
+	if i.plain {
+		pterm.Error.Printf("%s (%s) failed while %s\n", i.instanceId, i.instanceIp, i.instanceUpdateState.String())
+		return
+	}
+
 	_, stopErr := i.progressBar.Stop()
 	if stopErr != nil {
 		slog.Debug("error stopping progress bar", "error", stopErr)
@@ -2,33 +2,51 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
-	"golang.org/x/crypto/ssh"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 )
 
 //go:generate moq -skip-ensure -out ./moq_remote_ssh_enabler_test.go . RemoteSSHEnabler
 //go:generate moq -skip-ensure -out ./moq_remote_command_runner_test.go . CommandRunner
 //go:generate moq -skip-ensure -out ./moq_file_uploader_test.go . FileUploader
 //go:generate moq -skip-ensure -out ./moq_instance_updater_test.go . InstanceUpdater
+//go:generate moq -skip-ensure -out ./moq_remote_access_revoker_test.go . RemoteAccessRevoker
+//go:generate moq -skip-ensure -out ./moq_remote_session_test.go . RemoteSession
 
 // RemoteSSHEnabler is an abstraction around enabling access to an instance over SSH
 type RemoteSSHEnabler interface {
 	// Enable SSH on the remote instance
-	Enable(ctx context.Context) (remotePublicKey ssh.PublicKey, err error)
+	Enable(ctx context.Context) (hostKeys tools.HostKeys, err error)
+}
+
+// RemoteAccessRevoker is an abstraction around removing the access granted by a RemoteSSHEnabler
+type RemoteAccessRevoker interface {
+	// RevokeAccess removes SSH access from the remote instance
+	RevokeAccess(ctx context.Context) error
+}
+
+// RemoteSession is an abstraction around the SSH connection shared by the FileUploader and CommandRunner of an instance
+type RemoteSession interface {
+	// Connect to the remote instance, only trusting the provided host keys
+	Connect(ctx context.Context, hostKeys tools.HostKeys) error
+	// Close the connection to the remote instance
+	Close() error
 }
 
 // CommandRunner is an abstraction around running commands on a remote instance
 type CommandRunner interface {
 	// Run the command provided on the remote instance
-	Run(ctx context.Context, remotePublicKey ssh.PublicKey) error
+	Run(ctx context.Context) error
 }
 
 // FileUploader is an abstraction around copying files to a remote instance
 type FileUploader interface {
 	// CopyFiles will copy files to the remote instance
-	CopyFiles(ctx context.Context, remotePublicKey ssh.PublicKey) error
+	CopyFiles(ctx context.Context) error
 }
 
 // InstanceUpdater is used to update a single instance in a GameLift fleet
@@ -40,24 +58,35 @@ type InstanceUpdater interface {
 type instanceUpdater struct {
 	progressTracker *InstanceProgressWriter
 	sshEnabler      RemoteSSHEnabler
+	session         RemoteSession
 	fileUploader    FileUploader
 	commandRunner   CommandRunner
+	// accessRevoker is optional, when it is nil access is not revoked after the update
+	accessRevoker RemoteAccessRevoker
 
 	logger *slog.Logger
 }
 
 func (s *instanceUpdater) Update(ctx context.Context) error {
-	remotePublicKey, err := s.enableSSH(ctx)
+	hostKeys, err := s.enableSSH(ctx)
 	if err != nil {
 		return s.processError(err)
 	}
 
-	err = s.copyFilesToRemoteInstance(ctx, remotePublicKey)
-	if err != nil {
-		return s.processError(err)
+	err = s.connect(ctx, hostKeys)
+	if err == nil {
+		err = s.copyFilesToRemoteInstance(ctx)
+	}
+	if err == nil {
+		err = s.runUpdateScript(ctx)
+	}
+
+	if closeErr := s.session.Close(); closeErr != nil {
+		s.logger.Warn("error closing ssh session", "err", closeErr)
 	}
 
-	err = s.runUpdateScript(ctx, remotePublicKey)
+	// Once access has been granted it must always be revoked (if requested), even if the update failed
+	err = errors.Join(err, s.revokeAccess(ctx))
 	if err != nil {
 		return s.processError(err)
 	}
@@ -73,28 +102,51 @@ func (s *instanceUpdater) processError(err error) error {
 }
 
 // enableSSH will enable SSH on the instance. This must happen first as the other Update steps all depend on it.
-func (s *instanceUpdater) enableSSH(ctx context.Context) (ssh.PublicKey, error) {
+func (s *instanceUpdater) enableSSH(ctx context.Context) (hostKeys tools.HostKeys, err error) {
+	ctx, span := config.Tracer().Start(ctx, "EnableSSH")
+	defer func() { config.EndSpan(span, err) }()
+
 	s.logger.Debug("enabling ssh on remote instance")
 
 	s.progressTracker.UpdateState(UpdateStateEnableSSH)
 
-	remotePublicKey, err := s.sshEnabler.Enable(ctx)
+	hostKeys, err = s.sshEnabler.Enable(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error enabling ssh on remote instance %w", err)
 	}
 
 	s.logger.Debug("done enabling ssh on remote instance")
 
-	return remotePublicKey, nil
+	return hostKeys, nil
+}
+
+// connect will open the SSH connection that is shared by the rest of the update steps
+func (s *instanceUpdater) connect(ctx context.Context, hostKeys tools.HostKeys) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "Connect")
+	defer func() { config.EndSpan(span, err) }()
+
+	s.logger.Debug("connecting to remote instance")
+
+	err = s.session.Connect(ctx, hostKeys)
+	if err != nil {
+		return fmt.Errorf("error connecting to remote instance %w", err)
+	}
+
+	s.logger.Debug("done connecting to remote instance")
+
+	return nil
 }
 
 // copyFilesToRemoteInstance will copy the build and any relevant update scripts to the instance
-func (s *instanceUpdater) copyFilesToRemoteInstance(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+func (s *instanceUpdater) copyFilesToRemoteInstance(ctx context.Context) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "CopyFiles")
+	defer func() { config.EndSpan(span, err) }()
+
 	s.logger.Debug("copying files to remote instance")
 
 	s.progressTracker.UpdateState(UpdateStateCopyBuild)
 
-	err := s.fileUploader.CopyFiles(ctx, remotePublicKey)
+	err = s.fileUploader.CopyFiles(ctx)
 	if err != nil {
 		return fmt.Errorf("error copying files to remote instance %w", err)
 	}
@@ -105,12 +157,15 @@ func (s *instanceUpdater) copyFilesToRemoteInstance(ctx context.Context, remoteP
 }
 
 // runUpdateScript will actually run a script on the instance to perform the update
-func (s *instanceUpdater) runUpdateScript(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+func (s *instanceUpdater) runUpdateScript(ctx context.Context) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "RunUpdateScript")
+	defer func() { config.EndSpan(span, err) }()
+
 	s.logger.Debug("running update script")
 
 	s.progressTracker.UpdateState(UpdateStateRunUpdateScript)
 
-	err := s.commandRunner.Run(ctx, remotePublicKey)
+	err = s.commandRunner.Run(ctx)
 	if err != nil {
 		return fmt.Errorf("error running remote command %w", err)
 	}
@@ -119,3 +174,26 @@ func (s *instanceUpdater) runUpdateScript(ctx context.Context, remotePublicKey s
 
 	return nil
 }
+
+// revokeAccess will remove the SSH access granted by enableSSH, if this updater was configured to do so
+func (s *instanceUpdater) revokeAccess(ctx context.Context) (err error) {
+	if s.accessRevoker == nil {
+		return nil
+	}
+
+	ctx, span := config.Tracer().Start(ctx, "RevokeAccess")
+	defer func() { config.EndSpan(span, err) }()
+
+	s.logger.Debug("revoking ssh access on remote instance")
+
+	s.progressTracker.UpdateState(UpdateStateRevokeAccess)
+
+	err = s.accessRevoker.RevokeAccess(ctx)
+	if err != nil {
+		return fmt.Errorf("error revoking ssh access on remote instance %w", err)
+	}
+
+	s.logger.Debug("done revoking ssh access on remote instance")
+
+	return nil
+}
@@ -15,66 +15,191 @@ import (
 // InstanceUpdaterFactory will create a new InstanceUpdater for a specific GameLift instance
 type InstanceUpdaterFactory interface {
 	Create(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error)
+	// ScriptStatus returns what the update script reported about the server processes on an instance, in the last update created for it
+	ScriptStatus(instanceId string) tools.UpdateScriptStatus
 }
 
 type instanceUpdaterFactory struct {
 	logger          *slog.Logger
 	gameLiftClient  GameLiftClient
 	privateKeyPath  string
-	buildZipPath    string
+	archive         tools.BuildArchive
 	updateOperation config.UpdateOperation
+	revokeAccess    bool
+	stopSSHServer   bool
+	openSSHInstall  config.OpenSSHInstallOptions
+	hooks           config.UpdateHooks
+	transport       config.Transport
+	follow          bool
+	hostKeyCache    *tools.HostKeyCache
+	// dashboard is set when the progress of each instance is shown on the dashboard
+	dashboard *Dashboard
+	// plainOutput is set when the dashboard was asked for, but can't be shown
+	plainOutput bool
+
+	// instancesCreated is used to pick a different color for the output of each instance
+	instancesCreated int
+	// scriptOutputs holds the output writer of the last update created for each instance, by instance id
+	scriptOutputs map[string]*scriptOutputWriter
 }
 
-func NewInstanceUpdaterFactory(ctx context.Context, logger *slog.Logger, gameLiftClient GameLiftClient, args config.CLIArgs) InstanceUpdaterFactory {
+// NewInstanceUpdaterFactory builds a new InstanceUpdaterFactory, archive is the build copied to each instance, and dashboard is nil when the dashboard is not shown
+func NewInstanceUpdaterFactory(ctx context.Context, logger *slog.Logger, gameLiftClient GameLiftClient, args config.CLIArgs, archive tools.BuildArchive, dashboard *Dashboard) InstanceUpdaterFactory {
+	var hostKeyCache *tools.HostKeyCache
+	if args.ShouldUseHostKeyCache() {
+		hostKeyCachePath, err := tools.DefaultHostKeyCachePath()
+		if err != nil {
+			logger.Warn("host key cache is not available", "err", err)
+		} else {
+			hostKeyCache = tools.NewHostKeyCache(logger, hostKeyCachePath)
+		}
+	}
+
 	return &instanceUpdaterFactory{
 		logger:          logger,
 		gameLiftClient:  gameLiftClient,
 		privateKeyPath:  args.PrivateKeyPath,
-		buildZipPath:    args.BuildZipPath,
+		archive:         archive,
 		updateOperation: args.GetUpdateOperation(),
+		revokeAccess:    args.ShouldRevokeAccess(),
+		stopSSHServer:   args.StopSSHServer,
+		openSSHInstall:  args.OpenSSHInstall(),
+		hooks:           args.Hooks(),
+		transport:       args.Transport,
+		follow:          args.Follow,
+		hostKeyCache:    hostKeyCache,
+		dashboard:       dashboard,
+		plainOutput:     args.Dashboard && dashboard == nil,
+		scriptOutputs:   map[string]*scriptOutputWriter{},
 	}
 }
 
-// Create will create a new instance updater that can be used to update a single instance in a GameLift fleet
+// Create will create a new instance updater that can be used to update a single instance in a GameLift fleet.
+// sshKey and sshPort are not used when the update is sent through SSM.
 func (i *instanceUpdaterFactory) Create(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
 	instanceLogger := i.logger.With(
 		"instanceId", instance.InstanceId,
 		"ipAddress", instance.IpAddress)
 
-	sshEnabler, err := tools.NewSSHEnabler(instanceLogger, instance, i.gameLiftClient, sshKey.PublicKey(), sshPort)
+	scriptOutput := newScriptOutputWriter(instance.InstanceId, i.follow, scriptOutputColors[i.instancesCreated%len(scriptOutputColors)])
+	i.instancesCreated++
+	i.scriptOutputs[instance.InstanceId] = scriptOutput
+
+	// The bytes uploaded are only shown on the dashboard
+	var onUploadProgress tools.UploadProgressHandler
+	if i.dashboard != nil {
+		scriptOutput.dashboard = i.dashboard.instanceRow(instance)
+		onUploadProgress = scriptOutput.dashboard.addBytesUploaded
+	}
+
+	if i.transport == config.TransportSSM {
+		return i.createSSMInstanceUpdater(instanceLogger, verbose, updateScript, instance, scriptOutput, onUploadProgress)
+	}
+
+	// A single SSH connection is shared by every step of the update
+	session := tools.NewInstanceSession(instanceLogger, instance, sshKey, sshPort)
+
+	var sshEnabler RemoteSSHEnabler
+	sshEnabler, err := tools.NewSSHEnabler(instanceLogger, instance, i.gameLiftClient, sshKey.PublicKey(), sshPort, i.openSSHInstall)
 	if err != nil {
 		return nil, err
 	}
 
-	fileUploader, err := tools.NewFileUploader(instanceLogger, instance, i.privateKeyPath, i.GetFilesToUpload(updateScript), sshPort)
+	// Try to reuse host keys from a previous run before enabling SSH over SSM
+	if i.hostKeyCache != nil {
+		sshEnabler = tools.NewCachedSSHEnabler(instanceLogger, sshEnabler, i.hostKeyCache, instance, session)
+	}
+
+	fileUploader, err := tools.NewFileUploader(instanceLogger, instance, session, i.GetFilesToUpload(updateScript), i.GetStreamedFiles(), onUploadProgress)
 	if err != nil {
 		return nil, err
 	}
 
-	commandRunner, err := tools.NewSSHCommandRunner(instanceLogger, updateScript, sshPort, sshKey, instance)
+	commandRunner, err := tools.NewSSHCommandRunner(instanceLogger, updateScript, session, instance, scriptOutput.WriteLine)
 	if err != nil {
 		return nil, err
 	}
 
-	progressTracker, err := NewInstanceProgressWriter(instance, verbose)
+	// Only set up an access revoker if we've been asked to revoke access when the update is done
+	var accessRevoker RemoteAccessRevoker
+	if i.revokeAccess {
+		accessRevoker, err = tools.NewSSHAccessRevoker(instanceLogger, instance, i.gameLiftClient, sshKey.PublicKey(), i.stopSSHServer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	progressTracker, err := i.newProgressWriter(instance, verbose, scriptOutput.dashboard)
 	if err != nil {
 		return nil, err
 	}
+	scriptOutput.progressTracker = progressTracker
 
 	return &instanceUpdater{
 		sshEnabler:      sshEnabler,
+		session:         session,
 		fileUploader:    fileUploader,
 		commandRunner:   commandRunner,
+		accessRevoker:   accessRevoker,
 		logger:          instanceLogger,
 		progressTracker: progressTracker,
 	}, nil
 }
 
+// createSSMInstanceUpdater will create an instance updater that copies files, and runs the update script, through an SSM session
+func (i *instanceUpdaterFactory) createSSMInstanceUpdater(instanceLogger *slog.Logger, verbose bool, updateScript string, instance *gamelift.Instance, scriptOutput *scriptOutputWriter, onUploadProgress tools.UploadProgressHandler) (InstanceUpdater, error) {
+	updateRunner, err := tools.NewSSMUpdateRunner(instanceLogger, instance, i.gameLiftClient, updateScript, i.GetFilesToUpload(updateScript), scriptOutput.WriteLine, onUploadProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	progressTracker, err := i.newProgressWriter(instance, verbose, scriptOutput.dashboard)
+	if err != nil {
+		return nil, err
+	}
+	scriptOutput.progressTracker = progressTracker
+
+	return &ssmInstanceUpdater{
+		updateRunner:    updateRunner,
+		logger:          instanceLogger,
+		progressTracker: progressTracker,
+	}, nil
+}
+
+// newProgressWriter builds the progress writer for instance, showing its progress on the dashboard row when there is one
+func (i *instanceUpdaterFactory) newProgressWriter(instance *gamelift.Instance, verbose bool, row *dashboardInstance) (*InstanceProgressWriter, error) {
+	switch {
+	case row != nil:
+		return newDashboardProgressWriter(instance, row), nil
+	case i.plainOutput && !verbose:
+		return newPlainProgressWriter(instance), nil
+	default:
+		return NewInstanceProgressWriter(instance, verbose)
+	}
+}
+
+// ScriptStatus returns what the update script reported about the server processes on an instance, in the last update created for it
+func (i *instanceUpdaterFactory) ScriptStatus(instanceId string) tools.UpdateScriptStatus {
+	scriptOutput, found := i.scriptOutputs[instanceId]
+	if !found {
+		return tools.UpdateScriptStatus{}
+	}
+	return scriptOutput.Status()
+}
+
 func (i *instanceUpdaterFactory) GetFilesToUpload(updateScript string) []string {
-	result := make([]string, 1, 2)
+	result := make([]string, 1, 4)
 	result[0] = updateScript
-	if i.updateOperation == config.UpdateOperationReplaceBuild {
-		result = append(result, i.buildZipPath)
+	if zipFile, ok := i.archive.(tools.ArchiveFile); ok && i.updateOperation == config.UpdateOperationReplaceBuild {
+		result = append(result, string(zipFile))
+	}
+	return append(result, i.hooks.Paths()...)
+}
+
+// GetStreamedFiles returns the build archive when it is the zip of a build directory, rather than a zip file passed with --zip-path
+func (i *instanceUpdaterFactory) GetStreamedFiles() []tools.StreamedFile {
+	if streamedFile, ok := i.archive.(tools.StreamedFile); ok && i.updateOperation == config.UpdateOperationReplaceBuild {
+		return []tools.StreamedFile{streamedFile}
 	}
-	return result
+	return nil
 }
@@ -4,10 +4,12 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +17,7 @@ func TestGetFilesToUploadRestartProcess(t *testing.T) {
 	zipPath := "myfile.zip"
 	updateScript := "update-script.sh"
 
-	i := &instanceUpdaterFactory{updateOperation: config.UpdateOperationRestartProcess, buildZipPath: zipPath}
+	i := &instanceUpdaterFactory{updateOperation: config.UpdateOperationRestartProcess, archive: tools.ArchiveFile(zipPath)}
 
 	filesToUpload := i.GetFilesToUpload(updateScript)
 
@@ -27,7 +29,7 @@ func TestGetFilesToUploadReplaceBuild(t *testing.T) {
 	zipPath := "myfile.zip"
 	updateScript := "update-script.sh"
 
-	i := &instanceUpdaterFactory{updateOperation: config.UpdateOperationReplaceBuild, buildZipPath: zipPath}
+	i := &instanceUpdaterFactory{updateOperation: config.UpdateOperationReplaceBuild, archive: tools.ArchiveFile(zipPath)}
 
 	filesToUpload := i.GetFilesToUpload(updateScript)
 
@@ -36,7 +38,49 @@ func TestGetFilesToUploadReplaceBuild(t *testing.T) {
 	assert.Equal(t, zipPath, filesToUpload[1])
 }
 
+// TestGetFilesToUploadHooks ensures hooks are uploaded along with the build, and a script used for both hooks is only uploaded once
+func TestGetFilesToUploadHooks(t *testing.T) {
+	i := &instanceUpdaterFactory{updateOperation: config.UpdateOperationReplaceBuild, archive: tools.ArchiveFile("myfile.zip"), hooks: config.UpdateHooks{PreHookPath: "pre.sh", PostHookPath: "post.sh"}}
+	assert.Equal(t, []string{"update-script.sh", "myfile.zip", "pre.sh", "post.sh"}, i.GetFilesToUpload("update-script.sh"))
+
+	i = &instanceUpdaterFactory{updateOperation: config.UpdateOperationRestartProcess, hooks: config.UpdateHooks{PreHookPath: "hook.sh", PostHookPath: "hook.sh"}}
+	assert.Equal(t, []string{"update-script.sh", "hook.sh"}, i.GetFilesToUpload("update-script.sh"))
+}
+
+// TestGetStreamedFiles ensures the zip of a build directory is sent through its WriteTo instead of uploaded from a path, and only when the build is replaced
+func TestGetStreamedFiles(t *testing.T) {
+	buildDir := filepath.Join(t.TempDir(), "mybuild")
+	assert.Nil(t, os.MkdirAll(buildDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(buildDir, "server"), []byte("server"), 0755))
+	archive, err := tools.NewDirectoryArchive(buildDir)
+	assert.Nil(t, err)
+
+	i := &instanceUpdaterFactory{updateOperation: config.UpdateOperationReplaceBuild, archive: archive}
+	assert.Equal(t, []string{"update-script.sh"}, i.GetFilesToUpload("update-script.sh"))
+	assert.Equal(t, []tools.StreamedFile{archive}, i.GetStreamedFiles())
+
+	i = &instanceUpdaterFactory{updateOperation: config.UpdateOperationRestartProcess, archive: archive}
+	assert.Nil(t, i.GetStreamedFiles())
+
+	i = &instanceUpdaterFactory{updateOperation: config.UpdateOperationReplaceBuild, archive: tools.ArchiveFile("myfile.zip")}
+	assert.Nil(t, i.GetStreamedFiles())
+}
+
+// testInstallFakeCLIs puts stub aws and session-manager-plugin executables on the PATH, so validation passes without the real tools installed
+func testInstallFakeCLIs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"aws", "session-manager-plugin"} {
+		if runtime.GOOS == "windows" {
+			name = name + ".exe"
+		}
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755))
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
 func TestCreate(t *testing.T) {
+	testInstallFakeCLIs(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 	signer, privateKeyPath := generatePrivateSSHKey()
 	defer os.Remove(privateKeyPath)
 
@@ -55,9 +99,65 @@ func TestCreate(t *testing.T) {
 		LockName:       "test",
 		Verbose:        false,
 		PrivateKeyPath: privateKeyPath,
-	})
+	}, tools.ArchiveFile(buildZipPath), nil)
+
+	updater, err := factory.Create(context.Background(), true, signer, "update-script", 22, &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux})
+	assert.Nil(t, err)
+	assert.NotNil(t, updater)
+
+	// Host keys from previous runs should be used by default
+	assert.IsType(t, &tools.CachedSSHEnabler{}, updater.(*instanceUpdater).sshEnabler)
+}
+
+// TestCreateWithoutHostKeyCache ensures that the host key cache isn't used when disabled, or when our key won't stay authorized
+func TestCreateWithoutHostKeyCache(t *testing.T) {
+	testInstallFakeCLIs(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	signer, privateKeyPath := generatePrivateSSHKey()
+	defer os.Remove(privateKeyPath)
+
+	for _, args := range []config.CLIArgs{
+		{FleetId: fleetId, PrivateKeyPath: privateKeyPath, NoCache: true},
+		{FleetId: fleetId, PrivateKeyPath: privateKeyPath, RevokeAccess: true},
+		{FleetId: fleetId, EphemeralKey: true},
+	} {
+		factory := NewInstanceUpdaterFactory(context.Background(), NewTestLogger(), &GameLiftClientMock{}, args, tools.ArchiveFile(""), nil)
+
+		updater, err := factory.Create(context.Background(), false, signer, "update-script", 22, &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux})
+		assert.Nil(t, err)
+		assert.IsType(t, &tools.SSHEnabler{}, updater.(*instanceUpdater).sshEnabler)
+	}
+}
+
+// TestCreateSSMTransport ensures that no SSH steps are set up when the update is sent through SSM
+func TestCreateSSMTransport(t *testing.T) {
+	testInstallFakeCLIs(t)
+
+	factory := NewInstanceUpdaterFactory(context.Background(), NewTestLogger(), &GameLiftClientMock{}, config.CLIArgs{
+		FleetId:   fleetId,
+		Transport: config.TransportSSM,
+	}, tools.ArchiveFile(""), nil)
+
+	updater, err := factory.Create(context.Background(), true, nil, "update-script", 0, &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux})
+	assert.Nil(t, err)
+	assert.IsType(t, &tools.SSMUpdateRunner{}, updater.(*ssmInstanceUpdater).updateRunner)
+}
+
+// TestCreateProgressWriter ensures the progress of each instance is shown on the dashboard when there is one, and printed as plain lines when it could not be shown
+func TestCreateProgressWriter(t *testing.T) {
+	testInstallFakeCLIs(t)
+	instance := &gamelift.Instance{InstanceId: instanceId, OperatingSystem: config.OperatingSystemLinux}
+	args := config.CLIArgs{FleetId: fleetId, Transport: config.TransportSSM, Dashboard: true}
+
+	dashboard := NewDashboard(fleetId)
+	updater, err := NewInstanceUpdaterFactory(context.Background(), NewTestLogger(), &GameLiftClientMock{}, args, tools.ArchiveFile(""), dashboard).
+		Create(context.Background(), false, nil, "update-script", 0, instance)
+	assert.Nil(t, err)
+	assert.Equal(t, dashboard.instance(instanceId), updater.(*ssmInstanceUpdater).progressTracker.dashboard)
+	assert.Equal(t, dashboardStatusRunning, dashboard.instance(instanceId).status)
 
-	instanceUpdater, err := factory.Create(context.Background(), true, signer, "update-script", 22, &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux})
+	updater, err = NewInstanceUpdaterFactory(context.Background(), NewTestLogger(), &GameLiftClientMock{}, args, tools.ArchiveFile(""), nil).
+		Create(context.Background(), false, nil, "update-script", 0, instance)
 	assert.Nil(t, err)
-	assert.NotNil(t, instanceUpdater)
+	assert.True(t, updater.(*ssmInstanceUpdater).progressTracker.plain)
 }
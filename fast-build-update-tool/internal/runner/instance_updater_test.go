@@ -8,8 +8,10 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -20,10 +22,11 @@ const (
 type InstanceUpdaterTestSuite struct {
 	suite.Suite
 
-	publicKey       ssh.PublicKey
+	hostKeys        tools.HostKeys
 	progressTracker *InstanceProgressWriter
 
 	sshEnabler    *RemoteSSHEnablerMock
+	session       *RemoteSessionMock
 	fileUploader  *FileUploaderMock
 	commandRunner *CommandRunnerMock
 }
@@ -37,22 +40,32 @@ func (s *InstanceUpdaterTestSuite) SetupTest() {
 
 	s.progressTracker, _ = NewInstanceProgressWriter(&gamelift.Instance{InstanceId: instanceId, IpAddress: "127.0.0.1"}, false)
 
-	s.publicKey, _ = ssh.NewPublicKey(&privateKey.PublicKey)
+	publicKey, _ := ssh.NewPublicKey(&privateKey.PublicKey)
+	s.hostKeys = tools.HostKeys{publicKey}
 
 	s.sshEnabler = &RemoteSSHEnablerMock{
-		EnableFunc: func(ctx context.Context) (ssh.PublicKey, error) {
-			return s.publicKey, nil
+		EnableFunc: func(ctx context.Context) (tools.HostKeys, error) {
+			return s.hostKeys, nil
+		},
+	}
+
+	s.session = &RemoteSessionMock{
+		ConnectFunc: func(ctx context.Context, hostKeys tools.HostKeys) error {
+			return nil
+		},
+		CloseFunc: func() error {
+			return nil
 		},
 	}
 
 	s.fileUploader = &FileUploaderMock{
-		CopyFilesFunc: func(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+		CopyFilesFunc: func(ctx context.Context) error {
 			return nil
 		},
 	}
 
 	s.commandRunner = &CommandRunnerMock{
-		RunFunc: func(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+		RunFunc: func(ctx context.Context) error {
 			return nil
 		},
 	}
@@ -65,6 +78,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceUpdate() {
 	updater := &instanceUpdater{
 		progressTracker: s.progressTracker,
 		sshEnabler:      s.sshEnabler,
+		session:         s.session,
 		fileUploader:    s.fileUploader,
 		commandRunner:   s.commandRunner,
 		logger:          NewTestLogger(),
@@ -75,11 +89,48 @@ func (s *InstanceUpdaterTestSuite) TestInstanceUpdate() {
 
 	assert.Len(t, s.sshEnabler.EnableCalls(), 1)
 
+	assert.Len(t, s.session.ConnectCalls(), 1)
+	assert.Equal(t, s.hostKeys, s.session.ConnectCalls()[0].HostKeys)
+
 	assert.Len(t, s.fileUploader.CopyFilesCalls(), 1)
-	assert.Equal(t, s.publicKey, s.fileUploader.CopyFilesCalls()[0].RemotePublicKey)
 
 	assert.Len(t, s.commandRunner.RunCalls(), 1)
-	assert.Equal(t, s.publicKey, s.commandRunner.RunCalls()[0].RemotePublicKey)
+
+	// The shared connection should be closed once the update is done
+	assert.Len(t, s.session.CloseCalls(), 1)
+}
+
+// TestInstanceUpdateSpans verifies that a span is recorded for each step of the update, and the failing step is marked as failed
+func (s *InstanceUpdaterTestSuite) TestInstanceUpdateSpans() {
+	t := s.T()
+	spans := testRecordSpans(t)
+
+	s.commandRunner = &CommandRunnerMock{
+		RunFunc: func(ctx context.Context) error {
+			return errors.New("exit code 1")
+		},
+	}
+
+	updater := &instanceUpdater{
+		progressTracker: s.progressTracker,
+		sshEnabler:      s.sshEnabler,
+		session:         s.session,
+		fileUploader:    s.fileUploader,
+		commandRunner:   s.commandRunner,
+		logger:          NewTestLogger(),
+	}
+
+	err := updater.Update(context.Background())
+	assert.NotNil(t, err)
+
+	names := make([]string, 0, len(spans.GetSpans()))
+	for _, span := range spans.GetSpans() {
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"EnableSSH", "Connect", "CopyFiles", "RunUpdateScript"}, names)
+
+	assert.Equal(t, codes.Unset, testSpan(t, spans, "CopyFiles").Status.Code)
+	assert.Equal(t, codes.Error, testSpan(t, spans, "RunUpdateScript").Status.Code)
 }
 
 // TestInstanceUpdate verifies that enabling ssh shortcuts the process and returns the proper error
@@ -89,7 +140,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceEnableSSHFail() {
 	expectedErr := errors.New("enable fail")
 
 	s.sshEnabler = &RemoteSSHEnablerMock{
-		EnableFunc: func(ctx context.Context) (ssh.PublicKey, error) {
+		EnableFunc: func(ctx context.Context) (tools.HostKeys, error) {
 			return nil, expectedErr
 		},
 	}
@@ -97,6 +148,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceEnableSSHFail() {
 	updater := &instanceUpdater{
 		progressTracker: s.progressTracker,
 		sshEnabler:      s.sshEnabler,
+		session:         s.session,
 		fileUploader:    s.fileUploader,
 		commandRunner:   s.commandRunner,
 		logger:          NewTestLogger(),
@@ -118,7 +170,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceUploadFileFail() {
 	expectedErr := errors.New("enable fail")
 
 	s.fileUploader = &FileUploaderMock{
-		CopyFilesFunc: func(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+		CopyFilesFunc: func(ctx context.Context) error {
 			return expectedErr
 		},
 	}
@@ -126,6 +178,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceUploadFileFail() {
 	updater := &instanceUpdater{
 		progressTracker: s.progressTracker,
 		sshEnabler:      s.sshEnabler,
+		session:         s.session,
 		fileUploader:    s.fileUploader,
 		commandRunner:   s.commandRunner,
 		logger:          NewTestLogger(),
@@ -137,12 +190,42 @@ func (s *InstanceUpdaterTestSuite) TestInstanceUploadFileFail() {
 
 	assert.Len(t, s.sshEnabler.EnableCalls(), 1)
 
+	assert.Len(t, s.session.ConnectCalls(), 1)
+	assert.Equal(t, s.hostKeys, s.session.ConnectCalls()[0].HostKeys)
+
 	assert.Len(t, s.fileUploader.CopyFilesCalls(), 1)
-	assert.Equal(t, s.publicKey, s.fileUploader.CopyFilesCalls()[0].RemotePublicKey)
 
 	assert.Len(t, s.commandRunner.RunCalls(), 0)
 }
 
+// TestInstanceConnectFail verifies that failing to connect to the instance shortcuts the update process and returns the proper error
+func (s *InstanceUpdaterTestSuite) TestInstanceConnectFail() {
+	t := s.T()
+
+	expectedErr := errors.New("connect fail")
+
+	s.session.ConnectFunc = func(ctx context.Context, hostKeys tools.HostKeys) error {
+		return expectedErr
+	}
+
+	updater := &instanceUpdater{
+		progressTracker: s.progressTracker,
+		sshEnabler:      s.sshEnabler,
+		session:         s.session,
+		fileUploader:    s.fileUploader,
+		commandRunner:   s.commandRunner,
+		logger:          NewTestLogger(),
+	}
+
+	err := updater.Update(context.Background())
+	assert.ErrorContains(t, err, expectedErr.Error())
+
+	assert.Len(t, s.session.ConnectCalls(), 1)
+	assert.Len(t, s.fileUploader.CopyFilesCalls(), 0)
+	assert.Len(t, s.commandRunner.RunCalls(), 0)
+	assert.Len(t, s.session.CloseCalls(), 1)
+}
+
 // TestInstanceRunCommandFail verifies that when running remote commands on the instance fails, the proper error is returned
 func (s *InstanceUpdaterTestSuite) TestInstanceRunCommandFail() {
 	t := s.T()
@@ -150,7 +233,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceRunCommandFail() {
 	expectedErr := errors.New("enable fail")
 
 	s.commandRunner = &CommandRunnerMock{
-		RunFunc: func(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+		RunFunc: func(ctx context.Context) error {
 			return expectedErr
 		},
 	}
@@ -158,6 +241,7 @@ func (s *InstanceUpdaterTestSuite) TestInstanceRunCommandFail() {
 	updater := &instanceUpdater{
 		progressTracker: s.progressTracker,
 		sshEnabler:      s.sshEnabler,
+		session:         s.session,
 		fileUploader:    s.fileUploader,
 		commandRunner:   s.commandRunner,
 		logger:          NewTestLogger(),
@@ -169,9 +253,104 @@ func (s *InstanceUpdaterTestSuite) TestInstanceRunCommandFail() {
 
 	assert.Len(t, s.sshEnabler.EnableCalls(), 1)
 
+	assert.Len(t, s.session.ConnectCalls(), 1)
+	assert.Equal(t, s.hostKeys, s.session.ConnectCalls()[0].HostKeys)
+
 	assert.Len(t, s.fileUploader.CopyFilesCalls(), 1)
-	assert.Equal(t, s.publicKey, s.fileUploader.CopyFilesCalls()[0].RemotePublicKey)
 
 	assert.Len(t, s.commandRunner.RunCalls(), 1)
-	assert.Equal(t, s.publicKey, s.commandRunner.RunCalls()[0].RemotePublicKey)
+}
+
+// TestInstanceRevokeAccess verifies that access is revoked once the update is done
+func (s *InstanceUpdaterTestSuite) TestInstanceRevokeAccess() {
+	t := s.T()
+
+	accessRevoker := &RemoteAccessRevokerMock{
+		RevokeAccessFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+
+	updater := &instanceUpdater{
+		progressTracker: s.progressTracker,
+		sshEnabler:      s.sshEnabler,
+		session:         s.session,
+		fileUploader:    s.fileUploader,
+		commandRunner:   s.commandRunner,
+		accessRevoker:   accessRevoker,
+		logger:          NewTestLogger(),
+	}
+
+	err := updater.Update(context.Background())
+	assert.Nil(t, err)
+
+	assert.Len(t, s.commandRunner.RunCalls(), 1)
+	assert.Len(t, accessRevoker.RevokeAccessCalls(), 1)
+}
+
+// TestInstanceRevokeAccessAfterFailure verifies that access is still revoked when the update fails, and both errors are returned
+func (s *InstanceUpdaterTestSuite) TestInstanceRevokeAccessAfterFailure() {
+	t := s.T()
+
+	expectedErr := errors.New("run fail")
+	expectedRevokeErr := errors.New("revoke fail")
+
+	s.commandRunner = &CommandRunnerMock{
+		RunFunc: func(ctx context.Context) error {
+			return expectedErr
+		},
+	}
+
+	accessRevoker := &RemoteAccessRevokerMock{
+		RevokeAccessFunc: func(ctx context.Context) error {
+			return expectedRevokeErr
+		},
+	}
+
+	updater := &instanceUpdater{
+		progressTracker: s.progressTracker,
+		sshEnabler:      s.sshEnabler,
+		session:         s.session,
+		fileUploader:    s.fileUploader,
+		commandRunner:   s.commandRunner,
+		accessRevoker:   accessRevoker,
+		logger:          NewTestLogger(),
+	}
+
+	err := updater.Update(context.Background())
+	assert.ErrorContains(t, err, expectedErr.Error())
+	assert.ErrorContains(t, err, expectedRevokeErr.Error())
+
+	assert.Len(t, accessRevoker.RevokeAccessCalls(), 1)
+}
+
+// TestInstanceNoRevokeWhenEnableFails verifies that we don't try to revoke access that was never granted
+func (s *InstanceUpdaterTestSuite) TestInstanceNoRevokeWhenEnableFails() {
+	t := s.T()
+
+	s.sshEnabler = &RemoteSSHEnablerMock{
+		EnableFunc: func(ctx context.Context) (tools.HostKeys, error) {
+			return nil, errors.New("enable fail")
+		},
+	}
+
+	accessRevoker := &RemoteAccessRevokerMock{
+		RevokeAccessFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+
+	updater := &instanceUpdater{
+		progressTracker: s.progressTracker,
+		sshEnabler:      s.sshEnabler,
+		session:         s.session,
+		fileUploader:    s.fileUploader,
+		commandRunner:   s.commandRunner,
+		accessRevoker:   accessRevoker,
+		logger:          NewTestLogger(),
+	}
+
+	err := updater.Update(context.Background())
+	assert.NotNil(t, err)
+	assert.Len(t, accessRevoker.RevokeAccessCalls(), 0)
 }
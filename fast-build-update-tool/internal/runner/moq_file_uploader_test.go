@@ -5,7 +5,6 @@ package runner
 
 import (
 	"context"
-	"golang.org/x/crypto/ssh"
 	"sync"
 )
 
@@ -15,7 +14,7 @@ import (
 //
 //		// make and configure a mocked FileUploader
 //		mockedFileUploader := &FileUploaderMock{
-//			CopyFilesFunc: func(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+//			CopyFilesFunc: func(ctx context.Context) error {
 //				panic("mock out the CopyFiles method")
 //			},
 //		}
@@ -26,7 +25,7 @@ import (
 //	}
 type FileUploaderMock struct {
 	// CopyFilesFunc mocks the CopyFiles method.
-	CopyFilesFunc func(ctx context.Context, remotePublicKey ssh.PublicKey) error
+	CopyFilesFunc func(ctx context.Context) error
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -34,29 +33,25 @@ type FileUploaderMock struct {
 		CopyFiles []struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
-			// RemotePublicKey is the remotePublicKey argument value.
-			RemotePublicKey ssh.PublicKey
 		}
 	}
 	lockCopyFiles sync.RWMutex
 }
 
 // CopyFiles calls CopyFilesFunc.
-func (mock *FileUploaderMock) CopyFiles(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+func (mock *FileUploaderMock) CopyFiles(ctx context.Context) error {
 	if mock.CopyFilesFunc == nil {
 		panic("FileUploaderMock.CopyFilesFunc: method is nil but FileUploader.CopyFiles was just called")
 	}
 	callInfo := struct {
-		Ctx             context.Context
-		RemotePublicKey ssh.PublicKey
+		Ctx context.Context
 	}{
-		Ctx:             ctx,
-		RemotePublicKey: remotePublicKey,
+		Ctx: ctx,
 	}
 	mock.lockCopyFiles.Lock()
 	mock.calls.CopyFiles = append(mock.calls.CopyFiles, callInfo)
 	mock.lockCopyFiles.Unlock()
-	return mock.CopyFilesFunc(ctx, remotePublicKey)
+	return mock.CopyFilesFunc(ctx)
 }
 
 // CopyFilesCalls gets all the calls that were made to CopyFiles.
@@ -64,12 +59,10 @@ func (mock *FileUploaderMock) CopyFiles(ctx context.Context, remotePublicKey ssh
 //
 //	len(mockedFileUploader.CopyFilesCalls())
 func (mock *FileUploaderMock) CopyFilesCalls() []struct {
-	Ctx             context.Context
-	RemotePublicKey ssh.PublicKey
+	Ctx context.Context
 } {
 	var calls []struct {
-		Ctx             context.Context
-		RemotePublicKey ssh.PublicKey
+		Ctx context.Context
 	}
 	mock.lockCopyFiles.RLock()
 	calls = mock.calls.CopyFiles
@@ -15,18 +15,36 @@ import (
 //
 //		// make and configure a mocked GameLiftClient
 //		mockedGameLiftClient := &GameLiftClientMock{
+//			ClosePortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
+//				panic("mock out the ClosePortForFleet method")
+//			},
 //			GetFleetFunc: func(ctx context.Context, fleetId string) (*gamelift.Fleet, error) {
 //				panic("mock out the GetFleet method")
 //			},
+//			GetFleetLockFunc: func(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error) {
+//				panic("mock out the GetFleetLock method")
+//			},
+//			GetInboundPermissionsFunc: func(ctx context.Context, fleetId string) ([]*gamelift.InboundPermission, error) {
+//				panic("mock out the GetInboundPermissions method")
+//			},
 //			GetInstanceAccessFunc: func(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error) {
 //				panic("mock out the GetInstanceAccess method")
 //			},
 //			GetInstancesFunc: func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error) {
 //				panic("mock out the GetInstances method")
 //			},
-//			OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) error {
+//			OpenPortForFleetFunc: func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
 //				panic("mock out the OpenPortForFleet method")
 //			},
+//			PutFleetLockFunc: func(ctx context.Context, fleetArn string, lock *gamelift.FleetLock) error {
+//				panic("mock out the PutFleetLock method")
+//			},
+//			RemoveFleetLockFunc: func(ctx context.Context, fleetArn string) error {
+//				panic("mock out the RemoveFleetLock method")
+//			},
+//			RevokeInboundPermissionsFunc: func(ctx context.Context, fleetId string, permissions []*gamelift.InboundPermission) error {
+//				panic("mock out the RevokeInboundPermissions method")
+//			},
 //		}
 //
 //		// use mockedGameLiftClient in code that requires GameLiftClient
@@ -34,9 +52,18 @@ import (
 //
 //	}
 type GameLiftClientMock struct {
+	// ClosePortForFleetFunc mocks the ClosePortForFleet method.
+	ClosePortForFleetFunc func(ctx context.Context, fleetId string, port int32, ipRange string) error
+
 	// GetFleetFunc mocks the GetFleet method.
 	GetFleetFunc func(ctx context.Context, fleetId string) (*gamelift.Fleet, error)
 
+	// GetFleetLockFunc mocks the GetFleetLock method.
+	GetFleetLockFunc func(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error)
+
+	// GetInboundPermissionsFunc mocks the GetInboundPermissions method.
+	GetInboundPermissionsFunc func(ctx context.Context, fleetId string) ([]*gamelift.InboundPermission, error)
+
 	// GetInstanceAccessFunc mocks the GetInstanceAccess method.
 	GetInstanceAccessFunc func(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error)
 
@@ -44,10 +71,30 @@ type GameLiftClientMock struct {
 	GetInstancesFunc func(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error)
 
 	// OpenPortForFleetFunc mocks the OpenPortForFleet method.
-	OpenPortForFleetFunc func(ctx context.Context, fleetId string, port int32, ipRange string) error
+	OpenPortForFleetFunc func(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error)
+
+	// PutFleetLockFunc mocks the PutFleetLock method.
+	PutFleetLockFunc func(ctx context.Context, fleetArn string, lock *gamelift.FleetLock) error
+
+	// RemoveFleetLockFunc mocks the RemoveFleetLock method.
+	RemoveFleetLockFunc func(ctx context.Context, fleetArn string) error
+
+	// RevokeInboundPermissionsFunc mocks the RevokeInboundPermissions method.
+	RevokeInboundPermissionsFunc func(ctx context.Context, fleetId string, permissions []*gamelift.InboundPermission) error
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// ClosePortForFleet holds details about calls to the ClosePortForFleet method.
+		ClosePortForFleet []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// FleetId is the fleetId argument value.
+			FleetId string
+			// Port is the port argument value.
+			Port int32
+			// IpRange is the ipRange argument value.
+			IpRange string
+		}
 		// GetFleet holds details about calls to the GetFleet method.
 		GetFleet []struct {
 			// Ctx is the ctx argument value.
@@ -55,6 +102,20 @@ type GameLiftClientMock struct {
 			// FleetId is the fleetId argument value.
 			FleetId string
 		}
+		// GetFleetLock holds details about calls to the GetFleetLock method.
+		GetFleetLock []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// FleetArn is the fleetArn argument value.
+			FleetArn string
+		}
+		// GetInboundPermissions holds details about calls to the GetInboundPermissions method.
+		GetInboundPermissions []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// FleetId is the fleetId argument value.
+			FleetId string
+		}
 		// GetInstanceAccess holds details about calls to the GetInstanceAccess method.
 		GetInstanceAccess []struct {
 			// Ctx is the ctx argument value.
@@ -84,11 +145,86 @@ type GameLiftClientMock struct {
 			// IpRange is the ipRange argument value.
 			IpRange string
 		}
+		// PutFleetLock holds details about calls to the PutFleetLock method.
+		PutFleetLock []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// FleetArn is the fleetArn argument value.
+			FleetArn string
+			// Lock is the lock argument value.
+			Lock *gamelift.FleetLock
+		}
+		// RemoveFleetLock holds details about calls to the RemoveFleetLock method.
+		RemoveFleetLock []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// FleetArn is the fleetArn argument value.
+			FleetArn string
+		}
+		// RevokeInboundPermissions holds details about calls to the RevokeInboundPermissions method.
+		RevokeInboundPermissions []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// FleetId is the fleetId argument value.
+			FleetId string
+			// Permissions is the permissions argument value.
+			Permissions []*gamelift.InboundPermission
+		}
 	}
-	lockGetFleet          sync.RWMutex
-	lockGetInstanceAccess sync.RWMutex
-	lockGetInstances      sync.RWMutex
-	lockOpenPortForFleet  sync.RWMutex
+	lockClosePortForFleet        sync.RWMutex
+	lockGetFleet                 sync.RWMutex
+	lockGetFleetLock             sync.RWMutex
+	lockGetInboundPermissions    sync.RWMutex
+	lockGetInstanceAccess        sync.RWMutex
+	lockGetInstances             sync.RWMutex
+	lockOpenPortForFleet         sync.RWMutex
+	lockPutFleetLock             sync.RWMutex
+	lockRemoveFleetLock          sync.RWMutex
+	lockRevokeInboundPermissions sync.RWMutex
+}
+
+// ClosePortForFleet calls ClosePortForFleetFunc.
+func (mock *GameLiftClientMock) ClosePortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) error {
+	if mock.ClosePortForFleetFunc == nil {
+		panic("GameLiftClientMock.ClosePortForFleetFunc: method is nil but GameLiftClient.ClosePortForFleet was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		FleetId string
+		Port    int32
+		IpRange string
+	}{
+		Ctx:     ctx,
+		FleetId: fleetId,
+		Port:    port,
+		IpRange: ipRange,
+	}
+	mock.lockClosePortForFleet.Lock()
+	mock.calls.ClosePortForFleet = append(mock.calls.ClosePortForFleet, callInfo)
+	mock.lockClosePortForFleet.Unlock()
+	return mock.ClosePortForFleetFunc(ctx, fleetId, port, ipRange)
+}
+
+// ClosePortForFleetCalls gets all the calls that were made to ClosePortForFleet.
+// Check the length with:
+//
+//	len(mockedGameLiftClient.ClosePortForFleetCalls())
+func (mock *GameLiftClientMock) ClosePortForFleetCalls() []struct {
+	Ctx     context.Context
+	FleetId string
+	Port    int32
+	IpRange string
+} {
+	var calls []struct {
+		Ctx     context.Context
+		FleetId string
+		Port    int32
+		IpRange string
+	}
+	mock.lockClosePortForFleet.RLock()
+	calls = mock.calls.ClosePortForFleet
+	mock.lockClosePortForFleet.RUnlock()
+	return calls
 }
 
 // GetFleet calls GetFleetFunc.
@@ -127,6 +263,78 @@ func (mock *GameLiftClientMock) GetFleetCalls() []struct {
 	return calls
 }
 
+// GetFleetLock calls GetFleetLockFunc.
+func (mock *GameLiftClientMock) GetFleetLock(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error) {
+	if mock.GetFleetLockFunc == nil {
+		panic("GameLiftClientMock.GetFleetLockFunc: method is nil but GameLiftClient.GetFleetLock was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		FleetArn string
+	}{
+		Ctx:      ctx,
+		FleetArn: fleetArn,
+	}
+	mock.lockGetFleetLock.Lock()
+	mock.calls.GetFleetLock = append(mock.calls.GetFleetLock, callInfo)
+	mock.lockGetFleetLock.Unlock()
+	return mock.GetFleetLockFunc(ctx, fleetArn)
+}
+
+// GetFleetLockCalls gets all the calls that were made to GetFleetLock.
+// Check the length with:
+//
+//	len(mockedGameLiftClient.GetFleetLockCalls())
+func (mock *GameLiftClientMock) GetFleetLockCalls() []struct {
+	Ctx      context.Context
+	FleetArn string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		FleetArn string
+	}
+	mock.lockGetFleetLock.RLock()
+	calls = mock.calls.GetFleetLock
+	mock.lockGetFleetLock.RUnlock()
+	return calls
+}
+
+// GetInboundPermissions calls GetInboundPermissionsFunc.
+func (mock *GameLiftClientMock) GetInboundPermissions(ctx context.Context, fleetId string) ([]*gamelift.InboundPermission, error) {
+	if mock.GetInboundPermissionsFunc == nil {
+		panic("GameLiftClientMock.GetInboundPermissionsFunc: method is nil but GameLiftClient.GetInboundPermissions was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		FleetId string
+	}{
+		Ctx:     ctx,
+		FleetId: fleetId,
+	}
+	mock.lockGetInboundPermissions.Lock()
+	mock.calls.GetInboundPermissions = append(mock.calls.GetInboundPermissions, callInfo)
+	mock.lockGetInboundPermissions.Unlock()
+	return mock.GetInboundPermissionsFunc(ctx, fleetId)
+}
+
+// GetInboundPermissionsCalls gets all the calls that were made to GetInboundPermissions.
+// Check the length with:
+//
+//	len(mockedGameLiftClient.GetInboundPermissionsCalls())
+func (mock *GameLiftClientMock) GetInboundPermissionsCalls() []struct {
+	Ctx     context.Context
+	FleetId string
+} {
+	var calls []struct {
+		Ctx     context.Context
+		FleetId string
+	}
+	mock.lockGetInboundPermissions.RLock()
+	calls = mock.calls.GetInboundPermissions
+	mock.lockGetInboundPermissions.RUnlock()
+	return calls
+}
+
 // GetInstanceAccess calls GetInstanceAccessFunc.
 func (mock *GameLiftClientMock) GetInstanceAccess(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error) {
 	if mock.GetInstanceAccessFunc == nil {
@@ -208,7 +416,7 @@ func (mock *GameLiftClientMock) GetInstancesCalls() []struct {
 }
 
 // OpenPortForFleet calls OpenPortForFleetFunc.
-func (mock *GameLiftClientMock) OpenPortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) error {
+func (mock *GameLiftClientMock) OpenPortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error) {
 	if mock.OpenPortForFleetFunc == nil {
 		panic("GameLiftClientMock.OpenPortForFleetFunc: method is nil but GameLiftClient.OpenPortForFleet was just called")
 	}
@@ -250,3 +458,119 @@ func (mock *GameLiftClientMock) OpenPortForFleetCalls() []struct {
 	mock.lockOpenPortForFleet.RUnlock()
 	return calls
 }
+
+// PutFleetLock calls PutFleetLockFunc.
+func (mock *GameLiftClientMock) PutFleetLock(ctx context.Context, fleetArn string, lock *gamelift.FleetLock) error {
+	if mock.PutFleetLockFunc == nil {
+		panic("GameLiftClientMock.PutFleetLockFunc: method is nil but GameLiftClient.PutFleetLock was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		FleetArn string
+		Lock     *gamelift.FleetLock
+	}{
+		Ctx:      ctx,
+		FleetArn: fleetArn,
+		Lock:     lock,
+	}
+	mock.lockPutFleetLock.Lock()
+	mock.calls.PutFleetLock = append(mock.calls.PutFleetLock, callInfo)
+	mock.lockPutFleetLock.Unlock()
+	return mock.PutFleetLockFunc(ctx, fleetArn, lock)
+}
+
+// PutFleetLockCalls gets all the calls that were made to PutFleetLock.
+// Check the length with:
+//
+//	len(mockedGameLiftClient.PutFleetLockCalls())
+func (mock *GameLiftClientMock) PutFleetLockCalls() []struct {
+	Ctx      context.Context
+	FleetArn string
+	Lock     *gamelift.FleetLock
+} {
+	var calls []struct {
+		Ctx      context.Context
+		FleetArn string
+		Lock     *gamelift.FleetLock
+	}
+	mock.lockPutFleetLock.RLock()
+	calls = mock.calls.PutFleetLock
+	mock.lockPutFleetLock.RUnlock()
+	return calls
+}
+
+// RemoveFleetLock calls RemoveFleetLockFunc.
+func (mock *GameLiftClientMock) RemoveFleetLock(ctx context.Context, fleetArn string) error {
+	if mock.RemoveFleetLockFunc == nil {
+		panic("GameLiftClientMock.RemoveFleetLockFunc: method is nil but GameLiftClient.RemoveFleetLock was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		FleetArn string
+	}{
+		Ctx:      ctx,
+		FleetArn: fleetArn,
+	}
+	mock.lockRemoveFleetLock.Lock()
+	mock.calls.RemoveFleetLock = append(mock.calls.RemoveFleetLock, callInfo)
+	mock.lockRemoveFleetLock.Unlock()
+	return mock.RemoveFleetLockFunc(ctx, fleetArn)
+}
+
+// RemoveFleetLockCalls gets all the calls that were made to RemoveFleetLock.
+// Check the length with:
+//
+//	len(mockedGameLiftClient.RemoveFleetLockCalls())
+func (mock *GameLiftClientMock) RemoveFleetLockCalls() []struct {
+	Ctx      context.Context
+	FleetArn string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		FleetArn string
+	}
+	mock.lockRemoveFleetLock.RLock()
+	calls = mock.calls.RemoveFleetLock
+	mock.lockRemoveFleetLock.RUnlock()
+	return calls
+}
+
+// RevokeInboundPermissions calls RevokeInboundPermissionsFunc.
+func (mock *GameLiftClientMock) RevokeInboundPermissions(ctx context.Context, fleetId string, permissions []*gamelift.InboundPermission) error {
+	if mock.RevokeInboundPermissionsFunc == nil {
+		panic("GameLiftClientMock.RevokeInboundPermissionsFunc: method is nil but GameLiftClient.RevokeInboundPermissions was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		FleetId     string
+		Permissions []*gamelift.InboundPermission
+	}{
+		Ctx:         ctx,
+		FleetId:     fleetId,
+		Permissions: permissions,
+	}
+	mock.lockRevokeInboundPermissions.Lock()
+	mock.calls.RevokeInboundPermissions = append(mock.calls.RevokeInboundPermissions, callInfo)
+	mock.lockRevokeInboundPermissions.Unlock()
+	return mock.RevokeInboundPermissionsFunc(ctx, fleetId, permissions)
+}
+
+// RevokeInboundPermissionsCalls gets all the calls that were made to RevokeInboundPermissions.
+// Check the length with:
+//
+//	len(mockedGameLiftClient.RevokeInboundPermissionsCalls())
+func (mock *GameLiftClientMock) RevokeInboundPermissionsCalls() []struct {
+	Ctx         context.Context
+	FleetId     string
+	Permissions []*gamelift.InboundPermission
+} {
+	var calls []struct {
+		Ctx         context.Context
+		FleetId     string
+		Permissions []*gamelift.InboundPermission
+	}
+	mock.lockRevokeInboundPermissions.RLock()
+	calls = mock.calls.RevokeInboundPermissions
+	mock.lockRevokeInboundPermissions.RUnlock()
+	return calls
+}
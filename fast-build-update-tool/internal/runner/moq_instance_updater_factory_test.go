@@ -6,6 +6,7 @@ package runner
 import (
 	"context"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 	"golang.org/x/crypto/ssh"
 	"sync"
 )
@@ -19,6 +20,9 @@ import (
 //			CreateFunc: func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error) {
 //				panic("mock out the Create method")
 //			},
+//			ScriptStatusFunc: func(instanceId string) tools.UpdateScriptStatus {
+//				panic("mock out the ScriptStatus method")
+//			},
 //		}
 //
 //		// use mockedInstanceUpdaterFactory in code that requires InstanceUpdaterFactory
@@ -29,6 +33,9 @@ type InstanceUpdaterFactoryMock struct {
 	// CreateFunc mocks the Create method.
 	CreateFunc func(ctx context.Context, verbose bool, sshKey ssh.Signer, updateScript string, sshPort int32, instance *gamelift.Instance) (InstanceUpdater, error)
 
+	// ScriptStatusFunc mocks the ScriptStatus method.
+	ScriptStatusFunc func(instanceId string) tools.UpdateScriptStatus
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// Create holds details about calls to the Create method.
@@ -46,8 +53,14 @@ type InstanceUpdaterFactoryMock struct {
 			// Instance is the instance argument value.
 			Instance *gamelift.Instance
 		}
+		// ScriptStatus holds details about calls to the ScriptStatus method.
+		ScriptStatus []struct {
+			// InstanceId is the instanceId argument value.
+			InstanceId string
+		}
 	}
-	lockCreate sync.RWMutex
+	lockCreate       sync.RWMutex
+	lockScriptStatus sync.RWMutex
 }
 
 // Create calls CreateFunc.
@@ -101,3 +114,35 @@ func (mock *InstanceUpdaterFactoryMock) CreateCalls() []struct {
 	mock.lockCreate.RUnlock()
 	return calls
 }
+
+// ScriptStatus calls ScriptStatusFunc.
+func (mock *InstanceUpdaterFactoryMock) ScriptStatus(instanceId string) tools.UpdateScriptStatus {
+	if mock.ScriptStatusFunc == nil {
+		panic("InstanceUpdaterFactoryMock.ScriptStatusFunc: method is nil but InstanceUpdaterFactory.ScriptStatus was just called")
+	}
+	callInfo := struct {
+		InstanceId string
+	}{
+		InstanceId: instanceId,
+	}
+	mock.lockScriptStatus.Lock()
+	mock.calls.ScriptStatus = append(mock.calls.ScriptStatus, callInfo)
+	mock.lockScriptStatus.Unlock()
+	return mock.ScriptStatusFunc(instanceId)
+}
+
+// ScriptStatusCalls gets all the calls that were made to ScriptStatus.
+// Check the length with:
+//
+//	len(mockedInstanceUpdaterFactory.ScriptStatusCalls())
+func (mock *InstanceUpdaterFactoryMock) ScriptStatusCalls() []struct {
+	InstanceId string
+} {
+	var calls []struct {
+		InstanceId string
+	}
+	mock.lockScriptStatus.RLock()
+	calls = mock.calls.ScriptStatus
+	mock.lockScriptStatus.RUnlock()
+	return calls
+}
@@ -5,7 +5,6 @@ package runner
 
 import (
 	"context"
-	"golang.org/x/crypto/ssh"
 	"sync"
 )
 
@@ -15,7 +14,7 @@ import (
 //
 //		// make and configure a mocked CommandRunner
 //		mockedCommandRunner := &CommandRunnerMock{
-//			RunFunc: func(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+//			RunFunc: func(ctx context.Context) error {
 //				panic("mock out the Run method")
 //			},
 //		}
@@ -26,7 +25,7 @@ import (
 //	}
 type CommandRunnerMock struct {
 	// RunFunc mocks the Run method.
-	RunFunc func(ctx context.Context, remotePublicKey ssh.PublicKey) error
+	RunFunc func(ctx context.Context) error
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -34,29 +33,25 @@ type CommandRunnerMock struct {
 		Run []struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
-			// RemotePublicKey is the remotePublicKey argument value.
-			RemotePublicKey ssh.PublicKey
 		}
 	}
 	lockRun sync.RWMutex
 }
 
 // Run calls RunFunc.
-func (mock *CommandRunnerMock) Run(ctx context.Context, remotePublicKey ssh.PublicKey) error {
+func (mock *CommandRunnerMock) Run(ctx context.Context) error {
 	if mock.RunFunc == nil {
 		panic("CommandRunnerMock.RunFunc: method is nil but CommandRunner.Run was just called")
 	}
 	callInfo := struct {
-		Ctx             context.Context
-		RemotePublicKey ssh.PublicKey
+		Ctx context.Context
 	}{
-		Ctx:             ctx,
-		RemotePublicKey: remotePublicKey,
+		Ctx: ctx,
 	}
 	mock.lockRun.Lock()
 	mock.calls.Run = append(mock.calls.Run, callInfo)
 	mock.lockRun.Unlock()
-	return mock.RunFunc(ctx, remotePublicKey)
+	return mock.RunFunc(ctx)
 }
 
 // RunCalls gets all the calls that were made to Run.
@@ -64,12 +59,10 @@ func (mock *CommandRunnerMock) Run(ctx context.Context, remotePublicKey ssh.Publ
 //
 //	len(mockedCommandRunner.RunCalls())
 func (mock *CommandRunnerMock) RunCalls() []struct {
-	Ctx             context.Context
-	RemotePublicKey ssh.PublicKey
+	Ctx context.Context
 } {
 	var calls []struct {
-		Ctx             context.Context
-		RemotePublicKey ssh.PublicKey
+		Ctx context.Context
 	}
 	mock.lockRun.RLock()
 	calls = mock.calls.Run
@@ -5,7 +5,7 @@ package runner
 
 import (
 	"context"
-	"golang.org/x/crypto/ssh"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 	"sync"
 )
 
@@ -15,7 +15,7 @@ import (
 //
 //		// make and configure a mocked RemoteSSHEnabler
 //		mockedRemoteSSHEnabler := &RemoteSSHEnablerMock{
-//			EnableFunc: func(ctx context.Context) (ssh.PublicKey, error) {
+//			EnableFunc: func(ctx context.Context) (tools.HostKeys, error) {
 //				panic("mock out the Enable method")
 //			},
 //		}
@@ -26,7 +26,7 @@ import (
 //	}
 type RemoteSSHEnablerMock struct {
 	// EnableFunc mocks the Enable method.
-	EnableFunc func(ctx context.Context) (ssh.PublicKey, error)
+	EnableFunc func(ctx context.Context) (tools.HostKeys, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -40,7 +40,7 @@ type RemoteSSHEnablerMock struct {
 }
 
 // Enable calls EnableFunc.
-func (mock *RemoteSSHEnablerMock) Enable(ctx context.Context) (ssh.PublicKey, error) {
+func (mock *RemoteSSHEnablerMock) Enable(ctx context.Context) (tools.HostKeys, error) {
 	if mock.EnableFunc == nil {
 		panic("RemoteSSHEnablerMock.EnableFunc: method is nil but RemoteSSHEnabler.Enable was just called")
 	}
@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"github.com/pterm/pterm"
+)
+
+// scriptPhases are well-known lines written by the update scripts, and the state of the update they start
+var scriptPhases = []struct {
+	line  string
+	state InstanceUpdateState
+}{
+	// Linux
+	{line: "extracting the archive", state: UpdateStateUnzipBuild},
+	{line: "killing running processes", state: UpdateStateRestartProcesses},
+	// Windows
+	{line: "Expanding ", state: UpdateStateUnzipBuild},
+	{line: "Ending running server processes", state: UpdateStateRestartProcesses},
+}
+
+// scriptOutputColors are used for the instance ID in front of each line of output, so the output of each instance can be told apart
+var scriptOutputColors = []pterm.Color{
+	pterm.FgCyan,
+	pterm.FgMagenta,
+	pterm.FgYellow,
+	pterm.FgBlue,
+	pterm.FgGreen,
+	pterm.FgLightCyan,
+	pterm.FgLightMagenta,
+	pterm.FgLightYellow,
+}
+
+// scriptOutputWriter handles each line of output from the update script on an instance.
+// Lines that start a phase of the script move the progress of the instance forward, and the status lines about its server processes are recorded.
+// If follow is set, every line is also printed.
+type scriptOutputWriter struct {
+	follow          bool
+	prefix          string
+	progressTracker *InstanceProgressWriter
+	// dashboard is set when the dashboard is shown, every line is added to the log of the instance instead of being printed
+	dashboard *dashboardInstance
+
+	statusLock sync.Mutex
+	status     tools.UpdateScriptStatus
+}
+
+func newScriptOutputWriter(instanceId string, follow bool, color pterm.Color) *scriptOutputWriter {
+	return &scriptOutputWriter{
+		follow: follow,
+		prefix: color.Sprintf("[%s]", instanceId),
+	}
+}
+
+// WriteLine can be used as a tools.OutputLineHandler
+func (s *scriptOutputWriter) WriteLine(line string, isError bool) {
+	if state, ok := scriptPhaseState(line); ok && s.progressTracker != nil {
+		s.progressTracker.UpdateState(state)
+	}
+
+	s.statusLock.Lock()
+	s.status.AddLine(line)
+	s.statusLock.Unlock()
+
+	if s.dashboard != nil {
+		s.dashboard.addOutputLine(line, isError)
+		return
+	}
+
+	if !s.follow {
+		return
+	}
+
+	if isError {
+		line = pterm.FgRed.Sprint(line)
+	}
+	pterm.Println(s.prefix + " " + line)
+}
+
+// Status returns what the update script reported about its server processes so far
+func (s *scriptOutputWriter) Status() tools.UpdateScriptStatus {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	return tools.UpdateScriptStatus{
+		ProcessStops: append([]tools.ProcessStop{}, s.status.ProcessStops...),
+		NoProcesses:  append([]tools.NoProcess{}, s.status.NoProcesses...),
+	}
+}
+
+// scriptPhaseState returns the state started by line, if it is one of the scriptPhases
+func scriptPhaseState(line string) (InstanceUpdateState, bool) {
+	for _, phase := range scriptPhases {
+		if strings.Contains(line, phase.line) {
+			return phase.state, true
+		}
+	}
+	return UpdateStateNotStarted, false
+}
@@ -0,0 +1,96 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
+)
+
+// testScriptMessages returns the messages the built-in update script for operatingSystem writes out, in the order they appear in the script.
+// Variables are not expanded, so each message is cut off at the first one.
+func testScriptMessages(t *testing.T, operatingSystem config.OperatingSystem) []string {
+	currentDir, err := os.Getwd()
+	assert.Nil(t, err)
+
+	archive := tools.ArchiveFile(filepath.Join(currentDir, "testdata", "game-executable.zip"))
+	generator := tools.NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, archive, "test", config.UpdateHooks{}, nil, 0, "")
+	defer generator.Cleanup()
+
+	scriptPath, err := generator.GenerateScript(context.Background(), operatingSystem, []string{"bin/server"})
+	assert.Nil(t, err)
+
+	script, err := os.ReadFile(scriptPath)
+	assert.Nil(t, err)
+
+	messages := []string{}
+	for _, match := range regexp.MustCompile(`(?m)^\s*(?:echo|Write-Host) "([^"$]+)`).FindAllStringSubmatch(string(script), -1) {
+		messages = append(messages, match[1])
+	}
+	return messages
+}
+
+// TestScriptOutputWriterPhases ensures that the phases of the update script move the progress of the instance forward, and never back
+func TestScriptOutputWriterPhases(t *testing.T) {
+	for _, operatingSystem := range []config.OperatingSystem{config.OperatingSystemLinux, config.OperatingSystemWindows} {
+		progressTracker, err := NewInstanceProgressWriter(&gamelift.Instance{InstanceId: instanceId, IpAddress: "127.0.0.1"}, false)
+		assert.Nil(t, err)
+		progressTracker.UpdateState(UpdateStateRunUpdateScript)
+
+		writer := newScriptOutputWriter(instanceId, false, pterm.FgCyan)
+		writer.progressTracker = progressTracker
+
+		// Every phase is written out by the real update script
+		phases := map[InstanceUpdateState]bool{}
+		for _, message := range testScriptMessages(t, operatingSystem) {
+			if state, ok := scriptPhaseState(message); ok {
+				phases[state] = true
+			}
+			writer.WriteLine(message, false)
+		}
+		assert.True(t, phases[UpdateStateUnzipBuild], operatingSystem)
+		assert.True(t, phases[UpdateStateRestartProcesses], operatingSystem)
+		assert.Equal(t, UpdateStateRestartProcesses, progressTracker.instanceUpdateState, operatingSystem)
+	}
+
+	progressTracker, err := NewInstanceProgressWriter(&gamelift.Instance{InstanceId: instanceId, IpAddress: "127.0.0.1"}, false)
+	assert.Nil(t, err)
+	progressTracker.UpdateState(UpdateStateRunUpdateScript)
+
+	writer := newScriptOutputWriter(instanceId, false, pterm.FgCyan)
+	writer.progressTracker = progressTracker
+
+	writer.WriteLine("acquiring update lock", false)
+	assert.Equal(t, UpdateStateRunUpdateScript, progressTracker.instanceUpdateState)
+
+	writer.WriteLine("Ending running server processes", false)
+	assert.Equal(t, UpdateStateRestartProcesses, progressTracker.instanceUpdateState)
+
+	writer.WriteLine("Expanding C:\\Users\\gl-user-server\\build.zip", false)
+	assert.Equal(t, UpdateStateRestartProcesses, progressTracker.instanceUpdateState)
+}
+
+// TestScriptOutputWriterStatus ensures that the status lines written by the update script are recorded
+func TestScriptOutputWriterStatus(t *testing.T) {
+	writer := newScriptOutputWriter(instanceId, false, pterm.FgCyan)
+
+	writer.WriteLine("sent SIGTERM to 2 gameserver processes", false)
+	writer.WriteLine("FBUT_STOP 1234 exited 3 /local/game/server", false)
+	writer.WriteLine("FBUT_STOP 5678 killed 30 /local/game/server", false)
+	writer.WriteLine("FBUT_NO_PROCESS warn /local/game/other", false)
+
+	status := writer.Status()
+	assert.Equal(t, []tools.ProcessStop{
+		{Pid: 1234, Name: "/local/game/server", Result: tools.ProcessStopExited, Waited: 3 * time.Second},
+		{Pid: 5678, Name: "/local/game/server", Result: tools.ProcessStopKilled, Waited: 30 * time.Second},
+	}, status.ProcessStops)
+	assert.Equal(t, []tools.NoProcess{{Name: "/local/game/other", Policy: config.NoProcessPolicyWarn}}, status.NoProcesses)
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+)
+
+//go:generate moq -skip-ensure -out ./moq_ssm_update_runner_test.go . SSMUpdateRunner
+
+// SSMUpdateRunner is an abstraction around copying files to, and running the update script on, a remote instance through an SSM session
+type SSMUpdateRunner interface {
+	// Run will copy files to the remote instance, and run the update script. onScriptStarted is called once every file has been copied.
+	Run(ctx context.Context, onScriptStarted func()) error
+}
+
+// ssmInstanceUpdater is used to update a single instance in a GameLift fleet without SSH
+type ssmInstanceUpdater struct {
+	progressTracker *InstanceProgressWriter
+	updateRunner    SSMUpdateRunner
+
+	logger *slog.Logger
+}
+
+func (s *ssmInstanceUpdater) Update(ctx context.Context) error {
+	s.logger.Debug("updating instance over ssm")
+
+	s.progressTracker.UpdateState(UpdateStateCopyBuild)
+
+	err := s.run(ctx)
+	if err != nil {
+		err = fmt.Errorf("error updating instance over ssm %w", err)
+		s.progressTracker.UpdateFailed(err)
+		return err
+	}
+
+	s.logger.Debug("done updating instance over ssm")
+
+	s.progressTracker.UpdateState(UpdateStateCount)
+
+	return nil
+}
+
+// run copies the files to, and runs the update script on, the instance in a single SSM session
+func (s *ssmInstanceUpdater) run(ctx context.Context) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "RunOverSSM")
+	defer func() { config.EndSpan(span, err) }()
+
+	return s.updateRunner.Run(ctx, func() {
+		s.progressTracker.UpdateState(UpdateStateRunUpdateScript)
+	})
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSSMInstanceUpdater(t *testing.T, run func(ctx context.Context, onScriptStarted func()) error) (*ssmInstanceUpdater, *SSMUpdateRunnerMock) {
+	progressTracker, err := NewInstanceProgressWriter(&gamelift.Instance{InstanceId: instanceId, IpAddress: "127.0.0.1"}, false)
+	assert.Nil(t, err)
+
+	updateRunner := &SSMUpdateRunnerMock{RunFunc: run}
+
+	return &ssmInstanceUpdater{
+		progressTracker: progressTracker,
+		updateRunner:    updateRunner,
+		logger:          NewTestLogger(),
+	}, updateRunner
+}
+
+// TestSSMInstanceUpdate verifies that the progress moves through each step when the update succeeds
+func TestSSMInstanceUpdate(t *testing.T) {
+	var stateWhenStarted InstanceUpdateState
+	var updater *ssmInstanceUpdater
+	updater, updateRunner := testSSMInstanceUpdater(t, func(ctx context.Context, onScriptStarted func()) error {
+		assert.Equal(t, UpdateStateCopyBuild, updater.progressTracker.instanceUpdateState)
+		onScriptStarted()
+		stateWhenStarted = updater.progressTracker.instanceUpdateState
+		return nil
+	})
+
+	err := updater.Update(context.Background())
+
+	assert.Nil(t, err)
+	assert.Len(t, updateRunner.RunCalls(), 1)
+	assert.Equal(t, UpdateStateRunUpdateScript, stateWhenStarted)
+	assert.Equal(t, UpdateStateCount, updater.progressTracker.instanceUpdateState)
+}
+
+// TestSSMInstanceUpdateFailed verifies that an error from the SSM session is returned
+func TestSSMInstanceUpdateFailed(t *testing.T) {
+	updater, _ := testSSMInstanceUpdater(t, func(ctx context.Context, onScriptStarted func()) error {
+		return errors.New("session failed")
+	})
+
+	err := updater.Update(context.Background())
+
+	assert.ErrorContains(t, err, "error updating instance over ssm session failed")
+	assert.Equal(t, UpdateStateCopyBuild, updater.progressTracker.instanceUpdateState)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
 )
 
 //go:generate moq -skip-ensure -out ./moq_gamelift_client_test.go . GameLiftClient
@@ -12,13 +13,27 @@ type GameLiftClient interface {
 	GetFleet(ctx context.Context, fleetId string) (*gamelift.Fleet, error)
 	GetInstanceAccess(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error)
 	GetInstances(ctx context.Context, fleetId string, allowedInstanceIds []string) ([]*gamelift.Instance, error)
-	OpenPortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) error
+	OpenPortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) (bool, error)
+	ClosePortForFleet(ctx context.Context, fleetId string, port int32, ipRange string) error
+	GetInboundPermissions(ctx context.Context, fleetId string) ([]*gamelift.InboundPermission, error)
+	RevokeInboundPermissions(ctx context.Context, fleetId string, permissions []*gamelift.InboundPermission) error
+	GetFleetLock(ctx context.Context, fleetArn string) (*gamelift.FleetLock, error)
+	PutFleetLock(ctx context.Context, fleetArn string, lock *gamelift.FleetLock) error
+	RemoveFleetLock(ctx context.Context, fleetArn string) error
 }
 
 type FleetUpdateResults struct {
 	InstancesFound        int
 	InstancesUpdated      int
 	InstancesFailedUpdate []string
+	// InstancesCanceled holds the instances the user canceled from the dashboard before they were updated
+	InstancesCanceled []string
+	// FailedSteps holds the remote step that failed for each failed instance, when it failed in a step run over SSM
+	FailedSteps map[string]*tools.RemoteCommandError
+	// ProcessStops holds the server processes stopped by the update script on each instance, and how each of them exited
+	ProcessStops map[string][]tools.ProcessStop
+	// NoProcesses holds the executables that had no running server process on each instance, along with what the update script did about it
+	NoProcesses map[string][]tools.NoProcess
 }
 
 type InstanceUpdateState uint
@@ -28,6 +43,10 @@ const (
 	UpdateStateEnableSSH       InstanceUpdateState = iota
 	UpdateStateCopyBuild       InstanceUpdateState = iota
 	UpdateStateRunUpdateScript InstanceUpdateState = iota
+	// UpdateStateUnzipBuild and UpdateStateRestartProcesses are phases of the update script, they are found in its output
+	UpdateStateUnzipBuild       InstanceUpdateState = iota
+	UpdateStateRestartProcesses InstanceUpdateState = iota
+	UpdateStateRevokeAccess     InstanceUpdateState = iota
 
 	// Must be last
 
@@ -42,6 +61,12 @@ func (i InstanceUpdateState) String() string {
 		return "copying build to instance"
 	case UpdateStateRunUpdateScript:
 		return "updating instance"
+	case UpdateStateUnzipBuild:
+		return "unzipping build"
+	case UpdateStateRestartProcesses:
+		return "restarting server processes"
+	case UpdateStateRevokeAccess:
+		return "revoking remote access"
 	case UpdateStateCount:
 		return "done"
 	default:
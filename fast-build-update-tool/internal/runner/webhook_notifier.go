@@ -0,0 +1,321 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/tools"
+)
+
+// WebhookEvent is the kind of notification sent to webhooks
+type WebhookEvent string
+
+const (
+	// WebhookEventStarted is sent once the instances to update are known, before any of them are updated
+	WebhookEventStarted WebhookEvent = "update.started"
+	// WebhookEventInstanceFailed is sent each time an instance fails to update
+	WebhookEventInstanceFailed WebhookEvent = "instance.failed"
+	// WebhookEventCompleted is sent once every instance was updated, or failed to update
+	WebhookEventCompleted WebhookEvent = "update.completed"
+)
+
+const (
+	// webhookSignatureHeader holds the HMAC-SHA256 of the payload, when a webhook secret is set
+	webhookSignatureHeader = "X-Signature-256"
+	// webhookEventHeader holds the WebhookEvent of the payload
+	webhookEventHeader = "X-Webhook-Event"
+
+	webhookAttempts       = 3
+	webhookRetryDelay     = 2 * time.Second
+	webhookRequestTimeout = 10 * time.Second
+)
+
+// WebhookPayload is the JSON sent to webhooks for each event
+type WebhookPayload struct {
+	Event     WebhookEvent `json:"event"`
+	FleetId   string       `json:"fleetId"`
+	RunId     string       `json:"runId,omitempty"`
+	StartedBy string       `json:"startedBy,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+	// InstanceCount is the number of instances that will be updated, it is only set on WebhookEventStarted
+	InstanceCount int `json:"instanceCount,omitempty"`
+	// Instance is only set on WebhookEventInstanceFailed
+	Instance *WebhookInstanceFailure `json:"instance,omitempty"`
+	// Results is only set on WebhookEventCompleted
+	Results *WebhookResults `json:"results,omitempty"`
+}
+
+// WebhookInstanceFailure describes why an instance failed to update
+type WebhookInstanceFailure struct {
+	InstanceId string `json:"instanceId"`
+	Region     string `json:"region,omitempty"`
+	Error      string `json:"error"`
+	// FailedStep is the remote step that failed, when the instance failed in a step run over SSM
+	FailedStep  string `json:"failedStep,omitempty"`
+	LogFilePath string `json:"logFilePath,omitempty"`
+}
+
+// WebhookResults is the FleetUpdateResults of a finished update
+type WebhookResults struct {
+	Succeeded         bool     `json:"succeeded"`
+	InstancesFound    int      `json:"instancesFound"`
+	InstancesUpdated  int      `json:"instancesUpdated"`
+	InstancesFailed   []string `json:"instancesFailed"`
+	InstancesCanceled []string `json:"instancesCanceled"`
+	// FailedSteps holds the remote step that failed for each failed instance, when it failed in a step run over SSM
+	FailedSteps map[string]string `json:"failedSteps,omitempty"`
+}
+
+// slackPayload is the message posted to a Slack incoming webhook
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// WebhookNotifier sends notifications about a fleet update to every configured webhook.
+// Webhooks that can't be reached are only logged, they never fail the update.
+type WebhookNotifier struct {
+	options   config.WebhookOptions
+	fleetId   string
+	runId     string
+	startedBy string
+
+	logger     *slog.Logger
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+// NewWebhookNotifier builds a new WebhookNotifier, it does nothing when no webhook URLs are configured
+func NewWebhookNotifier(logger *slog.Logger, fleetId string, runId string, options config.WebhookOptions) *WebhookNotifier {
+	return &WebhookNotifier{
+		options:    options,
+		fleetId:    fleetId,
+		runId:      runId,
+		startedBy:  startedBy(),
+		logger:     logger.With("context", "WebhookNotifier"),
+		client:     &http.Client{Timeout: webhookRequestTimeout},
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// startedBy returns who is running this update, eg. user@hostname, so others know who is updating a shared fleet
+func startedBy() string {
+	name, host := currentUser(), currentHost()
+	if name == "" || host == "" {
+		return name + host
+	}
+	return name + "@" + host
+}
+
+// Started notifies every webhook that instanceCount instances are about to be updated
+func (w *WebhookNotifier) Started(ctx context.Context, instanceCount int) {
+	payload := w.newPayload(WebhookEventStarted)
+	payload.InstanceCount = instanceCount
+
+	w.send(ctx, payload)
+}
+
+// InstanceFailed notifies every webhook that instance failed to update with err
+func (w *WebhookNotifier) InstanceFailed(ctx context.Context, instance *gamelift.Instance, err error) {
+	payload := w.newPayload(WebhookEventInstanceFailed)
+	payload.Instance = &WebhookInstanceFailure{
+		InstanceId: instance.InstanceId,
+		Region:     instance.Region,
+		Error:      err.Error(),
+	}
+
+	var stepErr *tools.RemoteCommandError
+	if errors.As(err, &stepErr) {
+		payload.Instance.FailedStep = stepErr.Step
+		payload.Instance.LogFilePath = stepErr.LogFilePath
+	}
+
+	w.send(ctx, payload)
+}
+
+// Completed notifies every webhook of the results of the update
+func (w *WebhookNotifier) Completed(ctx context.Context, results *FleetUpdateResults) {
+	payload := w.newPayload(WebhookEventCompleted)
+	payload.Results = &WebhookResults{
+		Succeeded:         len(results.InstancesFailedUpdate) == 0 && len(results.InstancesCanceled) == 0,
+		InstancesFound:    results.InstancesFound,
+		InstancesUpdated:  results.InstancesUpdated,
+		InstancesFailed:   append([]string{}, results.InstancesFailedUpdate...),
+		InstancesCanceled: append([]string{}, results.InstancesCanceled...),
+	}
+
+	if len(results.FailedSteps) > 0 {
+		payload.Results.FailedSteps = make(map[string]string, len(results.FailedSteps))
+		for instanceId, stepErr := range results.FailedSteps {
+			payload.Results.FailedSteps[instanceId] = stepErr.Step
+		}
+	}
+
+	w.send(ctx, payload)
+}
+
+func (w *WebhookNotifier) newPayload(event WebhookEvent) *WebhookPayload {
+	return &WebhookPayload{
+		Event:     event,
+		FleetId:   w.fleetId,
+		RunId:     w.runId,
+		StartedBy: w.startedBy,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// send posts payload to every webhook, in the configured template
+func (w *WebhookNotifier) send(ctx context.Context, payload *WebhookPayload) {
+	if len(w.options.URLs) == 0 {
+		return
+	}
+
+	body, err := w.render(payload)
+	if err != nil {
+		w.logger.Warn("error building webhook payload", "event", payload.Event, "err", err)
+		return
+	}
+
+	for _, webhookURL := range w.options.URLs {
+		err := w.post(ctx, webhookURL, payload.Event, body)
+		if err != nil {
+			w.logger.Warn("error sending webhook notification", "event", payload.Event, "url", redactWebhookURL(webhookURL), "err", err)
+		} else {
+			w.logger.Debug("sent webhook notification", "event", payload.Event, "url", redactWebhookURL(webhookURL))
+		}
+	}
+}
+
+// render returns the body sent to webhooks for payload
+func (w *WebhookNotifier) render(payload *WebhookPayload) ([]byte, error) {
+	if w.options.Template == config.WebhookTemplateSlack {
+		return json.Marshal(&slackPayload{Text: slackText(payload)})
+	}
+
+	return json.Marshal(payload)
+}
+
+// slackText returns a short message describing payload, in Slack's markdown
+func slackText(payload *WebhookPayload) string {
+	switch payload.Event {
+	case WebhookEventStarted:
+		return fmt.Sprintf(":rocket: %s started updating %d instance(s) in fleet `%s`", orSomeone(payload.StartedBy), payload.InstanceCount, payload.FleetId)
+
+	case WebhookEventInstanceFailed:
+		text := fmt.Sprintf(":x: Instance `%s` in fleet `%s` failed to update: %s", payload.Instance.InstanceId, payload.FleetId, payload.Instance.Error)
+		if payload.Instance.FailedStep != "" {
+			text += fmt.Sprintf(" (step %q)", payload.Instance.FailedStep)
+		}
+		return text
+
+	default:
+		results := payload.Results
+		if results.Succeeded {
+			return fmt.Sprintf(":white_check_mark: %s finished updating fleet `%s`, %d instance(s) updated", orSomeone(payload.StartedBy), payload.FleetId, results.InstancesUpdated)
+		}
+
+		text := fmt.Sprintf(":warning: %s finished updating fleet `%s` with errors, %d of %d instance(s) updated", orSomeone(payload.StartedBy), payload.FleetId, results.InstancesUpdated, results.InstancesFound)
+		if len(results.InstancesFailed) > 0 {
+			text += fmt.Sprintf("\nFailed: %s", strings.Join(results.InstancesFailed, ", "))
+		}
+		if len(results.InstancesCanceled) > 0 {
+			text += fmt.Sprintf("\nCanceled: %s", strings.Join(results.InstancesCanceled, ", "))
+		}
+		return text
+	}
+}
+
+func orSomeone(startedBy string) string {
+	if startedBy == "" {
+		return "Someone"
+	}
+	return startedBy
+}
+
+// post sends body to webhookURL, and retries when the webhook can't be reached or returns a server error
+func (w *WebhookNotifier) post(ctx context.Context, webhookURL string, event WebhookEvent, body []byte) (err error) {
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(w.retryDelay * time.Duration(attempt-1)):
+			}
+		}
+
+		var retry bool
+		retry, err = w.postOnce(ctx, webhookURL, event, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", webhookAttempts, err)
+}
+
+// postOnce sends body to webhookURL, retry is true when the request failed in a way that may succeed if it is sent again
+func (w *WebhookNotifier) postOnce(ctx context.Context, webhookURL string, event WebhookEvent, body []byte) (retry bool, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, redactWebhookURLError(err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", config.AppName)
+	request.Header.Set(webhookEventHeader, string(event))
+	if w.options.Secret != "" {
+		request.Header.Set(webhookSignatureHeader, signWebhookPayload(w.options.Secret, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return true, redactWebhookURLError(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("webhook returned %s", response.Status)
+	return response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests, err
+}
+
+// redactWebhookURL returns only the scheme and host of webhookURL for logging, since webhook URLs often hold a secret token in their path or query
+func redactWebhookURL(webhookURL string) string {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Host == "" {
+		return "<invalid url>"
+	}
+
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// redactWebhookURLError removes the full webhook URL that the http client includes in its errors
+func redactWebhookURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactWebhookURL(urlErr.URL)
+	}
+
+	return err
+}
+
+// signWebhookPayload returns the value of the signature header for body, in the same format as GitHub webhooks (sha256=<hex HMAC>)
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
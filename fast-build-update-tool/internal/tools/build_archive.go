@@ -0,0 +1,494 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveFormat is the file format of a build archive
+type ArchiveFormat string
+
+const (
+	ArchiveFormatZip     ArchiveFormat = "zip"
+	ArchiveFormatTarGzip ArchiveFormat = "tar.gz"
+	ArchiveFormatTarZstd ArchiveFormat = "tar.zst"
+)
+
+// archiveMagicBytes are the bytes each archive format starts with, a tar file is only supported when it is compressed
+var archiveMagicBytes = []struct {
+	magic  []byte
+	format ArchiveFormat
+}{
+	{magic: []byte("PK\x03\x04"), format: ArchiveFormatZip},
+	// An empty zip is only an end of central directory record
+	{magic: []byte("PK\x05\x06"), format: ArchiveFormatZip},
+	{magic: []byte{0x1f, 0x8b}, format: ArchiveFormatTarGzip},
+	{magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, format: ArchiveFormatTarZstd},
+}
+
+// DetectArchiveFormat works out the format of an archive from the first bytes of reader, the file extension is never looked at
+func DetectArchiveFormat(reader io.Reader) (ArchiveFormat, error) {
+	header := make([]byte, 4)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	for _, candidate := range archiveMagicBytes {
+		if bytes.HasPrefix(header[:n], candidate.magic) {
+			return candidate.format, nil
+		}
+	}
+	return "", errors.New("build archive is not a zip, tar.gz or tar.zst file")
+}
+
+// BuildArchive is the archive of the build that is copied to, and unpacked on, each instance
+type BuildArchive interface {
+	// Name is the file name of the archive on the instance
+	Name() string
+	// Format returns the file format of the archive
+	Format() (ArchiveFormat, error)
+	// SHA256 returns the hex encoded SHA-256 of the archive
+	SHA256() (string, error)
+	// EntryNames returns the slash separated path of every file in the archive
+	EntryNames() ([]string, error)
+}
+
+// StreamedFile is a file that is copied to an instance from WriteTo, rather than from a path passed to the upload, like the zip of a build directory
+type StreamedFile interface {
+	// Name is the file name on the instance
+	Name() string
+	// Size returns the number of bytes WriteTo will write
+	Size() (int64, error)
+	WriteTo(writer io.Writer) (int64, error)
+}
+
+// ArchiveFile is a BuildArchive for a zip, tar.gz or tar.zst file on the local filesystem, as passed with --zip-path
+type ArchiveFile string
+
+// Name is the file name of the archive
+func (a ArchiveFile) Name() string {
+	return filepath.Base(string(a))
+}
+
+// Format works out the file format of the archive from its first bytes
+func (a ArchiveFile) Format() (ArchiveFormat, error) {
+	file, err := os.Open(string(a))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return DetectArchiveFormat(file)
+}
+
+// SHA256 returns the hex encoded SHA-256 of the archive, it is worked out each time it is called
+func (a ArchiveFile) SHA256() (string, error) {
+	return config.FileSHA256(string(a))
+}
+
+// EntryNames returns the name of every file in the archive
+func (a ArchiveFile) EntryNames() ([]string, error) {
+	format, err := a.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case ArchiveFormatTarGzip, ArchiveFormatTarZstd:
+		return a.tarEntryNames(format)
+	default:
+		return a.zipEntryNames()
+	}
+}
+
+func (a ArchiveFile) zipEntryNames() ([]string, error) {
+	zipReader, err := zip.OpenReader(string(a))
+	if err != nil {
+		return nil, err
+	}
+	defer zipReader.Close()
+
+	result := make([]string, 0, len(zipReader.File))
+	for _, file := range zipReader.File {
+		result = append(result, file.Name)
+	}
+	return result, nil
+}
+
+// tarEntryNames reads through the whole tar file, since it has no index. Directories are left out, and the ./ that tar adds when a
+// directory is archived with "tar -C dir ." is trimmed, so the names match the paths in a zip.
+func (a ArchiveFile) tarEntryNames(format ArchiveFormat) ([]string, error) {
+	file, err := os.Open(string(a))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var decompressed io.Reader
+	if format == ArchiveFormatTarGzip {
+		gzipReader, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		decompressed = gzipReader
+	} else {
+		zstdReader, err := zstd.NewReader(bufio.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		decompressed = zstdReader
+	}
+
+	var result []string
+	tarReader := tar.NewReader(decompressed)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		result = append(result, strings.TrimPrefix(header.Name, "./"))
+	}
+}
+
+// DirectoryArchive is a BuildArchive for a build directory, as passed with --build-dir.
+// The directory is zipped once, into a temporary file the first time the zip is needed, and every instance is sent that same zip.
+type DirectoryArchive struct {
+	dir     string
+	name    string
+	entries []archiveEntry
+
+	zipOnce sync.Once
+	zipPath ArchiveFile
+	size    int64
+	sha256  string
+	zipErr  error
+
+	// tempDir holds the zip once it was built, it is removed by Cleanup
+	tempDir string
+}
+
+// archiveEntry is a file or directory in a build directory, that is added to its archive
+type archiveEntry struct {
+	// name is the slash separated path of the entry in the zip, directories end with a slash
+	name      string
+	localPath string
+	info      fs.FileInfo
+}
+
+// NewDirectoryArchive will list the files in dir, leaving out the files matched by its .fastbuildignore.
+// The archive is named after the directory.
+func NewDirectoryArchive(dir string) (*DirectoryArchive, error) {
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error finding build directory %w", err)
+	}
+
+	ignorePatterns, err := loadIgnorePatterns(filepath.Join(absoluteDir, config.BuildIgnoreFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DirectoryArchive{
+		dir:  absoluteDir,
+		name: config.DirectoryArchiveName(absoluteDir),
+	}
+
+	err = filepath.WalkDir(absoluteDir, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(absoluteDir, localPath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if relativePath == "." || relativePath == config.BuildIgnoreFileName {
+			return nil
+		}
+
+		// Symbolic links to files are added as the file they point to
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink != 0 && info.IsDir() {
+			return fmt.Errorf("%s is a symbolic link to a directory, which can't be added to the build archive", relativePath)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file, and can't be added to the build archive", relativePath)
+		}
+
+		if ignorePatterns.matches(relativePath, info.IsDir()) {
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		name := relativePath
+		if info.IsDir() {
+			name += "/"
+		}
+		result.entries = append(result.entries, archiveEntry{name: name, localPath: localPath, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading build directory %w", err)
+	}
+
+	return result, nil
+}
+
+// Name is the file name of the zip, the name of the build directory with a .zip extension
+func (d *DirectoryArchive) Name() string {
+	return d.name
+}
+
+// Format is always zip, a build directory is zipped before it is copied
+func (d *DirectoryArchive) Format() (ArchiveFormat, error) {
+	return ArchiveFormatZip, nil
+}
+
+// SHA256 returns the hex encoded SHA-256 of the zip, the zip is built if it was not already
+func (d *DirectoryArchive) SHA256() (string, error) {
+	d.buildZip()
+	return d.sha256, d.zipErr
+}
+
+// Size returns the size of the zip in bytes, the zip is built if it was not already
+func (d *DirectoryArchive) Size() (int64, error) {
+	d.buildZip()
+	return d.size, d.zipErr
+}
+
+// EntryNames returns the slash separated path of every file in the zip
+func (d *DirectoryArchive) EntryNames() ([]string, error) {
+	result := make([]string, 0, len(d.entries))
+	for _, entry := range d.entries {
+		if !entry.info.IsDir() {
+			result = append(result, entry.name)
+		}
+	}
+	return result, nil
+}
+
+// WriteTo writes the zip to writer, the zip is built if it was not already
+func (d *DirectoryArchive) WriteTo(writer io.Writer) (int64, error) {
+	d.buildZip()
+	if d.zipErr != nil {
+		return 0, d.zipErr
+	}
+
+	file, err := os.Open(string(d.zipPath))
+	if err != nil {
+		return 0, fmt.Errorf("error opening the build archive %w", err)
+	}
+	defer file.Close()
+
+	return io.Copy(writer, file)
+}
+
+// WriteTempZip returns the zip on the local filesystem, for transfers that have to read it from there. The zip is built if it was not already.
+func (d *DirectoryArchive) WriteTempZip() (ArchiveFile, error) {
+	d.buildZip()
+	return d.zipPath, d.zipErr
+}
+
+// buildZip zips the build directory into a new temporary directory, working out the size and SHA-256 of the zip as it is written
+func (d *DirectoryArchive) buildZip() {
+	d.zipOnce.Do(func() {
+		d.zipPath, d.zipErr = d.writeTempZip()
+		if d.zipErr != nil {
+			d.zipErr = fmt.Errorf("error building archive of the build directory %w", d.zipErr)
+		}
+	})
+}
+
+func (d *DirectoryArchive) writeTempZip() (ArchiveFile, error) {
+	tempDir, err := os.MkdirTemp("", "fast-build-update-tool-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary directory for the build archive %w", err)
+	}
+	d.tempDir = tempDir
+
+	zipPath := filepath.Join(tempDir, d.name)
+	file, err := os.Create(zipPath)
+	if err != nil {
+		return "", fmt.Errorf("error creating the build archive %w", err)
+	}
+
+	hash := sha256.New()
+	bufferedFile := bufio.NewWriter(file)
+	d.size, err = d.writeZip(io.MultiWriter(bufferedFile, hash))
+	if err == nil {
+		err = bufferedFile.Flush()
+	}
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		return "", fmt.Errorf("error writing the build archive %w", err)
+	}
+
+	d.sha256 = hex.EncodeToString(hash.Sum(nil))
+	return ArchiveFile(zipPath), nil
+}
+
+// writeZip zips the build directory to writer, in the order the entries were listed. The permissions of each file are kept, so executables can still be run once unpacked on Linux.
+func (d *DirectoryArchive) writeZip(writer io.Writer) (int64, error) {
+	counter := &countingWriter{writer: writer}
+	zipWriter := zip.NewWriter(counter)
+
+	for _, entry := range d.entries {
+		header, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return counter.bytes, err
+		}
+		header.Name = entry.name
+		if entry.info.IsDir() {
+			header.Method = zip.Store
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		entryWriter, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return counter.bytes, err
+		}
+		if entry.info.IsDir() {
+			continue
+		}
+
+		err = copyFileTo(entryWriter, entry.localPath)
+		if err != nil {
+			return counter.bytes, fmt.Errorf("error adding %s to the build archive %w", entry.name, err)
+		}
+	}
+
+	err := zipWriter.Close()
+	return counter.bytes, err
+}
+
+// Cleanup removes the zip, if it was built
+func (d *DirectoryArchive) Cleanup() error {
+	if d.tempDir == "" {
+		return nil
+	}
+	return os.RemoveAll(d.tempDir)
+}
+
+// copyFileTo copies the contents of the file at localPath to writer
+func copyFileTo(writer io.Writer, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// countingWriter counts the bytes written to writer
+type countingWriter struct {
+	writer io.Writer
+	bytes  int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.writer.Write(b)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// ignorePattern is a glob from a .fastbuildignore file
+type ignorePattern struct {
+	glob string
+	// anchored patterns contain a slash, and are matched against the whole path from the root of the build directory. Other patterns are matched against the name of each file and directory.
+	anchored bool
+	// directoryOnly patterns end with a slash, and only match directories
+	directoryOnly bool
+}
+
+type ignorePatterns []ignorePattern
+
+// loadIgnorePatterns reads the patterns in a .fastbuildignore file, there are none if the file does not exist.
+// Each line holds a glob in the syntax of path.Match, blank lines and lines starting with # are skipped.
+func loadIgnorePatterns(ignoreFilePath string) (ignorePatterns, error) {
+	contents, err := os.ReadFile(ignoreFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s %w", config.BuildIgnoreFileName, err)
+	}
+
+	var result ignorePatterns
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := ignorePattern{}
+		if strings.HasSuffix(line, "/") {
+			pattern.directoryOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			pattern.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		pattern.glob = line
+
+		if _, err := path.Match(pattern.glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern on line %d of %s: %w", i+1, config.BuildIgnoreFileName, err)
+		}
+		result = append(result, pattern)
+	}
+	return result, nil
+}
+
+// matches returns true if the file or directory at relativePath, relative to the root of the build directory, is ignored
+func (i ignorePatterns) matches(relativePath string, isDir bool) bool {
+	for _, pattern := range i {
+		if pattern.directoryOnly && !isDir {
+			continue
+		}
+
+		name := path.Base(relativePath)
+		if pattern.anchored {
+			name = relativePath
+		}
+		if matched, _ := path.Match(pattern.glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
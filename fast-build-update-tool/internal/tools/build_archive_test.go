@@ -0,0 +1,232 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBuildDir creates a build directory with each of files, keyed by their slash separated path
+func writeBuildDir(t *testing.T, files map[string]string) string {
+	dir := filepath.Join(t.TempDir(), "mybuild")
+	for name, contents := range files {
+		localPath := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(localPath), 0755))
+		assert.Nil(t, os.WriteFile(localPath, []byte(contents), 0644))
+	}
+	return dir
+}
+
+// TestDirectoryArchive ensures every file in a build directory is zipped, and the zip is the same every time it is built
+func TestDirectoryArchive(t *testing.T) {
+	dir := writeBuildDir(t, map[string]string{
+		"bin/server":       "server",
+		"data/level1.pak":  "level1",
+		"config/game.json": "{}",
+	})
+
+	archive, err := NewDirectoryArchive(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "mybuild.zip", archive.Name())
+
+	entryNames, err := archive.EntryNames()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bin/server", "config/game.json", "data/level1.pak"}, entryNames)
+
+	var first, second bytes.Buffer
+	_, err = archive.WriteTo(&first)
+	assert.Nil(t, err)
+	_, err = archive.WriteTo(&second)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Bytes(), second.Bytes())
+
+	size, err := archive.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(first.Len()), size)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(first.Bytes()), int64(first.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, "bin/", zipReader.File[0].Name)
+	assert.Equal(t, "bin/server", zipReader.File[1].Name)
+
+	assert.Nil(t, archive.Cleanup())
+}
+
+// TestDirectoryArchiveBuiltOnce ensures the directory is only zipped once, and every instance is sent that same zip
+func TestDirectoryArchiveBuiltOnce(t *testing.T) {
+	dir := writeBuildDir(t, map[string]string{"bin/server": "server"})
+
+	archive, err := NewDirectoryArchive(dir)
+	assert.Nil(t, err)
+	defer archive.Cleanup()
+
+	expected, err := archive.SHA256()
+	assert.Nil(t, err)
+
+	// A change to the directory is not picked up once the zip was built
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "bin", "server"), []byte("a new server"), 0644))
+
+	hash := sha256.New()
+	_, err = archive.WriteTo(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// TestDirectoryArchiveExecutableBits ensures the permissions of each file are kept in the zip, so executables can be run on Linux
+func TestDirectoryArchiveExecutableBits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("files have no executable bit on Windows")
+	}
+
+	dir := writeBuildDir(t, map[string]string{"bin/server": "server", "readme.txt": "hello"})
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "bin", "server"), 0755))
+
+	archive, err := NewDirectoryArchive(dir)
+	assert.Nil(t, err)
+	defer archive.Cleanup()
+
+	var buffer bytes.Buffer
+	_, err = archive.WriteTo(&buffer)
+	assert.Nil(t, err)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.Nil(t, err)
+	modes := map[string]os.FileMode{}
+	for _, file := range zipReader.File {
+		modes[file.Name] = file.Mode().Perm()
+	}
+	assert.Equal(t, os.FileMode(0755), modes["bin/server"])
+	assert.Equal(t, os.FileMode(0644), modes["readme.txt"])
+}
+
+// TestDirectoryArchiveIgnore ensures the files matched by .fastbuildignore are left out of the zip, along with the ignore file itself
+func TestDirectoryArchiveIgnore(t *testing.T) {
+	dir := writeBuildDir(t, map[string]string{
+		config.BuildIgnoreFileName: "# debug files\n*.pdb\n\nlogs/\n/config/local.json\n",
+		"bin/server":               "server",
+		"bin/server.pdb":           "symbols",
+		"logs/today.log":           "log",
+		"bin/logs":                 "a file called logs",
+		"config/local.json":        "{}",
+		"config/game.json":         "{}",
+	})
+
+	archive, err := NewDirectoryArchive(dir)
+	assert.Nil(t, err)
+
+	entryNames, err := archive.EntryNames()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bin/logs", "bin/server", "config/game.json"}, entryNames)
+}
+
+// TestDirectoryArchiveInvalidIgnore ensures a broken pattern in .fastbuildignore is reported with its line
+func TestDirectoryArchiveInvalidIgnore(t *testing.T) {
+	dir := writeBuildDir(t, map[string]string{config.BuildIgnoreFileName: "*.pdb\n[logs\n", "bin/server": "server"})
+
+	_, err := NewDirectoryArchive(dir)
+	assert.ErrorContains(t, err, "invalid pattern on line 2 of .fastbuildignore")
+}
+
+// TestDirectoryArchiveWriteTempZip ensures the zip on disk is the same as the one WriteTo writes, and is removed by Cleanup
+func TestDirectoryArchiveWriteTempZip(t *testing.T) {
+	dir := writeBuildDir(t, map[string]string{"bin/server": "server"})
+
+	archive, err := NewDirectoryArchive(dir)
+	assert.Nil(t, err)
+
+	zipFile, err := archive.WriteTempZip()
+	assert.Nil(t, err)
+	assert.Equal(t, "mybuild.zip", zipFile.Name())
+
+	expected, err := archive.SHA256()
+	assert.Nil(t, err)
+	actual, err := zipFile.SHA256()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+
+	entryNames, err := zipFile.EntryNames()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bin/", "bin/server"}, entryNames)
+
+	assert.Nil(t, archive.Cleanup())
+	_, err = os.Stat(string(zipFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// writeTarArchive creates a compressed tar file called name with each of files, the way "tar -C dir ." would, with a ./ in front of each path
+func writeTarArchive(t *testing.T, format ArchiveFormat, name string, files map[string]string) string {
+	var buffer bytes.Buffer
+	var compressed io.WriteCloser
+	if format == ArchiveFormatTarGzip {
+		compressed = gzip.NewWriter(&buffer)
+	} else {
+		zstdWriter, err := zstd.NewWriter(&buffer)
+		assert.Nil(t, err)
+		compressed = zstdWriter
+	}
+
+	names := make([]string, 0, len(files))
+	for fileName := range files {
+		names = append(names, fileName)
+	}
+	sort.Strings(names)
+
+	tarWriter := tar.NewWriter(compressed)
+	assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}))
+	for _, fileName := range names {
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Name: "./" + fileName, Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(files[fileName]))}))
+		_, err := tarWriter.Write([]byte(files[fileName]))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, compressed.Close())
+
+	archivePath := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(archivePath, buffer.Bytes(), 0644))
+	return archivePath
+}
+
+// TestArchiveFileTar ensures the files in tar.gz and tar.zst archives are listed the same way as the files in a zip
+func TestArchiveFileTar(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveFormatTarGzip, ArchiveFormatTarZstd} {
+		archive := ArchiveFile(writeTarArchive(t, format, "mybuild."+string(format), map[string]string{"bin/server": "server", "data/level1.pak": "level1"}))
+
+		actualFormat, err := archive.Format()
+		assert.Nil(t, err)
+		assert.Equal(t, format, actualFormat)
+
+		entryNames, err := archive.EntryNames()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bin/server", "data/level1.pak"}, entryNames)
+	}
+}
+
+// TestDetectArchiveFormat ensures the format comes from the first bytes of the archive, and not from its file extension
+func TestDetectArchiveFormat(t *testing.T) {
+	format, err := ArchiveFile(filepath.Join("testdata", "game-executable.zip")).Format()
+	assert.Nil(t, err)
+	assert.Equal(t, ArchiveFormatZip, format)
+
+	format, err = ArchiveFile(writeTarArchive(t, ArchiveFormatTarZstd, "mybuild.zip", map[string]string{"server": "server"})).Format()
+	assert.Nil(t, err)
+	assert.Equal(t, ArchiveFormatTarZstd, format)
+
+	_, err = DetectArchiveFormat(bytes.NewReader([]byte("not an archive")))
+	assert.ErrorContains(t, err, "build archive is not a zip, tar.gz or tar.zst file")
+
+	_, err = DetectArchiveFormat(bytes.NewReader(nil))
+	assert.ErrorContains(t, err, "build archive is not a zip, tar.gz or tar.zst file")
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"golang.org/x/crypto/ssh"
+)
+
+// hostKeyEnabler enables SSH on a remote instance, and returns the host keys of the instance
+type hostKeyEnabler interface {
+	Enable(ctx context.Context) (HostKeys, error)
+}
+
+// CachedSSHEnabler skips enabling SSH over SSM when a previous run already authorized our key on the instance.
+// Cached host keys are only trusted after connecting the instance's session with them succeeds, otherwise we fall back to the wrapped enabler.
+type CachedSSHEnabler struct {
+	logger   *slog.Logger
+	enabler  hostKeyEnabler
+	cache    *HostKeyCache
+	instance *gamelift.Instance
+	sshKey   ssh.Signer
+	sshPort  int32
+	probe    func(ctx context.Context, hostKeys HostKeys) error
+}
+
+// NewCachedSSHEnabler wraps enabler with a lookup in the host key cache.
+// A successful probe leaves session connected, so the rest of the update can reuse the connection.
+func NewCachedSSHEnabler(logger *slog.Logger, enabler hostKeyEnabler, cache *HostKeyCache, instance *gamelift.Instance, session *InstanceSession) *CachedSSHEnabler {
+	return &CachedSSHEnabler{
+		logger:   logger.With("context", "CachedSSHEnabler"),
+		enabler:  enabler,
+		cache:    cache,
+		instance: instance,
+		sshKey:   session.sshKey,
+		sshPort:  session.sshPort,
+		probe:    session.Connect,
+	}
+}
+
+// Enable returns the cached host keys for the instance if we can still connect with them, otherwise it enables SSH over SSM
+func (c *CachedSSHEnabler) Enable(ctx context.Context) (HostKeys, error) {
+	if hostKeys, ok := c.cache.Get(c.instance, c.sshPort, c.sshKey.PublicKey()); ok {
+		err := c.probe(ctx, hostKeys)
+		if err == nil {
+			c.logger.Debug("connected with cached host keys, skipping SSM")
+			return hostKeys, nil
+		}
+
+		c.logger.Debug("could not connect with cached host keys, enabling SSH over SSM", "err", err)
+	}
+
+	hostKeys, err := c.enabler.Enable(ctx)
+	if err != nil {
+		// Whatever we had cached for this instance is no longer useful
+		if removeErr := c.cache.Remove(c.instance); removeErr != nil {
+			c.logger.Warn("error removing instance from host key cache", "err", removeErr)
+		}
+		return nil, err
+	}
+
+	if err = c.cache.Put(c.instance, c.sshPort, c.sshKey.PublicKey(), hostKeys); err != nil {
+		// Failing to cache only makes the next run slower, so don't fail the update over it
+		c.logger.Warn("error saving host keys to cache", "err", err)
+	}
+
+	return hostKeys, nil
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHostKeyEnabler is a stub for the SSM based SSH enabler
+type testHostKeyEnabler struct {
+	hostKeys HostKeys
+	err      error
+	calls    int
+}
+
+func (t *testHostKeyEnabler) Enable(ctx context.Context) (HostKeys, error) {
+	t.calls = t.calls + 1
+	return t.hostKeys, t.err
+}
+
+func testCachedSSHEnabler(t *testing.T, enabler hostKeyEnabler, probeErr error) (*CachedSSHEnabler, *HostKeyCache) {
+	sshKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	cache := NewHostKeyCache(NewTestLogger(), filepath.Join(t.TempDir(), "host-keys.json"))
+	instance := &gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-1234", IpAddress: "127.0.0.1", OperatingSystem: config.OperatingSystemLinux}
+
+	cachedEnabler := NewCachedSSHEnabler(NewTestLogger(), enabler, cache, instance, NewInstanceSession(NewTestLogger(), instance, sshKey, 22))
+	cachedEnabler.probe = func(ctx context.Context, hostKeys HostKeys) error {
+		return probeErr
+	}
+
+	return cachedEnabler, cache
+}
+
+// TestCachedSSHEnablerMiss ensures that we enable SSH over SSM when nothing is cached, and cache the result
+func TestCachedSSHEnablerMiss(t *testing.T) {
+	hostKeys := HostKeys{testGenerateED25519Key(t)}
+	enabler := &testHostKeyEnabler{hostKeys: hostKeys}
+
+	cachedEnabler, cache := testCachedSSHEnabler(t, enabler, nil)
+
+	result, err := cachedEnabler.Enable(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, hostKeys, result)
+	assert.Equal(t, 1, enabler.calls)
+
+	_, ok := cache.Get(cachedEnabler.instance, 22, cachedEnabler.sshKey.PublicKey())
+	assert.True(t, ok)
+}
+
+// TestCachedSSHEnablerHit ensures that we skip SSM when we can connect with cached host keys
+func TestCachedSSHEnablerHit(t *testing.T) {
+	hostKeys := HostKeys{testGenerateED25519Key(t)}
+	enabler := &testHostKeyEnabler{hostKeys: hostKeys}
+
+	cachedEnabler, cache := testCachedSSHEnabler(t, enabler, nil)
+	assert.Nil(t, cache.Put(cachedEnabler.instance, 22, cachedEnabler.sshKey.PublicKey(), hostKeys))
+
+	result, err := cachedEnabler.Enable(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, hostKeys[0].Marshal(), result[0].Marshal())
+	assert.Equal(t, 0, enabler.calls)
+}
+
+// TestCachedSSHEnablerProbeFailed ensures that we fall back to SSM when we can't connect with cached host keys
+func TestCachedSSHEnablerProbeFailed(t *testing.T) {
+	newHostKeys := HostKeys{testGenerateED25519Key(t)}
+	enabler := &testHostKeyEnabler{hostKeys: newHostKeys}
+
+	cachedEnabler, cache := testCachedSSHEnabler(t, enabler, errors.New("unable to authenticate"))
+	assert.Nil(t, cache.Put(cachedEnabler.instance, 22, cachedEnabler.sshKey.PublicKey(), HostKeys{testGenerateED25519Key(t)}))
+
+	result, err := cachedEnabler.Enable(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, newHostKeys, result)
+	assert.Equal(t, 1, enabler.calls)
+
+	// The cache should now hold the new host keys
+	cached, ok := cache.Get(cachedEnabler.instance, 22, cachedEnabler.sshKey.PublicKey())
+	assert.True(t, ok)
+	assert.Equal(t, newHostKeys[0].Marshal(), cached[0].Marshal())
+}
+
+// TestCachedSSHEnablerEnableFailed ensures that errors from SSM are returned, and the stale cache entry is removed
+func TestCachedSSHEnablerEnableFailed(t *testing.T) {
+	enabler := &testHostKeyEnabler{err: errors.New("ssm failed")}
+
+	cachedEnabler, cache := testCachedSSHEnabler(t, enabler, errors.New("unable to authenticate"))
+	assert.Nil(t, cache.Put(cachedEnabler.instance, 22, cachedEnabler.sshKey.PublicKey(), HostKeys{testGenerateED25519Key(t)}))
+
+	_, err := cachedEnabler.Enable(context.Background())
+	assert.ErrorContains(t, err, "ssm failed")
+
+	_, ok := cache.Get(cachedEnabler.instance, 22, cachedEnabler.sshKey.PublicKey())
+	assert.False(t, ok)
+}
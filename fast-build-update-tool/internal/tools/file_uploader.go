@@ -2,56 +2,44 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net"
-	"os"
-	"os/exec"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func runCommand(cmdName string, args ...string) error {
-	cmd := exec.Command(cmdName, args...)
-	cmd.Stderr = config.NewErrorLogger(cmdName)
-	err := cmd.Run()
-	if err != nil {
-		return err
-	}
-	return nil
-}
+// UploadProgressHandler is called with the number of bytes of a file that were just copied to an instance
+type UploadProgressHandler func(bytes int64)
 
 // FileUploader is used to upload one or more files to a remote instance
 type FileUploader struct {
 	logger                *slog.Logger
-	remoteIpAddress       string
-	privateKeyPath        string
-	remoteUser            config.RemoteUser
+	session               *InstanceSession
 	remoteUploadDirectory config.RemoteUploadDirectory
 	filesToUpload         []string
-	sshPort               int32
-	commandRunner         func(cmdName string, args ...string) error
+	// streamedFiles are copied from their WriteTo, after filesToUpload
+	streamedFiles []StreamedFile
+	// onProgress is optional, it is called as each file is copied
+	onProgress UploadProgressHandler
 }
 
-const (
-	scpCommand = "scp"
-)
-
-// NewFileUploader instantiates a new file uploader for the given GameLift instance
-func NewFileUploader(logger *slog.Logger, instance *gamelift.Instance, privateKeyPath string, filesToUpload []string, sshPort int32) (*FileUploader, error) {
+// NewFileUploader instantiates a new file uploader for the given GameLift instance.
+// Files are uploaded over the instance's shared SSH session, so the key never needs to exist as a plaintext file.
+// streamedFiles is optional, each of them is copied to the instance from its WriteTo.
+func NewFileUploader(logger *slog.Logger, instance *gamelift.Instance, session *InstanceSession, filesToUpload []string, streamedFiles []StreamedFile, onProgress UploadProgressHandler) (*FileUploader, error) {
 	result := &FileUploader{
 		logger:                logger.With("context", "FileUploader"),
-		remoteIpAddress:       instance.IpAddress,
-		privateKeyPath:        privateKeyPath,
-		remoteUser:            config.RemoteUserForOperatingSystem(instance.OperatingSystem),
+		session:               session,
 		remoteUploadDirectory: config.RemoteUploadDirectoryForOperatingSystem(instance.OperatingSystem),
 		filesToUpload:         filesToUpload,
-		sshPort:               sshPort,
-		commandRunner:         runCommand,
+		streamedFiles:         streamedFiles,
+		onProgress:            onProgress,
 	}
 
 	return result, result.Validate()
@@ -59,70 +47,75 @@ func NewFileUploader(logger *slog.Logger, instance *gamelift.Instance, privateKe
 
 // Validate that the FileUploader can copy files to the remote instance
 func (f *FileUploader) Validate() error {
-	return verifyExe(scpCommand)
+	if f.session == nil {
+		return errors.New("an ssh session is required to upload files")
+	}
+	return nil
 }
 
-// CopyFiles opens an connection to the remote instance, and copies files up to it
-func (f *FileUploader) CopyFiles(ctx context.Context, remotePublicKey ssh.PublicKey) error {
-	tempKnownHostsFile, err := f.generateKnownHostsFile(ctx, remotePublicKey)
-	if err != nil {
-		return err
-	}
+// CopyFiles copies files up to the remote instance over its SSH session
+func (f *FileUploader) CopyFiles(ctx context.Context) error {
+	transferred := &transferCounter{onProgress: f.onProgress}
+	defer transferred.record(ctx)
+
+	for _, file := range f.filesToUpload {
+		f.logger.Debug("copying file to remote instance", "file", file)
 
-	defer func() {
-		if err := os.Remove(tempKnownHostsFile); err != nil {
-			f.logger.Error("error removing temporary known hosts file", "file", tempKnownHostsFile, "error", err)
+		session, err := f.session.NewSession()
+		if err != nil {
+			return fmt.Errorf("error starting ssh session: %w", err)
 		}
-	}()
 
-	for _, file := range f.filesToUpload {
-		if err := f.copyFile(ctx, file, tempKnownHostsFile); err != nil {
+		if err := scpUpload(session, file, string(f.remoteUploadDirectory)+filepath.Base(file), transferred.add); err != nil {
 			return fmt.Errorf("error uploading file %s to server %w", file, err)
 		}
 	}
 
-	return nil
-}
+	for _, file := range f.streamedFiles {
+		f.logger.Debug("copying file to remote instance", "file", file.Name())
 
-// generateKnownHostsFile generates a temporary known hosts file with the provided public key, so we can safely SCP files to server
-func (f *FileUploader) generateKnownHostsFile(ctx context.Context, remotePublicKey ssh.PublicKey) (string, error) {
-	khFile, err := os.CreateTemp("", "known_hosts")
-	if err != nil {
-		return "", err
-	}
+		session, err := f.session.NewSession()
+		if err != nil {
+			return fmt.Errorf("error starting ssh session: %w", err)
+		}
 
-	defer func() {
-		if err = khFile.Close(); err != nil {
-			f.logger.Warn("error closing known hosts file", "error", err)
+		if err := scpStream(session, file, string(f.remoteUploadDirectory)+file.Name(), transferred.add); err != nil {
+			return fmt.Errorf("error uploading file %s to server %w", file.Name(), err)
 		}
-	}()
+	}
+
+	return nil
+}
+
+// progressReader calls onProgress with the number of bytes read from reader
+type progressReader struct {
+	reader     io.Reader
+	onProgress UploadProgressHandler
+}
 
-	hostPort := net.JoinHostPort(f.remoteIpAddress, fmt.Sprintf("%d", f.sshPort))
-	line := knownhosts.Line([]string{hostPort}, remotePublicKey)
-	_, err = khFile.Write([]byte(line))
-	if err != nil {
-		return "", err
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.onProgress(int64(n))
 	}
+	return n, err
+}
 
-	return khFile.Name(), err
+// transferCounter counts the bytes copied to an instance, and passes them on to onProgress
+type transferCounter struct {
+	bytes atomic.Int64
+	// onProgress is optional
+	onProgress UploadProgressHandler
 }
 
-// copyFile actually runs the scp command to copy a file ot the server
-func (f *FileUploader) copyFile(ctx context.Context, file, knownHostsFile string) error {
-	f.logger.Debug("copying file to remote instance", "file", file)
-
-	err := f.commandRunner(scpCommand,
-		"-o",
-		"UserKnownHostsFile="+knownHostsFile,
-		"-P",
-		fmt.Sprintf("%d", f.sshPort),
-		"-i",
-		f.privateKeyPath,
-		file,
-		fmt.Sprintf("%s@%s:%s", f.remoteUser, f.remoteIpAddress, string(f.remoteUploadDirectory)+filepath.Base(file)))
-	if err != nil {
-		return fmt.Errorf("error copying file to remote instance: %s %w", f.remoteIpAddress, err)
+func (t *transferCounter) add(bytes int64) {
+	t.bytes.Add(bytes)
+	if t.onProgress != nil {
+		t.onProgress(bytes)
 	}
+}
 
-	return nil
+// record sets the number of bytes copied on the span in ctx
+func (t *transferCounter) record(ctx context.Context) {
+	trace.SpanFromContext(ctx).SetAttributes(config.AttributeBytesTransferred.Int64(t.bytes.Load()))
 }
@@ -2,66 +2,142 @@ package tools
 
 import (
 	"context"
-	"errors"
-	"strconv"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
 	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
-// TestCopyFiles verifies we pass the proper arguments to SCP
+// TestCopyFiles verifies that files are uploaded over SSH to the proper remote directory
 func TestCopyFiles(t *testing.T) {
-	port := 1026
-	keyPath := "my.pem"
-	uploadFile := "myfile.txt"
+	sshKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, sshKey.PublicKey())
+	defer server.Close()
+
+	script := filepath.Join(t.TempDir(), "myscript.sh")
+	assert.Nil(t, os.WriteFile(script, []byte("echo hello"), 0644))
+
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}
+
+	session := NewInstanceSession(NewTestLogger(), instance, sshKey, server.port)
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	defer session.Close()
+
+	uploader, err := NewFileUploader(NewTestLogger(), instance, session, []string{script}, nil, nil)
+	assert.Nil(t, err)
+
+	err = uploader.CopyFiles(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, "gl-user-remote", server.user)
+	assert.Equal(t, map[string]string{"/tmp/myscript.sh": "echo hello"}, server.uploadedFiles())
+}
+
+// TestCopyFilesBytesTransferred verifies that the number of bytes copied is set on the span of the upload
+func TestCopyFilesBytesTransferred(t *testing.T) {
+	sshKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, sshKey.PublicKey())
+	defer server.Close()
+
+	script := filepath.Join(t.TempDir(), "myscript.sh")
+	assert.Nil(t, os.WriteFile(script, []byte("echo hello"), 0644))
+
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}
+
+	session := NewInstanceSession(NewTestLogger(), instance, sshKey, server.port)
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	defer session.Close()
 
-	uploader, err := NewFileUploader(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}, keyPath, []string{uploadFile}, int32(port))
+	var progress int64
+	uploader, err := NewFileUploader(NewTestLogger(), instance, session, []string{script}, nil, func(bytes int64) { progress += bytes })
 	assert.Nil(t, err)
 
-	commandCallCount := 0
-	var calledCommand string
-	var calledArgs []string
+	exporter := tracetest.NewInMemoryExporter()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test").Start(context.Background(), "CopyFiles")
 
-	uploader.commandRunner = func(cmdName string, args ...string) error {
-		commandCallCount = commandCallCount + 1
-		calledCommand = cmdName
-		calledArgs = args
-		return nil
-	}
+	err = uploader.CopyFiles(ctx)
+	assert.Nil(t, err)
+	span.End()
+
+	assert.Equal(t, int64(len("echo hello")), progress)
+	assert.Contains(t, exporter.GetSpans()[0].Attributes, config.AttributeBytesTransferred.Int64(int64(len("echo hello"))))
+}
+
+// TestCopyFilesStreamed verifies that a build directory is zipped as it is uploaded, and comes out the same as its checksum
+func TestCopyFilesStreamed(t *testing.T) {
+	sshKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, sshKey.PublicKey())
+	defer server.Close()
+
+	buildDir := filepath.Join(t.TempDir(), "mybuild")
+	assert.Nil(t, os.MkdirAll(filepath.Join(buildDir, "bin"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(buildDir, "bin", "server"), []byte("#!/bin/sh"), 0755))
+	archive, err := NewDirectoryArchive(buildDir)
+	assert.Nil(t, err)
+	defer archive.Cleanup()
+
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}
 
-	key := testGenerateKey(t)
+	session := NewInstanceSession(NewTestLogger(), instance, sshKey, server.port)
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	defer session.Close()
 
-	err = uploader.CopyFiles(context.Background(), key)
+	var progress int64
+	uploader, err := NewFileUploader(NewTestLogger(), instance, session, nil, []StreamedFile{archive}, func(bytes int64) { progress += bytes })
 	assert.Nil(t, err)
 
-	assert.Equal(t, 1, commandCallCount)
-	assert.Equal(t, "scp", calledCommand)
-	assert.Equal(t, "-o", calledArgs[0])
-	assert.Contains(t, calledArgs[1], "UserKnownHostsFile=")
-	assert.Equal(t, "-P", calledArgs[2])
-	assert.Equal(t, strconv.Itoa(port), calledArgs[3])
-	assert.Equal(t, "-i", calledArgs[4])
-	assert.Equal(t, keyPath, calledArgs[5])
-	assert.Equal(t, uploadFile, calledArgs[6])
-	assert.Equal(t, "gl-user-remote@127.0.0.1:/tmp/myfile.txt", calledArgs[7])
+	err = uploader.CopyFiles(context.Background())
+	assert.Nil(t, err)
+
+	uploaded, found := server.uploadedFiles()["/tmp/mybuild.zip"]
+	assert.True(t, found)
+	checksum := sha256.Sum256([]byte(uploaded))
+	expectedChecksum, err := archive.SHA256()
+	assert.Nil(t, err)
+	assert.Equal(t, expectedChecksum, hex.EncodeToString(checksum[:]))
+	assert.Equal(t, int64(len(uploaded)), progress)
 }
 
 // TestCopyFilesUploadError verifies that we handle any file upload errors properly
 func TestCopyFilesUploadError(t *testing.T) {
-	uploader, err := NewFileUploader(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}, "mykey.pem", []string{"myfile.txt"}, 1026)
+	sshKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
 	assert.Nil(t, err)
 
-	expectedErr := errors.New("test error")
+	server := newTestSSHServer(t, sshKey.PublicKey())
+	server.reject = "disk full"
+	defer server.Close()
+
+	script := filepath.Join(t.TempDir(), "myscript.sh")
+	assert.Nil(t, os.WriteFile(script, []byte("echo hello"), 0644))
 
-	uploader.commandRunner = func(cmdName string, args ...string) error {
-		return expectedErr
-	}
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}
 
-	key := testGenerateKey(t)
+	session := NewInstanceSession(NewTestLogger(), instance, sshKey, server.port)
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	defer session.Close()
+
+	uploader, err := NewFileUploader(NewTestLogger(), instance, session, []string{script}, nil, nil)
+	assert.Nil(t, err)
+
+	err = uploader.CopyFiles(context.Background())
+	assert.ErrorContains(t, err, "disk full")
+}
 
-	err = uploader.CopyFiles(context.Background(), key)
+// TestNewFileUploaderRequiresSession ensures we can't build an uploader without an SSH session
+func TestNewFileUploaderRequiresSession(t *testing.T) {
+	_, err := NewFileUploader(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}, nil, []string{"myfile.txt"}, nil, nil)
 	assert.NotNil(t, err)
-	assert.ErrorContains(t, err, expectedErr.Error())
 }
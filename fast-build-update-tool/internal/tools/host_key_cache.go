@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"golang.org/x/crypto/ssh"
+)
+
+// hostKeyCacheFileName is the name of the file the host key cache is stored in, inside of the user's cache directory
+const hostKeyCacheFileName = "host-keys.json"
+
+// HostKeyCache persists the host keys of instances we've enabled SSH on, along with the client key that was authorized on them.
+// This lets later runs connect to an instance directly, without going through SSM again.
+type HostKeyCache struct {
+	logger  *slog.Logger
+	path    string
+	mutex   sync.Mutex
+	entries map[string]hostKeyCacheEntry
+}
+
+// hostKeyCacheEntry is a single cached instance
+type hostKeyCacheEntry struct {
+	IpAddress            string    `json:"ipAddress"`
+	SSHPort              int32     `json:"sshPort"`
+	ClientKeyFingerprint string    `json:"clientKeyFingerprint"`
+	HostKeys             []string  `json:"hostKeys"`
+	UpdatedAt            time.Time `json:"updatedAt"`
+}
+
+// DefaultHostKeyCachePath returns the path of the host key cache in the user's cache directory
+func DefaultHostKeyCachePath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, config.AppName, hostKeyCacheFileName), nil
+}
+
+// NewHostKeyCache loads the host key cache stored at path. A missing, or unreadable cache is treated as empty.
+func NewHostKeyCache(logger *slog.Logger, path string) *HostKeyCache {
+	cache := &HostKeyCache{
+		logger:  logger.With("context", "HostKeyCache"),
+		path:    path,
+		entries: map[string]hostKeyCacheEntry{},
+	}
+
+	if err := cache.load(); err != nil {
+		cache.logger.Warn("error loading host key cache, starting with an empty cache", "path", path, "err", err)
+	}
+
+	return cache
+}
+
+// Get returns the cached host keys for an instance, if our client key was authorized on it at the same address and port
+func (h *HostKeyCache) Get(instance *gamelift.Instance, sshPort int32, clientKey ssh.PublicKey) (HostKeys, bool) {
+	h.mutex.Lock()
+	entry, ok := h.entries[hostKeyCacheKey(instance)]
+	h.mutex.Unlock()
+
+	if !ok || entry.IpAddress != instance.IpAddress || entry.SSHPort != sshPort || entry.ClientKeyFingerprint != ssh.FingerprintSHA256(clientKey) {
+		return nil, false
+	}
+
+	hostKeys := make(HostKeys, 0, len(entry.HostKeys))
+	for _, hostKey := range entry.HostKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			h.logger.Warn("ignoring invalid host key in cache", "instanceId", instance.InstanceId, "err", err)
+			return nil, false
+		}
+		hostKeys = append(hostKeys, key)
+	}
+
+	return hostKeys, len(hostKeys) > 0
+}
+
+// Put stores the host keys of an instance our client key has been authorized on, and saves the cache
+func (h *HostKeyCache) Put(instance *gamelift.Instance, sshPort int32, clientKey ssh.PublicKey, hostKeys HostKeys) error {
+	entry := hostKeyCacheEntry{
+		IpAddress:            instance.IpAddress,
+		SSHPort:              sshPort,
+		ClientKeyFingerprint: ssh.FingerprintSHA256(clientKey),
+		UpdatedAt:            time.Now().UTC(),
+	}
+
+	for _, hostKey := range hostKeys {
+		entry.HostKeys = append(entry.HostKeys, convertPublicKeyToString(hostKey))
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries[hostKeyCacheKey(instance)] = entry
+
+	return h.save()
+}
+
+// Remove deletes an instance from the cache, and saves the cache
+func (h *HostKeyCache) Remove(instance *gamelift.Instance) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.entries[hostKeyCacheKey(instance)]; !ok {
+		return nil
+	}
+
+	delete(h.entries, hostKeyCacheKey(instance))
+
+	return h.save()
+}
+
+func (h *HostKeyCache) load() error {
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]hostKeyCacheEntry{}
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	if entries != nil {
+		h.entries = entries
+	}
+
+	return nil
+}
+
+// save writes the cache to a temporary file first, so an interrupted run can't leave a partially written cache behind
+func (h *HostKeyCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("error creating host key cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// A unique temporary file in the same directory, so concurrent runs don't write to the same file and the rename stays on one filesystem
+	tempFile, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary host key cache: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+	err = errors.Join(err, tempFile.Close())
+	if err != nil {
+		return fmt.Errorf("error writing host key cache: %w", err)
+	}
+
+	return os.Rename(tempFile.Name(), h.path)
+}
+
+func hostKeyCacheKey(instance *gamelift.Instance) string {
+	return instance.FleetId + "/" + instance.InstanceId
+}
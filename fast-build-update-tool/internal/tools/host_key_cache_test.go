@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHostKeyCachePutGet ensures that host keys are persisted, and can be loaded again by a later run
+func TestHostKeyCachePutGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "host-keys.json")
+	instance := &gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-1234", IpAddress: "127.0.0.1"}
+	clientKey := testGenerateED25519Key(t)
+	hostKeys := HostKeys{testGenerateED25519Key(t), testGenerateKey(t)}
+
+	cache := NewHostKeyCache(NewTestLogger(), path)
+	_, ok := cache.Get(instance, 22, clientKey)
+	assert.False(t, ok)
+
+	assert.Nil(t, cache.Put(instance, 22, clientKey, hostKeys))
+
+	// Load the cache from disk as a new run would
+	cached, ok := NewHostKeyCache(NewTestLogger(), path).Get(instance, 22, clientKey)
+	assert.True(t, ok)
+	assert.Len(t, cached, 2)
+	assert.True(t, cached.contains(hostKeys[0]))
+	assert.True(t, cached.contains(hostKeys[1]))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The temporary file the cache was written to is renamed, so only the cache is left
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestHostKeyCacheMismatch ensures that cached host keys are not used if anything about the connection changed
+func TestHostKeyCacheMismatch(t *testing.T) {
+	instance := &gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-1234", IpAddress: "127.0.0.1"}
+	clientKey := testGenerateED25519Key(t)
+
+	cache := NewHostKeyCache(NewTestLogger(), filepath.Join(t.TempDir(), "host-keys.json"))
+	assert.Nil(t, cache.Put(instance, 22, clientKey, HostKeys{testGenerateED25519Key(t)}))
+
+	_, ok := cache.Get(instance, 1026, clientKey)
+	assert.False(t, ok, "different port")
+
+	_, ok = cache.Get(instance, 22, testGenerateED25519Key(t))
+	assert.False(t, ok, "different client key")
+
+	_, ok = cache.Get(&gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-1234", IpAddress: "127.0.0.2"}, 22, clientKey)
+	assert.False(t, ok, "different ip address")
+
+	_, ok = cache.Get(&gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-5678", IpAddress: "127.0.0.1"}, 22, clientKey)
+	assert.False(t, ok, "different instance")
+}
+
+// TestHostKeyCacheRemove ensures that removed instances are no longer returned from the cache
+func TestHostKeyCacheRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host-keys.json")
+	instance := &gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-1234", IpAddress: "127.0.0.1"}
+	clientKey := testGenerateED25519Key(t)
+
+	cache := NewHostKeyCache(NewTestLogger(), path)
+	assert.Nil(t, cache.Put(instance, 22, clientKey, HostKeys{testGenerateED25519Key(t)}))
+	assert.Nil(t, cache.Remove(instance))
+
+	_, ok := NewHostKeyCache(NewTestLogger(), path).Get(instance, 22, clientKey)
+	assert.False(t, ok)
+}
+
+// TestHostKeyCacheCorrupt ensures that an unreadable cache is treated as empty
+func TestHostKeyCacheCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host-keys.json")
+	assert.Nil(t, os.WriteFile(path, []byte("not json"), 0600))
+
+	instance := &gamelift.Instance{FleetId: "fleet-1234", InstanceId: "i-1234", IpAddress: "127.0.0.1"}
+	clientKey := testGenerateED25519Key(t)
+
+	cache := NewHostKeyCache(NewTestLogger(), path)
+	_, ok := cache.Get(instance, 22, clientKey)
+	assert.False(t, ok)
+
+	assert.Nil(t, cache.Put(instance, 22, clientKey, HostKeys{testGenerateED25519Key(t)}))
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeys holds every public host key a remote instance offers, so we can trust the instance no matter which key type the SSH handshake negotiates
+type HostKeys []ssh.PublicKey
+
+var (
+	hostKeyRegex = regexp.MustCompile(`(ssh-ed25519|ecdsa-sha2-nistp256|ecdsa-sha2-nistp384|ecdsa-sha2-nistp521|ssh-rsa) ([A-Za-z0-9+/=]+)`)
+)
+
+const (
+	// hostKeysEndMarker is written by the remote instance once every host key has been printed.
+	// The enable commands build it out of two halves, so the echoed command itself does not contain the marker.
+	hostKeysEndMarker      = hostKeysEndMarkerStart + hostKeysEndMarkerEnd
+	hostKeysEndMarkerStart = "FBUT_HOST"
+	hostKeysEndMarkerEnd   = "KEYS_END"
+)
+
+// FindPublicHostKeys will return every authorized key formatted public key found in the output of a remote session
+func FindPublicHostKeys(s string) []string {
+	return hostKeyRegex.FindAllString(s, -1)
+}
+
+// ParseHostKeys will parse every public host key found in output, skipping any that are contained in ignore (eg. our own public key echoed back by the terminal)
+func ParseHostKeys(output string, ignore string) (HostKeys, error) {
+	var result HostKeys
+
+	for _, match := range FindPublicHostKeys(output) {
+		if strings.Contains(ignore, match) {
+			continue
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(match))
+		if err != nil {
+			// A key that was cut off, or mangled by the terminal can't be used, but any other keys still can
+			continue
+		}
+
+		if !result.contains(key) {
+			result = append(result, key)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("remote public key was not found in the output of the SSM session")
+	}
+
+	return result, nil
+}
+
+// Callback returns an ssh.HostKeyCallback that accepts any of the host keys
+func (h HostKeys) Callback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if h.contains(key) {
+			return nil
+		}
+		return errors.New("ssh: host key mismatch")
+	}
+}
+
+// Algorithms returns the host key algorithms that can be used to verify the host keys, in order of preference
+func (h HostKeys) Algorithms() []string {
+	var result []string
+
+	for _, key := range h {
+		algorithms := []string{key.Type()}
+
+		// RSA keys can sign with SHA-2, which newer servers require. Prefer those over the legacy SHA-1 algorithm.
+		if key.Type() == ssh.KeyAlgoRSA {
+			algorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+
+		for _, algorithm := range algorithms {
+			if !slices.Contains(result, algorithm) {
+				result = append(result, algorithm)
+			}
+		}
+	}
+
+	return result
+}
+
+func (h HostKeys) contains(key ssh.PublicKey) bool {
+	for _, hostKey := range h {
+		if bytes.Equal(hostKey.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func testGenerateECDSAKey(t *testing.T) ssh.PublicKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	key, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	assert.Nil(t, err)
+
+	return key
+}
+
+// TestFindPublicHostKeys ensures that we find every supported key type in the remote output
+func TestFindPublicHostKeys(t *testing.T) {
+	ed25519Key := "ssh-ed25519 ABCDE0FghI1jKLM1NOP5RSTUVW04XYzA0BCDefghIJKlMNOPQRSTuVWXYzabCdEf11GhI"
+	ecdsaKey := "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTY="
+	rsaKey := "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABgQ=="
+
+	// Make sure we can filter out additional garbage
+	output := ecdsaKey + " root@host\r\n" + rsaKey + "\r\n" + ed25519Key + "\x1b[?25l"
+
+	assert.Equal(t, []string{ecdsaKey, rsaKey, ed25519Key}, FindPublicHostKeys(output))
+}
+
+// TestParseHostKeys ensures that every valid host key is parsed, ignoring our own key and any duplicates
+func TestParseHostKeys(t *testing.T) {
+	ed25519Key := testGenerateED25519Key(t)
+	ecdsaKey := testGenerateECDSAKey(t)
+	rsaKey := testGenerateKey(t)
+	clientKey := convertPublicKeyToString(testGenerateED25519Key(t))
+
+	output := "echo \"" + clientKey + "\" | sudo tee -a authorized_keys\r\n" +
+		clientKey + "\r\n" +
+		convertPublicKeyToString(ecdsaKey) + "\r\n" +
+		convertPublicKeyToString(ed25519Key) + "\r\n" +
+		convertPublicKeyToString(rsaKey) + "\r\n" +
+		convertPublicKeyToString(ed25519Key) + "\r\n" +
+		// A key that was cut off should be skipped
+		"ssh-rsa AAAAB3Nza\r\n"
+
+	hostKeys, err := ParseHostKeys(output, clientKey)
+
+	assert.Nil(t, err)
+	assert.Equal(t, HostKeys{ecdsaKey, ed25519Key, rsaKey}, hostKeys)
+}
+
+// TestParseHostKeysNotFound ensures that we return an error when the remote instance did not list any host keys
+func TestParseHostKeysNotFound(t *testing.T) {
+	clientKey := convertPublicKeyToString(testGenerateED25519Key(t))
+
+	_, err := ParseHostKeys("sh-5.2$ "+clientKey, clientKey)
+
+	assert.ErrorContains(t, err, "remote public key was not found")
+}
+
+// TestHostKeysCallback ensures that any of the host keys are trusted, and no others
+func TestHostKeysCallback(t *testing.T) {
+	ed25519Key := testGenerateED25519Key(t)
+	rsaKey := testGenerateKey(t)
+
+	callback := HostKeys{ed25519Key, rsaKey}.Callback()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	assert.Nil(t, callback("127.0.0.1:22", addr, ed25519Key))
+	assert.Nil(t, callback("127.0.0.1:22", addr, rsaKey))
+	assert.NotNil(t, callback("127.0.0.1:22", addr, testGenerateECDSAKey(t)))
+}
+
+// TestHostKeysAlgorithms ensures that we offer algorithms for every host key, preferring SHA-2 signatures for RSA keys
+func TestHostKeysAlgorithms(t *testing.T) {
+	hostKeys := HostKeys{testGenerateED25519Key(t), testGenerateKey(t), testGenerateECDSAKey(t), testGenerateED25519Key(t)}
+
+	assert.Equal(t, []string{
+		ssh.KeyAlgoED25519,
+		ssh.KeyAlgoRSASHA512,
+		ssh.KeyAlgoRSASHA256,
+		ssh.KeyAlgoRSA,
+		ssh.KeyAlgoECDSA256,
+	}, hostKeys.Algorithms())
+}
@@ -0,0 +1,200 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// keepAliveInterval is how often we check that the SSH connection to an instance is still alive
+	keepAliveInterval = 15 * time.Second
+	// keepAliveTimeout is how long we wait for a reply to a keepalive before treating the connection as dropped
+	keepAliveTimeout = 10 * time.Second
+	// keepAliveRequest is the global request OpenSSH uses for keepalives, servers reply to it even if they don't support it
+	keepAliveRequest = "keepalive@openssh.com"
+)
+
+var (
+	// ErrSessionNotConnected is returned when the InstanceSession is used before Connect has been called
+	ErrSessionNotConnected = errors.New("ssh session to the instance has not been connected")
+)
+
+// InstanceSession holds a single authenticated SSH connection to an instance, which is shared by every step of an update.
+// The connection is kept alive in the background, and is reconnected the next time it is used if it was dropped.
+type InstanceSession struct {
+	logger            *slog.Logger
+	ipAddress         string
+	sshPort           int32
+	userName          string
+	sshKey            ssh.Signer
+	keepAliveInterval time.Duration
+	dial              func(ipAddress string, sshPort int32, userName string, sshKey ssh.Signer, hostKeys HostKeys) (*ssh.Client, error)
+
+	mutex         sync.Mutex
+	hostKeys      HostKeys
+	client        *ssh.Client
+	stopKeepAlive chan struct{}
+}
+
+// NewInstanceSession builds a new InstanceSession for the instance. No connection is made until Connect is called.
+func NewInstanceSession(logger *slog.Logger, instance *gamelift.Instance, sshKey ssh.Signer, sshPort int32) *InstanceSession {
+	return &InstanceSession{
+		logger:            logger.With("context", "InstanceSession"),
+		ipAddress:         instance.IpAddress,
+		sshPort:           sshPort,
+		userName:          string(config.RemoteUserForOperatingSystem(instance.OperatingSystem)),
+		sshKey:            sshKey,
+		keepAliveInterval: keepAliveInterval,
+		dial:              dialSSH,
+	}
+}
+
+// Connect opens the SSH connection to the instance, only trusting the provided host keys.
+// If the session is already connected it is left as is.
+func (s *InstanceSession) Connect(ctx context.Context, hostKeys HostKeys) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client != nil {
+		return nil
+	}
+
+	s.hostKeys = hostKeys
+
+	return s.connect()
+}
+
+// NewSession opens a new session on the shared connection, reconnecting once if the connection was dropped
+func (s *InstanceSession) NewSession() (*ssh.Session, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	s.logger.Debug("error opening ssh session, reconnecting", "err", err)
+	s.disconnect(client)
+
+	client, err = s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewSession()
+}
+
+// Close closes the connection to the instance, the session can not be used again after it is closed
+func (s *InstanceSession) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.hostKeys = nil
+
+	if s.client == nil {
+		return nil
+	}
+
+	close(s.stopKeepAlive)
+	err := s.client.Close()
+	s.client = nil
+
+	return err
+}
+
+// getClient returns the current connection, reconnecting if it was dropped
+func (s *InstanceSession) getClient() (*ssh.Client, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	if s.hostKeys == nil {
+		return nil, ErrSessionNotConnected
+	}
+
+	s.logger.Debug("reconnecting to instance")
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s.client, nil
+}
+
+// connect dials the instance, and starts sending keepalives. The mutex must be held by the caller.
+func (s *InstanceSession) connect() error {
+	client, err := s.dial(s.ipAddress, s.sshPort, s.userName, s.sshKey, s.hostKeys)
+	if err != nil {
+		return err
+	}
+
+	s.client = client
+	s.stopKeepAlive = make(chan struct{})
+
+	go s.keepAlive(client, s.stopKeepAlive)
+
+	return nil
+}
+
+// disconnect closes client if it is still the current connection, so the next use of the session reconnects
+func (s *InstanceSession) disconnect(client *ssh.Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client != client {
+		return
+	}
+
+	close(s.stopKeepAlive)
+	client.Close()
+	s.client = nil
+}
+
+// keepAlive periodically pings the instance until stopped, and drops the connection if the instance stops responding
+func (s *InstanceSession) keepAlive(client *ssh.Client, stop chan struct{}) {
+	ticker := time.NewTicker(s.keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := ping(client); err != nil {
+				s.logger.Debug("ssh keepalive failed, dropping connection", "err", err)
+				s.disconnect(client)
+				return
+			}
+		}
+	}
+}
+
+// ping sends a keepalive request over client, and waits for the reply
+func ping(client *ssh.Client) error {
+	result := make(chan error, 1)
+
+	go func() {
+		_, _, err := client.SendRequest(keepAliveRequest, true, nil)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(keepAliveTimeout):
+		return errors.New("timed out waiting for keepalive reply")
+	}
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// testInstanceSession builds an InstanceSession for a test SSH server, and counts how many times it dials the server
+func testInstanceSession(t *testing.T) (*InstanceSession, *testSSHServer, *int) {
+	sshKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, sshKey.PublicKey())
+	t.Cleanup(server.Close)
+
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux, IpAddress: "127.0.0.1"}
+	session := NewInstanceSession(NewTestLogger(), instance, sshKey, server.port)
+	t.Cleanup(func() { session.Close() })
+
+	dials := 0
+	session.dial = func(ipAddress string, sshPort int32, userName string, sshKey ssh.Signer, hostKeys HostKeys) (*ssh.Client, error) {
+		dials = dials + 1
+		return dialSSH(ipAddress, sshPort, userName, sshKey, hostKeys)
+	}
+
+	return session, server, &dials
+}
+
+// TestInstanceSessionConnect ensures that a connected session can be used, and that connecting again reuses the connection
+func TestInstanceSessionConnect(t *testing.T) {
+	session, server, dials := testInstanceSession(t)
+
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	assert.Equal(t, 1, *dials)
+	assert.Equal(t, "gl-user-remote", server.user)
+
+	sshSession, err := session.NewSession()
+	assert.Nil(t, err)
+	sshSession.Close()
+
+	assert.Equal(t, 1, *dials)
+}
+
+// TestInstanceSessionUnknownHostKey ensures that we refuse to connect when the host key doesn't match
+func TestInstanceSessionUnknownHostKey(t *testing.T) {
+	session, _, _ := testInstanceSession(t)
+
+	assert.NotNil(t, session.Connect(context.Background(), HostKeys{testGenerateED25519Key(t)}))
+}
+
+// TestInstanceSessionNotConnected ensures that the session can't be used before it is connected, or after it is closed
+func TestInstanceSessionNotConnected(t *testing.T) {
+	session, server, _ := testInstanceSession(t)
+
+	_, err := session.NewSession()
+	assert.ErrorIs(t, err, ErrSessionNotConnected)
+
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+	assert.Nil(t, session.Close())
+
+	_, err = session.NewSession()
+	assert.ErrorIs(t, err, ErrSessionNotConnected)
+}
+
+// TestInstanceSessionReconnect ensures that a dropped connection is reconnected the next time the session is used
+func TestInstanceSessionReconnect(t *testing.T) {
+	session, server, dials := testInstanceSession(t)
+
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+
+	// Drop the connection out from under the session
+	session.client.Close()
+
+	sshSession, err := session.NewSession()
+	assert.Nil(t, err)
+	sshSession.Close()
+
+	assert.Equal(t, 2, *dials)
+}
+
+// TestInstanceSessionKeepAlive ensures that the keepalive drops a dead connection, so it is reconnected on next use
+func TestInstanceSessionKeepAlive(t *testing.T) {
+	session, server, _ := testInstanceSession(t)
+	session.keepAliveInterval = 10 * time.Millisecond
+
+	assert.Nil(t, session.Connect(context.Background(), HostKeys{server.hostKey.PublicKey()}))
+
+	session.mutex.Lock()
+	client := session.client
+	session.mutex.Unlock()
+	client.Close()
+
+	assert.Eventually(t, func() bool {
+		session.mutex.Lock()
+		defer session.mutex.Unlock()
+		return session.client == nil
+	}, time.Second, 10*time.Millisecond)
+
+	sshSession, err := session.NewSession()
+	assert.Nil(t, err)
+	sshSession.Close()
+}
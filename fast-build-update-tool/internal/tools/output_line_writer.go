@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"strings"
+	"sync"
+)
+
+// OutputLineHandler is called with each line of output from the update script on an instance. isError is true for lines written to stderr.
+type OutputLineHandler func(line string, isError bool)
+
+// maxOutputLineLength is the longest line held back while waiting for its end, longer lines are split
+const maxOutputLineLength = 4096
+
+// outputLineWriter is an io.Writer that calls its handler with each complete line written to it
+type outputLineWriter struct {
+	mutex       sync.Mutex
+	partialLine string
+	isError     bool
+	handler     OutputLineHandler
+}
+
+func newOutputLineWriter(handler OutputLineHandler, isError bool) *outputLineWriter {
+	return &outputLineWriter{handler: handler, isError: isError}
+}
+
+func (w *outputLineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	lines := strings.Split(w.partialLine+string(p), "\n")
+	// The last line isn't complete yet, keep it until the rest of it is written
+	w.partialLine = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		w.handler(strings.TrimRight(line, "\r"), w.isError)
+	}
+
+	if len(w.partialLine) > maxOutputLineLength {
+		w.handler(w.partialLine, w.isError)
+		w.partialLine = ""
+	}
+
+	return len(p), nil
+}
+
+// Flush passes on the last line, if it was never ended
+func (w *outputLineWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.partialLine != "" {
+		w.handler(strings.TrimRight(w.partialLine, "\r"), w.isError)
+		w.partialLine = ""
+	}
+}
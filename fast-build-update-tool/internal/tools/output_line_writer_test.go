@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOutputLineWriter ensures that lines split across writes are joined, and the last line is passed on when flushed
+func TestOutputLineWriter(t *testing.T) {
+	var lines []string
+	writer := newOutputLineWriter(func(line string, isError bool) {
+		assert.True(t, isError)
+		lines = append(lines, line)
+	}, true)
+
+	writer.Write([]byte("unzipping the ar"))
+	assert.Empty(t, lines)
+
+	writer.Write([]byte("chive\r\nkilling running processes\nstarting"))
+	assert.Equal(t, []string{"unzipping the archive", "killing running processes"}, lines)
+
+	writer.Flush()
+	assert.Equal(t, []string{"unzipping the archive", "killing running processes", "starting"}, lines)
+}
+
+// TestOutputLineWriterLongLine ensures that a line that never ends is not held back forever
+func TestOutputLineWriterLongLine(t *testing.T) {
+	var lines []string
+	writer := newOutputLineWriter(func(line string, isError bool) { lines = append(lines, line) }, false)
+
+	writer.Write([]byte(strings.Repeat("a", maxOutputLineLength+1)))
+	assert.Len(t, lines, 1)
+
+	writer.Flush()
+	assert.Len(t, lines, 1)
+}
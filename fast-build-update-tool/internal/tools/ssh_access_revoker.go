@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHAccessRevoker is used to remove the SSH access granted by SSHEnabler from a remote instance.
+// Access is revoked over AWS SSM, so it does not depend on SSH still working on the instance.
+type SSHAccessRevoker struct {
+	logger               *slog.Logger
+	instance             *gamelift.Instance
+	instanceAccessGetter GameLiftInstanceAccessGetter
+	protocol             commandProtocol
+	commandsToRun        []sessionStep
+	pty                  PTY
+}
+
+// NewSSHAccessRevoker builds a new SSHAccessRevoker that will remove localPublicKey from the target instance.
+// If stopSSHServer is true, the SSH server started by SSHEnabler will be stopped (on Windows the firewall rule it created is also removed).
+func NewSSHAccessRevoker(logger *slog.Logger, instance *gamelift.Instance, instanceAccessGetter GameLiftInstanceAccessGetter, localPublicKey ssh.PublicKey, stopSSHServer bool) (*SSHAccessRevoker, error) {
+	localPublicKeyStr := convertPublicKeyToString(localPublicKey)
+
+	var revokeCommands []sessionStep
+	var protocol commandProtocol
+
+	switch instance.OperatingSystem {
+
+	case config.OperatingSystemWindows:
+		revokeCommands = windowsRevokeSSHCommands(localPublicKeyStr, stopSSHServer)
+		protocol = windowsCommandProtocol
+
+	case config.OperatingSystemLinux:
+		revokeCommands = linuxRevokeSSHCommands(localPublicKeyStr, stopSSHServer)
+		protocol = linuxCommandProtocol
+
+	default:
+		return nil, config.UnknownOperatingSystemError(fmt.Sprint(instance.OperatingSystem))
+	}
+
+	pty, err := newPtyCommandRunner()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSHAccessRevoker{
+		logger:               logger.With("context", "SSHAccessRevoker"),
+		instance:             instance,
+		instanceAccessGetter: instanceAccessGetter,
+		protocol:             protocol,
+		commandsToRun:        revokeCommands,
+		pty:                  pty,
+	}, nil
+}
+
+// RevokeAccess will remove the local public key from the authorized keys on the remote instance
+func (s *SSHAccessRevoker) RevokeAccess(ctx context.Context) error {
+	logFilePath := config.GetLogPathForFile(fmt.Sprintf("%s-ssm-revoke.log", s.instance.InstanceId))
+	// Set up a log file so we log out the output of every step run on the instance
+	logFile, err := config.OpenLogFile(logFilePath)
+	if err != nil {
+		return fmt.Errorf("error creating log file for ssh access revoker: %w", err)
+	}
+	defer logFile.Close()
+
+	session := &ssmCommandSession{
+		logger:               s.logger,
+		instance:             s.instance,
+		instanceAccessGetter: s.instanceAccessGetter,
+		protocol:             s.protocol,
+		pty:                  s.pty,
+		log:                  logFile,
+		logFilePath:          logFilePath,
+	}
+
+	err = session.Run(ctx, s.commandsToRun, nil)
+	if err != nil {
+		return fmt.Errorf("error revoking ssh access on remote instance %w", err)
+	}
+
+	return nil
+}
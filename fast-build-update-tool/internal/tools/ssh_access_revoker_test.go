@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSSHAccessRevokerLinux(t *testing.T) {
+	key := testGenerateKey(t)
+	keyData := publicKeyData(convertPublicKeyToString(key))
+
+	revoker, err := NewSSHAccessRevoker(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}, &GameLiftInstanceAccessGetterMock{}, key, false)
+	assert.Nil(t, err)
+
+	commands := testJoinSteps(revoker.commandsToRun)
+	assert.Contains(t, commands, `grep -vxF "`+markedAuthorizedKey(convertPublicKeyToString(key))+`" /home/gl-user-remote/.ssh/authorized_keys`)
+	assert.NotContains(t, commands, `grep -vF "`+keyData+`"`)
+	assert.NotContains(t, commands, "net stop sshd")
+	assert.NotContains(t, commands, "systemctl stop")
+}
+
+func TestNewSSHAccessRevokerLinuxStopSSHServer(t *testing.T) {
+	revoker, err := NewSSHAccessRevoker(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), true)
+	assert.Nil(t, err)
+
+	commands := testJoinSteps(revoker.commandsToRun)
+	assert.Contains(t, commands, "sudo systemctl stop 'fast-build-update-tool-sshd-*'")
+}
+
+func TestNewSSHAccessRevokerWindows(t *testing.T) {
+	key := testGenerateKey(t)
+	keyData := publicKeyData(convertPublicKeyToString(key))
+
+	revoker, err := NewSSHAccessRevoker(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows}, &GameLiftInstanceAccessGetterMock{}, key, false)
+	assert.Nil(t, err)
+
+	commands := testJoinSteps(revoker.commandsToRun)
+	assert.Contains(t, commands, `$authorizedKey="`+markedAuthorizedKey(convertPublicKeyToString(key))+`"`)
+	assert.Contains(t, commands, "Where-Object { $_.Trim() -ne $authorizedKey }")
+	assert.NotContains(t, commands, keyData+`"`)
+	assert.NotContains(t, commands, "net stop sshd")
+	assert.NotContains(t, commands, "Remove-NetFirewallRule")
+}
+
+func TestNewSSHAccessRevokerWindowsStopSSHServer(t *testing.T) {
+	revoker, err := NewSSHAccessRevoker(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows}, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), true)
+	assert.Nil(t, err)
+
+	commands := testJoinSteps(revoker.commandsToRun)
+	assert.Contains(t, commands, "net stop sshd")
+	assert.Contains(t, commands, `$firewallRuleName="fast-build-update-tool-sshd"`)
+	assert.Contains(t, commands, "Remove-NetFirewallRule -Name $firewallRuleName")
+}
+
+// TestRevokeAccessKeepsExistingKey runs the Linux commands against a local authorized_keys, to ensure a key that was already authorized
+// is kept when access is revoked, while a key added by this application is removed again
+func TestRevokeAccessKeepsExistingKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the Linux commands are run in sh")
+	}
+
+	key := convertPublicKeyToString(testGenerateKey(t))
+	otherKey := convertPublicKeyToString(testGenerateED25519Key(t))
+	authorizedKeysPath := filepath.Join(t.TempDir(), "authorized_keys")
+	enableCommands := linuxSSHEnableCommands(key, config.DefaultPortLinux)
+	revokeCommands := linuxRevokeSSHCommands(key, false)
+
+	// The key was authorized before the tool ran, so it is neither added again nor removed
+	existing := otherKey + "\n" + key + " me@laptop\n"
+	assert.Nil(t, os.WriteFile(authorizedKeysPath, []byte(existing), 0600))
+	testRunLinuxCommands(t, authorizedKeysPath, enableCommands)
+	testRunLinuxCommands(t, authorizedKeysPath, revokeCommands)
+	contents, err := os.ReadFile(authorizedKeysPath)
+	assert.Nil(t, err)
+	assert.Equal(t, existing, string(contents))
+
+	// The key was added by the tool, so it is removed again
+	assert.Nil(t, os.WriteFile(authorizedKeysPath, []byte(otherKey+"\n"), 0600))
+	testRunLinuxCommands(t, authorizedKeysPath, enableCommands)
+	contents, err = os.ReadFile(authorizedKeysPath)
+	assert.Nil(t, err)
+	assert.Equal(t, otherKey+"\n"+markedAuthorizedKey(key)+"\n", string(contents))
+	testRunLinuxCommands(t, authorizedKeysPath, revokeCommands)
+	contents, err = os.ReadFile(authorizedKeysPath)
+	assert.Nil(t, err)
+	assert.Equal(t, otherKey+"\n", string(contents))
+}
+
+// testRunLinuxCommands runs the authorized_keys steps in sh against authorizedKeysPath, without sudo. Any other step is skipped.
+func testRunLinuxCommands(t *testing.T, authorizedKeysPath string, steps []sessionStep) {
+	for _, step := range steps {
+		if !strings.Contains(step.command, linuxAuthorizedKeysPath) {
+			continue
+		}
+		command := strings.ReplaceAll(step.command, linuxAuthorizedKeysPath, authorizedKeysPath)
+		command = strings.ReplaceAll(command, "sudo ", "")
+		output, err := exec.Command("sh", "-c", command).CombinedOutput()
+		assert.Nil(t, err, "%s: %s", step.name, output)
+	}
+}
+
+func TestNewSSHAccessRevokerUnknownOS(t *testing.T) {
+	_, err := NewSSHAccessRevoker(NewTestLogger(), &gamelift.Instance{}, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), false)
+	assert.ErrorContains(t, err, "unknown operating system")
+}
+
+func TestRevokeAccess(t *testing.T) {
+	testUseLogsDir(t)
+	instanceAccessGetter := &GameLiftInstanceAccessGetterMock{
+		GetInstanceAccessFunc: func(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error) {
+			return &gamelift.InstanceAccessCredentials{}, nil
+		},
+	}
+
+	mockedSSMCommandRunner := testShellPTY(linuxCommandProtocol, func(command string) (string, int) {
+		return "", 0
+	})
+
+	revoker := &SSHAccessRevoker{
+		logger:               NewTestLogger(),
+		instance:             &gamelift.Instance{FleetId: "f-1234", InstanceId: "i-1234"},
+		instanceAccessGetter: instanceAccessGetter,
+		protocol:             linuxCommandProtocol,
+		pty:                  mockedSSMCommandRunner,
+		commandsToRun:        []sessionStep{{name: "list files", command: "ls -lah;\n"}},
+	}
+
+	err := revoker.RevokeAccess(context.Background())
+	assert.Nil(t, err)
+
+	assert.Len(t, instanceAccessGetter.GetInstanceAccessCalls(), 1)
+	assert.Len(t, mockedSSMCommandRunner.StartCalls(), 1)
+	assert.Equal(t, []string{"ssm", "start-session", "--target", "i-1234"}, mockedSSMCommandRunner.StartCalls()[0].Args)
+	assert.Len(t, mockedSSMCommandRunner.CleanupCalls(), 1)
+}
+
+func TestPublicKeyData(t *testing.T) {
+	assert.Equal(t, "AAAAC3NzaC1", publicKeyData("ssh-ed25519 AAAAC3NzaC1 comment"))
+	assert.Equal(t, "AAAAC3NzaC1", publicKeyData("ssh-ed25519 AAAAC3NzaC1"))
+	assert.Equal(t, "AAAAC3NzaC1", publicKeyData("AAAAC3NzaC1"))
+}
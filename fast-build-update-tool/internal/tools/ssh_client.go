@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshDialTimeout is how long to wait for an SSH connection to be established with a remote instance
+const sshDialTimeout = 15 * time.Second
+
+// dialSSH will open an authenticated SSH connection to the remote instance, only trusting the provided host keys
+func dialSSH(ipAddress string, sshPort int32, userName string, sshKey ssh.Signer, hostKeys HostKeys) (*ssh.Client, error) {
+	client, err := ssh.Dial("tcp", net.JoinHostPort(ipAddress, fmt.Sprintf("%d", sshPort)), &ssh.ClientConfig{
+		User:              userName,
+		HostKeyCallback:   hostKeys.Callback(),
+		HostKeyAlgorithms: hostKeys.Algorithms(),
+		Timeout:           sshDialTimeout,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(sshKey),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error dialing ssh connection: %w", err)
+	}
+
+	return client, nil
+}
+
+// scpUpload will copy a local file to remotePath on the remote instance, using the provided SSH session.
+// This speaks the sink side of the scp protocol directly over the SSH connection, so no local scp executable or key file is needed.
+func scpUpload(session *ssh.Session, localPath, remotePath string, onProgress UploadProgressHandler) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		session.Close()
+		return fmt.Errorf("error opening file for upload: %w", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		session.Close()
+		return fmt.Errorf("error reading file info for upload: %w", err)
+	}
+
+	return scpCopy(session, file, fileInfo.Size(), filepath.Base(localPath), remotePath, onProgress)
+}
+
+// scpStream will copy a StreamedFile to remotePath on the remote instance, piping what its WriteTo writes into the provided SSH session.
+// scp needs the size of the file up front, so the upload fails if WriteTo does not write that many bytes.
+func scpStream(session *ssh.Session, file StreamedFile, remotePath string, onProgress UploadProgressHandler) error {
+	size, err := file.Size()
+	if err != nil {
+		session.Close()
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		written, err := file.WriteTo(writer)
+		if err == nil && written != size {
+			err = fmt.Errorf("%s was %d bytes instead of %d, its contents changed while it was copied", file.Name(), written, size)
+		}
+		writer.CloseWithError(err)
+	}()
+	defer reader.Close()
+
+	return scpCopy(session, io.LimitReader(reader, size), size, file.Name(), remotePath, onProgress)
+}
+
+// scpCopy sends size bytes of contents to remotePath on the remote instance, as a file called name
+func scpCopy(session *ssh.Session, contents io.Reader, size int64, name string, remotePath string, onProgress UploadProgressHandler) error {
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdoutPipe, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stdout := bufio.NewReader(stdoutPipe)
+
+	err = session.Start(fmt.Sprintf("scp -t \"%s\"", remotePath))
+	if err != nil {
+		return fmt.Errorf("error starting remote scp: %w", err)
+	}
+
+	// The remote side acknowledges that it is ready, then acknowledges the file header, and then the file contents
+	if err = readSCPAck(stdout); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdin, "C0644 %d %s\n", size, name)
+	if err != nil {
+		return err
+	}
+
+	if err = readSCPAck(stdout); err != nil {
+		return err
+	}
+
+	if onProgress != nil {
+		contents = &progressReader{reader: contents, onProgress: onProgress}
+	}
+
+	_, err = io.Copy(stdin, contents)
+	if err != nil {
+		return fmt.Errorf("error writing file contents: %w", err)
+	}
+
+	_, err = stdin.Write([]byte{0})
+	if err != nil {
+		return err
+	}
+
+	if err = readSCPAck(stdout); err != nil {
+		return err
+	}
+
+	// Closing stdin lets the remote scp process know we're done sending files
+	if err = stdin.Close(); err != nil {
+		return err
+	}
+
+	return session.Wait()
+}
+
+// readSCPAck reads a single scp protocol acknowledgement, and returns an error if the remote side reported one
+func readSCPAck(reader *bufio.Reader) error {
+	code, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("error reading scp response: %w", err)
+	}
+
+	if code == 0 {
+		return nil
+	}
+
+	// Warnings (1) and errors (2) are followed by a message line
+	message, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading scp error message: %w", err)
+	}
+
+	return fmt.Errorf("remote scp error: %s", message)
+}
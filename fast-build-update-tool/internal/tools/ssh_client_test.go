@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer is a minimal SSH server that accepts uploads using the sink side of the scp protocol
+type testSSHServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	port     int32
+	user     string
+	reject   string
+
+	mutex sync.Mutex
+	files map[string]string
+}
+
+func newTestSSHServer(t *testing.T, authorizedKey ssh.PublicKey) *testSSHServer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	assert.Nil(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := &testSSHServer{
+		listener: listener,
+		hostKey:  hostKey,
+		port:     int32(listener.Addr().(*net.TCPAddr).Port),
+		files:    map[string]string{},
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorizedKey.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			server.user = conn.User()
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	go server.serve(serverConfig)
+
+	return server
+}
+
+func (s *testSSHServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testSSHServer) uploadedFiles() map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.files
+}
+
+func (s *testSSHServer) serve(serverConfig *ssh.ServerConfig) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(requests)
+
+			for newChannel := range channels {
+				channel, channelRequests, err := newChannel.Accept()
+				if err != nil {
+					return
+				}
+				go s.handleSession(channel, channelRequests)
+			}
+		}()
+	}
+}
+
+func (s *testSSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			request.Reply(false, nil)
+			continue
+		}
+		request.Reply(true, nil)
+
+		// The payload is the length prefixed command string, eg. `scp -t "/tmp/file.zip"`
+		command := string(request.Payload[4:])
+		remotePath := strings.Trim(strings.TrimPrefix(command, "scp -t "), "\"")
+
+		status := s.receiveFile(channel, remotePath)
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func (s *testSSHServer) receiveFile(channel ssh.Channel, remotePath string) uint32 {
+	reader := bufio.NewReader(channel)
+	channel.Write([]byte{0})
+
+	var mode, name string
+	var size int
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return 1
+	}
+	fmt.Sscanf(header, "C%s %d %s", &mode, &size, &name)
+
+	if s.reject != "" {
+		channel.Write([]byte("\x02" + s.reject + "\n"))
+		return 1
+	}
+	channel.Write([]byte{0})
+
+	contents := make([]byte, size+1)
+	if _, err := io.ReadFull(reader, contents); err != nil {
+		return 1
+	}
+	channel.Write([]byte{0})
+
+	s.mutex.Lock()
+	s.files[remotePath] = string(contents[:size])
+	s.mutex.Unlock()
+
+	// Like scp, wait for the client to let us know it has no more files to send
+	io.Copy(io.Discard, reader)
+
+	return 0
+}
+
+// TestSCPUpload ensures that we can upload a file to a remote instance using the scp protocol, and every byte sent is reported
+func TestSCPUpload(t *testing.T) {
+	clientKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, clientKey.PublicKey())
+	defer server.Close()
+
+	localFile := filepath.Join(t.TempDir(), "build.zip")
+	assert.Nil(t, os.WriteFile(localFile, []byte("zip contents"), 0644))
+
+	client, err := dialSSH("127.0.0.1", server.port, "gl-user-remote", clientKey, HostKeys{server.hostKey.PublicKey()})
+	assert.Nil(t, err)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	assert.Nil(t, err)
+
+	var uploaded int64
+	err = scpUpload(session, localFile, "/tmp/build.zip", func(bytes int64) { uploaded += bytes })
+	assert.Nil(t, err)
+
+	assert.Equal(t, "zip contents", server.uploadedFiles()["/tmp/build.zip"])
+	assert.Equal(t, int64(len("zip contents")), uploaded)
+}
+
+// TestSCPUploadRemoteError ensures that errors reported by the remote scp process are returned
+func TestSCPUploadRemoteError(t *testing.T) {
+	clientKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, clientKey.PublicKey())
+	server.reject = "permission denied"
+	defer server.Close()
+
+	localFile := filepath.Join(t.TempDir(), "build.zip")
+	assert.Nil(t, os.WriteFile(localFile, []byte("zip contents"), 0644))
+
+	client, err := dialSSH("127.0.0.1", server.port, "gl-user-remote", clientKey, HostKeys{server.hostKey.PublicKey()})
+	assert.Nil(t, err)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	assert.Nil(t, err)
+
+	err = scpUpload(session, localFile, "/tmp/build.zip", nil)
+	assert.ErrorContains(t, err, "remote scp error: permission denied")
+}
+
+// TestDialSSHUnknownHostKey ensures that we refuse to connect to a server with an unexpected host key
+func TestDialSSHUnknownHostKey(t *testing.T) {
+	clientKey, err := NewSSHConfigManager(NewTestLogger(), "", 0, false, "").GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+
+	server := newTestSSHServer(t, clientKey.PublicKey())
+	defer server.Close()
+
+	_, err = dialSSH("127.0.0.1", server.port, "gl-user-remote", clientKey, HostKeys{testGenerateED25519Key(t)})
+	assert.NotNil(t, err)
+}
@@ -3,29 +3,27 @@ package tools
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"net"
-	"os"
 	"path/filepath"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
-	"golang.org/x/crypto/ssh"
 )
 
 // SSHCommandRunner is used to run a shell script on a remote instance over SSH
 type SSHCommandRunner struct {
 	logger              *slog.Logger
-	sshPort             int32
-	instanceIpAddress   string
+	session             *InstanceSession
 	instanceId          string
-	sshKey              ssh.Signer
 	updateScriptCommand string
-	remoteUserName      string
+	// onOutputLine is optional, when set it is called with each line the update script writes
+	onOutputLine OutputLineHandler
 }
 
-// NewSSHCommandRunner build a new SSHCommandRunner for the provided script, and instance
-func NewSSHCommandRunner(logger *slog.Logger, localUpdateScriptPath string, sshPort int32, sshKey ssh.Signer, instance *gamelift.Instance) (*SSHCommandRunner, error) {
+// NewSSHCommandRunner build a new SSHCommandRunner for the provided script, and instance.
+// onOutputLine is optional, when set it is called with each line of stdout, and stderr from the update script as it runs.
+func NewSSHCommandRunner(logger *slog.Logger, localUpdateScriptPath string, session *InstanceSession, instance *gamelift.Instance, onOutputLine OutputLineHandler) (*SSHCommandRunner, error) {
 	updateScriptCommand, err := generateUpdateScriptCommand(localUpdateScriptPath, instance)
 	if err != nil {
 		return nil, err
@@ -33,32 +31,17 @@ func NewSSHCommandRunner(logger *slog.Logger, localUpdateScriptPath string, sshP
 
 	return &SSHCommandRunner{
 		logger:              logger.With("context", "SSHCommandRunner"),
-		sshPort:             sshPort,
-		instanceIpAddress:   instance.IpAddress,
+		session:             session,
 		instanceId:          instance.InstanceId,
-		sshKey:              sshKey,
 		updateScriptCommand: updateScriptCommand,
-		remoteUserName:      string(config.RemoteUserForOperatingSystem(instance.OperatingSystem)),
+		onOutputLine:        onOutputLine,
 	}, nil
 }
 
 // Run will open an SSH connection to the remote instance, and run a script command on it
-func (s *SSHCommandRunner) Run(ctx context.Context, remotePublicKey ssh.PublicKey) error {
-	// Set up the SSH connection to the remote instance
-	client, err := ssh.Dial("tcp", net.JoinHostPort(s.instanceIpAddress, fmt.Sprintf("%d", s.sshPort)), &ssh.ClientConfig{
-		User:              s.remoteUserName,
-		HostKeyCallback:   ssh.FixedHostKey(remotePublicKey),
-		HostKeyAlgorithms: []string{remotePublicKey.Type()},
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(s.sshKey),
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("error dialing ssh connection: %w", err)
-	}
-	defer client.Close()
-
-	session, err := client.NewSession()
+func (s *SSHCommandRunner) Run(ctx context.Context) error {
+	// Open a session on the instance's shared SSH connection
+	session, err := s.session.NewSession()
 	if err != nil {
 		return fmt.Errorf("error starting ssh session: %w", err)
 	}
@@ -66,7 +49,7 @@ func (s *SSHCommandRunner) Run(ctx context.Context, remotePublicKey ssh.PublicKe
 
 	logFilePath := config.GetLogPathForFile(fmt.Sprintf("%s-ssh-command.log", s.instanceId))
 	// Set up a log file so we log out any remote output we get from the instance
-	logFile, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE, 0666)
+	logFile, err := config.OpenLogFile(logFilePath)
 	if err != nil {
 		return fmt.Errorf("error creating log file for ssh command runner: %w", err)
 	}
@@ -75,6 +58,17 @@ func (s *SSHCommandRunner) Run(ctx context.Context, remotePublicKey ssh.PublicKe
 	session.Stdout = logFile
 	session.Stderr = config.NewErrorLogger("SSHCommandRunner")
 
+	// Pass on each line of output as well, so it can be shown while the script runs
+	if s.onOutputLine != nil {
+		stdoutLines := newOutputLineWriter(s.onOutputLine, false)
+		stderrLines := newOutputLineWriter(s.onOutputLine, true)
+		defer stdoutLines.Flush()
+		defer stderrLines.Flush()
+
+		session.Stdout = io.MultiWriter(logFile, stdoutLines)
+		session.Stderr = io.MultiWriter(session.Stderr, stderrLines)
+	}
+
 	slog.Debug("running command on instance", "command", s.updateScriptCommand)
 
 	// Run the actual update command on the instance
@@ -13,7 +13,7 @@ func TestNewSSHCommandRunnerWindows(t *testing.T) {
 	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows}
 	localUpdateScriptPath := `C:\temporary-directory\update-script.ps1`
 
-	cmd, err := NewSSHCommandRunner(NewTestLogger(), localUpdateScriptPath, 22, nil, instance)
+	cmd, err := NewSSHCommandRunner(NewTestLogger(), localUpdateScriptPath, nil, instance, nil)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "powershell.exe -ExecutionPolicy Bypass -File C:\\Users\\gl-user-server\\update-script.ps1", cmd.updateScriptCommand)
@@ -24,7 +24,7 @@ func TestNewSSHCommandRunnerLinux(t *testing.T) {
 	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}
 	localUpdateScriptPath := `/user/local/tmp/my-script.sh`
 
-	cmd, err := NewSSHCommandRunner(NewTestLogger(), localUpdateScriptPath, 22, nil, instance)
+	cmd, err := NewSSHCommandRunner(NewTestLogger(), localUpdateScriptPath, nil, instance, nil)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "chmod +x /tmp/my-script.sh && /tmp/my-script.sh", cmd.updateScriptCommand)
@@ -35,7 +35,7 @@ func TestNewSSHCommandRunnerUnknownOS(t *testing.T) {
 	instance := &gamelift.Instance{}
 	localUpdateScriptPath := `/user/local/tmp/my-script.sh`
 
-	_, err := NewSSHCommandRunner(NewTestLogger(), localUpdateScriptPath, 22, nil, instance)
+	_, err := NewSSHCommandRunner(NewTestLogger(), localUpdateScriptPath, nil, instance, nil)
 
 	assert.NotNil(t, err)
 	assert.ErrorContains(t, err, "argument operatingSystem was invalid")
@@ -1,28 +1,53 @@
 package tools
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
 )
 
+// sshAuthSockEnv is the environment variable pointing to the socket of a running SSH agent
+const sshAuthSockEnv = "SSH_AUTH_SOCK"
+
+// windowsSSHAgentPipe is the named pipe the agent service of Windows OpenSSH listens on
+const windowsSSHAgentPipe = `\\.\pipe\openssh-ssh-agent`
+
 // SSHConfigManager manages configuration around interactions with SSH
 type SSHConfigManager struct {
 	logger         *slog.Logger
 	privateKeyPath string
 	sshPort        int
+	useSSHAgent    bool
+	// agentPublicKeyPath is optional, it is the public key of the agent key to use
+	agentPublicKeyPath string
+	agentConn          io.ReadWriteCloser
+	passphrasePrompt   func(prompt string) ([]byte, error)
 }
 
-// NewSSHConfigManager builds a new SSHConfigManager
-func NewSSHConfigManager(logger *slog.Logger, privateKeyPath string, sshPort int) *SSHConfigManager {
+// NewSSHConfigManager builds a new SSHConfigManager.
+// If useSSHAgent is true keys are loaded from the SSH agent instead of privateKeyPath, and agentPublicKeyPath may optionally point to the public key of the agent key to use.
+func NewSSHConfigManager(logger *slog.Logger, privateKeyPath string, sshPort int, useSSHAgent bool, agentPublicKeyPath string) *SSHConfigManager {
 	return &SSHConfigManager{
-		logger:         logger.With("context", "LocalSSHConfigManager"),
-		privateKeyPath: privateKeyPath,
-		sshPort:        sshPort,
+		logger:             logger.With("context", "LocalSSHConfigManager"),
+		privateKeyPath:     privateKeyPath,
+		sshPort:            sshPort,
+		useSSHAgent:        useSSHAgent,
+		agentPublicKeyPath: agentPublicKeyPath,
+		passphrasePrompt:   readPassphrase,
 	}
 }
 
@@ -30,37 +55,184 @@ func NewSSHConfigManager(logger *slog.Logger, privateKeyPath string, sshPort int
 func (s *SSHConfigManager) DeterminePort(operatingSystem config.OperatingSystem) (int32, error) {
 	port := int32(s.sshPort)
 
-	// Currently this tool does not support using a custom port for Linux
-	if operatingSystem == config.OperatingSystemLinux {
-		if port > 0 && port != config.DefaultPortLinux {
-			s.logger.Warn("custom SSH ports are not supported for Linux fleets, using the default", "port", config.DefaultPortLinux)
+	if port == 0 {
+		if operatingSystem == config.OperatingSystemLinux {
+			return config.DefaultPortLinux, nil
 		}
-		return config.DefaultPortLinux, nil
+		return config.DefaultPortWindows, nil
 	}
 
-	// If the user provided a port, but it is invalid return an error
-	if port > 0 && port < config.DefaultPortWindows {
-		return 0, fmt.Errorf("ssh port must be greater than or equal to %d for Windows servers", config.DefaultPortWindows)
+	// Linux instances already run sshd on the default port, so it can always be used
+	if operatingSystem == config.OperatingSystemLinux && port == config.DefaultPortLinux {
+		return port, nil
 	}
 
-	if port == 0 {
-		return config.DefaultPortWindows, nil
+	// GameLift only allows custom ports to be opened on a fleet within this range
+	if port < config.MinCustomPort {
+		return 0, fmt.Errorf("ssh port must be greater than or equal to %d for %s servers", config.MinCustomPort, operatingSystem)
+	}
+	if port > config.MaxCustomPort {
+		return 0, fmt.Errorf("ssh port must be less than or equal to %d for %s servers", config.MaxCustomPort, operatingSystem)
 	}
 
 	return port, nil
 }
 
-// LoadKey loads an SSH key off of the filesystem
+// LoadKey loads an SSH key from the SSH agent, or off of the filesystem.
+// If the key file is encrypted the user is prompted for its passphrase.
 func (s *SSHConfigManager) LoadKey(ctx context.Context) (signer ssh.Signer, err error) {
+	if s.useSSHAgent {
+		return s.loadAgentKey(ctx)
+	}
+
 	privateKeyBytes, err := os.ReadFile(s.privateKeyPath)
 	if err != nil {
 		return signer, fmt.Errorf("error reading private key file for instance: %w", err)
 	}
 
 	signer, err = ssh.ParsePrivateKey(privateKeyBytes)
+
+	var passphraseMissingErr *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseMissingErr) {
+		return s.loadEncryptedKey(privateKeyBytes)
+	}
+
 	if err != nil {
 		return signer, fmt.Errorf("error parsing private key file %w", err)
 	}
 
 	return signer, nil
 }
+
+// loadEncryptedKey prompts the user for a passphrase, and uses it to decrypt the private key
+func (s *SSHConfigManager) loadEncryptedKey(privateKeyBytes []byte) (signer ssh.Signer, err error) {
+	passphrase, err := s.passphrasePrompt(fmt.Sprintf("Enter passphrase for key %s: ", s.privateKeyPath))
+	if err != nil {
+		return signer, fmt.Errorf("error reading passphrase for private key file %w", err)
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKeyBytes, passphrase)
+	if err != nil {
+		return signer, fmt.Errorf("error parsing encrypted private key file %w", err)
+	}
+
+	return signer, nil
+}
+
+// loadAgentKey loads a key from the SSH agent listening on SSH_AUTH_SOCK, or on Windows from the OpenSSH agent service.
+// The connection to the agent is kept open, since the agent is needed every time the key signs something.
+func (s *SSHConfigManager) loadAgentKey(ctx context.Context) (signer ssh.Signer, err error) {
+	address, isPipe, err := sshAgentAddress(runtime.GOOS, os.Getenv(sshAuthSockEnv))
+	if err != nil {
+		return signer, err
+	}
+
+	if isPipe {
+		// Named pipes are opened like a file on Windows
+		s.agentConn, err = os.OpenFile(address, os.O_RDWR, 0)
+	} else {
+		s.agentConn, err = net.Dial("unix", address)
+	}
+	if err != nil {
+		return signer, fmt.Errorf("error connecting to ssh agent %w", err)
+	}
+
+	signers, err := agent.NewClient(s.agentConn).Signers()
+	if err != nil {
+		return signer, fmt.Errorf("error listing keys in ssh agent %w", err)
+	}
+
+	if len(signers) == 0 {
+		return signer, errors.New("ssh agent does not have any keys")
+	}
+
+	// Without a public key to match against, use the first key the agent offers (like ssh does)
+	if s.agentPublicKeyPath == "" {
+		return signers[0], nil
+	}
+
+	publicKey, err := s.loadPublicKey()
+	if err != nil {
+		return signer, err
+	}
+
+	for _, agentSigner := range signers {
+		if bytes.Equal(agentSigner.PublicKey().Marshal(), publicKey.Marshal()) {
+			return agentSigner, nil
+		}
+	}
+
+	return signer, fmt.Errorf("ssh agent does not have a key matching %s", s.agentPublicKeyPath)
+}
+
+// sshAgentAddress returns where the SSH agent listens for the operating system, and whether it is a Windows named pipe.
+// authSock is the value of SSH_AUTH_SOCK. On Windows it may be a unix socket or a named pipe, and without it the pipe of the OpenSSH agent service is used.
+func sshAgentAddress(operatingSystem string, authSock string) (address string, isPipe bool, err error) {
+	if operatingSystem == "windows" {
+		if authSock == "" {
+			return windowsSSHAgentPipe, true, nil
+		}
+		if strings.HasPrefix(authSock, `\\.\pipe\`) {
+			return authSock, true, nil
+		}
+	}
+
+	if authSock == "" {
+		return "", false, fmt.Errorf("no ssh agent found, %s is not set", sshAuthSockEnv)
+	}
+	return authSock, false, nil
+}
+
+// loadPublicKey loads the public key at agentPublicKeyPath, which is used to choose a key from the SSH agent
+func (s *SSHConfigManager) loadPublicKey() (ssh.PublicKey, error) {
+	publicKeyBytes, err := os.ReadFile(s.agentPublicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key file %w", err)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key file %w", err)
+	}
+
+	return publicKey, nil
+}
+
+// Close will release the connection to the SSH agent, if one was opened
+func (s *SSHConfigManager) Close() error {
+	if s.agentConn == nil {
+		return nil
+	}
+
+	err := s.agentConn.Close()
+	s.agentConn = nil
+	return err
+}
+
+// readPassphrase prompts for a passphrase on the terminal without echoing it
+func readPassphrase(prompt string) ([]byte, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return nil, errors.New("a terminal is required to enter a passphrase, add the key to an ssh agent instead")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	return term.ReadPassword(stdin)
+}
+
+// GenerateEphemeralKey generates a new ed25519 SSH key in memory. The key is only valid for the current run, and is never written to disk.
+func (s *SSHConfigManager) GenerateEphemeralKey(ctx context.Context) (signer ssh.Signer, err error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return signer, fmt.Errorf("error generating ephemeral key %w", err)
+	}
+
+	signer, err = ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return signer, fmt.Errorf("error creating signer for ephemeral key %w", err)
+	}
+
+	return signer, nil
+}
@@ -2,20 +2,26 @@ package tools
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
-// TestDeterminePortLinuxDefault ensures that we don't allow custom ports set for Linux instances
+// TestDeterminePortLinuxDefault ensures that we return the expected default port for Linux instances
 func TestDeterminePortLinuxDefault(t *testing.T) {
-	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 1045)
+	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 0, false, "")
 
 	port, err := configMgr.DeterminePort(config.OperatingSystemLinux)
 
@@ -23,9 +29,34 @@ func TestDeterminePortLinuxDefault(t *testing.T) {
 	assert.Equal(t, config.DefaultPortLinux, port)
 }
 
+// TestDeterminePortLinuxCustom ensures that we allow a user to set a custom port for Linux instances when valid
+func TestDeterminePortLinuxCustom(t *testing.T) {
+	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 1045, false, "")
+
+	port, err := configMgr.DeterminePort(config.OperatingSystemLinux)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1045), port)
+}
+
+// TestDeterminePortLinuxInvalid verifies that we don't allow the user to set an invalid port for a Linux instance
+func TestDeterminePortLinuxInvalid(t *testing.T) {
+	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 2222222, false, "")
+
+	_, err := configMgr.DeterminePort(config.OperatingSystemLinux)
+
+	assert.ErrorContains(t, err, "ssh port must be less than or equal to")
+
+	configMgr = NewSSHConfigManager(NewTestLogger(), "fake-path", 80, false, "")
+
+	_, err = configMgr.DeterminePort(config.OperatingSystemLinux)
+
+	assert.ErrorContains(t, err, "ssh port must be greater than or equal to")
+}
+
 // TestDeterminePortWindowsInvalid verifies that we don't allow the user to set an invalid port for a Windows instance
 func TestDeterminePortWindowsInvalid(t *testing.T) {
-	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 22)
+	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 22, false, "")
 
 	_, err := configMgr.DeterminePort(config.OperatingSystemWindows)
 
@@ -35,7 +66,7 @@ func TestDeterminePortWindowsInvalid(t *testing.T) {
 
 // TestDeterminePortWindowsDefault ensures that we return the expected default port for Windows instances
 func TestDeterminePortWindowsDefault(t *testing.T) {
-	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 00)
+	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 00, false, "")
 
 	port, err := configMgr.DeterminePort(config.OperatingSystemWindows)
 
@@ -45,7 +76,7 @@ func TestDeterminePortWindowsDefault(t *testing.T) {
 
 // TestDeterminePortWindowCustom ensures that we allow a user to set a custom port for Windows instances when valid
 func TestDeterminePortWindowCustom(t *testing.T) {
-	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 1500)
+	configMgr := NewSSHConfigManager(NewTestLogger(), "fake-path", 1500, false, "")
 
 	port, err := configMgr.DeterminePort(config.OperatingSystemWindows)
 
@@ -72,10 +103,206 @@ func TestLoadKey(t *testing.T) {
 	_, err = keyFile.Write(pemBytes)
 	assert.Nil(t, err)
 
-	configMgr := NewSSHConfigManager(NewTestLogger(), keyFile.Name(), 1500)
+	configMgr := NewSSHConfigManager(NewTestLogger(), keyFile.Name(), 1500, false, "")
 
 	signer, err := configMgr.LoadKey(context.Background())
 
 	assert.Nil(t, err)
 	assert.Equal(t, "ssh-rsa", signer.PublicKey().Type())
 }
+
+// TestGenerateEphemeralKey ensures that we generate a new ed25519 key every time one is requested
+func TestGenerateEphemeralKey(t *testing.T) {
+	configMgr := NewSSHConfigManager(NewTestLogger(), "", 0, false, "")
+
+	first, err := configMgr.GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "ssh-ed25519", first.PublicKey().Type())
+
+	second, err := configMgr.GenerateEphemeralKey(context.Background())
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.PublicKey().Marshal(), second.PublicKey().Marshal())
+}
+
+// testWriteEncryptedKey writes a new passphrase protected ed25519 key to a temporary file
+func testWriteEncryptedKey(t *testing.T, passphrase string) string {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte(passphrase))
+	assert.Nil(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "encrypted_key")
+	assert.Nil(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+
+	return keyPath
+}
+
+// TestLoadKeyEncrypted ensures that we prompt for a passphrase when the key is encrypted
+func TestLoadKeyEncrypted(t *testing.T) {
+	keyPath := testWriteEncryptedKey(t, "correct horse")
+
+	configMgr := NewSSHConfigManager(NewTestLogger(), keyPath, 0, false, "")
+
+	var prompt string
+	configMgr.passphrasePrompt = func(p string) ([]byte, error) {
+		prompt = p
+		return []byte("correct horse"), nil
+	}
+
+	signer, err := configMgr.LoadKey(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "ssh-ed25519", signer.PublicKey().Type())
+	assert.Contains(t, prompt, keyPath)
+}
+
+// TestLoadKeyEncryptedWrongPassphrase ensures that we return an error when the wrong passphrase is entered
+func TestLoadKeyEncryptedWrongPassphrase(t *testing.T) {
+	configMgr := NewSSHConfigManager(NewTestLogger(), testWriteEncryptedKey(t, "correct horse"), 0, false, "")
+	configMgr.passphrasePrompt = func(p string) ([]byte, error) {
+		return []byte("battery staple"), nil
+	}
+
+	_, err := configMgr.LoadKey(context.Background())
+
+	assert.ErrorContains(t, err, "error parsing encrypted private key file")
+}
+
+// TestLoadKeyEncryptedPromptError ensures that errors reading the passphrase are returned
+func TestLoadKeyEncryptedPromptError(t *testing.T) {
+	configMgr := NewSSHConfigManager(NewTestLogger(), testWriteEncryptedKey(t, "correct horse"), 0, false, "")
+	configMgr.passphrasePrompt = func(p string) ([]byte, error) {
+		return nil, errors.New("no terminal")
+	}
+
+	_, err := configMgr.LoadKey(context.Background())
+
+	assert.ErrorContains(t, err, "no terminal")
+}
+
+// testStartAgent serves an in-memory SSH agent holding the provided number of keys, and points SSH_AUTH_SOCK at it
+func testStartAgent(t *testing.T, keyCount int) []ssh.PublicKey {
+	keyring := agent.NewKeyring()
+
+	var publicKeys []ssh.PublicKey
+	for i := 0; i < keyCount; i++ {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		assert.Nil(t, keyring.Add(agent.AddedKey{PrivateKey: privateKey}))
+
+		signer, err := ssh.NewSignerFromKey(privateKey)
+		assert.Nil(t, err)
+		publicKeys = append(publicKeys, signer.PublicKey())
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	t.Setenv(sshAuthSockEnv, socket)
+
+	return publicKeys
+}
+
+// TestLoadKeyAgent ensures that we use the first agent key when no public key is provided
+func TestLoadKeyAgent(t *testing.T) {
+	publicKeys := testStartAgent(t, 2)
+
+	configMgr := NewSSHConfigManager(NewTestLogger(), "", 0, true, "")
+	defer configMgr.Close()
+
+	signer, err := configMgr.LoadKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, publicKeys[0].Marshal(), signer.PublicKey().Marshal())
+
+	// The signer should be able to sign through the agent
+	signature, err := signer.Sign(rand.Reader, []byte("data"))
+	assert.Nil(t, err)
+	assert.Nil(t, publicKeys[0].Verify([]byte("data"), signature))
+}
+
+// TestLoadKeyAgentMatchingPublicKey ensures that we choose the agent key matching the provided public key file
+func TestLoadKeyAgentMatchingPublicKey(t *testing.T) {
+	publicKeys := testStartAgent(t, 2)
+
+	publicKeyPath := filepath.Join(t.TempDir(), "key.pub")
+	assert.Nil(t, os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(publicKeys[1]), 0644))
+
+	configMgr := NewSSHConfigManager(NewTestLogger(), "", 0, true, publicKeyPath)
+	defer configMgr.Close()
+
+	signer, err := configMgr.LoadKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, publicKeys[1].Marshal(), signer.PublicKey().Marshal())
+}
+
+// TestLoadKeyAgentNoMatchingKey ensures that we return an error when the agent doesn't hold the requested key
+func TestLoadKeyAgentNoMatchingKey(t *testing.T) {
+	testStartAgent(t, 1)
+
+	publicKeyPath := filepath.Join(t.TempDir(), "key.pub")
+	assert.Nil(t, os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(testGenerateED25519Key(t)), 0644))
+
+	configMgr := NewSSHConfigManager(NewTestLogger(), "", 0, true, publicKeyPath)
+	defer configMgr.Close()
+
+	_, err := configMgr.LoadKey(context.Background())
+	assert.ErrorContains(t, err, "ssh agent does not have a key matching")
+}
+
+// TestLoadKeyAgentEmpty ensures that we return an error when the agent doesn't have any keys
+func TestLoadKeyAgentEmpty(t *testing.T) {
+	testStartAgent(t, 0)
+
+	configMgr := NewSSHConfigManager(NewTestLogger(), "", 0, true, "")
+	defer configMgr.Close()
+
+	_, err := configMgr.LoadKey(context.Background())
+	assert.ErrorContains(t, err, "ssh agent does not have any keys")
+}
+
+// TestLoadKeyAgentNotRunning ensures that we return an error when SSH_AUTH_SOCK is not set
+func TestLoadKeyAgentNotRunning(t *testing.T) {
+	t.Setenv(sshAuthSockEnv, "")
+
+	_, err := NewSSHConfigManager(NewTestLogger(), "", 0, true, "").LoadKey(context.Background())
+	assert.ErrorContains(t, err, "SSH_AUTH_SOCK is not set")
+}
+
+// TestSSHAgentAddress ensures that the Windows OpenSSH agent pipe is used when SSH_AUTH_SOCK is not set on Windows
+func TestSSHAgentAddress(t *testing.T) {
+	address, isPipe, err := sshAgentAddress("linux", "/tmp/agent.sock")
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/agent.sock", address)
+	assert.False(t, isPipe)
+
+	_, _, err = sshAgentAddress("linux", "")
+	assert.ErrorContains(t, err, "SSH_AUTH_SOCK is not set")
+
+	address, isPipe, err = sshAgentAddress("windows", "")
+	assert.Nil(t, err)
+	assert.Equal(t, `\\.\pipe\openssh-ssh-agent`, address)
+	assert.True(t, isPipe)
+
+	address, isPipe, err = sshAgentAddress("windows", `\\.\pipe\custom-agent`)
+	assert.Nil(t, err)
+	assert.Equal(t, `\\.\pipe\custom-agent`, address)
+	assert.True(t, isPipe)
+
+	address, isPipe, err = sshAgentAddress("windows", "C:\\agent.sock")
+	assert.Nil(t, err)
+	assert.Equal(t, "C:\\agent.sock", address)
+	assert.False(t, isPipe)
+}
@@ -3,12 +3,9 @@ package tools
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
-	"regexp"
 	"strings"
 	"time"
 
@@ -25,13 +22,18 @@ type SSHEnabler struct {
 	instance             *gamelift.Instance
 	instanceAccessGetter GameLiftInstanceAccessGetter
 	clientPublicKey      string
-	isNewCommandOutput   func(output string) bool
-	commandsToRun        []string
+	protocol             commandProtocol
+	commandsToRun        []sessionStep
 	pty                  PTY
+	// openSSHPackagePath is a local OpenSSH package to copy to Windows instances that don't have an SSH server installed
+	openSSHPackagePath string
+	// newPTY creates the pseudo terminal for any SSM session run before the main one
+	newPTY func() (PTY, error)
 }
 
-// NewSSHEnabler builds a new SSHEnabler for the target instance
-func NewSSHEnabler(logger *slog.Logger, instance *gamelift.Instance, instanceAccessGetter GameLiftInstanceAccessGetter, localPublicKey ssh.PublicKey, sshPort int32) (*SSHEnabler, error) {
+// NewSSHEnabler builds a new SSHEnabler for the target instance.
+// openSSH is only used for Windows instances, where OpenSSH may need to be installed before SSH can be enabled.
+func NewSSHEnabler(logger *slog.Logger, instance *gamelift.Instance, instanceAccessGetter GameLiftInstanceAccessGetter, localPublicKey ssh.PublicKey, sshPort int32, openSSH config.OpenSSHInstallOptions) (*SSHEnabler, error) {
 	localPublicKeyStr := convertPublicKeyToString(localPublicKey)
 
 	pty, err := newPtyCommandRunner()
@@ -39,18 +41,20 @@ func NewSSHEnabler(logger *slog.Logger, instance *gamelift.Instance, instanceAcc
 		return nil, err
 	}
 
-	var updateCommands []string
-	var isNewCommandOutput func(output string) bool
+	var updateCommands []sessionStep
+	var protocol commandProtocol
+	var openSSHPackagePath string
 
 	switch instance.OperatingSystem {
 
 	case config.OperatingSystemWindows:
-		updateCommands = windowsSSHEnableCommands(localPublicKeyStr, sshPort)
-		isNewCommandOutput = IsNewCommandOutputWindows
+		updateCommands = windowsSSHEnableCommands(localPublicKeyStr, sshPort, openSSH)
+		protocol = windowsCommandProtocol
+		openSSHPackagePath = openSSH.PackagePath
 
 	case config.OperatingSystemLinux:
-		updateCommands = linuxSSHEnableCommands(localPublicKeyStr)
-		isNewCommandOutput = IsNewCommandOutputLinux
+		updateCommands = linuxSSHEnableCommands(localPublicKeyStr, sshPort)
+		protocol = linuxCommandProtocol
 
 	default:
 		return nil, config.UnknownOperatingSystemError(fmt.Sprint(instance.OperatingSystem))
@@ -62,8 +66,12 @@ func NewSSHEnabler(logger *slog.Logger, instance *gamelift.Instance, instanceAcc
 		instance:             instance,
 		instanceAccessGetter: instanceAccessGetter,
 		clientPublicKey:      localPublicKeyStr,
-		isNewCommandOutput:   isNewCommandOutput,
+		protocol:             protocol,
 		commandsToRun:        updateCommands,
+		openSSHPackagePath:   openSSHPackagePath,
+		newPTY: func() (PTY, error) {
+			return newPtyCommandRunner()
+		},
 	}
 
 	return enabler, enabler.Validate()
@@ -73,6 +81,23 @@ func convertPublicKeyToString(key ssh.PublicKey) string {
 	return string(bytes.TrimSuffix(ssh.MarshalAuthorizedKey(key), []byte{'\n'}))
 }
 
+// authorizedKeyComment marks the lines this application adds to authorized_keys, so access is only ever revoked for a key it added itself
+const authorizedKeyComment = "fast-build-update-tool"
+
+// markedAuthorizedKey returns the authorized_keys line this application adds for localPublicKey
+func markedAuthorizedKey(localPublicKey string) string {
+	return localPublicKey + " " + authorizedKeyComment
+}
+
+// publicKeyData returns only the base64 encoded key data of an authorized key line (without the key type, or any comment)
+func publicKeyData(authorizedKey string) string {
+	fields := strings.Fields(authorizedKey)
+	if len(fields) < 2 {
+		return authorizedKey
+	}
+	return fields[1]
+}
+
 func (s *SSHEnabler) Validate() error {
 	// Verify we have the AWS CLI in the path
 	if err := verifyExe(awsCommand); err != nil {
@@ -88,130 +113,103 @@ func (s *SSHEnabler) Validate() error {
 }
 
 // Enable enable SSH on the remote instance
-func (s *SSHEnabler) Enable(ctx context.Context) (ssh.PublicKey, error) {
-	defer s.pty.Cleanup()
-
-	// Get remote instance access credentials
-	accessCredentials, err := s.instanceAccessGetter.GetInstanceAccess(ctx, s.instance.FleetId, s.instance.InstanceId)
+func (s *SSHEnabler) Enable(ctx context.Context) (HostKeys, error) {
+	logFilePath := config.GetLogPathForFile(fmt.Sprintf("%s-ssm-enable.log", s.instance.InstanceId))
+	// Set up a log file so we log out the output of every step run on the instance
+	logFile, err := config.OpenLogFile(logFilePath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error creating log file for ssh enabler: %w", err)
 	}
+	defer logFile.Close()
 
-	// Add AWS access credential environment variables
-	env := os.Environ()
-	env = append(env, envVar("AWS_REGION", s.instance.Region))
-	env = append(env, envVar("AWS_ACCESS_KEY_ID", accessCredentials.AccessKeyId))
-	env = append(env, envVar("AWS_SECRET_ACCESS_KEY", accessCredentials.SecretAccessKey))
-	env = append(env, envVar("AWS_SESSION_TOKEN", accessCredentials.SessionToken))
+	commands := newSessionCommands()
 
-	err = s.pty.Start("aws", []string{"ssm", "start-session", "--target", s.instance.InstanceId}, env)
-	if err != nil {
-		return nil, err
+	// The OpenSSH package is only sent when the instance needs it, copying it over SSM is slow
+	if s.openSSHPackagePath != "" {
+		err := s.addOpenSSHPackageUploadCommands(ctx, commands, logFile, logFilePath)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Channel used to let us know when we can send the next command to the SSM session
-	commandReady := make(chan int, 1)
+	commands.Add(s.commandsToRun...)
 
-	// Channel used to let us know when the SSM session has written out the contents of the remote server's public key
-	sshKeyReady := make(chan string, 1)
+	// Capture all of the output, and let us know when the session has written out every public host key of the remote server
+	output := newSessionOutput(hostKeysEndMarker)
 
-	// Set up an io.Writer to handle the remote output of the SSM session
-	ioWriter := &ptyWriter{
-		logger:             s.logger,
-		commandReady:       commandReady,
-		commandsToAccept:   len(s.commandsToRun),
-		sshKeyReady:        sshKeyReady,
-		isNewCommandOutput: s.isNewCommandOutput,
-		clientPublicKey:    s.clientPublicKey,
+	err = s.newSession(s.pty, logFile, logFilePath).RunCommands(ctx, commands, output.Write)
+	if err != nil {
+		return nil, err
 	}
 
-	// Start a goroutine to actually send the commands to the remote session
-	go func() {
-		for i, command := range s.commandsToRun {
-			s.logger.Debug("waiting to run ssh enable command", "commandNumber", i)
-			<-commandReady
-			s.logger.Debug("running ssh enable command", "commandNumber", i)
-
-			err := s.pty.RunCommand(command)
-			if err != nil {
-				s.logger.Error("error running remote command", "error", err)
-				return
-			}
-
-			time.Sleep(200 * time.Millisecond)
-		}
-	}()
-
-	// Start a goroutine to copy the output from the SSM session to our writer
-	go func() {
-		_, err := io.Copy(ioWriter, s.pty.Reader())
-		if err != nil && !errors.Is(err, os.ErrClosed) && errors.Is(err, io.EOF) {
-			s.logger.Warn("error copying pty commands from remote instance", "err", err)
-		}
-	}()
+	// The session output may still be processing after the session exits
+	if !output.Wait(remoteOutputTimeout) {
+		s.logger.Warn("timed out waiting for the remote host keys to be listed, using the output received so far")
+	}
 
-	// Wait for the SSM session to finish
-	err = s.pty.Wait()
+	// Parse the remote public SSH keys we read out of the session, we need these to connect to the server later on
+	hostKeys, err := ParseHostKeys(output.String(), s.clientPublicKey)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w; Check logs in %s for more information", err, logFilePath)
 	}
 
-	// Read the remote public SSH key out of the channel, and parse it
-	sshKey := <-sshKeyReady
-	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sshKey))
-	if err != nil {
-		return nil, fmt.Errorf("error parsing remote public key %s %w", sshKey, err)
+	for _, key := range hostKeys {
+		s.logger.Debug("found server public key", "type", key.Type(), "fingerprint", ssh.FingerprintSHA256(key))
 	}
 
-	return pubKey, nil
+	return hostKeys, nil
 }
 
-// ptyWriter is used to handle writing, and parsing output from the remote SSM session
-type ptyWriter struct {
-	logger             *slog.Logger
-	commandReady       chan int
-	sshKeyReady        chan string
-	commandsToAccept   int
-	commandsRun        int
-	isNewCommandOutput func(output string) bool
-	clientPublicKey    string
-}
+// addOpenSSHPackageUploadCommands will add the commands needed to copy the local OpenSSH package to the instance.
+// No commands are added if the instance already has an SSH server installed.
+func (s *SSHEnabler) addOpenSSHPackageUploadCommands(ctx context.Context, commands *sessionCommands, log io.Writer, logFilePath string) error {
+	pty, err := s.newPTY()
+	if err != nil {
+		return err
+	}
 
-func (w *ptyWriter) Write(p []byte) (int, error) {
-	terminalOutputStr := string(p)
+	output := newSessionOutput(sshInstalledMarker, sshMissingMarker)
 
-	// If we have a new command input (eg. `sh $`), let the channel know we can accept the next command.
-	if w.isNewCommandOutput(terminalOutputStr) && w.commandsRun < w.commandsToAccept {
-		w.commandsRun = w.commandsRun + 1
-		w.commandReady <- w.commandsRun
-		// Everything has run, close the channel
-		if w.commandsToAccept <= w.commandsRun {
-			close(w.commandReady)
-		}
+	err = s.newSession(pty, log, logFilePath).Run(ctx, windowsIsSSHInstalledCommands(), output.Write)
+	if err != nil {
+		return fmt.Errorf("error checking if ssh is installed: %w", err)
 	}
 
-	// We'll cat the public key file, make sure we capture the output, we need this to connect to the server later on
-	match := FindED25519PublicKey(terminalOutputStr)
-	if match != "" && !strings.Contains(w.clientPublicKey, match) {
-		w.logger.Debug("found server public key", "key", match)
-		w.sshKeyReady <- match
+	if !output.Wait(remoteOutputTimeout) {
+		s.logger.Warn("timed out waiting to find out if ssh is installed, copying the OpenSSH package")
 	}
 
-	return len(p), nil
-}
+	if strings.Contains(output.String(), sshInstalledMarker) {
+		s.logger.Debug("ssh is already installed on the instance, skipping the OpenSSH package")
+		return nil
+	}
 
-var (
-	publicKeyRegex = regexp.MustCompile("ssh-ed25519 ([A-Za-z0-9+/=]+)")
-)
+	s.logger.Debug("copying OpenSSH package to the instance over SSM")
 
-func FindED25519PublicKey(s string) string {
-	return publicKeyRegex.FindString(s)
+	return addFileUploadCommands(commands, s.instance.OperatingSystem, s.openSSHPackagePath, windowsOpenSSHPackagePath, nil)
+}
+
+func (s *SSHEnabler) newSession(pty PTY, log io.Writer, logFilePath string) *ssmCommandSession {
+	return &ssmCommandSession{
+		logger:               s.logger,
+		instance:             s.instance,
+		instanceAccessGetter: s.instanceAccessGetter,
+		protocol:             s.protocol,
+		pty:                  pty,
+		log:                  log,
+		logFilePath:          logFilePath,
+	}
 }
 
 func envVar(key, value string) string {
 	return fmt.Sprintf("%s=%s", key, value)
 }
 
+const (
+	// remoteOutputTimeout is how long to wait for remote output to be processed after an SSM session has ended
+	remoteOutputTimeout = 10 * time.Second
+)
+
 const (
 	awsCommand            = "aws"
 	sessionManagerCommand = "session-manager-plugin"
@@ -2,22 +2,88 @@ package tools
 
 import (
 	"fmt"
-	"regexp"
-)
+	"strings"
 
-var (
-	linuxNewCommandRegex = regexp.MustCompile(`(?m)sh-\d\.\d\$`)
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 )
 
-func IsNewCommandOutputLinux(output string) bool {
-	return linuxNewCommandRegex.MatchString(output)
+// linuxCommandProtocol runs each command on its own line in sh, and reports its exit code with $?
+var linuxCommandProtocol = commandProtocol{
+	wrap: func(command string, sessionId string, index int) string {
+		return fmt.Sprintf("echo \"%s\"\"BEGIN_%s_%d\"\n%s\necho \"%s\"\"END_%s_%d:$?\"\n",
+			commandMarkerStart, sessionId, index, strings.TrimRight(command, "\r\n"), commandMarkerStart, sessionId, index)
+	},
+	exit: "exit\n",
+}
+
+const linuxAuthorizedKeysPath = "/home/gl-user-remote/.ssh/authorized_keys"
+
+// linuxSSHServiceName is the prefix of the systemd units this application starts to run sshd on a custom port
+const linuxSSHServiceName = "fast-build-update-tool-sshd"
+
+func linuxSSHEnableCommands(localPublicKey string, sshPort int32) []sessionStep {
+	commands := []sessionStep{}
+
+	// The system sshd is left untouched, a second instance of it listens on the custom port instead.
+	// -p overrides any Port lines in sshd_config, everything else (host keys, auth settings) is shared with the system sshd.
+	if sshPort != config.DefaultPortLinux {
+		unitName := fmt.Sprintf("%s-%d", linuxSSHServiceName, sshPort)
+		commands = append(commands, sessionStep{
+			name: fmt.Sprintf("start sshd on port %d", sshPort),
+			command: fmt.Sprintf("sudo systemctl is-active --quiet %s || sudo systemd-run --unit=%s /usr/sbin/sshd -D -p %d -o PidFile=/run/%s.pid;\n",
+				unitName, unitName, sshPort, unitName),
+		})
+	}
+
+	return append(commands,
+		sessionStep{name: "create authorized_keys", command: fmt.Sprintf("sudo touch %s;\n", linuxAuthorizedKeysPath)},
+		// Only add the key if it is missing, so we don't remove access for any other keys. A key that was already authorized is never marked, so it is kept when access is revoked.
+		sessionStep{name: "add public key to authorized_keys", command: fmt.Sprintf("sudo grep -qF \"%s\" %s || echo \"%s\" | sudo tee -a %s;\n",
+			publicKeyData(localPublicKey), linuxAuthorizedKeysPath, markedAuthorizedKey(localPublicKey), linuxAuthorizedKeysPath)},
+		// List every host key the instance offers, followed by a marker so we know the list is complete
+		sessionStep{name: "list host keys", command: fmt.Sprintf("cat /etc/ssh/ssh_host_*_key.pub; echo %s\"\"%s;\n", hostKeysEndMarkerStart, hostKeysEndMarkerEnd)},
+	)
+}
+
+// linuxFileUploadFormat writes files in sh. A failed upload fails its command, and sets $uploadFailed so the update script is never run.
+var linuxFileUploadFormat = fileUploadFormat{
+	start: func(encodedPath string) string {
+		return fmt.Sprintf(": > %s;\n", encodedPath)
+	},
+	chunk: func(encodedPath string, chunk string) string {
+		return fmt.Sprintf("printf '%%s' '%s' >> %s;\n", chunk, encodedPath)
+	},
+	finish: func(encodedPath string, remotePath string, sha256 string) string {
+		return fmt.Sprintf("base64 -d %s > %s; rm -f %s; echo \"%s  %s\" | sha256sum -c --status || { rm -f %s; uploadFailed=1; echo \"%s\"\"%s\"; echo \"%s did not match its checksum after it was copied\"; false; };\n",
+			encodedPath, remotePath, encodedPath, sha256, remotePath, remotePath, uploadFailedMarkerStart, uploadFailedMarkerEnd, remotePath)
+	},
 }
 
-func linuxSSHEnableCommands(localPublicKey string) []string {
-	return []string{
-		"sudo touch /home/gl-user-remote/.ssh/authorized_keys;\n",
-		fmt.Sprintf("echo \"%s\" | sudo tee /home/gl-user-remote/.ssh/authorized_keys;\n", localPublicKey),
-		"cat /etc/ssh/ssh_host_ed25519_key.pub;\n",
-		"exit;\n",
+// linuxSSMRunUpdateScriptCommands will generate the commands needed to run the update script in an SSM session, once every file has been copied.
+// The script is skipped if any upload failed.
+func linuxSSMRunUpdateScriptCommands(updateScriptCommand string) []sessionStep {
+	return []sessionStep{{
+		name: runUpdateScriptStep,
+		command: fmt.Sprintf("if [ -z \"$uploadFailed\" ]; then echo \"%s\"\"%s\"; %s; echo \"%s\"\"%s$?\"; fi;\n",
+			updateMarkerStart, updateStartedMarkerEnd, updateScriptCommand, updateMarkerStart, updateExitMarkerEnd),
+	}}
+}
+
+// linuxRevokeSSHCommands will generate the commands needed to remove the key installed by linuxSSHEnableCommands.
+// Only the line linuxSSHEnableCommands added is removed, the key is left in place if it was authorized before this application added it.
+// If stopSSHServer is true, any sshd started by linuxSSHEnableCommands on a custom port will also be stopped. The system sshd is never stopped.
+func linuxRevokeSSHCommands(localPublicKey string, stopSSHServer bool) []sessionStep {
+	tempAuthorizedKeysPath := linuxAuthorizedKeysPath + ".tmp"
+	commands := []sessionStep{{
+		name: "remove public key from authorized_keys",
+		// Filter out the line we added, and write the result back in place so file ownership and permissions are kept
+		command: fmt.Sprintf("sudo sh -c 'grep -vxF \"%s\" %s > %s; cat %s > %s; rm -f %s';\n",
+			markedAuthorizedKey(localPublicKey), linuxAuthorizedKeysPath, tempAuthorizedKeysPath, tempAuthorizedKeysPath, linuxAuthorizedKeysPath, tempAuthorizedKeysPath),
+	}}
+
+	if stopSSHServer {
+		commands = append(commands, sessionStep{name: "stop sshd", command: fmt.Sprintf("sudo systemctl stop '%s-*';\n", linuxSSHServiceName)})
 	}
+
+	return commands
 }
@@ -5,10 +5,13 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
@@ -41,75 +44,104 @@ func NewTestLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
 }
 
+// testInstallFakeCLIs puts stub aws and session-manager-plugin executables on the PATH, so validation passes without the real tools installed
+func testInstallFakeCLIs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"aws", "session-manager-plugin"} {
+		if runtime.GOOS == "windows" {
+			name = name + ".exe"
+		}
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755))
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// testUseLogsDir runs the test in a temporary directory that has a logs directory, so per-instance log files can be written
+func testUseLogsDir(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	assert.Nil(t, os.MkdirAll(config.GetLogPathForFile(""), os.ModePerm))
+}
+
 func TestNewSSHEnablerWindows(t *testing.T) {
+	testInstallFakeCLIs(t)
 	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows}
 
-	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22)
+	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22, config.OpenSSHInstallOptions{})
 	assert.Nil(t, err)
 	assert.True(t, len(enabler.commandsToRun) > 0)
+
+	// Without a checksum the package is still downloaded, and its signatures are checked before it is installed
+	commands := testJoinSteps(enabler.commandsToRun)
+	assert.Contains(t, commands, "$packageUrl=\""+windowsOpenSSHDownloadUrl+"\";")
+	assert.Contains(t, commands, "$packageSHA256=\"\";")
+	assert.Contains(t, commands, "$signature = Get-AuthenticodeSignature -FilePath $_.FullName;")
+	assert.Contains(t, commands, "the OpenSSH package on the instance was not signed by Microsoft, so it was not installed")
+	assert.NotContains(t, commands, "no SHA-256 was provided")
 }
 
-func TestNewSSHEnablerLinux(t *testing.T) {
-	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}
+// TestNewSSHEnablerWindowsOpenSSHPackage ensures that a local OpenSSH package replaces the download, and is verified before install
+func TestNewSSHEnablerWindowsOpenSSHPackage(t *testing.T) {
+	testInstallFakeCLIs(t)
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows}
+	openSSH := config.OpenSSHInstallOptions{PackagePath: "OpenSSH-Win64.zip", PackageSHA256: "ABCD", UseCapability: true}
 
-	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22)
+	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 1026, openSSH)
 	assert.Nil(t, err)
-	assert.True(t, len(enabler.commandsToRun) > 0)
+	assert.Equal(t, "OpenSSH-Win64.zip", enabler.openSSHPackagePath)
+
+	commands := testJoinSteps(enabler.commandsToRun)
+	assert.Contains(t, commands, "$packageUrl=\"\";")
+	assert.Contains(t, commands, "$packageSHA256=\"ABCD\";")
+	assert.Contains(t, commands, "$useCapability=$true;")
+	assert.Contains(t, commands, "did not match the expected SHA-256, so it was not installed")
 }
 
-func TestNewSSHEnablerUnknownOS(t *testing.T) {
-	instance := &gamelift.Instance{}
+// TestNewSSHEnablerLinuxOpenSSHPackage ensures that the OpenSSH package is never sent to Linux instances
+func TestNewSSHEnablerLinuxOpenSSHPackage(t *testing.T) {
+	testInstallFakeCLIs(t)
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}
+	openSSH := config.OpenSSHInstallOptions{PackagePath: "OpenSSH-Win64.zip", PackageSHA256: "ABCD"}
 
-	_, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22)
-	assert.NotNil(t, err)
-	assert.ErrorContains(t, err, "unknown operating system")
+	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22, openSSH)
+	assert.Nil(t, err)
+	assert.Empty(t, enabler.openSSHPackagePath)
 }
 
-func TestIsNewCommandOutputLinux(t *testing.T) {
-	assert.True(t, IsNewCommandOutputLinux("sh-5.2$ "))
-	assert.True(t, IsNewCommandOutputLinux("abunchofrandominput\r\nsh-5.3$ "))
-	assert.True(t, IsNewCommandOutputLinux("abunch\r\nofrand\r\nominput\nsh-4.6$ "))
-	assert.True(t, IsNewCommandOutputLinux("abunchofrandominput\nsh-5.2$ "))
-	assert.True(t, IsNewCommandOutputLinux(`abunchofrandominput
-sh-5.2$ `))
-
-	assert.False(t, IsNewCommandOutputLinux("abunchofrandominput"))
-	assert.False(t, IsNewCommandOutputLinux("abunchofrandominput\r\n$"))
-	assert.False(t, IsNewCommandOutputLinux("abunchofrandominput\n$"))
+func TestNewSSHEnablerLinux(t *testing.T) {
+	testInstallFakeCLIs(t)
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}
+
+	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22, config.OpenSSHInstallOptions{})
+	assert.Nil(t, err)
+	assert.True(t, len(enabler.commandsToRun) > 0)
+	assert.NotContains(t, testJoinSteps(enabler.commandsToRun), "sshd")
 }
 
-func TestIsNewCommandOutputWindows(t *testing.T) {
-	assert.True(t, IsNewCommandOutputWindows("PS C:\\Windows\\system32>"))
-	assert.True(t, IsNewCommandOutputWindows("abunchofrandominput\r\nPS C:\\Windows\\system32>"))
-	assert.True(t, IsNewCommandOutputWindows("abunch\r\nofrand\r\nominput\nPS C:\\Windows\\system32>"))
-	assert.True(t, IsNewCommandOutputWindows(`abunchofrandominput
-PS C:\Windows\system32> `))
+// TestNewSSHEnablerLinuxCustomPort ensures that a second sshd is started on Linux instances when a custom port is used
+func TestNewSSHEnablerLinuxCustomPort(t *testing.T) {
+	testInstallFakeCLIs(t)
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}
 
-	assert.False(t, IsNewCommandOutputWindows("abunchofrandominput"))
-	assert.False(t, IsNewCommandOutputWindows("abunchofrandominput\r\nPS"))
-	assert.False(t, IsNewCommandOutputWindows("abunchofrandominput\nPS"))
-}
+	enabler, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 2222, config.OpenSSHInstallOptions{})
+	assert.Nil(t, err)
 
-func TestFindED25519PublicKey(t *testing.T) {
-	expectedKeyStr := "ssh-ed25519 ABCDE0FghI1jKLM1NOP5RSTUVW04XYzA0BCDefghIJKlMNOPQRSTuVWXYzabCdEf11GhI"
-	assert.Equal(t, expectedKeyStr, FindED25519PublicKey(expectedKeyStr))
-	// Make sure we can filter out additional garbage
-	assert.Equal(t, expectedKeyStr, FindED25519PublicKey(expectedKeyStr+`\x1b[?25l`))
+	commands := testJoinSteps(enabler.commandsToRun)
+	assert.Contains(t, commands, "sudo systemctl is-active --quiet fast-build-update-tool-sshd-2222 || sudo systemd-run --unit=fast-build-update-tool-sshd-2222 /usr/sbin/sshd -D -p 2222")
 }
 
-// mockSSMReader mocks how a remote SSM session would read output from a remote terminal session
-type mockSSMReader struct {
-	publicKey string
-}
+func TestNewSSHEnablerUnknownOS(t *testing.T) {
+	instance := &gamelift.Instance{}
 
-func (t *mockSSMReader) Read(p []byte) (n int, err error) {
-	commandSeparator := "sh-5.2$"
-	// write the public key and the terminal output so we can exit the session properly.
-	bytes := copy(p, []byte(fmt.Sprintf("%s\n%s", t.publicKey, commandSeparator)))
-	return bytes, nil
+	_, err := NewSSHEnabler(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, testGenerateKey(t), 22, config.OpenSSHInstallOptions{})
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "unknown operating system")
 }
 
 func TestEnable(t *testing.T) {
+	testUseLogsDir(t)
 	expectedAccessKey := "AccessKeyId"
 	expectedSecretAccessKey := "SecretAccessKey"
 	expectedSessionToken := "SessionToken"
@@ -124,25 +156,11 @@ func TestEnable(t *testing.T) {
 	}
 
 	publicKey := testGenerateED25519Key(t)
-	reader := &mockSSMReader{
-		publicKey: convertPublicKeyToString(publicKey),
-	}
 
-	mockedSSMCommandRunner := &PTYMock{
-		CleanupFunc: func() {},
-		ReaderFunc: func() io.Reader {
-			return reader
-		},
-		RunCommandFunc: func(cmd string) error {
-			return nil
-		},
-		StartFunc: func(cmdName string, args []string, env []string) error {
-			return nil
-		},
-		WaitFunc: func() error {
-			return nil
-		},
-	}
+	// write the public key, and the end of the host key list
+	mockedSSMCommandRunner := testShellPTY(linuxCommandProtocol, func(command string) (string, int) {
+		return fmt.Sprintf("%s\r\n%s", convertPublicKeyToString(publicKey), hostKeysEndMarker), 0
+	})
 
 	instanceId := "i-1234"
 	fleetId := "f-1234"
@@ -152,13 +170,14 @@ func TestEnable(t *testing.T) {
 		instance:             &gamelift.Instance{FleetId: fleetId, InstanceId: instanceId},
 		instanceAccessGetter: instanceAccessGetter,
 		clientPublicKey:      "",
-		isNewCommandOutput:   IsNewCommandOutputLinux,
+		protocol:             linuxCommandProtocol,
 		pty:                  mockedSSMCommandRunner,
-		commandsToRun:        []string{"ls -lah"},
+		commandsToRun:        []sessionStep{{name: "list files", command: "ls -lah"}},
 	}
 
-	_, err := enabler.Enable(context.Background())
+	hostKeys, err := enabler.Enable(context.Background())
 	assert.Nil(t, err)
+	assert.Equal(t, HostKeys{publicKey}, hostKeys)
 
 	assert.Len(t, instanceAccessGetter.GetInstanceAccessCalls(), 1)
 	assert.Equal(t, fleetId, instanceAccessGetter.GetInstanceAccessCalls()[0].FleetId)
@@ -171,3 +190,44 @@ func TestEnable(t *testing.T) {
 	assert.Contains(t, mockedSSMCommandRunner.StartCalls()[0].Env, "AWS_SECRET_ACCESS_KEY="+expectedSecretAccessKey)
 	assert.Contains(t, mockedSSMCommandRunner.StartCalls()[0].Env, "AWS_SESSION_TOKEN="+expectedSessionToken)
 }
+
+// testProbePTY mocks a remote SSM session that checks if SSH is installed
+func testProbePTY(marker string) *PTYMock {
+	return testShellPTY(windowsCommandProtocol, func(command string) (string, int) {
+		return marker, 0
+	})
+}
+
+// TestOpenSSHPackageUploadCommands ensures that the OpenSSH package is only copied to instances that don't have SSH installed
+func TestOpenSSHPackageUploadCommands(t *testing.T) {
+	packagePath := filepath.Join(t.TempDir(), "OpenSSH-Win64.zip")
+	assert.Nil(t, os.WriteFile(packagePath, []byte("package"), 0644))
+
+	instanceAccessGetter := &GameLiftInstanceAccessGetterMock{
+		GetInstanceAccessFunc: func(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error) {
+			return &gamelift.InstanceAccessCredentials{}, nil
+		},
+	}
+
+	newEnabler := func(probe PTY) *SSHEnabler {
+		return &SSHEnabler{
+			logger:               NewTestLogger(),
+			instance:             &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows},
+			instanceAccessGetter: instanceAccessGetter,
+			protocol:             windowsCommandProtocol,
+			openSSHPackagePath:   packagePath,
+			newPTY:               func() (PTY, error) { return probe, nil },
+		}
+	}
+
+	commands := newSessionCommands()
+	err := newEnabler(testProbePTY(sshInstalledMarker)).addOpenSSHPackageUploadCommands(context.Background(), commands, io.Discard, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, commands.Len())
+
+	err = newEnabler(testProbePTY(sshMissingMarker)).addOpenSSHPackageUploadCommands(context.Background(), commands, io.Discard, "")
+	assert.Nil(t, err)
+	chunk, err := commands.Command(1)
+	assert.Nil(t, err)
+	assert.Contains(t, chunk.command, base64.StdEncoding.EncodeToString([]byte("package")))
+}
@@ -2,51 +2,142 @@ package tools
 
 import (
 	"fmt"
-	"regexp"
-)
+	"strings"
 
-var (
-	windowsNewCommandRegex = regexp.MustCompile(`(?m)PS\s.*\>`)
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 )
 
-func IsNewCommandOutputWindows(output string) bool {
-	return windowsNewCommandRegex.MatchString(output)
+// windowsCommandProtocol runs each command in a PowerShell try block, so any error stops the command, and is reported as exit code 1
+var windowsCommandProtocol = commandProtocol{
+	wrap: func(command string, sessionId string, index int) string {
+		return fmt.Sprintf("Write-Host (\"%s\" + \"BEGIN_%s_%d\"); $fbutExitCode = 0; try {\r\n$ErrorActionPreference = \"Stop\";\r\n%s\r\n} catch { Write-Host $_; $fbutExitCode = 1 }; "+
+			"$ErrorActionPreference = \"Continue\"; Write-Host (\"%s\" + \"END_%s_%d:\" + $fbutExitCode);\r\n",
+			commandMarkerStart, sessionId, index, withoutBlankLines(command), commandMarkerStart, sessionId, index)
+	},
+	exit: "exit\r\n",
 }
 
-func windowsSSHEnableCommands(localPublicKey string, sshPort int32) []string {
-	return []string{
+// withoutBlankLines removes every blank line from a script, since PowerShell treats a blank line as the end of an incomplete block
+func withoutBlankLines(script string) string {
+	lines := []string{}
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// windowsFirewallRuleName is the name of the firewall rule this application creates to allow SSH traffic
+const windowsFirewallRuleName = "fast-build-update-tool-sshd"
+
+func windowsSSHEnableCommands(localPublicKey string, sshPort int32, openSSH config.OpenSSHInstallOptions) []sessionStep {
+	// A local package is copied to the instance before these commands run, so there is nothing to download
+	packageUrl := windowsOpenSSHDownloadUrl
+	if openSSH.PackagePath != "" {
+		packageUrl = ""
+	}
+
+	variables := []string{
 		fmt.Sprintf("$port=\"%d\";\r\n", sshPort),
-		fmt.Sprintf("$publicKey=\"%s\";\r\n", localPublicKey),
-		windowsInstallSSHPowershellScript,
-		"Get-Content -Path C:\\ProgramData\\ssh\\ssh_host_ed25519_key.pub;\r\n",
-		"exit;\r\n",
+		fmt.Sprintf("$publicKeyData=\"%s\";\r\n", publicKeyData(localPublicKey)),
+		fmt.Sprintf("$authorizedKey=\"%s\";\r\n", markedAuthorizedKey(localPublicKey)),
+		fmt.Sprintf("$firewallRuleName=\"%s\";\r\n", windowsFirewallRuleName),
+		fmt.Sprintf("$packagePath=\"%s\";\r\n", windowsOpenSSHPackagePath),
+		fmt.Sprintf("$packageUrl=\"%s\";\r\n", packageUrl),
+		fmt.Sprintf("$packageSHA256=\"%s\";\r\n", openSSH.PackageSHA256),
+		fmt.Sprintf("$stagingDir=\"%s\";\r\n", windowsOpenSSHStagingPath),
+		fmt.Sprintf("$useCapability=$%t;\r\n", openSSH.UseCapability),
 	}
+
+	commands := []sessionStep{}
+	for _, variable := range variables {
+		commands = append(commands, sessionStep{name: "set session variables", command: variable})
+	}
+
+	return append(commands,
+		sessionStep{name: "install OpenSSH", command: windowsInstallSSHPowershellScript},
+		sessionStep{name: "configure sshd port", command: windowsConfigureSSHPortPowershellScript},
+		sessionStep{name: "add public key to authorized_keys", command: windowsAddPublicKeyPowershellScript},
+		// List every host key the instance offers, followed by a marker so we know the list is complete
+		sessionStep{name: "list host keys", command: fmt.Sprintf("Get-Content -Path C:\\ProgramData\\ssh\\ssh_host_*_key.pub; Write-Host (\"%s\" + \"%s\");\r\n", hostKeysEndMarkerStart, hostKeysEndMarkerEnd)},
+	)
 }
 
+const (
+	// windowsOpenSSHDownloadUrl is where the OpenSSH package is downloaded from on the instance when a local package is not provided.
+	// It is the latest full release of Win32-OpenSSH, pre-releases are never picked.
+	windowsOpenSSHDownloadUrl = "https://github.com/PowerShell/Win32-OpenSSH/releases/latest/download/OpenSSH-Win64.zip"
+
+	// windowsOpenSSHPackagePath is where the OpenSSH package is stored on the instance until it is installed
+	windowsOpenSSHPackagePath = "C:\\OpenSSH-Win64.zip"
+
+	// windowsOpenSSHStagingPath is where a package without a checksum is expanded, so its signatures are checked before it is installed
+	windowsOpenSSHStagingPath = "C:\\OpenSSH-Win64-staging"
+)
+
 const windowsInstallSSHPowershellScript = `
 $isSSHRunning = net start | Select-String -Pattern OpenSSH;
 if (!$isSSHRunning) {
 	Write-Host "Setting up OpenSSH"
 
-	New-NetFirewallRule -Name sshd -DisplayName 'OpenSSH Server (sshd)' -Enabled True -Direction Inbound -Protocol TCP -Action Allow -LocalPort $port -ErrorAction SilentlyContinue;
-	
-	if (!(Test-Path "C:\OpenSSH-Win64.zip")) {
-		[Net.ServicePointManager]::SecurityProtocol = "tls12, tls11, tls";
-		Invoke-WebRequest -Uri "https://github.com/PowerShell/Win32-OpenSSH/releases/download/v8.9.1.0p1-Beta/OpenSSH-Win64.zip" -OutFile "C:\OpenSSH-Win64.zip";
+	New-NetFirewallRule -Name $firewallRuleName -DisplayName 'OpenSSH Server (fast-build-update-tool)' -Enabled True -Direction Inbound -Protocol TCP -Action Allow -LocalPort $port -ErrorAction SilentlyContinue;
+
+	# Prefer the OpenSSH server that ships with Windows, when the instance offers it
+	if ($useCapability -and !(Get-Service sshd -ErrorAction SilentlyContinue)) {
+		$capability = Get-WindowsCapability -Online -Name "OpenSSH.Server*" -ErrorAction SilentlyContinue | Select-Object -First 1;
+		if ($capability -and $capability.State -ne "Installed") {
+			Add-WindowsCapability -Online -Name $capability.Name -ErrorAction SilentlyContinue;
+		}
 	}
 
-	if (!(Test-Path "C:\Program Files\OpenSSH-Win64")) {
-		Expand-Archive C:\OpenSSH-Win64.zip -DestinationPath "C:\Program Files";
-		Remove-Item -Path "C:\OpenSSH-Win64.zip";
+	if (!(Get-Service sshd -ErrorAction SilentlyContinue)) {
+		if (!(Test-Path "C:\Program Files\OpenSSH-Win64")) {
+			if (!(Test-Path $packagePath) -and $packageUrl) {
+				[Net.ServicePointManager]::SecurityProtocol = "tls12, tls11, tls";
+				Invoke-WebRequest -Uri $packageUrl -OutFile $packagePath;
+			}
+
+			if ((Test-Path $packagePath) -and $packageSHA256) {
+				# Never install a package that does not match the expected checksum
+				if ((Get-FileHash -Algorithm SHA256 -Path $packagePath).Hash -ne $packageSHA256) {
+					Remove-Item -Path $packagePath -ErrorAction SilentlyContinue;
+					throw "the OpenSSH package on the instance did not match the expected SHA-256, so it was not installed"
+				}
+				Expand-Archive $packagePath -DestinationPath "C:\Program Files";
+			} elseif (Test-Path $packagePath) {
+				# Without a checksum, never install a package unless every program and script in it is signed by Microsoft
+				Remove-Item -Recurse -Force -Path $stagingDir -ErrorAction SilentlyContinue;
+				Expand-Archive $packagePath -DestinationPath $stagingDir;
+				$unsigned = Get-ChildItem -Path $stagingDir -Recurse -Include *.exe,*.dll,*.ps1 | Where-Object {
+					$signature = Get-AuthenticodeSignature -FilePath $_.FullName;
+					$signature.Status -ne "Valid" -or $signature.SignerCertificate.Subject -notmatch "O=Microsoft Corporation"
+				};
+				if ($unsigned -or !(Test-Path "$stagingDir\OpenSSH-Win64\install-sshd.ps1")) {
+					Remove-Item -Recurse -Force -Path $stagingDir -ErrorAction SilentlyContinue;
+					Remove-Item -Path $packagePath -ErrorAction SilentlyContinue;
+					throw "the OpenSSH package on the instance was not signed by Microsoft, so it was not installed"
+				}
+				Move-Item -Path "$stagingDir\OpenSSH-Win64" -Destination "C:\Program Files\OpenSSH-Win64";
+				Remove-Item -Recurse -Force -Path $stagingDir;
+			}
+			Remove-Item -Path $packagePath -ErrorAction SilentlyContinue;
+		}
+
+		if (Test-Path "C:\Program Files\OpenSSH-Win64\install-sshd.ps1") {
+			Set-Location -Path "C:\Program Files\OpenSSH-Win64\";
+			powershell.exe -ExecutionPolicy Bypass -File install-sshd.ps1;
+			if ($LASTEXITCODE -ne 0) { throw "install-sshd.ps1 failed with exit code $LASTEXITCODE" }
+		}
 	}
-		
-	Set-Location -Path "C:\Program Files\OpenSSH-Win64\";
-	powershell.exe -ExecutionPolicy Bypass -File install-sshd.ps1;
-	
+
 	net start sshd;
+	if ($LASTEXITCODE -ne 0) { throw "net start sshd failed with exit code $LASTEXITCODE" }
 }
+`
 
-
+const windowsConfigureSSHPortPowershellScript = `
 $sshConfig = "C:\ProgramData\ssh\sshd_config";
 
 if (!(Get-Content $sshConfig | Select-String -Pattern "^Port $port$")) {
@@ -62,6 +153,7 @@ if (!(Get-Content $sshConfig | Select-String -Pattern "^Port $port$")) {
 	# Restart service
 	net stop sshd;
 	net start sshd;
+	if ($LASTEXITCODE -ne 0) { throw "net start sshd failed with exit code $LASTEXITCODE" }
 }
 
 # Add SSH to the path
@@ -69,7 +161,9 @@ $path = [System.Environment]::GetEnvironmentVariable("PATH") -split ";"
 if (!($path -contains "C:\Program Files\OpenSSH-Win64")) {
 	setx PATH "$env:PATH;C:\Program Files\OpenSSH-Win64" -m;
 }
+`
 
+const windowsAddPublicKeyPowershellScript = `
 # Create C:\Users\gl-user-server\.ssh\authorized_keys file if it doesn't already exist
 if (!(Test-Path "C:\Users\gl-user-server\.ssh\")) {
 	New-Item -Path "C:\Users\gl-user-server\.ssh\" -ItemType Directory;
@@ -79,8 +173,84 @@ if (!(Test-Path "C:\Users\gl-user-server\.ssh\authorized_keys")) {
 	New-Item -Path "C:\Users\gl-user-server\.ssh\authorized_keys" -ItemType File;
 }
 
-# Add public key to authorized keys file
-if (!(Select-String -Path C:\Users\gl-user-server\.ssh\authorized_keys -Pattern $publicKey)) {
-	Add-Content -Path "C:\Users\gl-user-server\.ssh\authorized_keys" -Value $publicKey;
+# Add public key to authorized keys file, a key that was already authorized is never marked, so it is kept when access is revoked
+if (!(Select-String -Path C:\Users\gl-user-server\.ssh\authorized_keys -SimpleMatch -Pattern $publicKeyData)) {
+	Add-Content -Path "C:\Users\gl-user-server\.ssh\authorized_keys" -Value $authorizedKey;
+}
+`
+
+// windowsIsSSHInstalledCommands will generate the commands needed to check if an SSH server is already installed on the instance.
+// The session output will contain sshInstalledMarker, or sshMissingMarker.
+func windowsIsSSHInstalledCommands() []sessionStep {
+	return []sessionStep{{
+		name: "check if sshd is installed",
+		command: fmt.Sprintf("if (Get-Service sshd -ErrorAction SilentlyContinue) { Write-Host (\"%s\" + \"%s\") } else { Write-Host (\"%s\" + \"%s\") };\r\n",
+			sshStateMarkerStart, sshInstalledMarkerEnd, sshStateMarkerStart, sshMissingMarkerEnd),
+	}}
+}
+
+const (
+	// sshInstalledMarker and sshMissingMarker are written by windowsIsSSHInstalledCommands, they are built out of two halves like hostKeysEndMarker
+	sshInstalledMarker    = sshStateMarkerStart + sshInstalledMarkerEnd
+	sshMissingMarker      = sshStateMarkerStart + sshMissingMarkerEnd
+	sshStateMarkerStart   = "FBUT_SSH_"
+	sshInstalledMarkerEnd = "INSTALLED"
+	sshMissingMarkerEnd   = "MISSING"
+)
+
+// windowsFileUploadFormat writes files in PowerShell. A failed upload fails its command, and sets $uploadFailed so the update script is never run.
+var windowsFileUploadFormat = fileUploadFormat{
+	start: func(encodedPath string) string {
+		return fmt.Sprintf("[IO.File]::WriteAllText(\"%s\", \"\");\r\n", encodedPath)
+	},
+	chunk: func(encodedPath string, chunk string) string {
+		return fmt.Sprintf("[IO.File]::AppendAllText(\"%s\", \"%s\");\r\n", encodedPath, chunk)
+	},
+	finish: func(encodedPath string, remotePath string, sha256 string) string {
+		return fmt.Sprintf("[IO.File]::WriteAllBytes(\"%s\", [Convert]::FromBase64String([IO.File]::ReadAllText(\"%s\"))); Remove-Item -Path \"%s\"; "+
+			"if ((Get-FileHash -Algorithm SHA256 -Path \"%s\").Hash -ne \"%s\") { Remove-Item -Path \"%s\"; $uploadFailed=$true; Write-Host (\"%s\" + \"%s\"); throw \"%s did not match its checksum after it was copied\" };\r\n",
+			remotePath, encodedPath, encodedPath, remotePath, sha256, remotePath, uploadFailedMarkerStart, uploadFailedMarkerEnd, remotePath)
+	},
+}
+
+// windowsSSMRunUpdateScriptCommands will generate the commands needed to run the update script in an SSM session, once every file has been copied.
+// The script is skipped if any upload failed.
+func windowsSSMRunUpdateScriptCommands(updateScriptCommand string) []sessionStep {
+	return []sessionStep{{
+		name: runUpdateScriptStep,
+		command: fmt.Sprintf("if (!$uploadFailed) { Write-Host (\"%s\" + \"%s\"); %s; Write-Host (\"%s\" + \"%s\" + $LASTEXITCODE) };\r\n",
+			updateMarkerStart, updateStartedMarkerEnd, updateScriptCommand, updateMarkerStart, updateExitMarkerEnd),
+	}}
 }
+
+// windowsRevokeSSHCommands will generate the commands needed to remove the key installed by windowsSSHEnableCommands.
+// Only the line windowsSSHEnableCommands added is removed, the key is left in place if it was authorized before this application added it.
+// If stopSSHServer is true, sshd will also be stopped, and the firewall rule created by this application will be removed.
+func windowsRevokeSSHCommands(localPublicKey string, stopSSHServer bool) []sessionStep {
+	commands := []sessionStep{
+		{name: "set session variables", command: fmt.Sprintf("$authorizedKey=\"%s\";\r\n", markedAuthorizedKey(localPublicKey))},
+		{name: "remove public key from authorized_keys", command: windowsRevokeSSHPowershellScript},
+	}
+
+	if stopSSHServer {
+		commands = append(commands,
+			sessionStep{name: "set session variables", command: fmt.Sprintf("$firewallRuleName=\"%s\";\r\n", windowsFirewallRuleName)},
+			sessionStep{name: "stop sshd", command: windowsStopSSHPowershellScript})
+	}
+
+	return commands
+}
+
+const windowsRevokeSSHPowershellScript = `
+$authorizedKeys = "C:\Users\gl-user-server\.ssh\authorized_keys";
+if (Test-Path $authorizedKeys) {
+	# Remove the line we added, and leave every other key in place
+	$remainingKeys = @(Get-Content -Path $authorizedKeys | Where-Object { $_.Trim() -ne $authorizedKey });
+	Set-Content -Path $authorizedKeys -Value $remainingKeys;
+}
+`
+
+const windowsStopSSHPowershellScript = `
+net stop sshd;
+Remove-NetFirewallRule -Name $firewallRuleName -ErrorAction SilentlyContinue;
 `
@@ -0,0 +1,462 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+)
+
+// ssmCommandSession is used to run a list of commands on a remote instance through an interactive SSM session.
+// Each command is wrapped by the protocol, so the session knows exactly when a command is done, and whether it failed, without relying on the shell prompt.
+type ssmCommandSession struct {
+	logger               *slog.Logger
+	instance             *gamelift.Instance
+	instanceAccessGetter GameLiftInstanceAccessGetter
+	protocol             commandProtocol
+	pty                  PTY
+
+	// log receives the output of each step, it may be nil. logFilePath is where that log is stored, so errors can point to it.
+	log         io.Writer
+	logFilePath string
+}
+
+// Run will start an SSM session on the instance, and run each of the steps provided in order.
+// Any output from the remote session is passed to onOutput as it is received.
+// If a step fails, the remaining steps are skipped and a *RemoteCommandError is returned.
+func (s *ssmCommandSession) Run(ctx context.Context, steps []sessionStep, onOutput func(output string)) error {
+	return s.RunCommands(ctx, newSessionCommands(steps...), onOutput)
+}
+
+// RunCommands is the same as Run, but each command is only generated right before it is sent to the instance
+func (s *ssmCommandSession) RunCommands(ctx context.Context, commands *sessionCommands, onOutput func(output string)) error {
+	defer s.pty.Cleanup()
+
+	// Get remote instance access credentials
+	accessCredentials, err := s.instanceAccessGetter.GetInstanceAccess(ctx, s.instance.FleetId, s.instance.InstanceId)
+	if err != nil {
+		return err
+	}
+
+	// Add AWS access credential environment variables
+	env := os.Environ()
+	env = append(env, envVar("AWS_REGION", s.instance.Region))
+	env = append(env, envVar("AWS_ACCESS_KEY_ID", accessCredentials.AccessKeyId))
+	env = append(env, envVar("AWS_SECRET_ACCESS_KEY", accessCredentials.SecretAccessKey))
+	env = append(env, envVar("AWS_SESSION_TOKEN", accessCredentials.SessionToken))
+
+	// A new id for each session, so output from any other session can never be mistaken for one of our markers
+	sessionId, err := newCommandSessionId()
+	if err != nil {
+		return err
+	}
+
+	err = s.pty.Start(awsCommand, []string{"ssm", "start-session", "--target", s.instance.InstanceId}, env)
+	if err != nil {
+		return err
+	}
+
+	// Set up an io.Writer to handle the remote output of the SSM session
+	ioWriter := newPtyWriter(sessionId, onOutput, s.log)
+
+	// Start a goroutine to copy the output from the SSM session to our writer
+	go func() {
+		_, err := io.Copy(ioWriter, s.pty.Reader())
+		if err != nil && !errors.Is(err, os.ErrClosed) && errors.Is(err, io.EOF) {
+			s.logger.Warn("error copying pty commands from remote instance", "err", err)
+		}
+	}()
+
+	// Start a goroutine to actually send the commands to the remote session
+	sessionDone := make(chan struct{})
+	commandsDone := make(chan error, 1)
+	go func() {
+		commandsDone <- s.sendCommands(commands, sessionId, ioWriter, sessionDone)
+	}()
+
+	// Wait for the SSM session to finish
+	err = s.pty.Wait()
+	close(sessionDone)
+
+	return errors.Join(<-commandsDone, err)
+}
+
+// sendCommands sends each command to the session once the previous one is done, and then ends the session.
+// It stops early if a command fails, or the session ends before every command is done.
+func (s *ssmCommandSession) sendCommands(commands *sessionCommands, sessionId string, ioWriter *ptyWriter, sessionDone chan struct{}) error {
+	// Only start typing once the session has connected to the instance
+	select {
+	case <-ioWriter.sessionStarted:
+	case <-sessionDone:
+		return errors.New("ssm session ended before it started")
+	case <-time.After(sessionStartTimeout):
+		s.logger.Warn("timed out waiting for the ssm session to start, sending commands anyway")
+	}
+
+	var result error
+	for i := 0; i < commands.Len() && result == nil; i++ {
+		step, err := commands.Command(i)
+		if err != nil {
+			result = err
+			break
+		}
+
+		s.logger.Debug("running remote command", "commandNumber", i, "step", step.name)
+		ioWriter.setStep(i, step.name)
+
+		err = s.pty.RunCommand(s.protocol.wrap(step.command, sessionId, i))
+		if err != nil {
+			result = fmt.Errorf("error sending remote command %d (%s): %w", i, step.name, err)
+			break
+		}
+
+		select {
+		case done := <-ioWriter.commandDone:
+			if done.index != i {
+				result = fmt.Errorf("remote command %d finished while waiting for command %d", done.index, i)
+			} else if done.exitCode != 0 {
+				result = s.commandError(i, step.name, done.exitCode, done.output)
+			}
+		case <-sessionDone:
+			return s.commandError(i, step.name, sessionEndedExitCode, "")
+		}
+	}
+
+	if err := s.pty.RunCommand(s.protocol.exit); err != nil {
+		s.logger.Warn("error ending ssm session", "err", err)
+	}
+
+	return result
+}
+
+func (s *ssmCommandSession) commandError(index int, step string, exitCode int, output string) *RemoteCommandError {
+	return &RemoteCommandError{
+		CommandIndex: index,
+		Step:         step,
+		ExitCode:     exitCode,
+		Output:       output,
+		LogFilePath:  s.logFilePath,
+	}
+}
+
+const (
+	// sessionStartTimeout is how long to wait for an SSM session to connect before the first command is sent anyway
+	sessionStartTimeout = 30 * time.Second
+
+	// sessionStartedOutput is written by the session manager plugin once it has connected to the instance
+	sessionStartedOutput = "Starting session with SessionId"
+
+	// commandMarkerStart starts the markers written before, and after each command. Like hostKeysEndMarker, the protocols
+	// build the markers out of two halves so the echoed commands themselves do not contain them.
+	commandMarkerStart = "FBUT_CMD_"
+
+	// maxCommandErrorOutput is the most output of a failed command that is kept for its error
+	maxCommandErrorOutput = 2048
+
+	// sessionEndedExitCode is the exit code of a RemoteCommandError when the session ended before the command finished
+	sessionEndedExitCode = -1
+)
+
+var (
+	// commandMarkerRegex matches the BEGIN_<session id>_<index> and END_<session id>_<index>:<exit code> markers
+	commandMarkerRegex = regexp.MustCompile(commandMarkerStart + `(BEGIN|END)_([0-9a-f]+)_(\d+)(?::(\d+))?`)
+
+	// terminalEscapeRegex matches the escape sequences a terminal uses for colors, and moving the cursor
+	terminalEscapeRegex = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07]*\x07|[()][0-9A-Za-z])`)
+)
+
+// commandProtocol is how the shell of an operating system wraps each command sent to an SSM session
+type commandProtocol struct {
+	// wrap will surround command with the begin and end markers for the command at index. The end marker must include the exit code of the command.
+	wrap func(command string, sessionId string, index int) string
+	// exit will end the session
+	exit string
+}
+
+// RemoteCommandError is returned when a step run in an SSM session fails
+type RemoteCommandError struct {
+	// CommandIndex is the index of the command that failed
+	CommandIndex int
+	// Step is the name of the step the command is part of
+	Step string
+	// ExitCode is the exit code of the command, it is negative if the session ended before the command finished
+	ExitCode int
+	// Output is the start of the output of the command
+	Output string
+	// LogFilePath is the log that holds the full output of the session, it is empty when the output was not logged
+	LogFilePath string
+}
+
+func (r *RemoteCommandError) Error() string {
+	var message string
+	if r.ExitCode == sessionEndedExitCode {
+		message = fmt.Sprintf("ssm session ended before step %q finished", r.Step)
+	} else {
+		message = fmt.Sprintf("step %q failed with exit code %d", r.Step, r.ExitCode)
+	}
+
+	if r.Output != "" {
+		message += ": " + r.Output
+	}
+
+	if r.LogFilePath != "" {
+		message += fmt.Sprintf("; Check logs in %s for more information", r.LogFilePath)
+	}
+
+	return message
+}
+
+func newCommandSessionId() (string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// sessionStep is a single command run in an ssmCommandSession. name describes what the command does, so a failure can say which step failed.
+type sessionStep struct {
+	name    string
+	command string
+}
+
+// sessionCommands is a list of commands to run in an ssmCommandSession.
+// Commands can be added as a generator, so large files can be sent to an instance without holding all of them in memory.
+type sessionCommands struct {
+	groups []commandGroup
+}
+
+// commandGroup is a run of count commands for the same step, they are generated by calling command with the index of each command in the group
+type commandGroup struct {
+	step    string
+	count   int
+	command func(i int) (string, error)
+}
+
+func newSessionCommands(steps ...sessionStep) *sessionCommands {
+	result := &sessionCommands{}
+	result.Add(steps...)
+	return result
+}
+
+// Add steps to the end of the list
+func (c *sessionCommands) Add(steps ...sessionStep) {
+	for _, step := range steps {
+		step := step
+		c.AddGenerated(step.name, 1, func(i int) (string, error) {
+			return step.command, nil
+		})
+	}
+}
+
+// AddGenerated adds count commands for step to the end of the list, each of them is generated by calling command right before it is sent
+func (c *sessionCommands) AddGenerated(step string, count int, command func(i int) (string, error)) {
+	c.groups = append(c.groups, commandGroup{step: step, count: count, command: command})
+}
+
+// Len returns the number of commands in the list
+func (c *sessionCommands) Len() int {
+	result := 0
+	for _, group := range c.groups {
+		result += group.count
+	}
+	return result
+}
+
+// Command generates the command at index i
+func (c *sessionCommands) Command(i int) (sessionStep, error) {
+	for _, group := range c.groups {
+		if i < group.count {
+			command, err := group.command(i)
+			return sessionStep{name: group.step, command: command}, err
+		}
+		i -= group.count
+	}
+	return sessionStep{}, fmt.Errorf("command %d is out of range", i)
+}
+
+// commandResult is the result of a single command parsed out of the session output
+type commandResult struct {
+	index    int
+	exitCode int
+	output   string
+}
+
+// ptyWriter is used to handle writing, and parsing output from the remote SSM session.
+// Output is parsed a line at a time, since a marker can be split across several writes.
+// Only the output between the markers of each command is written to log, so the echoed commands are left out.
+type ptyWriter struct {
+	sessionId      string
+	onOutput       func(output string)
+	log            io.Writer
+	sessionStarted chan struct{}
+	commandDone    chan commandResult
+
+	stepMutex sync.Mutex
+	stepIndex int
+	stepName  string
+
+	started       bool
+	inCommand     bool
+	loggedStep    string
+	partialLine   string
+	commandOutput strings.Builder
+}
+
+func newPtyWriter(sessionId string, onOutput func(output string), log io.Writer) *ptyWriter {
+	if log == nil {
+		log = io.Discard
+	}
+
+	return &ptyWriter{
+		sessionId:      sessionId,
+		onOutput:       onOutput,
+		log:            log,
+		sessionStarted: make(chan struct{}),
+		commandDone:    make(chan commandResult, 1),
+	}
+}
+
+// setStep sets the name of the step of the command at index, it is called before the command is sent
+func (w *ptyWriter) setStep(index int, name string) {
+	w.stepMutex.Lock()
+	defer w.stepMutex.Unlock()
+	w.stepIndex = index
+	w.stepName = name
+}
+
+func (w *ptyWriter) step(index int) string {
+	w.stepMutex.Lock()
+	defer w.stepMutex.Unlock()
+	if index != w.stepIndex {
+		return ""
+	}
+	return w.stepName
+}
+
+func (w *ptyWriter) Write(p []byte) (int, error) {
+	terminalOutputStr := string(p)
+
+	if w.onOutput != nil {
+		w.onOutput(terminalOutputStr)
+	}
+
+	lines := strings.Split(w.partialLine+terminalOutputStr, "\n")
+	// The last line isn't complete yet, keep it until the rest of it is written
+	w.partialLine = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		w.handleLine(terminalEscapeRegex.ReplaceAllString(strings.TrimRight(line, "\r"), ""))
+	}
+
+	return len(p), nil
+}
+
+func (w *ptyWriter) handleLine(line string) {
+	if !w.started && strings.Contains(line, sessionStartedOutput) {
+		w.started = true
+		close(w.sessionStarted)
+		return
+	}
+
+	match := commandMarkerRegex.FindStringSubmatch(line)
+	if match == nil || match[2] != w.sessionId {
+		if !w.inCommand {
+			return
+		}
+		_, _ = fmt.Fprintln(w.log, line)
+		if w.commandOutput.Len() < maxCommandErrorOutput {
+			w.commandOutput.WriteString(line + "\n")
+		}
+		return
+	}
+
+	index, _ := strconv.Atoi(match[3])
+
+	if match[1] == "BEGIN" {
+		w.inCommand = true
+		w.commandOutput.Reset()
+		// A step can be many commands (eg. each chunk of a file), only name it once
+		if step := w.step(index); step != w.loggedStep {
+			w.loggedStep = step
+			_, _ = fmt.Fprintf(w.log, "==> %s\n", step)
+		}
+		return
+	}
+
+	exitCode, _ := strconv.Atoi(match[4])
+	result := commandResult{index: index, exitCode: exitCode, output: strings.TrimSpace(w.commandOutput.String())}
+	w.inCommand = false
+	w.commandOutput.Reset()
+	if exitCode != 0 {
+		_, _ = fmt.Fprintf(w.log, "<== %s failed with exit code %d\n", w.loggedStep, exitCode)
+	}
+
+	// Only one command runs at a time, never block the session output if a result is not being waited on
+	select {
+	case w.commandDone <- result:
+	default:
+	}
+}
+
+// sessionOutput collects the output of an SSM session, and signals once one of its markers has been written.
+// A marker may be split across several writes from the session, so the full output is kept.
+type sessionOutput struct {
+	mutex       sync.Mutex
+	output      strings.Builder
+	markers     []string
+	markerFound chan struct{}
+	closeFound  sync.Once
+}
+
+func newSessionOutput(markers ...string) *sessionOutput {
+	return &sessionOutput{markers: markers, markerFound: make(chan struct{})}
+}
+
+// Write adds output from the session, it can be used as the onOutput callback of ssmCommandSession.Run
+func (o *sessionOutput) Write(output string) {
+	o.mutex.Lock()
+	// Only search the new output, and enough of the old output to find a marker that was split across writes
+	searchFrom := o.output.Len()
+	o.output.WriteString(output)
+	found := false
+	for _, marker := range o.markers {
+		start := max(0, searchFrom-len(marker)+1)
+		if strings.Contains(o.output.String()[start:], marker) {
+			found = true
+		}
+	}
+	o.mutex.Unlock()
+
+	if found {
+		o.closeFound.Do(func() { close(o.markerFound) })
+	}
+}
+
+// Wait until one of the markers has been written, or the timeout has passed. It returns false on timeout.
+func (o *sessionOutput) Wait(timeout time.Duration) bool {
+	select {
+	case <-o.markerFound:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// String returns all of the output written so far
+func (o *sessionOutput) String() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.output.String()
+}
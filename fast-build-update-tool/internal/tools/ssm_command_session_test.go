@@ -0,0 +1,227 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+// testWrappedCommandRegex finds the session id, and index in a command wrapped by either protocol
+var testWrappedCommandRegex = regexp.MustCompile(`BEGIN_([0-9a-f]+)_(\d+)`)
+
+// testShellPTY mocks a remote shell in an SSM session. Each command is echoed back, followed by the output and exit code from respond.
+// The session ends once the exit command is sent, or when respond returns a negative exit code, as if the instance went away mid command.
+func testShellPTY(protocol commandProtocol, respond func(command string) (string, int)) *PTYMock {
+	reader, writer := io.Pipe()
+	outputs := make(chan string, 100)
+	done := make(chan struct{})
+
+	return &PTYMock{
+		CleanupFunc: func() {},
+		ReaderFunc:  func() io.Reader { return reader },
+		StartFunc: func(cmdName string, args []string, env []string) error {
+			go func() {
+				for output := range outputs {
+					_, _ = writer.Write([]byte(output))
+				}
+				_ = writer.Close()
+				close(done)
+			}()
+			outputs <- "\r\nStarting session with SessionId: test-1234\r\n"
+			return nil
+		},
+		RunCommandFunc: func(cmd string) error {
+			if cmd == protocol.exit {
+				close(outputs)
+				return nil
+			}
+
+			match := testWrappedCommandRegex.FindStringSubmatch(cmd)
+			output, exitCode := respond(cmd)
+			// Echo the command back like a terminal would
+			outputs <- fmt.Sprintf("%s\r\n%sBEGIN_%s_%s\r\n%s\r\n", cmd, commandMarkerStart, match[1], match[2], output)
+
+			if exitCode < 0 {
+				close(outputs)
+				return nil
+			}
+
+			outputs <- fmt.Sprintf("%sEND_%s_%s:%d\r\n", commandMarkerStart, match[1], match[2], exitCode)
+			return nil
+		},
+		WaitFunc: func() error {
+			<-done
+			return nil
+		},
+	}
+}
+
+// testJoinSteps joins the commands of every step, so tests can check what is sent to an instance
+func testJoinSteps(steps []sessionStep) string {
+	commands := ""
+	for _, step := range steps {
+		commands += step.command
+	}
+	return commands
+}
+
+func testCommandSession(protocol commandProtocol, pty PTY) *ssmCommandSession {
+	return &ssmCommandSession{
+		logger:   NewTestLogger(),
+		instance: &gamelift.Instance{FleetId: "f-1234", InstanceId: "i-1234"},
+		instanceAccessGetter: &GameLiftInstanceAccessGetterMock{
+			GetInstanceAccessFunc: func(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error) {
+				return &gamelift.InstanceAccessCredentials{}, nil
+			},
+		},
+		protocol: protocol,
+		pty:      pty,
+	}
+}
+
+// TestSSMCommandSessionRun ensures that every command is run in order, and the session is ended once they are done
+func TestSSMCommandSessionRun(t *testing.T) {
+	pty := testShellPTY(linuxCommandProtocol, func(command string) (string, int) {
+		return "ran " + testWrappedCommandRegex.FindStringSubmatch(command)[2], 0
+	})
+
+	output := &strings.Builder{}
+	steps := []sessionStep{{name: "first step", command: "first;\n"}, {name: "second step", command: "second;\n"}}
+	err := testCommandSession(linuxCommandProtocol, pty).Run(context.Background(), steps, func(o string) { output.WriteString(o) })
+	assert.Nil(t, err)
+
+	calls := pty.RunCommandCalls()
+	assert.Len(t, calls, 3)
+	assert.Contains(t, calls[0].Cmd, "\nfirst;\n")
+	assert.Contains(t, calls[1].Cmd, "\nsecond;\n")
+	assert.Equal(t, "exit\n", calls[2].Cmd)
+	assert.Contains(t, output.String(), "ran 0")
+	assert.Contains(t, output.String(), "ran 1")
+	assert.Len(t, pty.CleanupCalls(), 1)
+}
+
+// TestSSMCommandSessionCommandFailed ensures that the commands after a failed command are skipped, and the error names the failed step and its log
+func TestSSMCommandSessionCommandFailed(t *testing.T) {
+	pty := testShellPTY(windowsCommandProtocol, func(command string) (string, int) {
+		if strings.Contains(command, "Bad-Command") {
+			return "The term 'Bad-Command' is not recognized", 1
+		}
+		return "good output", 0
+	})
+
+	session := testCommandSession(windowsCommandProtocol, pty)
+	log := &strings.Builder{}
+	session.log = log
+	session.logFilePath = "i-1234-ssm-enable.log"
+
+	steps := []sessionStep{
+		{name: "good step", command: "Good-Command;\r\n"},
+		{name: "bad step", command: "Bad-Command;\r\n"},
+		{name: "never run", command: "Never-Run;\r\n"},
+	}
+	err := session.Run(context.Background(), steps, nil)
+
+	var commandErr *RemoteCommandError
+	assert.ErrorAs(t, err, &commandErr)
+	assert.Equal(t, 1, commandErr.CommandIndex)
+	assert.Equal(t, "bad step", commandErr.Step)
+	assert.Equal(t, 1, commandErr.ExitCode)
+	assert.Equal(t, "The term 'Bad-Command' is not recognized", commandErr.Output)
+	assert.Equal(t, "i-1234-ssm-enable.log", commandErr.LogFilePath)
+	assert.EqualError(t, err, "step \"bad step\" failed with exit code 1: The term 'Bad-Command' is not recognized; Check logs in i-1234-ssm-enable.log for more information")
+
+	// Only the output of each step is logged, the echoed commands are left out
+	assert.Equal(t, "==> good step\ngood output\n==> bad step\nThe term 'Bad-Command' is not recognized\n<== bad step failed with exit code 1\n", log.String())
+
+	calls := pty.RunCommandCalls()
+	assert.Len(t, calls, 3)
+	assert.Equal(t, "exit\r\n", calls[2].Cmd)
+}
+
+// TestSSMCommandSessionEndedEarly ensures that an error is returned, rather than hanging, when the session ends before every command is done
+func TestSSMCommandSessionEndedEarly(t *testing.T) {
+	pty := testShellPTY(linuxCommandProtocol, func(command string) (string, int) {
+		return "", -1
+	})
+
+	steps := []sessionStep{{name: "never finishes", command: "never-finishes;\n"}, {name: "second step", command: "second;\n"}}
+	err := testCommandSession(linuxCommandProtocol, pty).Run(context.Background(), steps, nil)
+	assert.EqualError(t, err, "ssm session ended before step \"never finishes\" finished")
+}
+
+// TestPtyWriterSplitMarker ensures that markers are found when they are split across writes, and surrounded by terminal escape sequences
+func TestPtyWriterSplitMarker(t *testing.T) {
+	writer := newPtyWriter("abcd1234", nil, nil)
+
+	_, _ = writer.Write([]byte("Starting session with Sess"))
+	_, _ = writer.Write([]byte("ionId: test-1234\r\n"))
+	select {
+	case <-writer.sessionStarted:
+	case <-time.After(time.Second):
+		assert.Fail(t, "session start was not found")
+	}
+
+	_, _ = writer.Write([]byte("FBUT_CMD_BEGIN_abcd1234_3\r\nsome \x1b[31moutput\x1b[0m\r\n\x1b[?25lFBUT_CMD_EN"))
+	_, _ = writer.Write([]byte("D_abcd1234_3:2"))
+	_, _ = writer.Write([]byte("\r\n"))
+
+	select {
+	case result := <-writer.commandDone:
+		assert.Equal(t, commandResult{index: 3, exitCode: 2, output: "some output"}, result)
+	case <-time.After(time.Second):
+		assert.Fail(t, "command result was not found")
+	}
+}
+
+// TestPtyWriterIgnoresOtherSessions ensures that markers from another session are treated as plain output
+func TestPtyWriterIgnoresOtherSessions(t *testing.T) {
+	writer := newPtyWriter("abcd1234", nil, nil)
+
+	_, _ = writer.Write([]byte("FBUT_CMD_END_ffff0000_0:0\r\n"))
+	assert.Len(t, writer.commandDone, 0)
+}
+
+// TestCommandProtocolWrap ensures that wrapped commands never contain a whole marker, since the terminal echoes every command back
+func TestCommandProtocolWrap(t *testing.T) {
+	for _, os := range []config.OperatingSystem{config.OperatingSystemLinux, config.OperatingSystemWindows} {
+		protocol := linuxCommandProtocol
+		if os == config.OperatingSystemWindows {
+			protocol = windowsCommandProtocol
+		}
+
+		wrapped := protocol.wrap("some-command;\n\n", "abcd1234", 7)
+		assert.Contains(t, wrapped, "some-command;")
+		assert.Contains(t, wrapped, "BEGIN_abcd1234_7")
+		assert.Contains(t, wrapped, "END_abcd1234_7:")
+		assert.NotRegexp(t, commandMarkerRegex, wrapped)
+	}
+}
+
+// TestWindowsCommandProtocolBlankLines ensures that blank lines are removed from PowerShell scripts, so they run as a single block
+func TestWindowsCommandProtocolBlankLines(t *testing.T) {
+	wrapped := windowsCommandProtocol.wrap("\nif ($a) {\n\tWrite-Host a\n}\n\n\r\n$b = 1;\n", "abcd1234", 0)
+	assert.Contains(t, wrapped, "if ($a) {\r\n\tWrite-Host a\r\n}\r\n$b = 1;")
+	assert.NotContains(t, wrapped, "\n\r\n")
+	assert.NotContains(t, wrapped, "\n\n")
+}
+
+// TestSessionOutputSplitMarker ensures that a marker is found even when it is split across several writes
+func TestSessionOutputSplitMarker(t *testing.T) {
+	output := newSessionOutput("FIRST_MARKER", "SECOND_MARKER")
+
+	output.Write("some output SECOND_")
+	assert.False(t, output.Wait(time.Millisecond))
+
+	output.Write("MARK")
+	output.Write("ER more output")
+	assert.True(t, output.Wait(time.Millisecond))
+	assert.Equal(t, "some output SECOND_MARKER more output", output.String())
+}
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+)
+
+// uploadChunkSize is the number of base64 characters sent to the instance in a single command.
+// It is a multiple of 4 so each chunk can be encoded on its own, and it is kept well below the line limit of a terminal.
+const uploadChunkSize = 3072
+
+const (
+	// uploadFailedMarker is written by the remote instance when an uploaded file did not match its checksum.
+	// Like hostKeysEndMarker, it is built out of two halves so the echoed command itself does not contain the marker.
+	uploadFailedMarker      = uploadFailedMarkerStart + uploadFailedMarkerEnd
+	uploadFailedMarkerStart = "FBUT_UPLOAD_"
+	uploadFailedMarkerEnd   = "FAILED"
+)
+
+// fileUploadFormat holds the commands an operating system uses to write a base64 encoded file through an interactive session
+type fileUploadFormat struct {
+	// start creates an empty file at encodedPath
+	start func(encodedPath string) string
+	// chunk appends a chunk of base64 to encodedPath
+	chunk func(encodedPath string, chunk string) string
+	// finish decodes encodedPath into remotePath, and verifies its checksum
+	finish func(encodedPath string, remotePath string, sha256 string) string
+}
+
+// addFileUploadCommands adds the commands needed to copy localPath to remotePath through an interactive session.
+// The file is sent as base64 in chunks, and each chunk is only read from disk right before it is sent.
+// Once every chunk has been written, the file is decoded and its SHA-256 is verified on the instance. If it does not match, the file is removed and uploadFailedMarker is written.
+// onProgress is optional, it is called with the size of each chunk as it is sent.
+func addFileUploadCommands(commands *sessionCommands, operatingSystem config.OperatingSystem, localPath string, remotePath string, onProgress UploadProgressHandler) error {
+	var format fileUploadFormat
+	switch operatingSystem {
+	case config.OperatingSystemWindows:
+		format = windowsFileUploadFormat
+	case config.OperatingSystemLinux:
+		format = linuxFileUploadFormat
+	default:
+		return config.UnknownOperatingSystemError(fmt.Sprint(operatingSystem))
+	}
+
+	checksum, size, err := fileChecksum(localPath)
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %w", localPath, err)
+	}
+
+	encodedPath := remotePath + ".b64"
+	chunkBytes := int64(base64.StdEncoding.DecodedLen(uploadChunkSize))
+	chunkCount := int((size + chunkBytes - 1) / chunkBytes)
+
+	step := fmt.Sprintf("copy %s to %s", filepath.Base(localPath), remotePath)
+
+	commands.Add(sessionStep{name: step, command: format.start(encodedPath)})
+	commands.AddGenerated(step, chunkCount, func(i int) (string, error) {
+		chunk, err := readChunk(localPath, int64(i)*chunkBytes, chunkBytes)
+		if err != nil {
+			return "", fmt.Errorf("error reading file %s: %w", localPath, err)
+		}
+		if onProgress != nil {
+			onProgress(int64(len(chunk)))
+		}
+		return format.chunk(encodedPath, base64.StdEncoding.EncodeToString(chunk)), nil
+	})
+	commands.Add(sessionStep{name: step, command: format.finish(encodedPath, remotePath, checksum)})
+
+	return nil
+}
+
+// fileChecksum returns the hex encoded SHA-256, and the size of a local file
+func fileChecksum(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// readChunk reads up to length bytes from path, starting at offset
+func readChunk(path string, offset int64, length int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	chunk := make([]byte, length)
+	n, err := file.ReadAt(chunk, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return chunk[:n], nil
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testUploadedContent reassembles the base64 chunks of an upload, the way the instance would
+func testUploadedContent(t *testing.T, commands *sessionCommands, remotePath string, chunkRegex *regexp.Regexp) []byte {
+	var encoded strings.Builder
+	for i := 0; i < commands.Len(); i++ {
+		step, err := commands.Command(i)
+		assert.Nil(t, err)
+		assert.Equal(t, "copy file.zip to "+remotePath, step.name)
+
+		if match := chunkRegex.FindStringSubmatch(step.command); match != nil {
+			assert.LessOrEqual(t, len(match[1]), uploadChunkSize)
+			encoded.WriteString(match[1])
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded.String())
+	assert.Nil(t, err)
+	return decoded
+}
+
+func testUploadFile(t *testing.T, size int) (string, []byte) {
+	content := make([]byte, size)
+	_, err := rand.Read(content)
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "file.zip")
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	return path, content
+}
+
+// TestAddFileUploadCommandsWindows ensures that the chunks sent to a Windows instance add back up to the original file, are verified, and are reported as they are sent
+func TestAddFileUploadCommandsWindows(t *testing.T) {
+	path, content := testUploadFile(t, uploadChunkSize*2+5)
+	checksum, _, err := fileChecksum(path)
+	assert.Nil(t, err)
+
+	var uploaded int64
+	commands := newSessionCommands()
+	err = addFileUploadCommands(commands, config.OperatingSystemWindows, path, `C:\file.zip`, func(bytes int64) { uploaded += bytes })
+	assert.Nil(t, err)
+	assert.Zero(t, uploaded)
+
+	chunkRegex := regexp.MustCompile(`AppendAllText\("C:\\file\.zip\.b64", "([A-Za-z0-9+/=]*)"\)`)
+	assert.Equal(t, content, testUploadedContent(t, commands, `C:\file.zip`, chunkRegex))
+	assert.Equal(t, int64(len(content)), uploaded)
+
+	finish, err := commands.Command(commands.Len() - 1)
+	assert.Nil(t, err)
+	assert.Contains(t, finish.command, `WriteAllBytes("C:\file.zip"`)
+	assert.Contains(t, finish.command, checksum)
+	assert.Contains(t, finish.command, "throw")
+	assert.NotContains(t, finish.command, uploadFailedMarker)
+}
+
+// TestAddFileUploadCommandsLinux ensures that the chunks sent to a Linux instance add back up to the original file, and are verified
+func TestAddFileUploadCommandsLinux(t *testing.T) {
+	path, content := testUploadFile(t, uploadChunkSize)
+	checksum, _, err := fileChecksum(path)
+	assert.Nil(t, err)
+
+	commands := newSessionCommands()
+	err = addFileUploadCommands(commands, config.OperatingSystemLinux, path, "/tmp/file.zip", nil)
+	assert.Nil(t, err)
+
+	chunkRegex := regexp.MustCompile(`printf '%s' '([A-Za-z0-9+/=]*)' >> /tmp/file\.zip\.b64`)
+	assert.Equal(t, content, testUploadedContent(t, commands, "/tmp/file.zip", chunkRegex))
+
+	finish, err := commands.Command(commands.Len() - 1)
+	assert.Nil(t, err)
+	assert.Contains(t, finish.command, "echo \""+checksum+"  /tmp/file.zip\" | sha256sum -c --status")
+	// A failed checksum must fail the command, so the session stops at this step
+	assert.Contains(t, finish.command, "false; };")
+	assert.NotContains(t, finish.command, uploadFailedMarker)
+}
+
+// TestAddFileUploadCommandsMissingFile ensures that an error is returned when the local file can't be read
+func TestAddFileUploadCommandsMissingFile(t *testing.T) {
+	err := addFileUploadCommands(newSessionCommands(), config.OperatingSystemLinux, "not a real file", "/tmp/file.zip", nil)
+	assert.ErrorContains(t, err, "error reading file not a real file")
+}
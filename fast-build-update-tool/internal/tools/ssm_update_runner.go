@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+)
+
+// SSMUpdateRunner is used to update an instance without SSH.
+// Files are copied to the instance, and the update script is run on it, through a single SSM session.
+type SSMUpdateRunner struct {
+	logger                *slog.Logger
+	instance              *gamelift.Instance
+	instanceAccessGetter  GameLiftInstanceAccessGetter
+	protocol              commandProtocol
+	pty                   PTY
+	remoteUploadDirectory config.RemoteUploadDirectory
+	filesToUpload         []string
+	runCommands           []sessionStep
+	// onOutputLine is optional, when set it is called with each line the update script writes
+	onOutputLine OutputLineHandler
+	// onUploadProgress is optional, when set it is called as each file is copied
+	onUploadProgress UploadProgressHandler
+}
+
+// NewSSMUpdateRunner builds a new SSMUpdateRunner that will copy filesToUpload to the instance, and then run the update script.
+// onOutputLine is optional, when set it is called with each line of output from the update script as it runs.
+// onUploadProgress is optional, when set it is called with the number of bytes sent as each file is copied.
+func NewSSMUpdateRunner(logger *slog.Logger, instance *gamelift.Instance, instanceAccessGetter GameLiftInstanceAccessGetter, localUpdateScriptPath string, filesToUpload []string, onOutputLine OutputLineHandler, onUploadProgress UploadProgressHandler) (*SSMUpdateRunner, error) {
+	updateScriptCommand, err := generateUpdateScriptCommand(localUpdateScriptPath, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	var runCommands []sessionStep
+	var protocol commandProtocol
+
+	switch instance.OperatingSystem {
+	case config.OperatingSystemWindows:
+		runCommands = windowsSSMRunUpdateScriptCommands(updateScriptCommand)
+		protocol = windowsCommandProtocol
+
+	case config.OperatingSystemLinux:
+		runCommands = linuxSSMRunUpdateScriptCommands(updateScriptCommand)
+		protocol = linuxCommandProtocol
+
+	default:
+		return nil, config.UnknownOperatingSystemError(fmt.Sprint(instance.OperatingSystem))
+	}
+
+	pty, err := newPtyCommandRunner()
+	if err != nil {
+		return nil, err
+	}
+
+	runner := &SSMUpdateRunner{
+		logger:                logger.With("context", "SSMUpdateRunner"),
+		instance:              instance,
+		instanceAccessGetter:  instanceAccessGetter,
+		protocol:              protocol,
+		pty:                   pty,
+		remoteUploadDirectory: config.RemoteUploadDirectoryForOperatingSystem(instance.OperatingSystem),
+		filesToUpload:         filesToUpload,
+		runCommands:           runCommands,
+		onOutputLine:          onOutputLine,
+		onUploadProgress:      onUploadProgress,
+	}
+
+	return runner, runner.Validate()
+}
+
+// Validate that the AWS CLI, and the session manager plugin are installed
+func (s *SSMUpdateRunner) Validate() error {
+	if err := verifyExe(awsCommand); err != nil {
+		return err
+	}
+
+	return verifyExe(sessionManagerCommand)
+}
+
+// Run will copy every file to the instance, and then run the update script on it.
+// onScriptStarted is called once every file has been copied, and the update script has started.
+func (s *SSMUpdateRunner) Run(ctx context.Context, onScriptStarted func()) error {
+	transferred := &transferCounter{onProgress: s.onUploadProgress}
+	defer transferred.record(ctx)
+
+	commands := newSessionCommands()
+	for _, file := range s.filesToUpload {
+		s.logger.Debug("adding file to copy to remote instance", "file", file)
+
+		err := addFileUploadCommands(commands, s.instance.OperatingSystem, file, string(s.remoteUploadDirectory)+filepath.Base(file), transferred.add)
+		if err != nil {
+			return err
+		}
+	}
+	commands.Add(s.runCommands...)
+
+	logFilePath := config.GetLogPathForFile(fmt.Sprintf("%s-ssm-command.log", s.instance.InstanceId))
+	// Set up a log file so we log out any output from the update script
+	logFile, err := config.OpenLogFile(logFilePath)
+	if err != nil {
+		return fmt.Errorf("error creating log file for ssm update runner: %w", err)
+	}
+	defer logFile.Close()
+
+	output := &ssmUpdateOutput{
+		log:             logFile,
+		onScriptStarted: onScriptStarted,
+		exitCode:        -1,
+		done:            make(chan struct{}),
+	}
+
+	// Pass on each line of output from the update script as well, so it can be shown while the script runs
+	if s.onOutputLine != nil {
+		lines := newOutputLineWriter(scriptOutputLines(s.onOutputLine), false)
+		defer lines.Flush()
+		output.log = io.MultiWriter(logFile, lines)
+	}
+
+	session := &ssmCommandSession{
+		logger:               s.logger,
+		instance:             s.instance,
+		instanceAccessGetter: s.instanceAccessGetter,
+		protocol:             s.protocol,
+		pty:                  s.pty,
+		// The output of the update script is logged by ssmUpdateOutput, the session only needs to point its errors to the log
+		logFilePath: logFilePath,
+	}
+
+	err = session.RunCommands(ctx, commands, output.Write)
+	if err != nil {
+		return err
+	}
+
+	return output.Result(logFilePath)
+}
+
+const (
+	// updateStartedMarker is written by the remote instance once every file was copied, right before the update script is run.
+	// updateExitMarker is written after the update script is done, followed by its exit code.
+	// Like hostKeysEndMarker, they are built out of two halves so the echoed commands themselves do not contain the markers.
+	updateStartedMarker    = updateMarkerStart + updateStartedMarkerEnd
+	updateMarkerStart      = "FBUT_UPDATE_"
+	updateStartedMarkerEnd = "STARTED"
+	updateExitMarkerEnd    = "EXIT="
+
+	// updateOutputTailLength is how much of the previous output is kept to find a marker that was split across writes
+	updateOutputTailLength = 64
+
+	// runUpdateScriptStep is the name of the step that runs the update script
+	runUpdateScriptStep = "run update script"
+)
+
+var updateExitRegex = regexp.MustCompile(updateMarkerStart + updateExitMarkerEnd + `(\d+)\s`)
+
+// ssmUpdateOutput handles the output of an SSMUpdateRunner session.
+// Only the end of the output is kept, the files that are copied show up in the output and can be very large.
+type ssmUpdateOutput struct {
+	mutex           sync.Mutex
+	tail            string
+	log             io.Writer
+	onScriptStarted func()
+	started         bool
+	uploadFailed    bool
+	exitCode        int
+	done            chan struct{}
+	closeDone       sync.Once
+}
+
+func (o *ssmUpdateOutput) Write(output string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	// Search the end of the previous output as well, in case a marker was split across writes
+	text := o.tail + output
+	o.tail = text[max(0, len(text)-updateOutputTailLength):]
+
+	if !o.started {
+		if strings.Contains(text, uploadFailedMarker) {
+			o.uploadFailed = true
+			o.closeDone.Do(func() { close(o.done) })
+			return
+		}
+
+		index := strings.Index(text, updateStartedMarker)
+		if index < 0 {
+			return
+		}
+
+		o.started = true
+		if o.onScriptStarted != nil {
+			o.onScriptStarted()
+		}
+
+		// Only the output of the update script is logged. The marker was not found in the previous write, so it always ends in this one.
+		output = text[index+len(updateStartedMarker):]
+		text = output
+		o.tail = output[max(0, len(output)-updateOutputTailLength):]
+	}
+
+	o.log.Write([]byte(output))
+
+	if match := updateExitRegex.FindStringSubmatch(text); match != nil {
+		o.exitCode, _ = strconv.Atoi(match[1])
+		o.closeDone.Do(func() { close(o.done) })
+	}
+}
+
+// scriptOutputLines only passes on the output of the update script to handler.
+// The terminal escape sequences, the markers, and anything the shell writes after the script is done are left out.
+func scriptOutputLines(handler OutputLineHandler) OutputLineHandler {
+	done := false
+	return func(line string, isError bool) {
+		line = terminalEscapeRegex.ReplaceAllString(line, "")
+
+		if strings.Contains(line, updateMarkerStart+updateExitMarkerEnd) {
+			done = true
+		}
+
+		if done || strings.TrimSpace(line) == "" {
+			return
+		}
+
+		handler(line, isError)
+	}
+}
+
+// Result waits for the output of the session to be processed, and returns an error if the update did not succeed
+func (o *ssmUpdateOutput) Result(logFilePath string) error {
+	// The session output may still be processing after the session exits
+	select {
+	case <-o.done:
+	case <-time.After(remoteOutputTimeout):
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	switch {
+	case o.uploadFailed:
+		return errors.New("a file did not match its checksum after it was copied to the instance")
+	case !o.started:
+		return errors.New("the update script was never started on the instance")
+	case o.exitCode < 0:
+		return &RemoteCommandError{Step: runUpdateScriptStep, ExitCode: sessionEndedExitCode, LogFilePath: logFilePath}
+	case o.exitCode != 0:
+		return &RemoteCommandError{Step: runUpdateScriptStep, ExitCode: o.exitCode, LogFilePath: logFilePath}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSSMUpdateOutput(onScriptStarted func()) (*ssmUpdateOutput, *strings.Builder) {
+	log := &strings.Builder{}
+	return &ssmUpdateOutput{
+		log:             log,
+		onScriptStarted: onScriptStarted,
+		exitCode:        -1,
+		done:            make(chan struct{}),
+	}, log
+}
+
+// TestNewSSMUpdateRunnerLinux ensures the update script is only run on Linux instances when every upload succeeded
+func TestNewSSMUpdateRunnerLinux(t *testing.T) {
+	testInstallFakeCLIs(t)
+	instance := &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}
+
+	runner, err := NewSSMUpdateRunner(NewTestLogger(), instance, &GameLiftInstanceAccessGetterMock{}, "/local/update-instance.sh", []string{"/local/update-instance.sh"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/", string(runner.remoteUploadDirectory))
+
+	commands := testJoinSteps(runner.runCommands)
+	assert.Contains(t, commands, "if [ -z \"$uploadFailed\" ]; then")
+	assert.Contains(t, commands, "chmod +x /tmp/update-instance.sh && /tmp/update-instance.sh")
+	assert.NotContains(t, commands, updateStartedMarker)
+}
+
+// TestNewSSMUpdateRunnerUnknownOS ensures that an error is returned when the operating system is unknown
+func TestNewSSMUpdateRunnerUnknownOS(t *testing.T) {
+	_, err := NewSSMUpdateRunner(NewTestLogger(), &gamelift.Instance{}, &GameLiftInstanceAccessGetterMock{}, "/local/update-instance.sh", nil, nil, nil)
+	assert.ErrorContains(t, err, "unknown operating system")
+}
+
+// TestSSMUpdateOutputSuccess ensures that only the output of the update script is logged, and markers split across writes are found
+func TestSSMUpdateOutputSuccess(t *testing.T) {
+	started := false
+	output, log := testSSMUpdateOutput(func() { started = true })
+
+	output.Write("printf '%s' 'AAAA' >> /tmp/file.zip.b64;\nsh-5.2$ FBUT_UPD")
+	assert.False(t, started)
+
+	output.Write("ATE_STARTED\nupdating instance\nFBUT_UPDATE_EX")
+	assert.True(t, started)
+
+	output.Write("IT=0\nsh-5.2$ ")
+	assert.Nil(t, output.Result("log-file"))
+	assert.Equal(t, "\nupdating instance\nFBUT_UPDATE_EXIT=0\nsh-5.2$ ", log.String())
+}
+
+// TestSSMUpdateOutputScriptFailed ensures that the exit code of a failed update script is returned
+func TestSSMUpdateOutputScriptFailed(t *testing.T) {
+	output, _ := testSSMUpdateOutput(nil)
+
+	output.Write("FBUT_UPDATE_STARTED\nfailed to acquire update lock\nFBUT_UPDATE_EXIT=1")
+	output.Write("\r\n")
+
+	assert.ErrorContains(t, output.Result("log-file"), "exit code 1; Check logs in log-file")
+}
+
+// TestSSMUpdateOutputUploadFailed ensures that a checksum mismatch is returned as an error
+func TestSSMUpdateOutputUploadFailed(t *testing.T) {
+	output, log := testSSMUpdateOutput(nil)
+
+	output.Write("FBUT_UPLOAD_FAILED\n")
+
+	assert.ErrorContains(t, output.Result("log-file"), "did not match its checksum")
+	assert.Empty(t, log.String())
+}
+
+// TestScriptOutputLines ensures that only the output of the update script is passed on, without escape sequences or what the shell writes after it
+func TestScriptOutputLines(t *testing.T) {
+	var lines []string
+	handler := scriptOutputLines(func(line string, isError bool) { lines = append(lines, line) })
+
+	for _, line := range []string{"\x1b[?2004lunzipping the archive", "", "killing running processes", "FBUT_UPDATE_EXIT=0", "sh-5.2$ exit"} {
+		handler(line, false)
+	}
+
+	assert.Equal(t, []string{"unzipping the archive", "killing running processes"}, lines)
+}
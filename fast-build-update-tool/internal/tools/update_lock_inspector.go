@@ -0,0 +1,242 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+)
+
+// RemoteProcess is a process running on a remote instance
+type RemoteProcess struct {
+	Pid     int
+	Command string
+}
+
+// UpdateLockStatus is the state of the lock the update script takes on an instance, and of anything a run that died may have left behind
+type UpdateLockStatus struct {
+	// LockPath is the lock file (Linux), or named mutex (Windows) the update script takes
+	LockPath string
+	// Held is true if a process holds the lock, so the update script would fail to acquire it
+	Held bool
+	// Holders are the processes that have the lock file open. Windows can't tell which process holds a mutex, so this is always empty there.
+	Holders []RemoteProcess
+	// Scripts are update scripts that are still running, and are not already one of the Holders
+	Scripts []RemoteProcess
+	// Archives are build archives (and partially copied files) left in the upload directory
+	Archives []string
+}
+
+// ProcessIds returns the id of every holder, and update script, found on the instance
+func (u *UpdateLockStatus) ProcessIds() []int {
+	result := make([]int, 0, len(u.Holders)+len(u.Scripts))
+	for _, process := range u.Holders {
+		result = append(result, process.Pid)
+	}
+	for _, process := range u.Scripts {
+		result = append(result, process.Pid)
+	}
+	return result
+}
+
+// UpdateLockInspector is used to find out whether the update lock is held on a remote instance, and to release it when a run died without releasing it.
+// Everything is done over AWS SSM, so it does not depend on SSH access to the instance.
+type UpdateLockInspector struct {
+	logger               *slog.Logger
+	instance             *gamelift.Instance
+	instanceAccessGetter GameLiftInstanceAccessGetter
+	protocol             commandProtocol
+	lockName             string
+
+	inspectCommands func(lockName string) []sessionStep
+	releaseCommands func(lockName string, status *UpdateLockStatus, cleanArchives bool) []sessionStep
+
+	// newPTY creates the pseudo terminal for each SSM session
+	newPTY func() (PTY, error)
+}
+
+// NewUpdateLockInspector builds a new UpdateLockInspector for the lock named lockName on the target instance
+func NewUpdateLockInspector(logger *slog.Logger, instance *gamelift.Instance, instanceAccessGetter GameLiftInstanceAccessGetter, lockName string) (*UpdateLockInspector, error) {
+	inspector := &UpdateLockInspector{
+		logger:               logger.With("context", "UpdateLockInspector"),
+		instance:             instance,
+		instanceAccessGetter: instanceAccessGetter,
+		lockName:             lockName,
+		newPTY: func() (PTY, error) {
+			return newPtyCommandRunner()
+		},
+	}
+
+	switch instance.OperatingSystem {
+	case config.OperatingSystemWindows:
+		inspector.protocol = windowsCommandProtocol
+		inspector.inspectCommands = windowsInspectUpdateLockCommands
+		inspector.releaseCommands = windowsReleaseUpdateLockCommands
+
+	case config.OperatingSystemLinux:
+		inspector.protocol = linuxCommandProtocol
+		inspector.inspectCommands = linuxInspectUpdateLockCommands
+		inspector.releaseCommands = linuxReleaseUpdateLockCommands
+
+	default:
+		return nil, config.UnknownOperatingSystemError(fmt.Sprint(instance.OperatingSystem))
+	}
+
+	return inspector, inspector.Validate()
+}
+
+// Validate that the AWS CLI, and the session manager plugin are installed
+func (u *UpdateLockInspector) Validate() error {
+	if err := verifyExe(awsCommand); err != nil {
+		return err
+	}
+
+	return verifyExe(sessionManagerCommand)
+}
+
+// Inspect will find out whether the update lock is held on the instance, which processes hold it, and which archives were left behind
+func (u *UpdateLockInspector) Inspect(ctx context.Context) (*UpdateLockStatus, error) {
+	return u.run(ctx, u.inspectCommands(u.lockName))
+}
+
+// Release will stop every process in status, and remove the lock file once nothing holds it.
+// When cleanArchives is true the archives in status are removed as well.
+// Only what is in status is touched, so nothing is done that was not shown to the user first. The state of the lock once it is done is returned.
+func (u *UpdateLockInspector) Release(ctx context.Context, status *UpdateLockStatus, cleanArchives bool) (*UpdateLockStatus, error) {
+	u.logger.Debug("releasing update lock", "processIds", status.ProcessIds(), "cleanArchives", cleanArchives)
+
+	steps := u.releaseCommands(u.lockName, status, cleanArchives)
+	return u.run(ctx, append(steps, u.inspectCommands(u.lockName)...))
+}
+
+// run will run steps in an SSM session, and parse the state of the lock written out by the last of them
+func (u *UpdateLockInspector) run(ctx context.Context, steps []sessionStep) (*UpdateLockStatus, error) {
+	logFilePath := config.GetLogPathForFile(fmt.Sprintf("%s-ssm-lock.log", u.instance.InstanceId))
+	// Set up a log file so we log out the output of every step run on the instance
+	logFile, err := config.OpenLogFile(logFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log file for update lock inspector: %w", err)
+	}
+	defer logFile.Close()
+
+	pty, err := u.newPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &ssmCommandSession{
+		logger:               u.logger,
+		instance:             u.instance,
+		instanceAccessGetter: u.instanceAccessGetter,
+		protocol:             u.protocol,
+		pty:                  pty,
+		log:                  logFile,
+		logFilePath:          logFilePath,
+	}
+
+	output := newSessionOutput(updateLockDoneMarker)
+
+	err = session.Run(ctx, steps, output.Write)
+	if err != nil {
+		return nil, err
+	}
+
+	// The session output may still be processing after the session exits
+	if !output.Wait(remoteOutputTimeout) {
+		u.logger.Warn("timed out waiting for the update lock state to be written, using the output received so far")
+	}
+
+	status, err := parseUpdateLockStatus(output.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w; Check logs in %s for more information", err, logFilePath)
+	}
+
+	return status, nil
+}
+
+const (
+	// updateLockMarkerStart starts each line written by the inspect commands. Like hostKeysEndMarker, the commands build it out of two halves so the echoed commands do not contain it.
+	updateLockMarkerStart     = updateLockMarkerStartHead + updateLockMarkerStartTail
+	updateLockMarkerStartHead = "FBUT_"
+	updateLockMarkerStartTail = "LOCK_"
+	updateLockDoneMarker      = updateLockMarkerStart + "DONE"
+)
+
+// updateLockOutputRegex matches the lines the inspect commands write, eg. FBUT_LOCK_HOLDER=1234 /bin/bash /tmp/update-instance.sh
+var updateLockOutputRegex = regexp.MustCompile(updateLockMarkerStart + `(PATH|STATE|HOLDER|SCRIPT|ARCHIVE)=(.*)$`)
+
+// parseUpdateLockStatus will parse the lines written by the inspect commands out of the output of a session
+func parseUpdateLockStatus(output string) (*UpdateLockStatus, error) {
+	if !strings.Contains(output, updateLockDoneMarker) {
+		return nil, errors.New("the state of the update lock was not written by the instance")
+	}
+
+	status := &UpdateLockStatus{}
+	holders := map[int]bool{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = terminalEscapeRegex.ReplaceAllString(strings.TrimRight(line, "\r"), "")
+
+		match := updateLockOutputRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		value := strings.TrimSpace(match[2])
+		switch match[1] {
+		case "PATH":
+			status.LockPath = value
+		case "STATE":
+			status.Held = value == "held"
+		case "HOLDER":
+			if process, ok := parseRemoteProcess(value); ok && !holders[process.Pid] {
+				holders[process.Pid] = true
+				status.Holders = append(status.Holders, process)
+			}
+		case "SCRIPT":
+			// The update script holding the lock is listed as a holder too, it only needs to be listed once
+			if process, ok := parseRemoteProcess(value); ok && !holders[process.Pid] {
+				holders[process.Pid] = true
+				status.Scripts = append(status.Scripts, process)
+			}
+		case "ARCHIVE":
+			status.Archives = append(status.Archives, value)
+		}
+	}
+
+	return status, nil
+}
+
+// parseRemoteProcess parses a process id, followed by the command line of the process
+func parseRemoteProcess(value string) (RemoteProcess, bool) {
+	pid, command, _ := strings.Cut(value, " ")
+	id, err := strconv.Atoi(pid)
+	if err != nil || id <= 0 {
+		return RemoteProcess{}, false
+	}
+	return RemoteProcess{Pid: id, Command: strings.TrimSpace(command)}, true
+}
+
+// joinProcessIds joins ids with separator
+func joinProcessIds(ids []int, separator string) string {
+	result := make([]string, len(ids))
+	for i, id := range ids {
+		result[i] = strconv.Itoa(id)
+	}
+	return strings.Join(result, separator)
+}
+
+// quotedPaths joins every path quoted with quote, with separator between them
+func quotedPaths(paths []string, quote func(string) string, separator string) string {
+	result := make([]string, len(paths))
+	for i, path := range paths {
+		result[i] = quote(path)
+	}
+	return strings.Join(result, separator)
+}
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+)
+
+// linuxUpdateLockPath is the lock file taken by the Linux update script
+func linuxUpdateLockPath(lockName string) string {
+	return fmt.Sprintf("/tmp/%s.lock", lockName)
+}
+
+// linuxIsLockFreeCommand succeeds if nothing holds the lock file at $LOCKFILE. The file is opened without O_CREAT,
+// so it works on a lock file owned by another user in /tmp (where fs.protected_regular would refuse to open it with O_CREAT).
+const linuxIsLockFreeCommand = `sudo sh -c 'exec 9<"$1" && flock -n 9' sh "$LOCKFILE"`
+
+// linuxUpdateScriptPattern matches the command line of the Linux update script. The first letter is in brackets,
+// so pgrep doesn't match its own command line, or that of the shell running it.
+func linuxUpdateScriptPattern() string {
+	scriptName := string(config.UpdateScriptLinuxName)
+	return fmt.Sprintf("[%s]%s", scriptName[:1], regexp.QuoteMeta(scriptName[1:]))
+}
+
+// linuxInspectUpdateLockCommands will generate the commands that write out the state of the update lock, the processes holding it,
+// any update scripts still running, and the archives left in the upload directory
+func linuxInspectUpdateLockCommands(lockName string) []sessionStep {
+	uploadDirectory := string(config.UploadDirectoryLinux)
+
+	return []sessionStep{{
+		name: "inspect update lock",
+		command: strings.Join([]string{
+			fmt.Sprintf(`LOCKFILE="%s"; M="%s""%s"; echo "${M}PATH=$LOCKFILE";`, linuxUpdateLockPath(lockName), updateLockMarkerStartHead, updateLockMarkerStartTail),
+			fmt.Sprintf(`if [ -e "$LOCKFILE" ] && ! %s 2>/dev/null; then echo "${M}STATE=held"; else echo "${M}STATE=free"; fi;`, linuxIsLockFreeCommand),
+			// Every process with the lock file open holds the lock, including children of the update script that inherited it
+			`for PID in $(sudo find /proc -maxdepth 3 -path '/proc/[0-9]*/fd/*' -lname "$LOCKFILE" 2>/dev/null | cut -d/ -f3 | sort -un); do echo "${M}HOLDER=$PID $(ps -o args= -p "$PID")"; done;`,
+			fmt.Sprintf(`for PID in $(pgrep -f '%s'); do echo "${M}SCRIPT=$PID $(ps -o args= -p "$PID")"; done;`, linuxUpdateScriptPattern()),
+			fmt.Sprintf(`for FILE in %[1]s*.zip %[1]s*.tar.gz %[1]s*.tar.zst %[1]s*.b64; do [ -f "$FILE" ] && echo "${M}ARCHIVE=$FILE"; done;`, uploadDirectory),
+			`echo "${M}DONE";`,
+		}, "\n") + "\n",
+	}}
+}
+
+// linuxReleaseUpdateLockCommands will generate the commands that stop every process in status, and remove the lock file once nothing holds it.
+// The archives in status are removed as well when cleanArchives is true.
+func linuxReleaseUpdateLockCommands(lockName string, status *UpdateLockStatus, cleanArchives bool) []sessionStep {
+	commands := []sessionStep{}
+
+	if pids := status.ProcessIds(); len(pids) > 0 {
+		ids := joinProcessIds(pids, " ")
+		// The processes may have exited since they were inspected, and their ids been reused. Each one is only stopped if it
+		// still has the lock file open, or is still an update script.
+		isHolder := fmt.Sprintf(`LOCKFILE="%s"; isHolder() { sudo find "/proc/$1/fd" -maxdepth 1 -lname "$LOCKFILE" 2>/dev/null | grep -q . || pgrep -f '%s' | grep -qx "$1"; };`,
+			linuxUpdateLockPath(lockName), linuxUpdateScriptPattern())
+		// Give the update script a chance to run its clean-up trap before it is killed
+		commands = append(commands, sessionStep{
+			name: "stop update scripts",
+			command: fmt.Sprintf("%s for PID in %s; do isHolder $PID && sudo kill -TERM $PID 2>/dev/null; done; sleep 2; for PID in %s; do isHolder $PID && sudo kill -KILL $PID 2>/dev/null; done; true;\n",
+				isHolder, ids, ids),
+		})
+	}
+
+	commands = append(commands, sessionStep{
+		name:    "remove lock file",
+		command: fmt.Sprintf("LOCKFILE=\"%s\"; if [ -e \"$LOCKFILE\" ] && %s 2>/dev/null; then sudo rm -f \"$LOCKFILE\"; fi;\n", linuxUpdateLockPath(lockName), linuxIsLockFreeCommand),
+	})
+
+	if cleanArchives && len(status.Archives) > 0 {
+		commands = append(commands, sessionStep{
+			name:    "remove archives",
+			command: fmt.Sprintf("sudo rm -f -- %s;\n", quotedPaths(status.Archives, linuxQuote, " ")),
+		})
+	}
+
+	return commands
+}
+
+// linuxQuote quotes value so sh passes it on as a single argument, exactly as it is
+func linuxQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
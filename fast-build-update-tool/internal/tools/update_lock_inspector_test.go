@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
+	"github.com/stretchr/testify/assert"
+)
+
+func testUpdateLockInspector(protocol commandProtocol, respond func(command string) (string, int)) (*UpdateLockInspector, *PTYMock) {
+	pty := testShellPTY(protocol, respond)
+
+	inspector := &UpdateLockInspector{
+		logger:   NewTestLogger(),
+		instance: &gamelift.Instance{FleetId: "f-1234", InstanceId: "i-1234"},
+		instanceAccessGetter: &GameLiftInstanceAccessGetterMock{
+			GetInstanceAccessFunc: func(ctx context.Context, fleetId string, instanceId string) (*gamelift.InstanceAccessCredentials, error) {
+				return &gamelift.InstanceAccessCredentials{}, nil
+			},
+		},
+		protocol:        protocol,
+		lockName:        "my-lock",
+		inspectCommands: linuxInspectUpdateLockCommands,
+		releaseCommands: linuxReleaseUpdateLockCommands,
+		newPTY: func() (PTY, error) {
+			return pty, nil
+		},
+	}
+
+	return inspector, pty
+}
+
+func TestNewUpdateLockInspector(t *testing.T) {
+	testInstallFakeCLIs(t)
+
+	inspector, err := NewUpdateLockInspector(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemLinux}, &GameLiftInstanceAccessGetterMock{}, "my-lock")
+	assert.Nil(t, err)
+	assert.Contains(t, testJoinSteps(inspector.inspectCommands(inspector.lockName)), `LOCKFILE="/tmp/my-lock.lock"`)
+
+	inspector, err = NewUpdateLockInspector(NewTestLogger(), &gamelift.Instance{OperatingSystem: config.OperatingSystemWindows}, &GameLiftInstanceAccessGetterMock{}, "my-lock")
+	assert.Nil(t, err)
+	assert.Contains(t, testJoinSteps(inspector.inspectCommands(inspector.lockName)), `$lockName="Global\my-lock"`)
+
+	_, err = NewUpdateLockInspector(NewTestLogger(), &gamelift.Instance{}, &GameLiftInstanceAccessGetterMock{}, "my-lock")
+	assert.ErrorContains(t, err, "unknown operating system")
+}
+
+// TestUpdateLockInspectorInspect ensures the state written by the instance is parsed, and the echoed commands are never mistaken for it
+func TestUpdateLockInspectorInspect(t *testing.T) {
+	testUseLogsDir(t)
+
+	inspector, pty := testUpdateLockInspector(linuxCommandProtocol, func(command string) (string, int) {
+		return strings.Join([]string{
+			"FBUT_LOCK_PATH=/tmp/my-lock.lock",
+			"FBUT_LOCK_STATE=held",
+			"FBUT_LOCK_HOLDER=1200 /bin/bash /tmp/1234update-instance.sh",
+			"FBUT_LOCK_HOLDER=1201 unzip -o /tmp/build.zip -d /local/game",
+			"FBUT_LOCK_SCRIPT=1200 /bin/bash /tmp/1234update-instance.sh",
+			"FBUT_LOCK_SCRIPT=980 /bin/bash /tmp/5678update-instance.sh",
+			"FBUT_LOCK_ARCHIVE=/tmp/build.zip",
+			"FBUT_LOCK_DONE",
+		}, "\r\n"), 0
+	})
+
+	status, err := inspector.Inspect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &UpdateLockStatus{
+		LockPath: "/tmp/my-lock.lock",
+		Held:     true,
+		Holders: []RemoteProcess{
+			{Pid: 1200, Command: "/bin/bash /tmp/1234update-instance.sh"},
+			{Pid: 1201, Command: "unzip -o /tmp/build.zip -d /local/game"},
+		},
+		Scripts:  []RemoteProcess{{Pid: 980, Command: "/bin/bash /tmp/5678update-instance.sh"}},
+		Archives: []string{"/tmp/build.zip"},
+	}, status)
+	assert.Equal(t, []int{1200, 1201, 980}, status.ProcessIds())
+	assert.Equal(t, []string{"ssm", "start-session", "--target", "i-1234"}, pty.StartCalls()[0].Args)
+}
+
+// TestParseUpdateLockStatusNoState ensures an error is returned when the instance never wrote out the state of the lock
+func TestParseUpdateLockStatusNoState(t *testing.T) {
+	_, err := parseUpdateLockStatus("FBUT_LOCK_PATH=/tmp/my-lock.lock\r\nFBUT_LOCK_STATE=held\r\n")
+	assert.ErrorContains(t, err, "the state of the update lock was not written by the instance")
+}
+
+// TestUpdateLockInspectorRelease ensures only the processes, and archives that were found are removed, and the lock is inspected again afterwards
+func TestUpdateLockInspectorRelease(t *testing.T) {
+	testUseLogsDir(t)
+
+	commands := []string{}
+	inspector, _ := testUpdateLockInspector(linuxCommandProtocol, func(command string) (string, int) {
+		commands = append(commands, command)
+		if strings.Contains(command, "STATE=") {
+			return "FBUT_LOCK_PATH=/tmp/my-lock.lock\r\nFBUT_LOCK_STATE=free\r\nFBUT_LOCK_DONE", 0
+		}
+		return "", 0
+	})
+
+	found := &UpdateLockStatus{
+		Held:     true,
+		Holders:  []RemoteProcess{{Pid: 1200}},
+		Scripts:  []RemoteProcess{{Pid: 980}},
+		Archives: []string{"/tmp/build.zip", "/tmp/it's.zip"},
+	}
+
+	status, err := inspector.Release(context.Background(), found, true)
+	assert.Nil(t, err)
+	assert.False(t, status.Held)
+
+	assert.Len(t, commands, 4)
+	// Each process is checked again just before it is stopped, in case its id was reused
+	assert.Contains(t, commands[0], `LOCKFILE="/tmp/my-lock.lock"; isHolder() { sudo find "/proc/$1/fd" -maxdepth 1 -lname "$LOCKFILE" 2>/dev/null | grep -q . || pgrep -f '[u]pdate-instance\.sh' | grep -qx "$1"; };`)
+	assert.Contains(t, commands[0], "for PID in 1200 980; do isHolder $PID && sudo kill -TERM $PID 2>/dev/null; done; sleep 2; for PID in 1200 980; do isHolder $PID && sudo kill -KILL $PID 2>/dev/null; done;")
+	assert.Contains(t, commands[1], `then sudo rm -f "$LOCKFILE"; fi;`)
+	assert.Contains(t, commands[2], `sudo rm -f -- '/tmp/build.zip' '/tmp/it'\''s.zip';`)
+}
+
+func TestReleaseUpdateLockCommands(t *testing.T) {
+	status := &UpdateLockStatus{Scripts: []RemoteProcess{{Pid: 42}}, Archives: []string{`C:\Users\gl-user-server\build.zip`}}
+
+	commands := testJoinSteps(windowsReleaseUpdateLockCommands("my-lock", status, false))
+	assert.Contains(t, commands, `Where-Object { @(42) -contains $_.ProcessId -and $_.CommandLine -like "*update-instance.ps1*" } | ForEach-Object { Stop-Process -Id $_.ProcessId -Force`)
+	assert.NotContains(t, commands, "Remove-Item")
+
+	commands = testJoinSteps(windowsReleaseUpdateLockCommands("my-lock", status, true))
+	assert.Contains(t, commands, `Remove-Item -LiteralPath 'C:\Users\gl-user-server\build.zip' -Force`)
+
+	// Nothing to stop, the lock file is still removed if nothing holds it
+	commands = testJoinSteps(linuxReleaseUpdateLockCommands("my-lock", &UpdateLockStatus{}, true))
+	assert.NotContains(t, commands, "kill")
+	assert.Contains(t, commands, `LOCKFILE="/tmp/my-lock.lock"`)
+	assert.NotContains(t, commands, "rm -f --")
+}
+
+// TestInspectUpdateLockArchives ensures every kind of build archive left in the upload directory is found
+func TestInspectUpdateLockArchives(t *testing.T) {
+	commands := testJoinSteps(linuxInspectUpdateLockCommands("my-lock"))
+	assert.Contains(t, commands, "for FILE in /tmp/*.zip /tmp/*.tar.gz /tmp/*.tar.zst /tmp/*.b64; do")
+
+	commands = testJoinSteps(windowsInspectUpdateLockCommands("my-lock"))
+	assert.Contains(t, commands, `-Include "*.zip","*.tar.gz","*.tar.zst","*.b64"`)
+}
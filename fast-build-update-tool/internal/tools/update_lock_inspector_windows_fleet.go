@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
+)
+
+// windowsUpdateLockPath is the named mutex taken by the Windows update script
+func windowsUpdateLockPath(lockName string) string {
+	return fmt.Sprintf("Global\\%s", lockName)
+}
+
+// windowsInspectUpdateLockCommands will generate the commands that write out the state of the update lock, any update scripts
+// still running, and the archives left in the upload directory
+func windowsInspectUpdateLockCommands(lockName string) []sessionStep {
+	return []sessionStep{
+		{name: "set session variables", command: fmt.Sprintf("$lockName=\"%s\"; $scriptName=\"%s\"; $uploadDirectory=\"%s\"; $lockMarker=(\"%s\" + \"%s\");\r\n",
+			windowsUpdateLockPath(lockName), config.UpdateScriptWindowsName, config.UploadDirectoryWindows, updateLockMarkerStartHead, updateLockMarkerStartTail)},
+		{name: "inspect update lock", command: windowsInspectUpdateLockPowershellScript},
+	}
+}
+
+// The mutex only exists while a process has it open, and the update script keeps it open until it exits.
+// Windows can't tell which process that is, so only the update scripts still running are listed.
+const windowsInspectUpdateLockPowershellScript = `
+Write-Host ($lockMarker + "PATH=" + $lockName);
+$mutex = $null;
+$held = $false;
+try {
+	$held = [System.Threading.Mutex]::TryOpenExisting($lockName, [ref]$mutex);
+	if ($held) { $mutex.Dispose(); }
+} catch [System.UnauthorizedAccessException] {
+	# The mutex exists, this session is just not allowed to open it
+	$held = $true;
+}
+if ($held) { Write-Host ($lockMarker + "STATE=held"); } else { Write-Host ($lockMarker + "STATE=free"); }
+Get-CimInstance -ClassName Win32_Process -Filter "Name = 'powershell.exe'" | Where-Object { $_.CommandLine -like "*$scriptName*" } | ForEach-Object {
+	Write-Host ($lockMarker + "SCRIPT=" + $_.ProcessId + " " + $_.CommandLine);
+}
+Get-ChildItem -Path (Join-Path $uploadDirectory "*") -Include "*.zip","*.tar.gz","*.tar.zst","*.b64" -File -ErrorAction SilentlyContinue | ForEach-Object {
+	Write-Host ($lockMarker + "ARCHIVE=" + $_.FullName);
+}
+Write-Host ($lockMarker + "DONE");
+`
+
+// windowsReleaseUpdateLockCommands will generate the commands that stop every process in status, the mutex is released as soon as they have exited.
+// The archives in status are removed as well when cleanArchives is true.
+func windowsReleaseUpdateLockCommands(lockName string, status *UpdateLockStatus, cleanArchives bool) []sessionStep {
+	commands := []sessionStep{}
+
+	if pids := status.ProcessIds(); len(pids) > 0 {
+		ids := joinProcessIds(pids, ",")
+		// The processes may have exited since they were inspected, and their ids been reused. Each one is only stopped if it is still an update script.
+		commands = append(commands, sessionStep{
+			name: "stop update scripts",
+			command: fmt.Sprintf("$stopped = @(Get-CimInstance -ClassName Win32_Process -Filter \"Name = 'powershell.exe'\" | Where-Object { @(%s) -contains $_.ProcessId -and $_.CommandLine -like \"*%s*\" } | ForEach-Object { Stop-Process -Id $_.ProcessId -Force -ErrorAction SilentlyContinue; $_.ProcessId }); if ($stopped.Count -gt 0) { Wait-Process -Id $stopped -Timeout 30 -ErrorAction SilentlyContinue; }\r\n",
+				ids, config.UpdateScriptWindowsName),
+		})
+	}
+
+	if cleanArchives && len(status.Archives) > 0 {
+		commands = append(commands, sessionStep{
+			name:    "remove archives",
+			command: fmt.Sprintf("Remove-Item -LiteralPath %s -Force -ErrorAction SilentlyContinue;\r\n", quotedPaths(status.Archives, windowsQuote, ",")),
+		})
+	}
+
+	return commands
+}
+
+// windowsQuote quotes value as a PowerShell string that is used exactly as it is
+func windowsQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -4,27 +4,176 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 )
 
+// UpdateScriptData is the data an update script template is rendered with, both the built-in templates and one passed with --script-template.
+// Lists are comma separated, and paths on the instance are in the format of its operating system.
+type UpdateScriptData struct {
+	// OperatingSystem is the operating system of the fleet, linux or windows
+	OperatingSystem string
+	// IsReplaceBuild is "replace" when the build is replaced, and empty when the server processes are only restarted
+	IsReplaceBuild string
+	// ArchiveName is the file name of the build archive, it is uploaded to UploadDirectory. It is empty when the server processes are only restarted.
+	ArchiveName string
+	// ArchiveFormat is the file format of the build archive: zip, tar.gz or tar.zst. It is empty when the server processes are only restarted.
+	ArchiveFormat string
+	// ArchiveSHA256 is the hex encoded SHA-256 of the build archive, it is empty when the server processes are only restarted
+	ArchiveSHA256 string
+	// ExecutablePaths is the full path of each executable that runs a game server on the fleet
+	ExecutablePaths string
+	// ProcessNames is the name of the process started from each executable, the file name without the .exe extension
+	ProcessNames string
+	// InstallRoot is the directory the build is installed to, it ends with a path separator
+	InstallRoot string
+	// UploadDirectory is the directory the update script, the build archive and the hooks are uploaded to, it ends with a path separator
+	UploadDirectory string
+	// LockName is the name of the lock taken so two updates never run on an instance at once
+	LockName string
+	// PreHookPath is the path of the pre-hook on the instance, it is empty when there is no pre-hook
+	PreHookPath string
+	// PostHookPath is the path of the post-hook on the instance, it is empty when there is no post-hook
+	PostHookPath string
+	// StopGracePeriod is how many seconds a server process is given to exit after a soft stop before it is killed, 0 when processes are not waited for
+	StopGracePeriod int
+	// OnNoProcess is what to do when no server process is running for an executable: fail, warn or ignore
+	OnNoProcess string
+}
+
+// ProcessStopResult is how a server process exited when the update script stopped it
+type ProcessStopResult string
+
+const (
+	// ProcessStopExited is a process that exited by itself within the stop grace period
+	ProcessStopExited ProcessStopResult = "exited"
+	// ProcessStopKilled is a process that was killed, either because it was still running once the stop grace period was over, or because there is no grace period on Windows
+	ProcessStopKilled ProcessStopResult = "killed"
+	// ProcessStopSignaled is a process that was sent SIGTERM on Linux, and not waited for since there is no stop grace period
+	ProcessStopSignaled ProcessStopResult = "signaled"
+)
+
+// ProcessStop is a server process the update script stopped, and how it exited
+type ProcessStop struct {
+	Pid int
+	// Name is the executable path of the process on Linux, and the process name on Windows
+	Name   string
+	Result ProcessStopResult
+	// Waited is how long the update script waited for the process to exit
+	Waited time.Duration
+}
+
+// processStopRegex matches the line the update scripts write for each process they stopped, eg. FBUT_STOP 1234 exited 3 /local/game/MyGame
+var processStopRegex = regexp.MustCompile(`FBUT_STOP (\d+) (exited|killed|signaled) (\d+) (.+)$`)
+
+// ParseProcessStop parses a line of update script output, it returns false if the line is not about a stopped process
+func ParseProcessStop(line string) (ProcessStop, bool) {
+	match := processStopRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return ProcessStop{}, false
+	}
+
+	pid, _ := strconv.Atoi(match[1])
+	seconds, _ := strconv.Atoi(match[3])
+	return ProcessStop{
+		Pid:    pid,
+		Name:   match[4],
+		Result: ProcessStopResult(match[2]),
+		Waited: time.Duration(seconds) * time.Second,
+	}, true
+}
+
+// NoProcess is an executable, or a process name on Windows, that had no running server process when the update script went to stop them
+type NoProcess struct {
+	Name string
+	// Policy is what the update script did about it
+	Policy config.NoProcessPolicy
+}
+
+// noProcessRegex matches the line the update scripts write when no server process is running for an executable, eg. FBUT_NO_PROCESS warn /local/game/MyGame
+var noProcessRegex = regexp.MustCompile(`FBUT_NO_PROCESS (fail|warn|ignore) (.+)$`)
+
+// ParseNoProcess parses a line of update script output, it returns false if the line is not about an executable with no running server process
+func ParseNoProcess(line string) (NoProcess, bool) {
+	match := noProcessRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return NoProcess{}, false
+	}
+
+	return NoProcess{Name: match[2], Policy: config.NoProcessPolicy(match[1])}, true
+}
+
+// UpdateScriptStatus is what the update script on an instance reported back about the server processes it stopped
+type UpdateScriptStatus struct {
+	// ProcessStops holds the server processes that were stopped, in the order they were stopped
+	ProcessStops []ProcessStop
+	// NoProcesses holds the executables that had no running server process
+	NoProcesses []NoProcess
+}
+
+// AddLine records the status reported by a line of update script output, it returns false if the line is not a status line
+func (u *UpdateScriptStatus) AddLine(line string) bool {
+	if stop, ok := ParseProcessStop(line); ok {
+		u.ProcessStops = append(u.ProcessStops, stop)
+		return true
+	}
+	if noProcess, ok := ParseNoProcess(line); ok {
+		u.NoProcesses = append(u.NoProcesses, noProcess)
+		return true
+	}
+	return false
+}
+
+// Failed returns true if the update script stopped because no server process was running for an executable
+func (u *UpdateScriptStatus) Failed() bool {
+	for _, noProcess := range u.NoProcesses {
+		if noProcess.Policy == config.NoProcessPolicyFail {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	linuxInstallRoot   = "/local/game/"
+	windowsInstallRoot = "C:\\Game\\"
+)
+
 // InstanceUpdateScriptGenerator is used to generate a local script file which can be uploaded and run on each instance in a GameLift fleet
 // The UpdateOperation provided will determine the contents of the script that is generated.
 type InstanceUpdateScriptGenerator struct {
 	tempBuildFile *os.File
 
-	updateOperation   config.UpdateOperation
-	localBuildZipPath string
-	lockName          string
+	updateOperation config.UpdateOperation
+	archive         BuildArchive
+	lockName        string
+	hooks           config.UpdateHooks
+	// scriptTemplate is the template passed with --script-template, the built-in template for the fleet is used when it is nil
+	scriptTemplate *template.Template
+	// stopGracePeriod is how long server processes are given to exit before they are killed
+	stopGracePeriod time.Duration
+	// onNoProcess is what the update script does when no server process is running for an executable
+	onNoProcess   config.NoProcessPolicy
+	archiveSHA256 string
+	archiveFormat ArchiveFormat
 }
 
 // NewInstanceUpdateScriptGenerator build a new InstanceUpdateScriptGenerator
-func NewInstanceUpdateScriptGenerator(updateOperation config.UpdateOperation, localBuildZipPath, lockName string) *InstanceUpdateScriptGenerator {
+func NewInstanceUpdateScriptGenerator(updateOperation config.UpdateOperation, archive BuildArchive, lockName string, hooks config.UpdateHooks, scriptTemplate *template.Template, stopGracePeriod time.Duration, onNoProcess config.NoProcessPolicy) *InstanceUpdateScriptGenerator {
 	return &InstanceUpdateScriptGenerator{
-		updateOperation:   updateOperation,
-		localBuildZipPath: localBuildZipPath,
-		lockName:          lockName,
+		updateOperation: updateOperation,
+		archive:         archive,
+		lockName:        lockName,
+		hooks:           hooks,
+		scriptTemplate:  scriptTemplate,
+		stopGracePeriod: stopGracePeriod,
+		onNoProcess:     onNoProcess,
 	}
 }
 
@@ -32,6 +181,19 @@ func NewInstanceUpdateScriptGenerator(updateOperation config.UpdateOperation, lo
 // This function requires a slice of all of the executables that are used to run a GameServer in this specific fleet.
 // The string value returned is the path on the local filesytem to the update script.
 func (i *InstanceUpdateScriptGenerator) GenerateScript(ctx context.Context, operatingSystem config.OperatingSystem, executableNames []string) (filname string, err error) {
+	data, err := i.scriptData(operatingSystem, executableNames)
+	if err != nil {
+		return "", err
+	}
+
+	scriptTemplate := i.scriptTemplate
+	if scriptTemplate == nil {
+		scriptTemplate, err = builtinUpdateScriptTemplate(operatingSystem)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// Actually create a file to write the update script contents to
 	i.tempBuildFile, err = os.CreateTemp("", "*"+string(config.UpdateScriptForOperatingSystem(operatingSystem)))
 	if err != nil {
@@ -40,25 +202,128 @@ func (i *InstanceUpdateScriptGenerator) GenerateScript(ctx context.Context, oper
 	defer i.tempBuildFile.Close()
 
 	// Generate the update script
+	err = scriptTemplate.Execute(i.tempBuildFile, data)
+	if err != nil {
+		return "", fmt.Errorf("error generating server update script %w", err)
+	}
+
+	// Return the filepath
+	return i.tempBuildFile.Name(), nil
+}
+
+// scriptData builds the data the update script template is rendered with for a fleet
+func (i *InstanceUpdateScriptGenerator) scriptData(operatingSystem config.OperatingSystem, executablePaths []string) (UpdateScriptData, error) {
+	var data UpdateScriptData
 	switch operatingSystem {
 	case config.OperatingSystemLinux:
-		err = generateLinuxUpdateScript(i.tempBuildFile, executableNames, i.localBuildZipPath, i.lockName, i.updateOperation)
-		if err != nil {
-			return "", fmt.Errorf("error generating server update script %w", err)
+		data = newLinuxUpdateScriptData(executablePaths)
+	case config.OperatingSystemWindows:
+		data = newWindowsUpdateScriptData(executablePaths)
+	default:
+		return data, config.UnknownOperatingSystemError(fmt.Sprint(operatingSystem))
+	}
+
+	uploadDirectory := config.RemoteUploadDirectoryForOperatingSystem(operatingSystem)
+	data.OperatingSystem = operatingSystem.String()
+	data.IsReplaceBuild = getIsReplaceBuildTemplateValue(i.updateOperation)
+	data.UploadDirectory = string(uploadDirectory)
+	data.LockName = i.lockName
+	data.PreHookPath = getRemoteHookPath(uploadDirectory, i.hooks.PreHookPath)
+	data.PostHookPath = getRemoteHookPath(uploadDirectory, i.hooks.PostHookPath)
+	data.StopGracePeriod = getStopGracePeriodTemplateValue(i.stopGracePeriod)
+	data.OnNoProcess = getOnNoProcessTemplateValue(i.onNoProcess)
+
+	if i.updateOperation == config.UpdateOperationReplaceBuild {
+		// The checksum is only worked out once, the build archive may be large
+		if i.archiveSHA256 == "" {
+			checksum, err := i.archive.SHA256()
+			if err != nil {
+				return data, fmt.Errorf("error working out the checksum of the build archive %w", err)
+			}
+			i.archiveSHA256 = checksum
+		}
+		if i.archiveFormat == "" {
+			format, err := i.archive.Format()
+			if err != nil {
+				return data, fmt.Errorf("error working out the format of the build archive %w", err)
+			}
+			i.archiveFormat = format
 		}
+		data.ArchiveName = i.archive.Name()
+		data.ArchiveFormat = string(i.archiveFormat)
+		data.ArchiveSHA256 = i.archiveSHA256
+	}
 
-	case config.OperatingSystemWindows:
-		err = generateWindowsUpdateScript(i.tempBuildFile, executableNames, i.localBuildZipPath, i.lockName, i.updateOperation)
+	return data, nil
+}
+
+// LoadUpdateScriptTemplate will load the update script template at path, and validate it by rendering it with sample data for each operating system
+func LoadUpdateScriptTemplate(path string) (*template.Template, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading update script template %w", err)
+	}
+
+	scriptTemplate, err := template.New(filepath.Base(path)).Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing update script template %w", err)
+	}
+
+	for _, data := range sampleUpdateScriptData() {
+		var rendered strings.Builder
+		err = scriptTemplate.Execute(&rendered, data)
 		if err != nil {
-			return "", fmt.Errorf("error generating server update script %w", err)
+			return nil, fmt.Errorf("error rendering update script template with sample %s data %w", data.OperatingSystem, err)
+		}
+		if strings.TrimSpace(rendered.String()) == "" {
+			return nil, fmt.Errorf("update script template rendered an empty script with sample %s data", data.OperatingSystem)
 		}
+	}
 
+	return scriptTemplate, nil
+}
+
+// BuiltinUpdateScriptTemplate returns the source of the update script template used for a fleet when no --script-template is passed
+func BuiltinUpdateScriptTemplate(operatingSystem config.OperatingSystem) (string, error) {
+	switch operatingSystem {
+	case config.OperatingSystemLinux:
+		return linuxReplaceBuildTemplate, nil
+	case config.OperatingSystemWindows:
+		return windowsUpdateScriptTemplate, nil
 	default:
 		return "", config.UnknownOperatingSystemError(fmt.Sprint(operatingSystem))
 	}
+}
 
-	// Return the filepath
-	return i.tempBuildFile.Name(), nil
+func builtinUpdateScriptTemplate(operatingSystem config.OperatingSystem) (*template.Template, error) {
+	source, err := BuiltinUpdateScriptTemplate(operatingSystem)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(operatingSystem.String() + "-update-template").Parse(source)
+}
+
+// sampleUpdateScriptData returns data for a build replaced on a Linux, and on a Windows fleet, with every field set
+func sampleUpdateScriptData() []UpdateScriptData {
+	linux := newLinuxUpdateScriptData([]string{"/local/game/MyGame", "/local/game/bin/OtherProcess"})
+	windows := newWindowsUpdateScriptData([]string{"C:\\Game\\MyGame.exe", "C:\\Game\\bin\\OtherProcess.exe"})
+
+	result := []UpdateScriptData{linux, windows}
+	for i, operatingSystem := range []config.OperatingSystem{config.OperatingSystemLinux, config.OperatingSystemWindows} {
+		uploadDirectory := config.RemoteUploadDirectoryForOperatingSystem(operatingSystem)
+		result[i].OperatingSystem = operatingSystem.String()
+		result[i].IsReplaceBuild = getIsReplaceBuildTemplateValue(config.UpdateOperationReplaceBuild)
+		result[i].ArchiveName = "build.zip"
+		result[i].ArchiveFormat = string(ArchiveFormatZip)
+		result[i].ArchiveSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+		result[i].UploadDirectory = string(uploadDirectory)
+		result[i].LockName = config.AppName
+		result[i].PreHookPath = string(uploadDirectory) + "pre-hook"
+		result[i].PostHookPath = string(uploadDirectory) + "post-hook"
+		result[i].StopGracePeriod = 30
+		result[i].OnNoProcess = string(config.NoProcessPolicyWarn)
+	}
+	return result
 }
 
 // Cleanup will remove the update script file generated, and clean up anything else set up by InstanceUpdateScriptGenerator
@@ -73,6 +338,27 @@ func csvify(in []string) string {
 	return strings.Join(in, ",")
 }
 
+// getRemoteHookPath returns where a hook uploaded to the instance will be found, or an empty string if the hook is not set
+func getRemoteHookPath(uploadDirectory config.RemoteUploadDirectory, localHookPath string) string {
+	if localHookPath == "" {
+		return ""
+	}
+	return string(uploadDirectory) + filepath.Base(localHookPath)
+}
+
+// getStopGracePeriodTemplateValue returns the stop grace period in whole seconds, rounded up so a process is never given less time than was asked for
+func getStopGracePeriodTemplateValue(stopGracePeriod time.Duration) int {
+	return int((stopGracePeriod + time.Second - 1) / time.Second)
+}
+
+// getOnNoProcessTemplateValue returns the no process policy for the update script, the update fails when none was set
+func getOnNoProcessTemplateValue(onNoProcess config.NoProcessPolicy) string {
+	if onNoProcess == "" {
+		return string(config.NoProcessPolicyFail)
+	}
+	return string(onNoProcess)
+}
+
 func getIsReplaceBuildTemplateValue(updateOperation config.UpdateOperation) string {
 	isReplaceBuild := ""
 	if updateOperation == config.UpdateOperationReplaceBuild {
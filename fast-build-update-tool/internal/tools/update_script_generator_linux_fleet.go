@@ -1,27 +1,19 @@
 package tools
 
-import (
-	"io"
-	"path/filepath"
-	"text/template"
-
-	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
-)
-
-// generateLinuxUpdateScript is used to generate an update script for a Linux fleet
-// updateOperation configures which type of update script will be generated
-func generateLinuxUpdateScript(writer io.Writer, executablePaths []string, localBuildZipPath, lockName string, updateOperation config.UpdateOperation) error {
-	template, err := template.New("linux-update-template").Parse(linuxReplaceBuildTemplate)
-	if err != nil {
-		return err
+import "path"
+
+// newLinuxUpdateScriptData builds the update script data that is specific to a Linux fleet
+func newLinuxUpdateScriptData(executablePaths []string) UpdateScriptData {
+	processNames := make([]string, len(executablePaths))
+	for i, executablePath := range executablePaths {
+		processNames[i] = path.Base(executablePath)
 	}
 
-	return template.Execute(writer, map[string]string{
-		"ArchiveName":     filepath.Base(localBuildZipPath),
-		"ExecutablePaths": csvify(executablePaths),
-		"IsReplaceBuild":  getIsReplaceBuildTemplateValue(updateOperation),
-		"LockName":        lockName,
-	})
+	return UpdateScriptData{
+		ExecutablePaths: csvify(executablePaths),
+		ProcessNames:    csvify(processNames),
+		InstallRoot:     linuxInstallRoot,
+	}
 }
 
 const linuxReplaceBuildTemplate = `
@@ -30,8 +22,15 @@ const linuxReplaceBuildTemplate = `
 set -e
 
 ARCHIVE_NAME={{.ArchiveName}}
+ARCHIVE_FORMAT={{.ArchiveFormat}}
+ARCHIVE_SHA256={{.ArchiveSHA256}}
+INSTALL_ROOT={{.InstallRoot}}
 EXE_PATHS={{.ExecutablePaths}}
 LOCKFILE="/tmp/{{.LockName}}.lock"
+PRE_HOOK="{{.PreHookPath}}"
+POST_HOOK="{{.PostHookPath}}"
+STOP_GRACE_PERIOD={{.StopGracePeriod}}
+ON_NO_PROCESS={{.OnNoProcess}}
 OLD_IFS="$IFS"
 
 # Cleanup script at the end
@@ -40,15 +39,89 @@ function cleanup {
 	exec 200>&-
 	IFS="$OLD_IFS"
 	rm -f $ARCHIVE_NAME
+	if [ -n "$PRE_HOOK" ]; then rm -f -- "$PRE_HOOK"; fi
+	if [ -n "$POST_HOOK" ]; then rm -f -- "$POST_HOOK"; fi
 	rm -- "$0"
 }
 trap cleanup EXIT
 
+# Run a hook with the stage of the update as its first argument, the update stops if it fails
+function run_hook {
+	if [ -z "$1" ]; then
+		return 0
+	fi
+
+	echo "running $2 hook: $1"
+	sudo chmod +x "$1"
+	if ! sudo "$1" "$2"; then
+		echo "$2 hook failed: $1"
+		exit 1
+	fi
+	echo "$2 hook finished"
+}
+
+# Wait for the processes sent SIGTERM to exit, each argument is PID:EXE_PATH. Once the grace period is over the processes still running are killed, along with the server they started.
+function wait_for_processes {
+	local WAITED=0
+	local REMAINING=("$@")
+
+	if [ ${#REMAINING[@]} -eq 0 ]; then
+		return 0
+	fi
+
+	if [ "$STOP_GRACE_PERIOD" -eq 0 ]; then
+		for ENTRY in "${REMAINING[@]}"; do
+			echo "FBUT_STOP ${ENTRY%%:*} signaled 0 ${ENTRY#*:}"
+		done
+		return 0
+	fi
+
+	echo "waiting up to $STOP_GRACE_PERIOD seconds for ${#REMAINING[@]} gameserver processes to exit"
+	while [ ${#REMAINING[@]} -gt 0 ]; do
+		local RUNNING=()
+		for ENTRY in "${REMAINING[@]}"; do
+			if sudo kill -0 "${ENTRY%%:*}" 2>/dev/null; then
+				RUNNING+=("$ENTRY")
+			else
+				echo "FBUT_STOP ${ENTRY%%:*} exited $WAITED ${ENTRY#*:}"
+			fi
+		done
+		REMAINING=("${RUNNING[@]}")
+
+		if [ ${#REMAINING[@]} -gt 0 ] && [ "$WAITED" -ge "$STOP_GRACE_PERIOD" ]; then
+			for ENTRY in "${REMAINING[@]}"; do
+				sudo pkill -KILL -P "${ENTRY%%:*}" || true
+				sudo kill -KILL "${ENTRY%%:*}" 2>/dev/null || true
+				echo "FBUT_STOP ${ENTRY%%:*} killed $WAITED ${ENTRY#*:}"
+			done
+			return 0
+		fi
+
+		if [ ${#REMAINING[@]} -gt 0 ]; then
+			sleep 1
+			WAITED=$((WAITED + 1))
+		fi
+	done
+}
+
 echo "attempting to acquire update lock"
 exec 200>$LOCKFILE
 flock -n 200 || { echo "failed to acquire update lock another process is holding it"; exit 1; }
 echo "update lock acquired"
 
+{{if .IsReplaceBuild}}
+echo "verifying the archive checksum: /tmp/$ARCHIVE_NAME";
+echo "$ARCHIVE_SHA256  /tmp/$ARCHIVE_NAME" | sha256sum -c --quiet - || { echo "archive checksum does not match, it may not have been uploaded completely"; exit 1; }
+
+# Check the archive can be extracted before any server process is stopped
+if [ "$ARCHIVE_FORMAT" = "tar.zst" ] && ! command -v unzstd >/dev/null; then
+	echo "unzstd is needed to extract /tmp/$ARCHIVE_NAME, install the zstd package on the instance"
+	exit 1
+fi
+{{end}}
+
+run_hook "$PRE_HOOK" pre-kill
+
 {{if .IsReplaceBuild}}
 
 IFS=","
@@ -58,24 +131,50 @@ do
 	sudo rm -f $EXE_PATH;
 done
 
-echo "unzipping the archive: /tmp/$ARCHIVE_NAME";
-sudo unzip -o /tmp/$ARCHIVE_NAME -d /local/game && rm /tmp/$ARCHIVE_NAME;
+echo "extracting the archive: /tmp/$ARCHIVE_NAME";
+case "$ARCHIVE_FORMAT" in
+	tar.gz) sudo tar -xzf /tmp/$ARCHIVE_NAME -C $INSTALL_ROOT;;
+	tar.zst) sudo tar --use-compress-program=unzstd -xf /tmp/$ARCHIVE_NAME -C $INSTALL_ROOT;;
+	*) sudo unzip -o /tmp/$ARCHIVE_NAME -d $INSTALL_ROOT;;
+esac
+rm /tmp/$ARCHIVE_NAME;
 
 echo "changing server permissions";
-sudo chown -R gl-user-server:gl-user /local/game/*;
+sudo chown -R gl-user-server:gl-user $INSTALL_ROOT*;
+
+run_hook "$POST_HOOK" post-unzip
 
 {{end}}
 
+IFS=","
+STOPPING=()
 for EXE_PATH in $EXE_PATHS
 do
 	sudo chmod -R 774 $EXE_PATH;
 
 	echo "killing running processes: $EXE_PATH";
-	KILLED=$(sudo pkill -c -f "sudo -H -E -u gl-user-server $EXE_PATH");
-	if [ "$KILLED" -gt 0 ]; then
-		echo "killed $KILLED gameserver processes";
-	else
-		exit 1;
+	PIDS=$(pgrep -d , -f "sudo -H -E -u gl-user-server $EXE_PATH" || true);
+	if [ -z "$PIDS" ]; then
+		echo "no running gameserver processes found: $EXE_PATH";
+		echo "FBUT_NO_PROCESS $ON_NO_PROCESS $EXE_PATH";
+		if [ "$ON_NO_PROCESS" = "fail" ]; then
+			exit 1;
+		fi
+		continue;
 	fi
+
+	KILLED=0
+	for PID in $PIDS
+	do
+		sudo kill -TERM $PID 2>/dev/null || true;
+		STOPPING+=("$PID:$EXE_PATH");
+		KILLED=$((KILLED + 1))
+	done
+	echo "sent SIGTERM to $KILLED gameserver processes";
 done
+IFS="$OLD_IFS"
+
+wait_for_processes "${STOPPING[@]}"
+
+run_hook "$POST_HOOK" post-restart
 `
@@ -3,14 +3,17 @@ package tools
 import (
 	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGenerateLinuxReplaceBuildScript(t *testing.T) {
-	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, "myarchive.zip", "lockfile")
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/game-executable.zip"), "lockfile", config.UpdateHooks{}, nil, 0, "")
 	defer func() {
 		err := updater.Cleanup()
 		assert.Nil(t, err)
@@ -24,16 +27,20 @@ func TestGenerateLinuxReplaceBuildScript(t *testing.T) {
 
 	fileContents := string(fileBytes)
 	assert.Contains(t, fileContents, "#!/bin/bash")
-	assert.Contains(t, fileContents, "ARCHIVE_NAME=myarchive.zip")
+	assert.Contains(t, fileContents, "ARCHIVE_NAME=game-executable.zip")
+	assert.Contains(t, fileContents, "ARCHIVE_FORMAT=zip")
+	assert.Contains(t, fileContents, "ARCHIVE_SHA256=6ab0040c1c09b8bd680acc731d3a48ec4a47047151ebfb27089e2173d5a9cffb")
+	assert.Contains(t, fileContents, "INSTALL_ROOT=/local/game/")
+	assert.Contains(t, fileContents, "STOP_GRACE_PERIOD=0")
 	assert.Contains(t, fileContents, `LOCKFILE="/tmp/lockfile.lock"`)
 	assert.Contains(t, fileContents, "EXE_PATHS=/local/game/my-game,/local/game/another-exe")
 	assert.Contains(t, fileContents, "sudo unzip -o /tmp/$ARCHIVE_NAME")
 	assert.Contains(t, fileContents, "sudo rm -f $EXE_PATH;")
-	assert.Contains(t, fileContents, "sudo pkill -c -f \"sudo -H -E -u gl-user-server $EXE_PATH\"")
+	assert.Contains(t, fileContents, `PIDS=$(pgrep -d , -f "sudo -H -E -u gl-user-server $EXE_PATH" || true);`)
 }
 
 func TestGenerateLinuxRestartProcessScript(t *testing.T) {
-	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, "", "")
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile(""), "", config.UpdateHooks{}, nil, 0, "")
 	defer func() {
 		err := updater.Cleanup()
 		assert.Nil(t, err)
@@ -50,11 +57,11 @@ func TestGenerateLinuxRestartProcessScript(t *testing.T) {
 	assert.Contains(t, fileContents, "#!/bin/bash")
 	assert.NotContains(t, fileContents, "sudo unzip -o /tmp/$ARCHIVE_NAME")
 	assert.NotContains(t, fileContents, "sudo rm -f $EXE_PATH;")
-	assert.Contains(t, fileContents, "sudo pkill -c -f \"sudo -H -E -u gl-user-server $EXE_PATH\"")
+	assert.Contains(t, fileContents, `PIDS=$(pgrep -d , -f "sudo -H -E -u gl-user-server $EXE_PATH" || true);`)
 }
 
 func TestGenerateWindowsReplaceBuildScript(t *testing.T) {
-	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, "myarchive.zip", "lockfile")
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/game-executable.zip"), "lockfile", config.UpdateHooks{}, nil, 0, "")
 	defer func() {
 		err := updater.Cleanup()
 		assert.Nil(t, err)
@@ -71,13 +78,16 @@ func TestGenerateWindowsReplaceBuildScript(t *testing.T) {
 	assert.Contains(t, fileContents, `$executablePaths="C:\Game\MyGame.exe,C:\Game\other-process.exe"`)
 	assert.Contains(t, fileContents, `New-Object System.Threading.Mutex($true, "Global\lockfile", [ref]$wasLockCreated);`)
 	assert.Contains(t, fileContents, `$processNames="MyGame,other-process"`)
-	assert.Contains(t, fileContents, `$zipFileName="myarchive.zip"`)
+	assert.Contains(t, fileContents, `$zipFileName="game-executable.zip"`)
+	assert.Contains(t, fileContents, `$baseDir="C:\Game\";`)
+	assert.Contains(t, fileContents, `$archivePath="C:\Users\gl-user-server\$zipFileName";`)
+	assert.Contains(t, fileContents, `if ($archiveHash -ne "6ab0040c1c09b8bd680acc731d3a48ec4a47047151ebfb27089e2173d5a9cffb") {`)
 	assert.Contains(t, fileContents, "Expand-Archive -Path $archivePath")
-	assert.Contains(t, fileContents, "KillAll-ServerProcess $processName;")
+	assert.Contains(t, fileContents, "Stop-ServerProcesses $processNames;")
 }
 
 func TestGenerateWindowsRestartProcessScript(t *testing.T) {
-	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, "myarchive.zip", "")
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile("myarchive.zip"), "", config.UpdateHooks{}, nil, 0, "")
 	defer func() {
 		err := updater.Cleanup()
 		assert.Nil(t, err)
@@ -93,5 +103,300 @@ func TestGenerateWindowsRestartProcessScript(t *testing.T) {
 	assert.NotContains(t, fileContents, "#!/bin/bash")
 	assert.NotContains(t, fileContents, "Expand-Archive -Path $archivePath -DestinationPath \"C:\\GameNew\\\" -Force;")
 	assert.NotContains(t, fileContents, "Remove-Item -Path C:\\Game\\ -Force -Recurse;")
-	assert.Contains(t, fileContents, "KillAll-ServerProcess $processName;")
+	assert.Contains(t, fileContents, "Stop-ServerProcesses $processNames;")
+}
+
+// TestGenerateLinuxScriptHooks ensures the hooks are uploaded to the update directory, and run in order around the build swap
+func TestGenerateLinuxScriptHooks(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/game-executable.zip"), "lockfile", config.UpdateHooks{PreHookPath: "hooks/pre.sh", PostHookPath: "hooks/post.sh"}, nil, 0, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game"})
+	assert.Nil(t, err)
+
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+
+	fileContents := string(fileBytes)
+	assert.Contains(t, fileContents, `PRE_HOOK="/tmp/pre.sh"`)
+	assert.Contains(t, fileContents, `POST_HOOK="/tmp/post.sh"`)
+	assert.Contains(t, fileContents, `if ! sudo "$1" "$2"; then`)
+
+	preKill := strings.Index(fileContents, `run_hook "$PRE_HOOK" pre-kill`)
+	postUnzip := strings.Index(fileContents, `run_hook "$POST_HOOK" post-unzip`)
+	postRestart := strings.Index(fileContents, `run_hook "$POST_HOOK" post-restart`)
+	assert.Less(t, strings.Index(fileContents, "flock -n 200"), preKill)
+	assert.Less(t, preKill, strings.Index(fileContents, "sudo rm -f $EXE_PATH;"))
+	assert.Less(t, strings.Index(fileContents, "sudo chown -R"), postUnzip)
+	assert.Less(t, postUnzip, strings.Index(fileContents, `echo "killing running processes: $EXE_PATH";`))
+	assert.Less(t, strings.Index(fileContents, `echo "killing running processes: $EXE_PATH";`), postRestart)
+}
+
+// TestGenerateScriptWithoutHooks ensures no hook is run when none were provided, and there is no unzip stage when only restarting processes
+func TestGenerateScriptWithoutHooks(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile(""), "lockfile", config.UpdateHooks{}, nil, 0, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game"})
+	assert.Nil(t, err)
+
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+
+	fileContents := string(fileBytes)
+	assert.Contains(t, fileContents, `PRE_HOOK=""`)
+	assert.Contains(t, fileContents, `POST_HOOK=""`)
+	assert.NotContains(t, fileContents, "post-unzip")
+}
+
+// TestGenerateWindowsScriptHooks ensures the hooks are uploaded to the update directory, run in order around the build swap, and removed afterwards
+func TestGenerateWindowsScriptHooks(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/game-executable.zip"), "lockfile", config.UpdateHooks{PreHookPath: "pre.ps1", PostHookPath: "post.ps1"}, nil, 0, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemWindows, []string{"C:\\Game\\MyGame.exe"})
+	assert.Nil(t, err)
+
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+
+	fileContents := string(fileBytes)
+	assert.Contains(t, fileContents, `$preHookPath="C:\Users\gl-user-server\pre.ps1";`)
+	assert.Contains(t, fileContents, `$postHookPath="C:\Users\gl-user-server\post.ps1";`)
+	assert.Contains(t, fileContents, `foreach ($hookPath in @($preHookPath, $postHookPath)) {`)
+
+	preKill := strings.Index(fileContents, `Invoke-Hook $preHookPath "pre-kill";`)
+	postUnzip := strings.Index(fileContents, `Invoke-Hook $postHookPath "post-unzip";`)
+	postRestart := strings.Index(fileContents, `Invoke-Hook $postHookPath "post-restart";`)
+	assert.Less(t, preKill, strings.Index(fileContents, "Stop-ServerProcesses $processNames;"))
+	assert.Less(t, strings.Index(fileContents, "Expand-Archive -Path $archivePath"), postUnzip)
+	assert.Less(t, postUnzip, strings.Index(fileContents, `Write-Host "Moving executable file`))
+	assert.Less(t, postUnzip, postRestart)
+}
+
+// TestGenerateScriptMissingZip ensures an error is returned when the checksum of the build zip can't be worked out
+func TestGenerateScriptMissingZip(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/missing.zip"), "lockfile", config.UpdateHooks{}, nil, 0, "")
+
+	_, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game"})
+	assert.ErrorContains(t, err, "error working out the checksum of the build archive")
+}
+
+// TestGenerateScriptTarArchive ensures a tar archive is extracted with tar, whatever its file extension
+func TestGenerateScriptTarArchive(t *testing.T) {
+	archivePath := writeTarArchive(t, ArchiveFormatTarGzip, "build.zip", map[string]string{"bin/server": "server"})
+
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile(archivePath), "lockfile", config.UpdateHooks{}, nil, 0, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/bin/server"})
+	assert.Nil(t, err)
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), "ARCHIVE_FORMAT=tar.gz")
+	assert.Contains(t, string(fileBytes), "tar.gz) sudo tar -xzf /tmp/$ARCHIVE_NAME -C $INSTALL_ROOT;;")
+
+	filename, err = updater.GenerateScript(context.Background(), config.OperatingSystemWindows, []string{"C:\\Game\\bin\\server.exe"})
+	assert.Nil(t, err)
+	fileBytes, err = os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), `$archiveFormat="tar.gz";`)
+	assert.Contains(t, string(fileBytes), "& tar.exe -xf $archivePath -C $unzipDir;")
+}
+
+// TestGenerateScriptFromTemplate ensures a template passed with --script-template is used instead of the built-in one
+func TestGenerateScriptFromTemplate(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "update.tmpl")
+	assert.Nil(t, os.WriteFile(templatePath, []byte("{{.OperatingSystem}} {{.IsReplaceBuild}} {{.ArchiveName}} {{.ArchiveSHA256}} {{.ProcessNames}} {{.InstallRoot}} {{.UploadDirectory}} {{.LockName}} {{.PreHookPath}}"), 0644))
+
+	scriptTemplate, err := LoadUpdateScriptTemplate(templatePath)
+	assert.Nil(t, err)
+
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/game-executable.zip"), "lockfile", config.UpdateHooks{PreHookPath: "pre.sh"}, scriptTemplate, 0, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game", "/local/game/bin/other"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(filename, "update-instance.sh"))
+
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "linux replace game-executable.zip 6ab0040c1c09b8bd680acc731d3a48ec4a47047151ebfb27089e2173d5a9cffb my-game,other /local/game/ /tmp/ lockfile /tmp/pre.sh", string(fileBytes))
+}
+
+// TestLoadUpdateScriptTemplateInvalid ensures a template that can't be parsed, uses a field that isn't in the data, or renders nothing is rejected
+func TestLoadUpdateScriptTemplateInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+
+	_, err := LoadUpdateScriptTemplate(filepath.Join(dir, "missing.tmpl"))
+	assert.ErrorContains(t, err, "error reading update script template")
+
+	_, err = LoadUpdateScriptTemplate(writeTemplate("parse.tmpl", "{{if .IsReplaceBuild}}unzip"))
+	assert.ErrorContains(t, err, "error parsing update script template")
+
+	_, err = LoadUpdateScriptTemplate(writeTemplate("field.tmpl", "unzip {{.ZipName}}"))
+	assert.ErrorContains(t, err, "error rendering update script template with sample linux data")
+
+	_, err = LoadUpdateScriptTemplate(writeTemplate("empty.tmpl", `{{if eq .OperatingSystem "linux"}}echo linux{{end}}`))
+	assert.ErrorContains(t, err, "update script template rendered an empty script with sample windows data")
+}
+
+// TestBuiltinUpdateScriptTemplates ensures the built-in templates pass the same validation as a template passed with --script-template
+func TestBuiltinUpdateScriptTemplates(t *testing.T) {
+	for _, operatingSystem := range []config.OperatingSystem{config.OperatingSystemLinux, config.OperatingSystemWindows} {
+		source, err := BuiltinUpdateScriptTemplate(operatingSystem)
+		assert.Nil(t, err)
+
+		templatePath := filepath.Join(t.TempDir(), "update.tmpl")
+		assert.Nil(t, os.WriteFile(templatePath, []byte(source), 0644))
+
+		_, err = LoadUpdateScriptTemplate(templatePath)
+		assert.Nil(t, err)
+	}
+
+	_, err := BuiltinUpdateScriptTemplate(config.OperatingSystemUnknown)
+	assert.ErrorContains(t, err, "unknown")
+}
+
+// TestGenerateScriptStopGracePeriod ensures the grace period is rounded up to whole seconds for both operating systems
+func TestGenerateScriptStopGracePeriod(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile(""), "lockfile", config.UpdateHooks{}, nil, 1500*time.Millisecond, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game"})
+	assert.Nil(t, err)
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), "STOP_GRACE_PERIOD=2\n")
+	assert.Contains(t, string(fileBytes), `sudo kill -TERM $PID`)
+
+	filename, err = updater.GenerateScript(context.Background(), config.OperatingSystemWindows, []string{"C:\\Game\\MyGame.exe"})
+	assert.Nil(t, err)
+	fileBytes, err = os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), "$stopGracePeriod=2;")
+	assert.Contains(t, string(fileBytes), "bool sent = GenerateConsoleCtrlEvent(1, 0);")
+	assert.Contains(t, string(fileBytes), "Send-SoftStop ($stopping | ForEach-Object { $_.Id });")
+	assert.Contains(t, string(fileBytes), `& cmd.exe /c "taskkill /PID $processId >NUL 2>&1";`)
+}
+
+// TestParseProcessStop ensures the line written for each stopped server process is parsed, and other lines are not
+func TestParseProcessStop(t *testing.T) {
+	stop, ok := ParseProcessStop("FBUT_STOP 1234 exited 3 /local/game/My Game\r")
+	assert.True(t, ok)
+	assert.Equal(t, ProcessStop{Pid: 1234, Name: "/local/game/My Game", Result: ProcessStopExited, Waited: 3 * time.Second}, stop)
+
+	stop, ok = ParseProcessStop("FBUT_STOP 42 killed 30 MyGame")
+	assert.True(t, ok)
+	assert.Equal(t, ProcessStopKilled, stop.Result)
+
+	_, ok = ParseProcessStop("sent SIGTERM to 2 gameserver processes")
+	assert.False(t, ok)
+}
+
+// TestGenerateScriptOnNoProcess ensures both operating systems are told what to do when no server process is running, and fail by default
+func TestGenerateScriptOnNoProcess(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile(""), "lockfile", config.UpdateHooks{}, nil, 0, config.NoProcessPolicyWarn)
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game"})
+	assert.Nil(t, err)
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), "ON_NO_PROCESS=warn\n")
+	assert.Contains(t, string(fileBytes), `echo "FBUT_NO_PROCESS $ON_NO_PROCESS $EXE_PATH";`)
+
+	filename, err = updater.GenerateScript(context.Background(), config.OperatingSystemWindows, []string{"C:\\Game\\MyGame.exe"})
+	assert.Nil(t, err)
+	fileBytes, err = os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), `$onNoProcess="warn";`)
+	assert.Contains(t, string(fileBytes), `Write-Host "FBUT_NO_PROCESS $onNoProcess $processName";`)
+
+	updater = NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile(""), "lockfile", config.UpdateHooks{}, nil, 0, "")
+	filename, err = updater.GenerateScript(context.Background(), config.OperatingSystemLinux, []string{"/local/game/my-game"})
+	assert.Nil(t, err)
+	fileBytes, err = os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Contains(t, string(fileBytes), "ON_NO_PROCESS=fail\n")
+}
+
+// TestUpdateScriptStatus ensures the status lines of the update script are recorded, and that a run stopped by a missing process is failed
+func TestUpdateScriptStatus(t *testing.T) {
+	status := UpdateScriptStatus{}
+
+	assert.False(t, status.AddLine("no running gameserver processes found: /local/game/other"))
+	assert.True(t, status.AddLine("FBUT_NO_PROCESS warn /local/game/other"))
+	assert.True(t, status.AddLine("FBUT_STOP 1234 signaled 0 /local/game/my-game"))
+	assert.False(t, status.Failed())
+
+	assert.True(t, status.AddLine("FBUT_NO_PROCESS fail MyGame\r"))
+	assert.True(t, status.Failed())
+
+	assert.Equal(t, UpdateScriptStatus{
+		ProcessStops: []ProcessStop{{Pid: 1234, Name: "/local/game/my-game", Result: ProcessStopSignaled}},
+		NoProcesses: []NoProcess{
+			{Name: "/local/game/other", Policy: config.NoProcessPolicyWarn},
+			{Name: "MyGame", Policy: config.NoProcessPolicyFail},
+		},
+	}, status)
+}
+
+// TestGenerateWindowsReplaceBuildNoProcess ensures the old executables moved aside before the server processes are stopped are put back when no process is found
+func TestGenerateWindowsReplaceBuildNoProcess(t *testing.T) {
+	updater := NewInstanceUpdateScriptGenerator(config.UpdateOperationReplaceBuild, ArchiveFile("testdata/game-executable.zip"), "lockfile", config.UpdateHooks{}, nil, 0, "")
+	defer func() {
+		err := updater.Cleanup()
+		assert.Nil(t, err)
+	}()
+
+	filename, err := updater.GenerateScript(context.Background(), config.OperatingSystemWindows, []string{"C:\\Game\\MyGame.exe"})
+	assert.Nil(t, err)
+	fileBytes, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+
+	fileContents := string(fileBytes)
+	assert.Contains(t, fileContents, `$onNoProcess="fail";`)
+	assert.Contains(t, fileContents, `throw "No running server process found: $processName";`)
+
+	moved := strings.Index(fileContents, "$movedExecutables += $executablePath;")
+	stopped := strings.Index(fileContents, "Stop-ServerProcesses $processNames;")
+	caught := strings.Index(fileContents, "} catch {")
+	restored := strings.Index(fileContents, "Move-Item -Force -Path $executablePath-old -Destination $executablePath;")
+	assert.True(t, moved >= 0 && moved < stopped, "the moved executables must be recorded before the server processes are stopped")
+	assert.True(t, caught >= 0 && restored > caught, "the moved executables must be restored when the update fails")
+	assert.Contains(t, fileContents, "foreach ($executablePath in $movedExecutables) {")
+
+	updater = NewInstanceUpdateScriptGenerator(config.UpdateOperationRestartProcess, ArchiveFile(""), "lockfile", config.UpdateHooks{}, nil, 0, "")
+	filename, err = updater.GenerateScript(context.Background(), config.OperatingSystemWindows, []string{"C:\\Game\\MyGame.exe"})
+	assert.Nil(t, err)
+	fileBytes, err = os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(fileBytes), "Restoring old executable")
 }
@@ -1,22 +1,9 @@
 package tools
 
-import (
-	"io"
-	"path/filepath"
-	"strings"
-	"text/template"
-
-	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/config"
-)
-
-// generateLinuxUpdateScript is used to generate an update script for a Windows fleet
-// updateOperation configures which type of update script will be generated
-func generateWindowsUpdateScript(writer io.Writer, executablePaths []string, localBuildZipPath, lockName string, updateOperation config.UpdateOperation) error {
-	template, err := template.New("windows-update-template").Parse(windowsUpdateScriptTemplate)
-	if err != nil {
-		return err
-	}
+import "strings"
 
+// newWindowsUpdateScriptData builds the update script data that is specific to a Windows fleet
+func newWindowsUpdateScriptData(executablePaths []string) UpdateScriptData {
 	processNames := make([]string, len(executablePaths))
 	for i, executablePath := range executablePaths {
 		parts := strings.Split(executablePath, "\\")
@@ -24,13 +11,11 @@ func generateWindowsUpdateScript(writer io.Writer, executablePaths []string, loc
 		processNames[i] = strings.Replace(exeName, ".exe", "", -1)
 	}
 
-	return template.Execute(writer, map[string]string{
-		"ArchiveName":     filepath.Base(localBuildZipPath),
-		"ExecutablePaths": csvify(executablePaths),
-		"ProcessNames":    csvify(processNames),
-		"IsReplaceBuild":  getIsReplaceBuildTemplateValue(updateOperation),
-		"LockName":        lockName,
-	})
+	return UpdateScriptData{
+		ExecutablePaths: csvify(executablePaths),
+		ProcessNames:    csvify(processNames),
+		InstallRoot:     windowsInstallRoot,
+	}
 }
 
 const windowsUpdateScriptTemplate = `
@@ -41,13 +26,19 @@ $ErrorActionPreference = "Stop";
 
 [Reflection.Assembly]::LoadWithPartialName("System.IO.Compression.ZipFile")
 
-$baseDir="C:\Game\";
+$baseDir="{{ .InstallRoot }}";
 $unzipDir="C:\GameNew\";
 
 $executablePaths="{{ .ExecutablePaths }}" -split ",";
 $processNames="{{ .ProcessNames }}" -split ",";
 $zipFileName="{{ .ArchiveName }}";
-$archivePath="C:\Users\gl-user-server\$zipFileName";
+$archivePath="{{ .UploadDirectory }}$zipFileName";
+$archiveFormat="{{ .ArchiveFormat }}";
+$preHookPath="{{ .PreHookPath }}";
+$postHookPath="{{ .PostHookPath }}";
+$stopGracePeriod={{ .StopGracePeriod }};
+$onNoProcess="{{ .OnNoProcess }}";
+$movedExecutables=@();
 
 try { 
 
@@ -59,32 +50,147 @@ if (!$wasLockCreated)
 }
 Write-Host "Acquired update lock";
 
-function KillAll-ServerProcess {
+{{if .IsReplaceBuild}}
+Write-Host "Verifying the checksum of $archivePath";
+$archiveHash=(Get-FileHash -Path $archivePath -Algorithm SHA256).Hash;
+if ($archiveHash -ne "{{ .ArchiveSHA256 }}") {
+	throw "Archive checksum $archiveHash does not match, it may not have been uploaded completely";
+}
+
+# Check a tar archive can be read before any server process is stopped, the files listed are removed from the server later on
+if ($archiveFormat -ne "zip") {
+	if (!(Get-Command tar.exe -ErrorAction SilentlyContinue)) {
+		throw "tar.exe is needed to extract $archivePath, it is included with Windows Server 2019 and later";
+	}
+	$archiveEntries=& tar.exe -tf $archivePath;
+	if ($LASTEXITCODE -ne 0) {
+		throw "tar.exe could not read $archivePath, it may not support $archiveFormat archives";
+	}
+}
+{{end}}
+
+# Sends CTRL_BREAK to the console of each process id, the same as pressing Ctrl+Break in it, and writes out the ids it was sent to.
+# It runs in its own powershell.exe, since a process has to leave its own console to attach to the console of another.
+$ctrlBreakScript = @'
+Add-Type -TypeDefinition @"
+using System;
+using System.Runtime.InteropServices;
+public static class FastBuildConsole {
+	public delegate bool HandlerRoutine(uint ctrlType);
+	[DllImport("kernel32.dll")] static extern bool FreeConsole();
+	[DllImport("kernel32.dll")] static extern bool AttachConsole(uint processId);
+	[DllImport("kernel32.dll")] static extern bool SetConsoleCtrlHandler(HandlerRoutine handler, bool add);
+	[DllImport("kernel32.dll")] static extern bool GenerateConsoleCtrlEvent(uint ctrlEvent, uint processGroupId);
+	// Every process attached to the console gets the event, this one included, so it is ignored here
+	static HandlerRoutine ignore = delegate(uint ctrlType) { return true; };
+	public static bool SendCtrlBreak(uint processId) {
+		FreeConsole();
+		if (!AttachConsole(processId)) { return false; }
+		SetConsoleCtrlHandler(ignore, true);
+		bool sent = GenerateConsoleCtrlEvent(1, 0);
+		FreeConsole();
+		return sent;
+	}
+}
+"@;
+foreach ($id in @(PROCESS_IDS)) { if ([FastBuildConsole]::SendCtrlBreak($id)) { $id } }
+'@;
+
+# Ask server processes to stop. Console processes are sent CTRL_BREAK, processes without a console are asked to close their windows with taskkill.
+# A process with neither is only killed once the grace period is over.
+function Send-SoftStop {
 	param (
-        [string]$ProcessToKill
-    )
+		[int[]]$ProcessIds
+	)
 
-	Write-Host "Stopping all processes with name: $ProcessToKill";
+	$script = $ctrlBreakScript.Replace("PROCESS_IDS", ($ProcessIds -join ","));
+	$encodedCommand = [Convert]::ToBase64String([System.Text.Encoding]::Unicode.GetBytes($script));
+	$sentIds = @(& powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand $encodedCommand 2>$null | ForEach-Object { [int]$_ });
+
+	foreach ($processId in $ProcessIds) {
+		if ($sentIds -contains $processId) {
+			Write-Host "Sent CTRL_BREAK to the process with id $processId";
+		} else {
+			Write-Host "Asking the process with id $processId to close";
+			& cmd.exe /c "taskkill /PID $processId >NUL 2>&1";
+		}
+	}
+}
+
+# Stop every server process with one of the names. Each process is asked to stop first, and is only killed once it has not exited within the grace period.
+function Stop-ServerProcesses {
+	param (
+		[string[]]$ProcessNames
+	)
+
+	$stopping = @();
+	foreach ($processName in $ProcessNames) {
+		Write-Host "Stopping all processes with name: $processName";
+
+		$serverProcesses = Get-Process -Name $processName -ErrorAction SilentlyContinue;
+		if (!$serverProcesses) {
+			Write-Host "No running process found: $processName";
+			Write-Host "FBUT_NO_PROCESS $onNoProcess $processName";
+			if ($onNoProcess -eq "fail") {
+				throw "No running server process found: $processName";
+			}
+			continue;
+		}
 
-	$serverProcesses = Get-Process -Name $ProcessToKill -ErrorAction SilentlyContinue;
-	if ($serverProcesses) {
-		Write-Host "Stopping the old server processes";
 		foreach ($process in $serverProcesses) {
-			Write-Host "Stopping the process with id: " $process.Id;
+			$stopping += @{ Process = $process; Id = $process.Id; Name = $processName };
+		}
+	}
+
+	if ($stopGracePeriod -gt 0 -and $stopping.Count -gt 0) {
+		Send-SoftStop ($stopping | ForEach-Object { $_.Id });
+		Write-Host "Waiting up to $stopGracePeriod seconds for $($stopping.Count) server processes to exit";
+	}
 
-			# Stop the process
-			Stop-Process -Id $process.Id -Force -ErrorAction SilentlyContinue;
+	$timer = [System.Diagnostics.Stopwatch]::StartNew();
+	foreach ($stop in $stopping) {
+		$remaining = $stopGracePeriod - [int][Math]::Floor($timer.Elapsed.TotalSeconds);
+		if ($remaining -gt 0) {
+			Wait-Process -Id $stop.Id -Timeout $remaining -ErrorAction SilentlyContinue;
+		}
 
-			# Wait for the process to exit
-			Wait-Process -Id $process.Id -ErrorAction SilentlyContinue;
-			
-			Write-Host "Done stopping the process with id: " $process.Id;
+		if ($stop.Process.HasExited) {
+			$result = "exited";
+		} else {
+			Stop-Process -Id $stop.Id -Force -ErrorAction SilentlyContinue;
+			Wait-Process -Id $stop.Id -ErrorAction SilentlyContinue;
+			$result = "killed";
 		}
+
+		Write-Host "FBUT_STOP $($stop.Id) $result $([int][Math]::Floor($timer.Elapsed.TotalSeconds)) $($stop.Name)";
+	}
+}
+
+# Run a hook with the stage of the update as its first argument, the update stops if it fails
+function Invoke-Hook {
+	param (
+		[string]$HookPath,
+		[string]$Stage
+	)
+
+	if (!$HookPath) {
+		return;
+	}
+
+	Write-Host "Running $Stage hook: $HookPath";
+	if ($HookPath.EndsWith(".ps1")) {
+		& powershell.exe -NoProfile -ExecutionPolicy Bypass -File $HookPath $Stage | Out-Host;
 	} else {
-		Write-Host "No running process found: $ProcessToKill";
+		& $HookPath $Stage | Out-Host;
+	}
+	if ($LASTEXITCODE -ne 0) {
+		throw "$Stage hook failed with exit code $($LASTEXITCODE): $HookPath";
 	}
+	Write-Host "Finished $Stage hook";
 }
 
+Invoke-Hook $preHookPath "pre-kill";
+
 Write-Host "===========================================================";
 Write-Host "Ending running server processes";
 Write-Host "===========================================================";
@@ -95,6 +201,7 @@ foreach ($executablePath in $executablePaths) {
 	if (Test-Path $executablePath) {
 		Write-Host "Moving old executable to $executablePath-old";
 		Move-Item -Force -Path $executablePath -Destination $executablePath-old;
+		$movedExecutables += $executablePath;
 	} else {
 		Write-Host "Executable $executablePath not found";
 	}
@@ -102,48 +209,54 @@ foreach ($executablePath in $executablePaths) {
 
 {{end}}
 
-foreach ($processName in $processNames) {
-	KillAll-ServerProcess $processName;
-}
+Stop-ServerProcesses $processNames;
 
 {{if .IsReplaceBuild}}
 
 Start-Sleep -Seconds 5;
 
 Write-Host "===========================================================";
-Write-Host "Removing files found in the build zip from the server";
+Write-Host "Removing files found in the build archive from the server";
 Write-Host "===========================================================";
 
-$zip=[System.IO.Compression.ZipFile]::OpenRead($archivePath);
-try {
-	$zip.Entries | ForEach-Object {
-		$isDirectory= $_.FullName[-1] -eq '/' -or $_.FullName[-1] -eq '\';
-		if (!$isDirectory) {
-			$fileName= $_.FullName -replace '/', '\';
-			$removePath=$baseDir + $fileName;
-
-			if (Test-Path $removePath)
-			{
-				Write-Host "Removing old build file: $removePath";
-				Remove-Item -Path $removePath -Force;
-			} else {
-				Write-Host "File from build zip file: $removePath, not seen on the server.";
-			}
+if ($archiveFormat -eq "zip") {
+	$zip=[System.IO.Compression.ZipFile]::OpenRead($archivePath);
+	try {
+		$archiveEntries=$zip.Entries | ForEach-Object { $_.FullName };
+	} finally {
+		$zip.Dispose();
+	}
+}
+
+$archiveEntries | ForEach-Object {
+	$isDirectory= $_[-1] -eq '/' -or $_[-1] -eq '\';
+	if (!$isDirectory) {
+		$fileName= $_ -replace '^\./', '' -replace '/', '\';
+		$removePath=$baseDir + $fileName;
+
+		if (Test-Path $removePath)
+		{
+			Write-Host "Removing old build file: $removePath";
+			Remove-Item -Path $removePath -Force;
+		} else {
+			Write-Host "File from build archive: $removePath, not seen on the server.";
 		}
 	}
-} catch {
-	Write-Host "An unexpected error occurred:"
-	Write-Host $_
-	throw $_
-} finally {
-	$zip.Dispose();
 }
 
 
 Write-Host "===========================================================";
 Write-Host "Expanding $archivePath to $unzipDir";
 Write-Host "===========================================================";
-Expand-Archive -Path $archivePath -DestinationPath $unzipDir -Force;
+if ($archiveFormat -eq "zip") {
+	Expand-Archive -Path $archivePath -DestinationPath $unzipDir -Force;
+} else {
+	New-Item -Path $unzipDir -ItemType Directory -Force | Out-Null;
+	& tar.exe -xf $archivePath -C $unzipDir;
+	if ($LASTEXITCODE -ne 0) {
+		throw "tar.exe could not extract $archivePath";
+	}
+}
 
 Write-Host "===========================================================";
 Write-Host "Moving files from $unzipDir to $baseDir";
@@ -171,6 +284,8 @@ Get-ChildItem -Path $unzipDir -Recurse | ForEach-Object {
 	}
 }
 
+Invoke-Hook $postHookPath "post-unzip";
+
 foreach ($executablePath in $executablePaths) {
 	$unzipPath = Join-Path -Path $unzipDir -ChildPath $executablePath.Substring($baseDir.Length);
 	Write-Host "Moving executable file $unzipPath to $executablePath";
@@ -184,9 +299,22 @@ foreach ($executablePath in $executablePaths) {
 
 {{end}}
 
+Invoke-Hook $postHookPath "post-restart";
+
 } catch {
 	Write-Host "An unexpected error occurred:"
 	Write-Host $_
+
+{{if .IsReplaceBuild}}
+	# Put back any old executable that was moved aside, so the server is not left without one when the update stops part way through
+	foreach ($executablePath in $movedExecutables) {
+		if ((Test-Path $executablePath-old) -and !(Test-Path $executablePath)) {
+			Write-Host "Restoring old executable $executablePath";
+			Move-Item -Force -Path $executablePath-old -Destination $executablePath;
+		}
+	}
+{{end}}
+
 	throw $_
 
 } finally {
@@ -204,6 +332,12 @@ foreach ($executablePath in $executablePaths) {
 	}
 {{end}}
 
+	foreach ($hookPath in @($preHookPath, $postHookPath)) {
+		if ($hookPath -and (Test-Path $hookPath)) {
+			Remove-Item -Path $hookPath -Force;
+		}
+	}
+
 	Write-Host "Cleaning up update script $PSCommandPath";
 	Remove-Item $PSCommandPath -Force;
 }
@@ -1,48 +1,38 @@
 package tools
 
 import (
-	"archive/zip"
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/aws/amazon-gamelift-toolkit/fast-build-update-tool/internal/gamelift"
 )
 
 type ZipValidator struct {
-	buildZipPath string
+	archive BuildArchive
 }
 
-func NewZipValidator(buildZipPath string) *ZipValidator {
-	return &ZipValidator{buildZipPath: buildZipPath}
+func NewZipValidator(archive BuildArchive) *ZipValidator {
+	return &ZipValidator{archive: archive}
 }
 
-// ValidateZip will validate that the zip file provided is valid for the given fleet
+// ValidateZip will validate that the build archive provided is valid for the given fleet
 func (z *ZipValidator) ValidateZip(ctx context.Context, fleet *gamelift.Fleet) error {
-	zipReader, zipErr := zip.OpenReader(z.buildZipPath)
+	entryNames, zipErr := z.archive.EntryNames()
 	if zipErr != nil {
-		return fmt.Errorf("error opening zip file %w", zipErr)
+		return fmt.Errorf("error opening build archive %w", zipErr)
 	}
-	defer zipReader.Close()
 
 	for _, executablePath := range fleet.ExecutablePaths {
 		normalizedFileToFind := strings.ReplaceAll(executablePath, "C:\\game\\", "")
 		normalizedFileToFind = strings.ReplaceAll(normalizedFileToFind, "/local/game/", "")
 		normalizedFileToFind = strings.ReplaceAll(normalizedFileToFind, "\\", "/")
 
-		if !isFileInZip(zipReader, normalizedFileToFind) {
-			return fmt.Errorf("zip file does not contain executable %s", normalizedFileToFind)
+		if !slices.Contains(entryNames, normalizedFileToFind) {
+			return fmt.Errorf("build archive does not contain executable %s", normalizedFileToFind)
 		}
 	}
 
 	return nil
 }
-
-func isFileInZip(zipReader *zip.ReadCloser, fileToFind string) bool {
-	for _, file := range zipReader.File {
-		if file.Name == fileToFind {
-			return true
-		}
-	}
-	return false
-}
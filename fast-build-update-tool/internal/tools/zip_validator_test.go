@@ -22,7 +22,7 @@ func init() {
 }
 
 func TestValidateZipWindowsValidZip(t *testing.T) {
-	z := NewZipValidator(buildZipPath)
+	z := NewZipValidator(ArchiveFile(buildZipPath))
 	fleet := &gamelift.Fleet{OperatingSystem: config.OperatingSystemWindows, ExecutablePaths: []string{"C:\\game\\bin\\server.exe"}}
 
 	err := z.ValidateZip(context.Background(), fleet)
@@ -31,7 +31,7 @@ func TestValidateZipWindowsValidZip(t *testing.T) {
 }
 
 func TestValidateZipLinuxValidZip(t *testing.T) {
-	z := NewZipValidator(buildZipPath)
+	z := NewZipValidator(ArchiveFile(buildZipPath))
 	fleet := &gamelift.Fleet{OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"/local/game/bin/server.exe"}}
 
 	err := z.ValidateZip(context.Background(), fleet)
@@ -40,19 +40,29 @@ func TestValidateZipLinuxValidZip(t *testing.T) {
 }
 
 func TestValidateZipInvalidZipNoFile(t *testing.T) {
-	z := NewZipValidator("file does not exist")
+	z := NewZipValidator(ArchiveFile("file does not exist"))
 	fleet := &gamelift.Fleet{OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"/local/game/bin/server.exe"}}
 
 	err := z.ValidateZip(context.Background(), fleet)
 
-	assert.ErrorContains(t, err, "error opening zip file")
+	assert.ErrorContains(t, err, "error opening build archive")
 }
 
 func TestValidateZipInvalidZipNoExecutable(t *testing.T) {
-	z := NewZipValidator(buildZipPath)
+	z := NewZipValidator(ArchiveFile(buildZipPath))
 	fleet := &gamelift.Fleet{OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"/local/game/different-server.exe"}}
 
 	err := z.ValidateZip(context.Background(), fleet)
 
-	assert.ErrorContains(t, err, "zip file does not contain executable")
+	assert.ErrorContains(t, err, "build archive does not contain executable")
+}
+
+func TestValidateZipTarArchive(t *testing.T) {
+	z := NewZipValidator(ArchiveFile(writeTarArchive(t, ArchiveFormatTarZstd, "mybuild.tar.zst", map[string]string{"bin/server.exe": "server"})))
+	fleet := &gamelift.Fleet{OperatingSystem: config.OperatingSystemLinux, ExecutablePaths: []string{"/local/game/bin/server.exe"}}
+
+	assert.Nil(t, z.ValidateZip(context.Background(), fleet))
+
+	fleet.ExecutablePaths = []string{"/local/game/different-server.exe"}
+	assert.ErrorContains(t, z.ValidateZip(context.Background(), fleet), "build archive does not contain executable")
 }